@@ -2,24 +2,49 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
 
 	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/slok/reload"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/hiphops-io/hops/config"
+	"github.com/hiphops-io/hops/expression/funcs"
+	"github.com/hiphops-io/hops/internal/audit"
+	"github.com/hiphops-io/hops/internal/auth"
+	"github.com/hiphops-io/hops/internal/dirnotify"
+	"github.com/hiphops-io/hops/internal/health"
 	"github.com/hiphops-io/hops/internal/httpserver"
 	"github.com/hiphops-io/hops/internal/runner"
+	"github.com/hiphops-io/hops/internal/tracing"
 	"github.com/hiphops-io/hops/logs"
 	"github.com/hiphops-io/hops/markdown"
 	"github.com/hiphops-io/hops/nats"
 )
 
+// tracerShutdownTimeout is how long spans left at shutdown have to be exported
+const tracerShutdownTimeout = 5 * time.Second
+
 type (
 	HopsServer struct {
+		audit      *audit.Log
+		authn      auth.Authenticator
 		logger     zerolog.Logger
+		policy     *auth.Policy
 		natsClient *nats.Client
+		natsServer *nats.NatsServer
 		runGroup   run.Group
+		runner     *runner.Runner
+		// history and web provide the API the site is hydrated from
+		history *runner.RunHistory
+		web     *runner.WebFrontend
 	}
 
 	Reloader func(ctx context.Context) error
@@ -34,6 +59,15 @@ func Start(cfg *config.Config) error {
 		logger: logs.InitLogger(cfg.Dev),
 	}
 
+	tracerProvider, err := h.initTracing(cfg)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to init tracing")
+		return err
+	}
+	if tracerProvider != nil {
+		tracing.SetDefault(tracerProvider)
+	}
+
 	close, err := h.startNATS(cfg)
 	if err != nil {
 		h.logger.Error().Err(err).Msg("Failed to start NATS client")
@@ -41,12 +75,20 @@ func Start(cfg *config.Config) error {
 	}
 	defer close()
 
+	if err := h.initAuth(cfg); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to init auth")
+		return err
+	}
+
 	runnerReload, err := h.initRunner(ctx, cfg)
 	if err != nil {
 		return err
 	}
 
-	h.startHTTPServer(ctx)
+	if err := h.startHTTPServer(ctx, cfg); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to start HTTP server")
+		return err
+	}
 
 	if cfg.Dev {
 		if err := h.startReloader(ctx, cfg, runnerReload); err != nil {
@@ -55,7 +97,34 @@ func Start(cfg *config.Config) error {
 		}
 	}
 
-	return h.runGroup.Run()
+	// Added last so spans ended while the HTTP server drains are still exported
+	if tracerProvider != nil {
+		tracerCtx, cancel := context.WithCancel(ctx)
+		h.runGroup.Add(
+			func() error {
+				<-tracerCtx.Done()
+
+				// Export any spans left before exiting
+				shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(tracerCtx), tracerShutdownTimeout)
+				defer cancel()
+
+				return tracerProvider.Shutdown(shutdownCtx)
+			},
+			func(_ error) {
+				cancel()
+			},
+		)
+	}
+
+	h.runGroup.Add(run.SignalHandler(ctx, os.Interrupt, syscall.SIGTERM))
+
+	err = h.runGroup.Run()
+	if errors.As(err, &run.SignalError{}) {
+		h.logger.Info().Msgf("Shutting down on %s", err.Error())
+		return nil
+	}
+
+	return err
 }
 
 func (h *HopsServer) startReloader(ctx context.Context, cfg *config.Config, reloaders ...Reloader) error {
@@ -74,7 +143,7 @@ func (h *HopsServer) startReloader(ctx context.Context, cfg *config.Config, relo
 		}))
 	}
 
-	notifer, err := NewDirNotifier(cfg.FlowsPath(), h.logger)
+	notifer, err := dirnotify.NewDirNotifier(cfg.FlowsPath(), h.logger)
 	if err != nil {
 		return err
 	}
@@ -99,17 +168,189 @@ func (h *HopsServer) startReloader(ctx context.Context, cfg *config.Config, relo
 	return nil
 }
 
-func (h *HopsServer) startHTTPServer(ctx context.Context) {
-	server := httpserver.NewHTTPServer(":8080", h.natsClient)
+func (h *HopsServer) startHTTPServer(ctx context.Context, cfg *config.Config) error {
+	serverOpts := []httpserver.HTTPServerOpt{
+		httpserver.WithHealthOpt(h.healthChecker(cfg)),
+		httpserver.WithMetricsOpt(prometheus.DefaultGatherer),
+		httpserver.WithRunHistoryOpt(h.history),
+		httpserver.WithSiteDirOpt(markdown.CurrentBuild(cfg.SitePath())),
+	}
+
+	// Running commands and reading the audit trail are only open to anyone
+	// if that's explicitly allowed
+	switch {
+	case h.authn != nil:
+		serverOpts = append(
+			serverOpts,
+			httpserver.WithAuthOpt(h.authn, h.policy),
+			httpserver.WithAuditOpt(h.audit),
+			httpserver.WithCommandsOpt(h.web),
+		)
+	case cfg.Auth.AllowUnauthenticated:
+		h.logger.Warn().Msg("The hops API is open to anyone who can reach it, configure auth to restrict it")
+		serverOpts = append(serverOpts, httpserver.WithAuditOpt(h.audit), httpserver.WithCommandsOpt(h.web))
+	default:
+		h.logger.Warn().Msg("The command and audit APIs are off, configure auth or allow unauthenticated requests to serve them")
+	}
+
+	trustedProxies, err := cfg.HTTP.TrustedProxyRanges()
+	if err != nil {
+		return err
+	}
+	serverOpts = append(
+		serverOpts,
+		httpserver.WithAllowedOriginsOpt(cfg.HTTP.AllowedOrigins),
+		httpserver.WithTimeoutsOpt(cfg.HTTP.ReadTimeout, cfg.HTTP.WriteTimeout),
+		httpserver.WithTrustedProxiesOpt(trustedProxies),
+	)
+	if cfg.HTTP.TLSCert != "" || cfg.HTTP.TLSKey != "" {
+		if cfg.HTTP.TLSCert == "" || cfg.HTTP.TLSKey == "" {
+			return errors.New("HTTP TLS requires both a cert and key")
+		}
+		serverOpts = append(serverOpts, httpserver.WithTLSOpt(cfg.HTTP.TLSCert, cfg.HTTP.TLSKey))
+	}
+
+	server := httpserver.NewHTTPServer(cfg.HTTP.Address, h.natsClient, serverOpts...)
 
 	h.runGroup.Add(
 		func() error {
+			h.logger.Info().Msgf("Serving HTTP on %s", cfg.HTTP.Address)
 			return server.Serve()
 		},
 		func(_ error) {
-			server.Shutdown(ctx)
+			// Requests in flight are given time to finish, even though the
+			// parent context is already done
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.HTTP.ShutdownTimeout)
+			defer cancel()
+
+			if err := server.Shutdown(ctx); err != nil {
+				h.logger.Warn().Err(err).Msg("HTTP requests were cut off by shutdown")
+			}
 		},
 	)
+
+	return nil
+}
+
+// healthChecker checks hops is connected to NATS for liveness, and that it
+// can keep up with events for readiness
+func (h *HopsServer) healthChecker(cfg *config.Config) *health.Checker {
+	checker := health.NewChecker()
+
+	checker.AddLive("nats", h.natsClient.ConnectionHealth)
+	checker.AddReady("streams", h.natsClient.StreamsHealth)
+	checker.AddReady("runner_consumer", func(ctx context.Context) error {
+		return h.natsClient.ConsumerLagHealth(ctx, nats.ChannelNotify, nats.ChannelNotify, 0)
+	})
+	checker.AddReady("consumer_lag", func(ctx context.Context) error {
+		return h.natsClient.ConsumerLagHealth(ctx, nats.ChannelNotify, nats.ChannelNotify, cfg.Health.MaxConsumerPending)
+	})
+	checker.AddReady("flows", h.runner.FlowsHealth)
+	checker.AddReady("scheduler", h.runner.SchedulerHealth)
+
+	if h.natsServer.HasLeafnodeRemotes() {
+		checker.AddReady("leafnode", h.natsServer.LeafnodeHealth)
+	}
+
+	return checker
+}
+
+// initAuth creates the authenticators and policy for the API, which the
+// policy also applies to commands from chat. Both are nil if auth is off
+func (h *HopsServer) initAuth(cfg *config.Config) error {
+	if !cfg.Auth.Enabled() {
+		if len(cfg.Auth.Roles) > 0 {
+			return errors.New("auth roles require API tokens or OIDC to be configured")
+		}
+		return nil
+	}
+
+	authn, policy, err := newAuth(cfg.Auth, h.logger)
+	if err != nil {
+		return err
+	}
+
+	h.authn = authn
+	h.policy = policy
+
+	return nil
+}
+
+// newAuth creates the authenticators and policy for the API from config,
+// trying static tokens before OIDC
+func newAuth(conf config.AuthConf, logger zerolog.Logger) (auth.Chain, *auth.Policy, error) {
+	chain := auth.Chain{}
+
+	if len(conf.Tokens) > 0 {
+		tokens := make([]auth.StaticToken, len(conf.Tokens))
+		for i, t := range conf.Tokens {
+			tokens[i] = auth.StaticToken{Name: t.Name, Token: t.Token, Groups: t.Groups}
+			if t.TokenEnv != "" {
+				tokens[i].Token = os.Getenv(t.TokenEnv)
+			}
+		}
+
+		staticTokens, err := auth.NewStaticTokens(tokens)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, staticTokens)
+	}
+
+	if oidcConf := conf.OIDC; oidcConf.Enabled() {
+		oidc, err := auth.NewOIDC(auth.OIDCConfig{
+			Issuer:       oidcConf.Issuer,
+			Audience:     oidcConf.Audience,
+			JWKSURL:      oidcConf.JWKSURL,
+			JWKSFile:     oidcConf.JWKSFile,
+			SubjectClaim: oidcConf.SubjectClaim,
+			GroupsClaim:  oidcConf.GroupsClaim,
+		}, nil, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, oidc)
+	}
+
+	roles := make([]auth.Role, len(conf.Roles))
+	for i, r := range conf.Roles {
+		roles[i] = auth.Role{Name: r.Name, Users: r.Users, Groups: r.Groups, Run: r.Run, View: r.View, Audit: r.Audit}
+	}
+
+	policy, err := auth.NewPolicy(roles)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return chain, policy, nil
+}
+
+// initTracing creates the tracer provider for the configured exporter, or nil
+// if tracing is disabled
+func (h *HopsServer) initTracing(cfg *config.Config) (*sdktrace.TracerProvider, error) {
+	conf := cfg.Tracing
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch conf.Exporter {
+	case "":
+		return nil, nil
+	case "stdout":
+		exporter, err = tracing.NewStdoutExporter(os.Stdout)
+	case "otlp":
+		exporter, err = tracing.NewOTLPExporter(conf.OTLPEndpoint, conf.OTLPHeaders)
+	default:
+		err = fmt.Errorf("unknown tracing exporter '%s', must be otlp or stdout", conf.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		h.logger.Warn().Err(err).Msg("Unable to export traces")
+	}))
+
+	return tracing.NewTracerProvider(exporter, conf.ServiceName, conf.SampleRatio), nil
 }
 
 func (h *HopsServer) startNATS(cfg *config.Config) (func(), error) {
@@ -139,22 +380,61 @@ func (h *HopsServer) startNATS(cfg *config.Config) (func(), error) {
 	}
 
 	h.natsClient = natsClient
+	h.natsServer = server
+	prometheus.MustRegister(natsClient.StreamCollector())
 
 	return close, nil
 }
 
 func (h *HopsServer) initRunner(ctx context.Context, cfg *config.Config) (Reloader, error) {
-	flowReader := markdown.NewFlowReader(cfg.FlowsPath())
+	flowReaderOpts := []markdown.FlowReaderOpt{
+		markdown.WithEnvAllowListOpt(cfg.Runner.Expressions.EnvAllow),
+	}
+	if expr := cfg.Runner.Expressions; expr.SecretsDir != "" {
+		flowReaderOpts = append(flowReaderOpts, markdown.WithSecretProviderOpt(funcs.DirSecretProvider{Dir: expr.SecretsDir}))
+	} else if expr.SecretsEnvPrefix != "" {
+		flowReaderOpts = append(flowReaderOpts, markdown.WithSecretProviderOpt(funcs.EnvSecretProvider{Prefix: expr.SecretsEnvPrefix}))
+	}
+
+	flowReader := markdown.NewFlowReader(cfg.FlowsPath(), flowReaderOpts...)
 
 	consumer, err := h.natsClient.RunnerConsumer(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	runner, err := runner.NewRunner(h.natsClient, flowReader, consumer, h.logger)
+	h.audit = audit.NewLog(h.natsClient.JetStream, audit.WithErrorHandlerOpt(func(err error) {
+		h.logger.Warn().Err(err).Msg("Unable to publish audit record")
+	}))
+	h.history = runner.NewRunHistory(flowReader)
+	h.web = runner.NewWebFrontend(flowReader, h.natsClient)
+
+	runnerOpts := []runner.RunnerOpt{
+		runner.WithAuditLogOpt(h.audit),
+		runner.WithCommandFrontendOpt(runner.WebSource, h.web),
+		runner.WithPolicyOpt(h.policy),
+		runner.WithRunHistoryOpt(h.history),
+	}
+	if mm := cfg.Runner.Mattermost; mm.URL != "" {
+		frontend := runner.NewMattermostFrontend(
+			mm.URL,
+			mm.DialogURL,
+			runner.NewAPIClient(nil, runner.StaticToken(mm.Token), h.logger),
+		)
+		runnerOpts = append(runnerOpts, runner.WithCommandFrontendOpt("mattermost", frontend))
+	}
+	if teams := cfg.Runner.Teams; teams.AppID != "" {
+		frontend := runner.NewAdaptiveCardFrontend(
+			runner.NewAPIClient(nil, runner.NewBotFrameworkTokens(teams.AppID, teams.AppPassword, teams.TenantID), h.logger),
+		)
+		runnerOpts = append(runnerOpts, runner.WithCommandFrontendOpt("teams", frontend))
+	}
+
+	runner, err := runner.NewRunner(h.natsClient, flowReader, consumer, h.logger, runnerOpts...)
 	if err != nil {
 		return nil, err
 	}
+	h.runner = runner
 
 	// if cfg.Dev {
 	// 	h.reloadManager.Add(10, reload.ReloaderFunc(func(ctx context.Context, id string) error {
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/alexflint/go-arg"
 	"github.com/hiphops-io/hops/config"
@@ -26,10 +28,6 @@ func Run() error {
 	cmd := Cmd{}
 	arg.MustParse(&cmd)
 
-	if cmd.Healthcheck != nil {
-		return healthCheck()
-	}
-
 	if expanded, err := homedir.Expand(cmd.Directory); err != nil {
 		return err
 	} else {
@@ -41,16 +39,34 @@ func Run() error {
 		return err
 	}
 
+	if cmd.Healthcheck != nil {
+		return healthCheck(config.HTTP)
+	}
+
 	return Start(config)
 }
 
-func healthCheck() error {
+func healthCheck(conf config.HTTPConf) error {
 	fmt.Println("Running CLI healthcheck")
-	// TODO: If the httpserver address becomes configurable, then this must match it
-	resp, err := http.Get("http://127.0.0.1:8080/health")
+	url, err := conf.LocalURL("/health")
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			// The cert is for the server's public name, not the local address
+			// it's checked on, and identity doesn't matter to a healthcheck
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	resp, err := client.Get(url)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode > 299 {
 		return fmt.Errorf("healthcheck failed with status code: %d", resp.StatusCode)
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"github.com/hiphops-io/hops/internal/audit"
+)
+
+type AuditCmd struct {
+	URL        string `arg:"-u,--url" default:"http://localhost:8080" help:"URL of the hops server"`
+	Token      string `arg:"--token,env:HOPS_API_TOKEN" help:"API token, if the server requires auth"`
+	SequenceID string `arg:"-s,--sequence" help:"only records about the event with this sequence ID"`
+	Type       string `arg:"-t,--type" help:"only records of this type, such as flow_evaluated"`
+	Source     string `arg:"--source" help:"only records about events from this source"`
+	Event      string `arg:"--event" help:"only records about events of this type"`
+	Action     string `arg:"--action" help:"only records about events with this action"`
+	Flow       string `arg:"-f,--flow" help:"only records about this flow"`
+	Outcome    string `arg:"-o,--outcome" help:"only records with this outcome, such as if_error"`
+	User       string `arg:"--user" help:"only records of commands by this user"`
+	Since      string `arg:"--since" help:"only records since this time, as RFC 3339 or a duration ago such as 1h [default: 24h before until]"`
+	Until      string `arg:"--until" help:"only records until this time, as RFC 3339 or a duration ago such as 1h"`
+	Limit      int    `arg:"-n,--limit" help:"how many of the most recent records to show [default: 100]"`
+	JSON       bool   `arg:"--json" help:"print records as JSON, one per line"`
+}
+
+// Run prints the most recent audit records matching the filters, newest first
+func (a *AuditCmd) Run() error {
+	query, err := a.query(time.Now())
+	if err != nil {
+		return err
+	}
+
+	records, err := a.fetch(query)
+	if err != nil {
+		return err
+	}
+
+	if a.JSON {
+		return printAuditJSON(os.Stdout, records)
+	}
+
+	return printAuditTable(os.Stdout, records)
+}
+
+// query is the API query for the command's filters
+func (a *AuditCmd) query(now time.Time) (url.Values, error) {
+	query := url.Values{}
+	params := map[string]string{
+		"sequence_id": a.SequenceID,
+		"type":        a.Type,
+		"source":      a.Source,
+		"event":       a.Event,
+		"action":      a.Action,
+		"flow":        a.Flow,
+		"outcome":     a.Outcome,
+		"user":        a.User,
+	}
+	for param, value := range params {
+		if value != "" {
+			query.Set(param, value)
+		}
+	}
+
+	for param, value := range map[string]string{"since": a.Since, "until": a.Until} {
+		if value == "" {
+			continue
+		}
+
+		t, err := parseAuditTime(value, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", param, err)
+		}
+		query.Set(param, t.Format(time.RFC3339))
+	}
+
+	if a.Limit != 0 {
+		query.Set("limit", strconv.Itoa(a.Limit))
+	}
+
+	return query, nil
+}
+
+func (a *AuditCmd) fetch(query url.Values) ([]audit.Record, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(a.URL, "/")+"/api/audit?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query audit trail: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read audit trail: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := struct {
+			Error string `json:"error"`
+		}{}
+		if json.Unmarshal(body, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = resp.Status
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			apiErr.Error = "the server doesn't serve the audit trail"
+		}
+
+		return nil, errors.New(apiErr.Error)
+	}
+
+	result := struct {
+		Records []audit.Record `json:"records"`
+	}{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("unable to parse audit trail: %w", err)
+	}
+
+	return result.Records, nil
+}
+
+// parseAuditTime parses an RFC 3339 time, or a duration before now
+func parseAuditTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("'%s' is neither an RFC 3339 time nor a duration", value)
+	}
+
+	return t, nil
+}
+
+func printAuditJSON(out io.Writer, records []audit.Record) error {
+	enc := json.NewEncoder(out)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func printAuditTable(out io.Writer, records []audit.Record) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tTYPE\tSEQUENCE\tEVENT\tFLOW\tOUTCOME\tUSER\tERROR")
+
+	for _, rec := range records {
+		event := strings.Join(nonEmpty(rec.Source, rec.Event, rec.Action), ".")
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			rec.Time.Local().Format(time.DateTime),
+			rec.Type,
+			rec.SequenceID,
+			event,
+			orDash(rec.Flow),
+			orDash(rec.Outcome),
+			orDash(rec.User),
+			rec.Error,
+		)
+	}
+
+	return w.Flush()
+}
+
+func nonEmpty(values ...string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
-	"path/filepath"
+	"errors"
+	"io/fs"
+	"os"
 
+	"github.com/hiphops-io/hops/config"
+	"github.com/hiphops-io/hops/expression/funcs"
 	"github.com/hiphops-io/hops/markdown"
 )
 
@@ -20,13 +24,53 @@ func (b *BuildCmd) Run() error {
 }
 
 func buildSite(rootDir string) error {
-	sourceDir := filepath.Join(rootDir, "pages")
-	buildDir := filepath.Join(rootDir, ".hiphops", "site")
+	cfg, err := config.LoadConfig(rootDir, "")
+	if err != nil {
+		return err
+	}
+
+	flows, err := readFlows(cfg)
+	if err != nil {
+		return err
+	}
+
+	return buildSiteWithFlows(cfg, flows)
+}
 
-	builder, err := markdown.NewStaticBuilder()
+// buildSiteWithFlows builds the site with a catalogue of flows that have
+// already been read
+func buildSiteWithFlows(cfg *config.Config, flows map[string]*markdown.Flow) error {
+	builder, err := markdown.NewStaticBuilder(
+		markdown.WithFlowsOpt(flows),
+		markdown.WithTemplatesDirOpt(cfg.TemplatesPath()),
+	)
 	if err != nil {
 		return err
 	}
 
-	return builder.Build(sourceDir, buildDir)
+	return builder.Build(cfg.PagesPath(), cfg.SitePath())
+}
+
+// readFlows reads the flows for the site's catalogue, with access to env vars
+// and secrets checked as the runner would
+func readFlows(cfg *config.Config) (map[string]*markdown.Flow, error) {
+	if _, err := os.Stat(cfg.FlowsPath()); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	flowReaderOpts := []markdown.FlowReaderOpt{
+		markdown.WithEnvAllowListOpt(cfg.Runner.Expressions.EnvAllow),
+	}
+	if expr := cfg.Runner.Expressions; expr.SecretsDir != "" {
+		flowReaderOpts = append(flowReaderOpts, markdown.WithSecretProviderOpt(funcs.DirSecretProvider{Dir: expr.SecretsDir}))
+	} else if expr.SecretsEnvPrefix != "" {
+		flowReaderOpts = append(flowReaderOpts, markdown.WithSecretProviderOpt(funcs.EnvSecretProvider{Prefix: expr.SecretsEnvPrefix}))
+	}
+
+	flowReader := markdown.NewFlowReader(cfg.FlowsPath(), flowReaderOpts...)
+	if err := flowReader.ReadAll(); err != nil {
+		return nil, err
+	}
+
+	return flowReader.IndexedFlows(), nil
 }
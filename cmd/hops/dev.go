@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/oklog/run"
+	"github.com/rs/zerolog"
+	"github.com/slok/reload"
+
+	"github.com/hiphops-io/hops/config"
+	"github.com/hiphops-io/hops/internal/dirnotify"
+	"github.com/hiphops-io/hops/internal/httpserver"
+	"github.com/hiphops-io/hops/logs"
+	"github.com/hiphops-io/hops/markdown"
+)
+
+// devShutdownTimeout is how long open requests have to finish on exit
+const devShutdownTimeout = 5 * time.Second
+
+type DevCmd struct {
+	Dir     string `arg:"positional" default:"." help:"path to Hiphops dir [default: .]"`
+	Address string `arg:"-a,--address" default:"localhost:8081" help:"address to serve the site on"`
+}
+
+// devSite rebuilds the site as its sources change, only re-reading flows
+// when they have changed
+type devSite struct {
+	cfg    *config.Config
+	flows  map[string]*markdown.Flow
+	logger zerolog.Logger
+}
+
+// Run builds and serves the site, rebuilding it and reloading open pages
+// whenever pages, flows or templates change
+func (d *DevCmd) Run() error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	logger := logs.InitLogger(true)
+
+	cfg, err := config.LoadConfig(d.Dir, "")
+	if err != nil {
+		return err
+	}
+
+	site := &devSite{cfg: cfg, logger: logger}
+	// The site is served even if the first build fails, so errors can be fixed
+	// with the dev server running
+	if err := site.rebuild(cfg.FlowsPath()); err != nil {
+		logger.Warn().Msgf("Unable to build site: %s", err.Error())
+	}
+
+	liveReload := httpserver.NewLiveReload()
+
+	reloadManager := reload.NewManager()
+	reloadManager.Add(0, reload.ReloaderFunc(func(ctx context.Context, id string) error {
+		if err := site.rebuild(id); err != nil {
+			logger.Warn().Msgf("Unable to build site: %s", err.Error())
+			return nil
+		}
+
+		logger.Info().Msg("Site rebuilt")
+		liveReload.Reload()
+		return nil
+	}))
+
+	for _, dir := range []string{cfg.PagesPath(), cfg.FlowsPath(), cfg.TemplatesPath()} {
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		notifier, err := dirnotify.NewDirNotifier(dir, logger)
+		if err != nil {
+			return err
+		}
+		defer notifier.Close()
+
+		reloadManager.On(notifier.Notifier(ctx))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(httpserver.LiveReloadPath, liveReload)
+	mux.Handle(httpserver.HopsScriptPath, httpserver.HopsScriptHandler())
+	mux.Handle("/", httpserver.NewSiteHandler(
+		markdown.CurrentBuild(cfg.SitePath()),
+		httpserver.WithHTMLSnippetOpt(httpserver.LiveReloadSnippet),
+	))
+
+	server := &http.Server{
+		Addr:    d.Address,
+		Handler: mux,
+		// Live reload streams stay open until the server's context ends
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	var group run.Group
+	group.Add(
+		func() error {
+			return reloadManager.Run(ctx)
+		},
+		func(_ error) {
+			cancel()
+		},
+	)
+	group.Add(
+		func() error {
+			logger.Info().Msgf("Serving site on http://%s", d.Address)
+			err := server.ListenAndServe()
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		},
+		func(_ error) {
+			cancel()
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), devShutdownTimeout)
+			defer shutdownCancel()
+			server.Shutdown(shutdownCtx)
+		},
+	)
+
+	return group.Run()
+}
+
+// rebuild builds the site after a change to the watched dir changedPath
+func (s *devSite) rebuild(changedPath string) error {
+	if changedPath == s.cfg.FlowsPath() || s.flows == nil {
+		flows, err := readFlows(s.cfg)
+		if err != nil {
+			return err
+		}
+
+		s.flows = flows
+	}
+
+	return buildSiteWithFlows(s.cfg, s.flows)
+}
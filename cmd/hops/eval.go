@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+const evalFilename = "expression"
+
+const evalHelp = `Enter an expression to evaluate it against the event, or one of:
+  :event <path>  load the event from a JSON file
+  :help          show this help
+  :quit          exit`
+
+type EvalCmd struct {
+	Expression string `arg:"positional" help:"expression to evaluate - starts an interactive session if omitted"`
+	Event      string `arg:"-e,--event" help:"path to a JSON event to evaluate against, or - to read from stdin"`
+}
+
+// Run evaluates an expression against an event with the same context as
+// flows use when matching events, excluding functions that are added per
+// flow such as file() and env()
+func (e *EvalCmd) Run() error {
+	if e.Expression == "" && e.Event == "-" {
+		return errors.New("the event can't be read from stdin in an interactive session")
+	}
+
+	evalCtx, err := readEvalContext(e.Event)
+	if err != nil {
+		return err
+	}
+
+	if e.Expression != "" {
+		return evalExpression(os.Stdout, e.Expression, evalCtx)
+	}
+
+	return evalREPL(os.Stdin, os.Stdout, evalCtx)
+}
+
+func evalREPL(in io.Reader, out io.Writer, evalCtx *hcl.EvalContext) error {
+	fmt.Fprintln(out, evalHelp)
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			continue
+		case line == ":quit" || line == ":q" || line == "exit":
+			return nil
+		case line == ":help":
+			fmt.Fprintln(out, evalHelp)
+		case strings.HasPrefix(line, ":event"):
+			path := strings.TrimSpace(strings.TrimPrefix(line, ":event"))
+			if path == "" || path == "-" {
+				fmt.Fprintln(out, "ERROR a path to the event file is required")
+				continue
+			}
+
+			eventCtx, err := readEvalContext(path)
+			if err != nil {
+				fmt.Fprintln(out, "ERROR", err.Error())
+				continue
+			}
+
+			evalCtx = eventCtx
+			fmt.Fprintf(out, "Loaded event from %s\n", path)
+		case strings.HasPrefix(line, ":"):
+			fmt.Fprintf(out, "ERROR unknown command '%s'\n", line)
+		default:
+			// Errors are printed by evalExpression, so the session can continue
+			_ = evalExpression(out, line, evalCtx)
+		}
+	}
+}
+
+// evalExpression prints the value and type of an expression, or the
+// diagnostics if it's invalid or fails to evaluate
+func evalExpression(out io.Writer, src string, evalCtx *hcl.EvalContext) error {
+	expr, diags := hclsyntax.ParseExpression([]byte(src), evalFilename, hcl.InitialPos)
+	if !diags.HasErrors() {
+		val, valDiags := expr.Value(evalCtx)
+		diags = append(diags, valDiags...)
+
+		if !diags.HasErrors() {
+			formatted, err := formatEvalValue(val)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(out, "%s\n(%s)\n", formatted, val.Type().FriendlyName())
+			return nil
+		}
+	}
+
+	files := map[string]*hcl.File{evalFilename: {Bytes: []byte(src)}}
+	diagWriter := hcl.NewDiagnosticTextWriter(out, files, 80, false)
+	if err := diagWriter.WriteDiagnostics(diags); err != nil {
+		return err
+	}
+
+	return errors.New("unable to evaluate expression")
+}
+
+func formatEvalValue(val cty.Value) (string, error) {
+	if !val.IsWhollyKnown() {
+		return "(known after evaluation)", nil
+	}
+
+	b, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return "", fmt.Errorf("unable to format value: %w", err)
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, b, "", "  "); err != nil {
+		return "", fmt.Errorf("unable to format value: %w", err)
+	}
+
+	return indented.String(), nil
+}
+
+// readEvalContext creates the evaluation context for the event at path, or an
+// empty event if path is empty
+func readEvalContext(path string) (*hcl.EvalContext, error) {
+	data := map[string]any{}
+
+	if path != "" {
+		var (
+			content []byte
+			err     error
+		)
+
+		if path == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read event: %w", err)
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		if err := decoder.Decode(&data); err != nil {
+			return nil, fmt.Errorf("event must be a JSON object: %w", err)
+		}
+	}
+
+	return markdown.EventEvalContext(&nats.HopsMsg{Data: data})
+}
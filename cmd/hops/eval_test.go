@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeEvalEvent(t *testing.T, event string) string {
+	path := filepath.Join(t.TempDir(), "event.json")
+	require.NoError(t, os.WriteFile(path, []byte(event), 0o644), "Test setup: Event should be written")
+
+	return path
+}
+
+func TestEvalExpression(t *testing.T) {
+	eventPath := writeEvalEvent(t, `{"ref": "refs/heads/main", "pr": {"labels": ["bug", "urgent"], "number": 42}}`)
+
+	type testCase struct {
+		name           string
+		expression     string
+		expectedOutput string
+		expectError    bool
+	}
+
+	tests := []testCase{
+		{
+			name:           "String",
+			expression:     `trimprefix(event.ref, "refs/heads/")`,
+			expectedOutput: "\"main\"\n(string)\n",
+		},
+		{
+			name:           "Number",
+			expression:     `event.pr.number + 1`,
+			expectedOutput: "43\n(number)\n",
+		},
+		{
+			name:           "Bool",
+			expression:     `glob(event.ref, "refs/heads/*")`,
+			expectedOutput: "true\n(bool)\n",
+		},
+		{
+			name:           "Collection",
+			expression:     `event.pr.labels`,
+			expectedOutput: "[\n  \"bug\",\n  \"urgent\"\n]\n(tuple)\n",
+		},
+		{
+			name:           "Invalid syntax",
+			expression:     `event.ref ==`,
+			expectedOutput: "Error: Missing expression",
+			expectError:    true,
+		},
+		{
+			name:           "Unknown attribute",
+			expression:     `event.nope`,
+			expectedOutput: "Error: Unsupported attribute",
+			expectError:    true,
+		},
+		{
+			name:           "Unknown function",
+			expression:     `nope(event.ref)`,
+			expectedOutput: "Error: Call to unknown function",
+			expectError:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			evalCtx, err := readEvalContext(eventPath)
+			require.NoError(t, err)
+
+			out := &strings.Builder{}
+			err = evalExpression(out, tc.expression, evalCtx)
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, out.String(), tc.expectedOutput)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedOutput, out.String())
+		})
+	}
+}
+
+// secret() reads from a flow's secrets provider, so can't be evaluated
+// outside of a flow and must never reveal a secret from the environment
+func TestEvalExpressionSecret(t *testing.T) {
+	t.Setenv("TOKEN", "s3cr3t")
+
+	evalCtx, err := readEvalContext("")
+	require.NoError(t, err)
+
+	out := &strings.Builder{}
+	err = evalExpression(out, `secret("TOKEN")`, evalCtx)
+	assert.Error(t, err)
+	assert.Contains(t, out.String(), "Call to unknown function")
+	assert.NotContains(t, out.String(), "s3cr3t")
+}
+
+func TestEvalREPL(t *testing.T) {
+	eventPath := writeEvalEvent(t, `{"ref": "refs/heads/main"}`)
+
+	type testCase struct {
+		name             string
+		input            []string
+		expectedOutput   []string
+		unexpectedOutput []string
+	}
+
+	tests := []testCase{
+		{
+			name:           "Expressions",
+			input:          []string{`"hello"`, "", `1 + 1`},
+			expectedOutput: []string{"\"hello\"\n(string)", "2\n(number)"},
+		},
+		{
+			name:           "Errors don't end the session",
+			input:          []string{`event.ref ==`, `upper("still here")`},
+			expectedOutput: []string{"Error: Missing expression", "\"STILL HERE\"\n(string)"},
+		},
+		{
+			name:           "Load event",
+			input:          []string{`event.ref`, ":event " + eventPath, `event.ref`},
+			expectedOutput: []string{"Error: Unsupported attribute", "Loaded event from " + eventPath, "\"refs/heads/main\"\n(string)"},
+		},
+		{
+			name:           "Load event errors",
+			input:          []string{":event", ":event ./nope.json", ":event -"},
+			expectedOutput: []string{"ERROR a path to the event file is required", "ERROR unable to read event"},
+		},
+		{
+			name:           "Commands",
+			input:          []string{":help", ":nope"},
+			expectedOutput: []string{evalHelp + "\n> " + evalHelp, "ERROR unknown command ':nope'"},
+		},
+		{
+			name:             "Quit",
+			input:            []string{":quit", `"after quitting"`},
+			unexpectedOutput: []string{"after quitting"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			evalCtx, err := readEvalContext("")
+			require.NoError(t, err)
+
+			out := &strings.Builder{}
+			err = evalREPL(strings.NewReader(strings.Join(tc.input, "\n")+"\n"), out, evalCtx)
+			require.NoError(t, err, "Sessions should end without error")
+
+			for _, expected := range tc.expectedOutput {
+				assert.Contains(t, out.String(), expected)
+			}
+			for _, unexpected := range tc.unexpectedOutput {
+				assert.NotContains(t, out.String(), unexpected)
+			}
+		})
+	}
+}
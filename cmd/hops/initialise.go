@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/fs"
@@ -9,7 +10,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/hashicorp/go-getter"
+	"github.com/hashicorp/go-getter/v2"
 )
 
 type InitCmd struct {
@@ -23,7 +24,18 @@ func (i *InitCmd) Run() error {
 		os.RemoveAll(tmpDir)
 	}()
 
-	if err := getter.Get(tmpDir, i.Template, getWithPWD); err != nil {
+	pwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("unable to get current working directory: %w", err)
+	}
+
+	req := &getter.Request{
+		Src:     i.Template,
+		Dst:     tmpDir,
+		Pwd:     pwd,
+		GetMode: getter.ModeDir,
+	}
+	if _, err := getter.DefaultClient.Get(context.Background(), req); err != nil {
 		return fmt.Errorf("unable to fetch project template: %w", err)
 	}
 
@@ -90,14 +102,3 @@ func copyFile(src, dest string) error {
 	_, err = io.Copy(w, r)
 	return err
 }
-
-func getWithPWD(client *getter.Client) error {
-	pwd, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("unable to get current working directory: %w", err)
-	}
-
-	client.Pwd = pwd
-
-	return nil
-}
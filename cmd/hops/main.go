@@ -10,8 +10,11 @@ import (
 
 type (
 	Cmd struct {
+		Audit      *AuditCmd `arg:"subcommand:audit" help:"query the audit trail of decisions made about events"`
 		Build      *BuildCmd `arg:"subcommand:build" help:"build your Hiphops app"`
+		Dev        *DevCmd   `arg:"subcommand:dev" help:"serve your site, rebuilding it as you make changes"`
 		Down       *DownCmd  `arg:"subcommand:down" help:"stop Hiphops"`
+		Eval       *EvalCmd  `arg:"subcommand:eval" help:"evaluate an expression against an event"`
 		Initialise *InitCmd  `arg:"subcommand:init" help:"initialise a new Hiphops project"`
 		Link       *LinkCmd  `arg:"subcommand:link" help:"link to a hiphops.io account"`
 		Up         *UpCmd    `arg:"subcommand:up" help:"start Hiphops"`
@@ -33,10 +36,16 @@ func runCmd() error {
 	p := arg.MustParse(cmd)
 
 	switch {
+	case cmd.Audit != nil:
+		return cmd.Audit.Run()
 	case cmd.Build != nil:
 		return cmd.Build.Run()
+	case cmd.Dev != nil:
+		return cmd.Dev.Run()
 	case cmd.Down != nil:
 		return cmd.Down.Run()
+	case cmd.Eval != nil:
+		return cmd.Eval.Run()
 	case cmd.Initialise != nil:
 		return cmd.Initialise.Run()
 	case cmd.Link != nil:
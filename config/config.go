@@ -3,7 +3,9 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"path/filepath"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
@@ -12,18 +14,148 @@ const ConfigDirName = ".hiphops"
 
 type (
 	Config struct {
-		Dev        bool       `yaml:"dev" env:"HIPHOPS_DEV"`
-		Runner     RunnerConf `yaml:"runner" env-prefix:"HIPHOPS_RUNNER_"`
+		Dev        bool        `yaml:"dev" env:"HIPHOPS_DEV"`
+		Auth       AuthConf    `yaml:"auth" env-prefix:"HIPHOPS_AUTH_"`
+		Health     HealthConf  `yaml:"health" env-prefix:"HIPHOPS_HEALTH_"`
+		HTTP       HTTPConf    `yaml:"http" env-prefix:"HIPHOPS_HTTP_"`
+		Runner     RunnerConf  `yaml:"runner" env-prefix:"HIPHOPS_RUNNER_"`
+		Tracing    TracingConf `yaml:"tracing" env-prefix:"HIPHOPS_TRACING_"`
 		hiphopsDir string
 		tag        string
 	}
 
+	// AuthConf requires requests to the hops API to be authenticated, by one of
+	// the tokens or the OIDC provider. If neither is set, the command and audit
+	// APIs are only served if unauthenticated requests are allowed
+	AuthConf struct {
+		Tokens []TokenConf `yaml:"tokens"`
+		OIDC   OIDCConf    `yaml:"oidc" env-prefix:"OIDC_"`
+		// Roles limit what authenticated requests and chat users may do, which
+		// is anything if there are no roles
+		Roles []RoleConf `yaml:"roles"`
+		// AllowUnauthenticated serves the command and audit APIs to anyone who
+		// can reach them when auth isn't configured, such as in local dev
+		AllowUnauthenticated bool `yaml:"allow_unauthenticated" env:"ALLOW_UNAUTHENTICATED"`
+	}
+
+	// TokenConf is a static API token, such as for CI jobs
+	TokenConf struct {
+		// Name is who requests made with the token are made by
+		Name  string `yaml:"name"`
+		Token string `yaml:"token"`
+		// TokenEnv reads the token from an env var instead, keeping it out of config
+		TokenEnv string   `yaml:"token_env"`
+		Groups   []string `yaml:"groups"`
+	}
+
+	// OIDCConf authenticates JWT bearer tokens issued by an OIDC provider.
+	// Keys are discovered from the issuer unless JWKSURL or JWKSFile is set
+	OIDCConf struct {
+		Issuer string `yaml:"issuer" env:"ISSUER"`
+		// Audience is required, so tokens the provider issued to other clients
+		// aren't accepted
+		Audience string `yaml:"audience" env:"AUDIENCE"`
+		JWKSURL  string `yaml:"jwks_url" env:"JWKS_URL"`
+		JWKSFile string `yaml:"jwks_file" env:"JWKS_FILE"`
+		// SubjectClaim is the claim users are identified by, defaulting to sub
+		SubjectClaim string `yaml:"subject_claim" env:"SUBJECT_CLAIM"`
+		// GroupsClaim is the claim listing users' groups, defaulting to groups
+		GroupsClaim string `yaml:"groups_claim" env:"GROUPS_CLAIM"`
+	}
+
+	// RoleConf grants users and groups access to run commands and view the
+	// runs of flows, matched by glob patterns of command actions and flow IDs.
+	// Chat users are given by source and ID, such as slack:U012AB3CD
+	RoleConf struct {
+		Name   string   `yaml:"name"`
+		Users  []string `yaml:"users"`
+		Groups []string `yaml:"groups"`
+		Run    []string `yaml:"run"`
+		View   []string `yaml:"view"`
+		// Audit allows querying the audit trail, which covers every event
+		Audit bool `yaml:"audit"`
+	}
+
+	// HealthConf configures the checks made by /health/ready
+	HealthConf struct {
+		// MaxConsumerPending is how many events may be waiting to be handled
+		// before hops is considered unready, as it has fallen behind
+		MaxConsumerPending uint64 `yaml:"max_consumer_pending" env:"MAX_CONSUMER_PENDING" env-default:"1000"`
+	}
+
+	// HTTPConf configures the HTTP server serving the site, API and healthcheck
+	HTTPConf struct {
+		Address string `yaml:"address" env:"ADDRESS" env-default:":8080"`
+		// TLSCert and TLSKey are files to serve HTTPS with. Certs aren't
+		// obtained automatically, so must be renewed by something else
+		TLSCert string `yaml:"tls_cert" env:"TLS_CERT"`
+		TLSKey  string `yaml:"tls_key" env:"TLS_KEY"`
+		// AllowedOrigins may make cross origin requests, with * as a wildcard
+		AllowedOrigins []string      `yaml:"allowed_origins" env:"ALLOWED_ORIGINS" env-separator:","`
+		ReadTimeout    time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT" env-default:"30s"`
+		WriteTimeout   time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT" env-default:"30s"`
+		// ShutdownTimeout is how long requests in flight have to finish on shutdown
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" env-default:"10s"`
+		// TrustedProxies are IPs or CIDR ranges whose X-Forwarded-For headers
+		// are trusted to give the client's IP
+		TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" env-separator:","`
+	}
+
+	// TracingConf traces how events are handled, continuing traces from
+	// upstream and propagating them to workers in NATS message headers
+	TracingConf struct {
+		// Exporter is where spans are sent, either otlp or stdout. Tracing is
+		// disabled if it isn't set
+		Exporter string `yaml:"exporter" env:"EXPORTER"`
+		// OTLPEndpoint is the base URL of the collector to export to using OTLP
+		// over HTTP
+		OTLPEndpoint string `yaml:"otlp_endpoint" env:"OTLP_ENDPOINT" env-default:"http://localhost:4318"`
+		// OTLPHeaders are sent with every export, such as for auth
+		OTLPHeaders map[string]string `yaml:"otlp_headers" env:"OTLP_HEADERS"`
+		ServiceName string            `yaml:"service_name" env:"SERVICE_NAME" env-default:"hops"`
+		// SampleRatio is the fraction of traces started by hops that are
+		// recorded. Traces from upstream are recorded if sampled upstream
+		SampleRatio float64 `yaml:"sample_ratio" env:"SAMPLE_RATIO" env-default:"1"`
+	}
+
 	RunnerConf struct {
-		NATSConf string `yaml:"nats_config" env:"NATS_CONFIG"`
-		DataDir  string `yaml:"data_dir" env:"DATA_DIR"`
-		Local    bool   `yaml:"local" env:"LOCAL"` // TODO: Check we actually use/need this
+		NATSConf    string          `yaml:"nats_config" env:"NATS_CONFIG"`
+		DataDir     string          `yaml:"data_dir" env:"DATA_DIR"`
+		Local       bool            `yaml:"local" env:"LOCAL"` // TODO: Check we actually use/need this
+		Expressions ExpressionsConf `yaml:"expressions" env-prefix:"EXPRESSIONS_"`
+		Mattermost  MattermostConf  `yaml:"mattermost" env-prefix:"MATTERMOST_"`
+		Teams       TeamsConf       `yaml:"teams" env-prefix:"TEAMS_"`
 		// TODO: Add LogLevel as separate config
 	}
+
+	// ExpressionsConf controls what flow expressions can read from outside
+	// of the event that triggered them
+	ExpressionsConf struct {
+		// EnvAllow lists the env vars readable with env(), where entries ending
+		// in * allow any env var with that prefix
+		EnvAllow []string `yaml:"env_allow" env:"ENV_ALLOW" env-separator:","`
+		// SecretsDir is a directory with a file per secret readable with secret()
+		SecretsDir string `yaml:"secrets_dir" env:"SECRETS_DIR"`
+		// SecretsEnvPrefix reads secrets from env vars with this prefix instead,
+		// used if SecretsDir isn't set
+		SecretsEnvPrefix string `yaml:"secrets_env_prefix" env:"SECRETS_ENV_PREFIX"`
+	}
+
+	// MattermostConf enables running commands from a self hosted mattermost
+	MattermostConf struct {
+		URL       string `yaml:"url" env:"URL"`
+		Token     string `yaml:"token" env:"TOKEN"`
+		DialogURL string `yaml:"dialog_url" env:"DIALOG_URL"`
+	}
+
+	// TeamsConf enables running commands from microsoft teams, as the bot
+	// framework bot with these app credentials
+	TeamsConf struct {
+		AppID       string `yaml:"app_id" env:"APP_ID"`
+		AppPassword string `yaml:"app_password" env:"APP_PASSWORD"`
+		// TenantID is only set for single tenant bots
+		TenantID string `yaml:"tenant_id" env:"TENANT_ID"`
+	}
 )
 
 func NewConfig(hiphopsDir string, tag string) *Config {
@@ -56,6 +188,60 @@ func LoadConfig(hiphopsDir string, tag string) (*Config, error) {
 	return c, err
 }
 
+// Enabled is true if the API requires authentication
+func (a AuthConf) Enabled() bool {
+	return len(a.Tokens) > 0 || a.OIDC.Enabled()
+}
+
+// Enabled is true if OIDC tokens are accepted, which needs an issuer or keys
+func (o OIDCConf) Enabled() bool {
+	return o.Issuer != "" || o.JWKSURL != "" || o.JWKSFile != ""
+}
+
+// LocalURL is the URL of path on the HTTP server from the same host, as used
+// by the CLI healthcheck
+func (h HTTPConf) LocalURL(path string) (string, error) {
+	host, port, err := net.SplitHostPort(h.Address)
+	if err != nil {
+		return "", fmt.Errorf("invalid HTTP address '%s': %w", h.Address, err)
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	scheme := "http"
+	if h.TLSCert != "" {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, port), path), nil
+}
+
+// TrustedProxyRanges parses the trusted proxies, where IPs are ranges of one
+func (h HTTPConf) TrustedProxyRanges() ([]*net.IPNet, error) {
+	ranges := []*net.IPNet{}
+
+	for _, proxy := range h.TrustedProxies {
+		if ip := net.ParseIP(proxy); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			ranges = append(ranges, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipRange, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s', must be an IP or CIDR range", proxy)
+		}
+		ranges = append(ranges, ipRange)
+	}
+
+	return ranges, nil
+}
+
 func (c *Config) BaseConfigPath() string {
 	return filepath.Join(c.ConfigDirPath(), "config.yaml")
 }
@@ -80,6 +266,22 @@ func (c *Config) FlowsPath() string {
 	return filepath.Join(c.hiphopsDir, "flows")
 }
 
+// PagesPath is the dir of markdown pages the site is built from
+func (c *Config) PagesPath() string {
+	return filepath.Join(c.hiphopsDir, "pages")
+}
+
+// SitePath is the dir hops build keeps builds of the site in, which is served
+// from the link to the current build
+func (c *Config) SitePath() string {
+	return filepath.Join(c.LocalDirPath(), "site")
+}
+
+// TemplatesPath is the dir of templates that customise the built site
+func (c *Config) TemplatesPath() string {
+	return filepath.Join(c.ConfigDirPath(), "templates")
+}
+
 func (c *Config) LocalDirPath() string {
 	return filepath.Join(c.hiphopsDir, ConfigDirName)
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -67,6 +68,158 @@ runner:
 				},
 			},
 		},
+		{
+			name: "Mattermost config with env vars",
+			configFiles: map[string][]byte{
+				"": []byte(`
+runner:
+  mattermost:
+    url: https://mattermost.example.com
+    dialog_url: https://hooks.example.com/mattermost
+`),
+			},
+			envVars: map[string]string{
+				"HIPHOPS_RUNNER_MATTERMOST_TOKEN": "bot-token",
+			},
+			expectedHopsConf: Config{
+				Runner: RunnerConf{
+					Mattermost: MattermostConf{
+						URL:       "https://mattermost.example.com",
+						Token:     "bot-token",
+						DialogURL: "https://hooks.example.com/mattermost",
+					},
+				},
+			},
+		},
+		{
+			name: "Expressions config with env vars",
+			configFiles: map[string][]byte{
+				"": []byte(`
+runner:
+  expressions:
+    env_allow:
+      - DEPLOY_ENV
+      - APP_*
+`),
+			},
+			envVars: map[string]string{
+				"HIPHOPS_RUNNER_EXPRESSIONS_SECRETS_DIR": "/run/secrets",
+			},
+			expectedHopsConf: Config{
+				Runner: RunnerConf{
+					Expressions: ExpressionsConf{
+						EnvAllow:   []string{"DEPLOY_ENV", "APP_*"},
+						SecretsDir: "/run/secrets",
+					},
+				},
+			},
+		},
+		{
+			name: "Auth config with env vars",
+			configFiles: map[string][]byte{
+				"": []byte(`
+auth:
+  tokens:
+    - name: ci
+      token_env: CI_TOKEN
+      groups: [deployers]
+  oidc:
+    audience: hops
+  roles:
+    - name: deployers
+      groups: [deployers]
+      run: [deploy_*]
+      view: ["deploy.**"]
+    - name: compliance
+      groups: [compliance]
+      audit: true
+`),
+			},
+			envVars: map[string]string{
+				"HIPHOPS_AUTH_OIDC_ISSUER": "https://id.example.com",
+			},
+			expectedHopsConf: Config{
+				Auth: AuthConf{
+					Tokens: []TokenConf{{Name: "ci", TokenEnv: "CI_TOKEN", Groups: []string{"deployers"}}},
+					OIDC:   OIDCConf{Issuer: "https://id.example.com", Audience: "hops"},
+					Roles: []RoleConf{
+						{
+							Name:   "deployers",
+							Groups: []string{"deployers"},
+							Run:    []string{"deploy_*"},
+							View:   []string{"deploy.**"},
+						},
+						{Name: "compliance", Groups: []string{"compliance"}, Audit: true},
+					},
+				},
+			},
+		},
+		{
+			name: "HTTP config with env vars",
+			configFiles: map[string][]byte{
+				"": []byte(`
+http:
+  address: 127.0.0.1:8443
+  tls_cert: /etc/hops/tls.crt
+  tls_key: /etc/hops/tls.key
+  allowed_origins: [https://hops.example.com]
+  read_timeout: 1m
+`),
+			},
+			envVars: map[string]string{
+				"HIPHOPS_HTTP_TRUSTED_PROXIES": "10.0.0.0/8,192.168.1.1",
+			},
+			expectedHopsConf: Config{
+				HTTP: HTTPConf{
+					Address:         "127.0.0.1:8443",
+					TLSCert:         "/etc/hops/tls.crt",
+					TLSKey:          "/etc/hops/tls.key",
+					AllowedOrigins:  []string{"https://hops.example.com"},
+					ReadTimeout:     time.Minute,
+					WriteTimeout:    30 * time.Second,
+					ShutdownTimeout: 10 * time.Second,
+					TrustedProxies:  []string{"10.0.0.0/8", "192.168.1.1"},
+				},
+			},
+		},
+		{
+			name: "Tracing config with env vars",
+			configFiles: map[string][]byte{
+				"": []byte(`
+tracing:
+  exporter: otlp
+  otlp_endpoint: https://otel.example.com
+  sample_ratio: 0.25
+`),
+			},
+			envVars: map[string]string{
+				"HIPHOPS_TRACING_OTLP_HEADERS": "Authorization:Bearer otlp-token",
+			},
+			expectedHopsConf: Config{
+				Tracing: TracingConf{
+					Exporter:     "otlp",
+					OTLPEndpoint: "https://otel.example.com",
+					OTLPHeaders:  map[string]string{"Authorization": "Bearer otlp-token"},
+					ServiceName:  "hops",
+					SampleRatio:  0.25,
+				},
+			},
+		},
+		{
+			name: "Health config with env vars",
+			configFiles: map[string][]byte{
+				"": []byte(`
+health:
+  max_consumer_pending: 50
+`),
+			},
+			envVars: map[string]string{
+				"HIPHOPS_HEALTH_MAX_CONSUMER_PENDING": "200",
+			},
+			expectedHopsConf: Config{
+				Health: HealthConf{MaxConsumerPending: 200},
+			},
+		},
 		{
 			name: "Bad config",
 			configFiles: map[string][]byte{
@@ -86,9 +239,36 @@ runner:
 
 			cleanEnvVars(t, []string{
 				"HIPHOPS_DEV",
+				"HIPHOPS_HEALTH_MAX_CONSUMER_PENDING",
+				"HIPHOPS_HTTP_ADDRESS",
+				"HIPHOPS_HTTP_TLS_CERT",
+				"HIPHOPS_HTTP_TLS_KEY",
+				"HIPHOPS_HTTP_ALLOWED_ORIGINS",
+				"HIPHOPS_HTTP_READ_TIMEOUT",
+				"HIPHOPS_HTTP_WRITE_TIMEOUT",
+				"HIPHOPS_HTTP_SHUTDOWN_TIMEOUT",
+				"HIPHOPS_HTTP_TRUSTED_PROXIES",
+				"HIPHOPS_TRACING_EXPORTER",
+				"HIPHOPS_TRACING_OTLP_ENDPOINT",
+				"HIPHOPS_TRACING_OTLP_HEADERS",
+				"HIPHOPS_TRACING_SERVICE_NAME",
+				"HIPHOPS_TRACING_SAMPLE_RATIO",
+				"HIPHOPS_AUTH_ALLOW_UNAUTHENTICATED",
+				"HIPHOPS_AUTH_OIDC_ISSUER",
+				"HIPHOPS_AUTH_OIDC_AUDIENCE",
+				"HIPHOPS_AUTH_OIDC_JWKS_URL",
+				"HIPHOPS_AUTH_OIDC_JWKS_FILE",
+				"HIPHOPS_AUTH_OIDC_SUBJECT_CLAIM",
+				"HIPHOPS_AUTH_OIDC_GROUPS_CLAIM",
 				"HIPHOPS_RUNNER_NATS_CONFIG",
 				"HIPHOPS_RUNNER_DATA_DIR",
 				"HIPHOPS_RUNNER_LOCAL",
+				"HIPHOPS_RUNNER_MATTERMOST_URL",
+				"HIPHOPS_RUNNER_MATTERMOST_TOKEN",
+				"HIPHOPS_RUNNER_MATTERMOST_DIALOG_URL",
+				"HIPHOPS_RUNNER_EXPRESSIONS_ENV_ALLOW",
+				"HIPHOPS_RUNNER_EXPRESSIONS_SECRETS_DIR",
+				"HIPHOPS_RUNNER_EXPRESSIONS_SECRETS_ENV_PREFIX",
 			})
 
 			for name, value := range tc.envVars {
@@ -103,6 +283,24 @@ runner:
 
 			tc.expectedHopsConf.tag = tc.tag
 			tc.expectedHopsConf.hiphopsDir = hopsDir
+			if tc.expectedHopsConf.HTTP.Address == "" {
+				tc.expectedHopsConf.HTTP = HTTPConf{
+					Address:         ":8080",
+					ReadTimeout:     30 * time.Second,
+					WriteTimeout:    30 * time.Second,
+					ShutdownTimeout: 10 * time.Second,
+				}
+			}
+			if tc.expectedHopsConf.Health.MaxConsumerPending == 0 {
+				tc.expectedHopsConf.Health.MaxConsumerPending = 1000
+			}
+			if tc.expectedHopsConf.Tracing.ServiceName == "" {
+				tc.expectedHopsConf.Tracing = TracingConf{
+					OTLPEndpoint: "http://localhost:4318",
+					ServiceName:  "hops",
+					SampleRatio:  1,
+				}
+			}
 			if tc.expectedHopsConf.Runner.NATSConf == "" {
 				tc.expectedHopsConf.Runner.NATSConf = filepath.Join(hopsDir, "hiphops", "nats.conf")
 			}
@@ -141,3 +339,60 @@ func cleanEnvVars(t *testing.T, envVars []string) {
 		require.NoError(t, err, "Test setup: Unable to clean env vars")
 	}
 }
+
+func TestHTTPConf(t *testing.T) {
+	type testCase struct {
+		name        string
+		conf        HTTPConf
+		expectedURL string
+	}
+
+	tests := []testCase{
+		{name: "All interfaces", conf: HTTPConf{Address: ":8080"}, expectedURL: "http://127.0.0.1:8080/health"},
+		{name: "Unspecified IP", conf: HTTPConf{Address: "0.0.0.0:9000"}, expectedURL: "http://127.0.0.1:9000/health"},
+		{name: "Host", conf: HTTPConf{Address: "hops.internal:80"}, expectedURL: "http://hops.internal:80/health"},
+		{name: "IPv6", conf: HTTPConf{Address: "[::1]:8080"}, expectedURL: "http://[::1]:8080/health"},
+		{name: "TLS", conf: HTTPConf{Address: ":8443", TLSCert: "tls.crt"}, expectedURL: "https://127.0.0.1:8443/health"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			url, err := tc.conf.LocalURL("/health")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedURL, url)
+		})
+	}
+
+	_, err := HTTPConf{Address: "8080"}.LocalURL("/health")
+	assert.Error(t, err, "Addresses without a port should be rejected")
+
+	ranges, err := HTTPConf{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1", "fd00::1"}}.TrustedProxyRanges()
+	require.NoError(t, err)
+	require.Len(t, ranges, 3)
+	assert.Equal(t, "10.0.0.0/8", ranges[0].String())
+	assert.Equal(t, "192.168.1.1/32", ranges[1].String())
+	assert.Equal(t, "fd00::1/128", ranges[2].String())
+
+	_, err = HTTPConf{TrustedProxies: []string{"proxy.internal"}}.TrustedProxyRanges()
+	assert.Error(t, err)
+}
+
+func TestAuthConfEnabled(t *testing.T) {
+	tests := map[string]struct {
+		conf     AuthConf
+		expected bool
+	}{
+		"Nothing configured": {conf: AuthConf{}, expected: false},
+		"Tokens":             {conf: AuthConf{Tokens: []TokenConf{{Name: "ci", Token: "secret"}}}, expected: true},
+		"OIDC issuer":        {conf: AuthConf{OIDC: OIDCConf{Issuer: "https://id.example.com"}}, expected: true},
+		"OIDC JWKS URL":      {conf: AuthConf{OIDC: OIDCConf{JWKSURL: "https://id.example.com/keys"}}, expected: true},
+		"OIDC JWKS file":     {conf: AuthConf{OIDC: OIDCConf{JWKSFile: "jwks.json"}}, expected: true},
+		"Only roles":         {conf: AuthConf{Roles: []RoleConf{{Name: "admins"}}}, expected: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.conf.Enabled())
+		})
+	}
+}
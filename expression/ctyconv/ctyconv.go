@@ -2,20 +2,29 @@
 package ctyconv
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"reflect"
+	"time"
 
 	"github.com/goccy/go-json"
 	"github.com/zclconf/go-cty/cty"
 )
 
 // JSONToCtyValue converts an aribitrary json byte slice and converts to a corresponding cty.Value
+//
+// Numbers are decoded with full precision, so large integers such as IDs are
+// preserved exactly
 func JSONToCtyValue(jsonStr []byte) (cty.Value, error) {
 	var data interface{}
 
-	err := json.Unmarshal(jsonStr, &data)
-	if err != nil {
+	decoder := json.NewDecoder(bytes.NewReader(jsonStr))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&data); err != nil {
 		return cty.NilVal, err
 	}
 
@@ -29,8 +38,14 @@ func JSONToCtyValue(jsonStr []byte) (cty.Value, error) {
 
 // InterfaceToCtyVal converts an arbitrary interface into a cty.Value
 //
-// Note: Not all nested types are supported, only those that can be produced
-// by json.Marshal() into a generic interface{} value
+// Values produced by json.Unmarshal() into a generic interface{} value are
+// converted directly, including json.Number when decoding with UseNumber().
+// Go numbers, slices, arrays and maps with string keys are also converted, as
+// are pointers to them. time.Time values become RFC3339 timestamps, as used by
+// the time functions of expressions
+//
+// Any other structs are converted via their JSON encoding, so json tags
+// and custom marshallers are respected
 func InterfaceToCtyVal(i interface{}) (cty.Value, error) {
 	switch i := i.(type) {
 	case string:
@@ -40,12 +55,25 @@ func InterfaceToCtyVal(i interface{}) (cty.Value, error) {
 		return cty.BoolVal(i), nil
 
 	case float64:
+		if math.IsNaN(i) {
+			return cty.NilVal, errors.New("NaN can't be converted to a number")
+		}
 		bigFloat := new(big.Float).SetFloat64(i)
 		return cty.NumberVal(bigFloat), nil
 
+	case json.Number:
+		val, err := cty.ParseNumberVal(i.String())
+		if err != nil {
+			return cty.NilVal, fmt.Errorf("invalid number '%s': %w", i, err)
+		}
+		return val, nil
+
 	case nil:
 		return cty.NullVal(cty.DynamicPseudoType), nil
 
+	case time.Time:
+		return cty.StringVal(i.Format(time.RFC3339Nano)), nil
+
 	case []interface{}:
 		vals := []cty.Value{}
 		for _, v := range i {
@@ -71,7 +99,84 @@ func InterfaceToCtyVal(i interface{}) (cty.Value, error) {
 		return cty.ObjectVal(mapVals), nil
 
 	default:
-		return cty.NilVal, fmt.Errorf("Unknown type: %v", i)
+		return reflectToCtyVal(reflect.ValueOf(i))
+	}
+}
+
+// reflectToCtyVal converts values of types that InterfaceToCtyVal doesn't
+// handle directly
+func reflectToCtyVal(rv reflect.Value) (cty.Value, error) {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return cty.NullVal(cty.DynamicPseudoType), nil
+		}
+		return InterfaceToCtyVal(rv.Elem().Interface())
+
+	case reflect.String:
+		return cty.StringVal(rv.String()), nil
+
+	case reflect.Bool:
+		return cty.BoolVal(rv.Bool()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cty.NumberIntVal(rv.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return cty.NumberUIntVal(rv.Uint()), nil
+
+	case reflect.Float32, reflect.Float64:
+		return InterfaceToCtyVal(rv.Float())
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return cty.NullVal(cty.DynamicPseudoType), nil
+		}
+
+		vals := make([]cty.Value, rv.Len())
+		for idx := range vals {
+			val, err := InterfaceToCtyVal(rv.Index(idx).Interface())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			vals[idx] = val
+		}
+		return cty.TupleVal(vals), nil
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return cty.NullVal(cty.DynamicPseudoType), nil
+		}
+
+		mapVals := map[string]cty.Value{}
+		for it := rv.MapRange(); it.Next(); {
+			key := it.Key()
+			if key.Kind() == reflect.Interface {
+				key = key.Elem()
+			}
+			if key.Kind() != reflect.String {
+				return cty.NilVal, fmt.Errorf("unsupported map key type %s, keys must be strings", key.Type())
+			}
+
+			val, err := InterfaceToCtyVal(it.Value().Interface())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			mapVals[key.String()] = val
+		}
+		return cty.ObjectVal(mapVals), nil
+
+	case reflect.Struct:
+		b, err := json.Marshal(rv.Interface())
+		if err != nil {
+			return cty.NilVal, fmt.Errorf("unable to convert %s: %w", rv.Type(), err)
+		}
+		return JSONToCtyValue(b)
+
+	default:
+		return cty.NilVal, fmt.Errorf("Unknown type: %s", rv.Type())
 	}
 }
 
@@ -117,6 +222,10 @@ func CtyToEventAction(val cty.Value, metadataKey string) (source, event, action
 // Calls itself recursively to convert nested values.
 // Does not cover all possible cty types, such as unknown, capsule, empty object,
 // and empty tuple.
+//
+// Numbers are converted to float64, except integers that float64 can't hold
+// exactly, which are converted to json.Number so no precision is lost when
+// they're passed on or converted back with InterfaceToCtyVal.
 func CtyValueToInterface(val cty.Value) (interface{}, error) {
 	if val.IsNull() || !val.IsKnown() {
 		return nil, nil
@@ -129,7 +238,13 @@ func CtyValueToInterface(val cty.Value) (interface{}, error) {
 		return val.AsString(), nil
 
 	case valType.Equals(cty.Number):
-		num, _ := val.AsBigFloat().Float64()
+		bigFloat := val.AsBigFloat()
+		num, accuracy := bigFloat.Float64()
+		// Integers beyond the precision of cty numbers aren't exact anyway, so
+		// are left as float64
+		if accuracy != big.Exact && bigFloat.IsInt() && bigFloat.MantExp(nil) <= int(bigFloat.Prec()) {
+			return json.Number(bigFloat.Text('f', 0)), nil
+		}
 		return num, nil
 
 	case valType.Equals(cty.Bool):
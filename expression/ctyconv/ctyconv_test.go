@@ -1,11 +1,17 @@
 package ctyconv
 
 import (
+	"math"
+	"math/big"
 	"os"
 	"reflect"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/goccy/go-json"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/zclconf/go-cty/cty"
 )
 
@@ -207,3 +213,204 @@ func TestConvertCtyValueToInterface_CapsuleTypes(t *testing.T) {
 		}
 	})
 }
+
+type testEvent struct {
+	ID        uint64            `json:"id"`
+	Name      string            `json:"name"`
+	Labels    []string          `json:"labels,omitempty"`
+	Meta      map[string]string `json:"meta"`
+	CreatedAt time.Time         `json:"created_at"`
+	internal  string
+}
+
+func TestInterfaceToCtyVal(t *testing.T) {
+	createdAt := time.Date(2024, 3, 4, 10, 30, 0, 0, time.UTC)
+	largeID, _ := new(big.Float).SetString("12345678901234567890")
+
+	tests := []struct {
+		name        string
+		input       any
+		expected    cty.Value
+		expectError bool
+	}{
+		{
+			name:     "JSON number keeps precision",
+			input:    json.Number("9007199254740993"),
+			expected: cty.MustParseNumberVal("9007199254740993"),
+		},
+		{
+			name:     "Large uint",
+			input:    uint64(12345678901234567890),
+			expected: cty.NumberVal(largeID),
+		},
+		{
+			name:     "Int",
+			input:    int32(-42),
+			expected: cty.NumberIntVal(-42),
+		},
+		{
+			name:     "Float",
+			input:    float32(1.5),
+			expected: cty.NumberFloatVal(1.5),
+		},
+		{
+			name:        "NaN",
+			input:       math.NaN(),
+			expectError: true,
+		},
+		{
+			name:        "Invalid JSON number",
+			input:       json.Number("twelve"),
+			expectError: true,
+		},
+		{
+			name:     "Time",
+			input:    createdAt,
+			expected: cty.StringVal("2024-03-04T10:30:00Z"),
+		},
+		{
+			name:     "Time pointer",
+			input:    &createdAt,
+			expected: cty.StringVal("2024-03-04T10:30:00Z"),
+		},
+		{
+			name:     "Nil pointer",
+			input:    (*testEvent)(nil),
+			expected: cty.NullVal(cty.DynamicPseudoType),
+		},
+		{
+			name:  "Typed slice and map",
+			input: map[string][]string{"labels": {"bug", "urgent"}},
+			expected: cty.ObjectVal(map[string]cty.Value{
+				"labels": cty.TupleVal([]cty.Value{cty.StringVal("bug"), cty.StringVal("urgent")}),
+			}),
+		},
+		{
+			name:     "Interface keyed map with string keys",
+			input:    map[any]any{"key": "value"},
+			expected: cty.ObjectVal(map[string]cty.Value{"key": cty.StringVal("value")}),
+		},
+		{
+			name:        "Map with int keys",
+			input:       map[int]string{1: "one"},
+			expectError: true,
+		},
+		{
+			name:        "Interface keyed map with non-string keys",
+			input:       map[any]any{"key": "value", 2: "two"},
+			expectError: true,
+		},
+		{
+			name:        "Nested map with int keys",
+			input:       map[string]any{"nested": map[int]string{1: "one"}},
+			expectError: true,
+		},
+		{
+			name: "Struct",
+			input: testEvent{
+				ID:        12345678901234567890,
+				Name:      "push",
+				Meta:      map[string]string{"repo": "hops"},
+				CreatedAt: createdAt,
+				internal:  "hidden",
+			},
+			expected: cty.ObjectVal(map[string]cty.Value{
+				"id":         cty.NumberVal(largeID),
+				"name":       cty.StringVal("push"),
+				"meta":       cty.ObjectVal(map[string]cty.Value{"repo": cty.StringVal("hops")}),
+				"created_at": cty.StringVal("2024-03-04T10:30:00Z"),
+			}),
+		},
+		{
+			name:        "Unsupported type",
+			input:       make(chan int),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := InterfaceToCtyVal(tc.input)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.True(t, tc.expected.RawEquals(got), "Expected %#v, got %#v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestLargeIntegerPrecision(t *testing.T) {
+	eventJson := []byte(`{"id": 1234567890123456789, "ts": 1712345678.123456, "count": 3}`)
+
+	eventCty, err := JSONToCtyValue(eventJson)
+	require.NoError(t, err)
+
+	expectedID := cty.MustParseNumberVal("1234567890123456789")
+	assert.True(t, expectedID.Equals(eventCty.GetAttr("id")).True(), "Large IDs should keep their precision")
+	assert.False(
+		t,
+		cty.MustParseNumberVal("1234567890123456788").Equals(eventCty.GetAttr("id")).True(),
+		"Large IDs that differ only in precision shouldn't be equal",
+	)
+
+	got, err := CtyValueToInterface(eventCty)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{
+		"id":    json.Number("1234567890123456789"),
+		"ts":    1712345678.123456,
+		"count": float64(3),
+	}, got)
+
+	encoded, err := json.Marshal(got)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(eventJson), string(encoded))
+}
+
+func FuzzJSONRoundTrip(f *testing.F) {
+	f.Add([]byte(`{"id": 12345678901234567890, "name": "push", "labels": ["bug"], "ok": true}`))
+	f.Add([]byte(`[0.1, -3, 1e21, 9007199254740993, null]`))
+	f.Add([]byte(`{"nested": {"deep": [{"value": 1.5}]}}`))
+	f.Add([]byte(`"text"`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Invalid UTF-8 is replaced when encoding, so can't round trip
+		if !utf8.Valid(data) {
+			return
+		}
+
+		first, err := JSONToCtyValue(data)
+		if err != nil {
+			return
+		}
+
+		firstIface, err := CtyValueToInterface(first)
+		require.NoError(t, err)
+
+		// Values must survive being encoded and passed on, as they are to workers
+		encoded, err := json.Marshal(firstIface)
+		if err != nil {
+			// Infinite numbers can be decoded from JSON, but not encoded again
+			return
+		}
+
+		second, err := JSONToCtyValue(encoded)
+		require.NoError(t, err, "Encoded values should decode again: %s", encoded)
+
+		secondIface, err := CtyValueToInterface(second)
+		require.NoError(t, err)
+		assert.Equal(t, firstIface, secondIface, "Values should be stable across round trips")
+
+		// Converting back to cty directly should be stable too
+		direct, err := InterfaceToCtyVal(firstIface)
+		require.NoError(t, err)
+
+		directIface, err := CtyValueToInterface(direct)
+		require.NoError(t, err)
+		assert.Equal(t, firstIface, directIface)
+	})
+}
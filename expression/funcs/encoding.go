@@ -0,0 +1,67 @@
+package funcs
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Base64EncodeFunc is a cty.Function that base64 encodes a string
+var Base64EncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(base64.StdEncoding.EncodeToString([]byte(args[0].AsString()))), nil
+	},
+})
+
+// Base64DecodeFunc is a cty.Function that decodes a base64 string, which must
+// decode to valid UTF-8
+var Base64DecodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return Base64Decode(args[0])
+	},
+})
+
+func Base64Decode(str cty.Value) (cty.Value, error) {
+	decoded, err := base64.StdEncoding.DecodeString(str.AsString())
+	if err != nil {
+		return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+	}
+
+	if !utf8.Valid(decoded) {
+		return cty.UnknownVal(cty.String), function.NewArgError(0, errors.New("decoded value is not valid UTF-8"))
+	}
+
+	return cty.StringVal(string(decoded)), nil
+}
+
+// URLEncodeFunc is a cty.Function that escapes a string for use in a URL query
+var URLEncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(url.QueryEscape(args[0].AsString())), nil
+	},
+})
@@ -0,0 +1,33 @@
+package funcs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestBase64(t *testing.T) {
+	encoded, err := Base64EncodeFunc.Call([]cty.Value{cty.StringVal("hello, wörld")})
+	if assert.NoError(t, err) {
+		assert.Equal(t, cty.StringVal("aGVsbG8sIHfDtnJsZA=="), encoded)
+	}
+
+	decoded, err := Base64Decode(encoded)
+	if assert.NoError(t, err) {
+		assert.Equal(t, cty.StringVal("hello, wörld"), decoded, "Decoding should round trip")
+	}
+
+	_, err = Base64Decode(cty.StringVal("not base64!"))
+	assert.Error(t, err, "Invalid base64 should error")
+
+	_, err = Base64Decode(cty.StringVal("/w=="))
+	assert.Error(t, err, "Decoded values that aren't UTF-8 should error")
+}
+
+func TestURLEncode(t *testing.T) {
+	got, err := URLEncodeFunc.Call([]cty.Value{cty.StringVal("a b&c=d/é")})
+	if assert.NoError(t, err) {
+		assert.Equal(t, cty.StringVal("a+b%26c%3Dd%2F%C3%A9"), got)
+	}
+}
@@ -1,34 +1,51 @@
 package funcs
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
 )
 
-// EnvFunc is a cty.Function that returns an env var or the default value if it doesn't exist
-var EnvFunc = function.New(&function.Spec{
-	Params: []function.Parameter{
-		{
-			Name: "envVarName",
-			Type: cty.String,
+// EnvAllowList is the env vars that expressions may read, where entries
+// ending in * allow any env var with that prefix
+type EnvAllowList []string
+
+// EnvFunc is a stateful cty function that returns an env var or the default
+// value if it doesn't exist
+//
+// Only env vars in the allow list can be read, so expressions can't read
+// secrets from the environment of the hops process
+func EnvFunc(allowed EnvAllowList) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "envVarName",
+				Type: cty.String,
+			},
+			{
+				Name: "defaultValue",
+				Type: cty.String,
+			},
 		},
-		{
-			Name: "defaultValue",
-			Type: cty.String,
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			envVarName := args[0]
+			defaultValue := args[1]
+			return Env(allowed, envVarName, defaultValue)
 		},
-	},
-	Type: function.StaticReturnType(cty.String),
-	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
-		envVarName := args[0]
-		defaultValue := args[1]
-		return Env(envVarName, defaultValue)
-	},
-})
-
-func Env(envVarName, defaultValue cty.Value) (cty.Value, error) {
-	val, ok := os.LookupEnv(envVarName.AsString())
+	})
+}
+
+func Env(allowed EnvAllowList, envVarName, defaultValue cty.Value) (cty.Value, error) {
+	name := envVarName.AsString()
+	if !allowed.Allows(name) {
+		return cty.StringVal(""), fmt.Errorf("env var '%s' is not in the allow list for expressions", name)
+	}
+
+	val, ok := os.LookupEnv(name)
 	if !ok {
 		val = defaultValue.AsString()
 	}
@@ -37,3 +54,25 @@ func Env(envVarName, defaultValue cty.Value) (cty.Value, error) {
 
 	return ctyVal, nil
 }
+
+// Allows returns true if the env var can be read by expressions
+func (a EnvAllowList) Allows(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, allowed := range a {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+			continue
+		}
+
+		if name == allowed {
+			return true
+		}
+	}
+
+	return false
+}
@@ -13,14 +13,17 @@ func TestEnvFunc(t *testing.T) {
 		name         string
 		envVarName   string
 		defaultValue string
+		allowed      EnvAllowList
 		withEnv      map[string]string
 		expected     string
+		expectError  bool
 	}
 
 	tests := []testCase{
 		{
 			name:         "Existing env with no default",
 			envVarName:   "HIPHOPS_TEST",
+			allowed:      EnvAllowList{"HIPHOPS_TEST"},
 			defaultValue: "",
 			withEnv: map[string]string{
 				"HIPHOPS_TEST": "ONE",
@@ -30,6 +33,7 @@ func TestEnvFunc(t *testing.T) {
 		{
 			name:         "Existing env with default",
 			envVarName:   "HIPHOPS_TEST",
+			allowed:      EnvAllowList{"HIPHOPS_TEST"},
 			defaultValue: "TWO",
 			withEnv: map[string]string{
 				"HIPHOPS_TEST": "ONE",
@@ -39,6 +43,7 @@ func TestEnvFunc(t *testing.T) {
 		{
 			name:         "Missing env with default",
 			envVarName:   "HIPHOPS_TEST",
+			allowed:      EnvAllowList{"HIPHOPS_TEST"},
 			defaultValue: "TWO",
 			withEnv: map[string]string{
 				"HIPHOPS_OTHER_VALUE": "Hello there",
@@ -48,10 +53,40 @@ func TestEnvFunc(t *testing.T) {
 		{
 			name:         "Missing env with no default",
 			envVarName:   "HIPHOPS_TEST",
+			allowed:      EnvAllowList{"HIPHOPS_TEST"},
 			defaultValue: "",
 			withEnv:      map[string]string{},
 			expected:     "",
 		},
+		{
+			name:         "Env allowed by prefix",
+			envVarName:   "HIPHOPS_TEST",
+			defaultValue: "",
+			allowed:      EnvAllowList{"OTHER", "HIPHOPS_*"},
+			withEnv: map[string]string{
+				"HIPHOPS_TEST": "ONE",
+			},
+			expected: "ONE",
+		},
+		{
+			name:         "Env not allowed",
+			envVarName:   "HIPHOPS_SECRET",
+			defaultValue: "TWO",
+			allowed:      EnvAllowList{"HIPHOPS_TEST", "HIPHOPS_SECRETS_*"},
+			withEnv: map[string]string{
+				"HIPHOPS_SECRET": "ONE",
+			},
+			expectError: true,
+		},
+		{
+			name:         "Empty allow list",
+			envVarName:   "HIPHOPS_TEST",
+			defaultValue: "TWO",
+			withEnv: map[string]string{
+				"HIPHOPS_TEST": "ONE",
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tc := range tests {
@@ -66,7 +101,11 @@ func TestEnvFunc(t *testing.T) {
 			defaultVal := cty.StringVal(tc.defaultValue)
 			expectedVal := cty.StringVal(tc.expected)
 
-			got, err := Env(nameVal, defaultVal)
+			got, err := Env(tc.allowed, nameVal, defaultVal)
+			if tc.expectError {
+				assert.Error(t, err, "Env function should error for env vars that aren't allowed")
+				return
+			}
 
 			assert.NoError(t, err, "Env function should not throw an error")
 			assert.Equal(t, expectedVal, got, "Env function should return correct value")
@@ -8,65 +8,84 @@ import (
 )
 
 // DefaultFunctions for expressions in hiphops flows
+//
+// Functions that depend on config or a flow's files, such as env() and
+// secret(), are added per flow instead
 var DefaultFunctions = map[string]function.Function{
-	"abs":             stdlib.AbsoluteFunc,
-	"alltrue":         AllTrueFunc,
-	"anytrue":         AnyTrueFunc,
-	"versiontmpl":     VersionTemplateFunc,
-	"can":             tryfunc.CanFunc,
-	"ceil":            stdlib.CeilFunc,
-	"chomp":           stdlib.ChompFunc,
-	"coalesce":        stdlib.CoalesceFunc,
-	"compact":         stdlib.CompactFunc,
-	"concat":          stdlib.ConcatFunc,
-	"csv":             stdlib.CSVDecodeFunc,
-	"env":             EnvFunc,
-	"flatten":         stdlib.FlattenFunc,
-	"floor":           stdlib.FloorFunc,
-	"format":          stdlib.FormatFunc,
-	"formatdate":      stdlib.FormatDateFunc,
-	"glob":            GlobFunc,
-	"indent":          stdlib.IndentFunc,
-	"index":           stdlib.IndexFunc,
-	"int":             stdlib.IntFunc,
-	"join":            stdlib.JoinFunc,
-	"jsondecode":      stdlib.JSONDecodeFunc,
-	"jsonencode":      stdlib.JSONEncodeFunc,
-	"keys":            stdlib.KeysFunc,
-	"length":          stdlib.LengthFunc,
-	"lookup":          stdlib.LookupFunc,
-	"lower":           stdlib.LowerFunc,
-	"max":             stdlib.MaxFunc,
-	"merge":           stdlib.MergeFunc,
-	"min":             stdlib.MinFunc,
-	"range":           stdlib.RangeFunc,
-	"regex":           stdlib.RegexAllFunc,
-	"regexreplace":    stdlib.RegexReplaceFunc,
-	"replace":         stdlib.ReplaceFunc,
-	"reverse":         stdlib.ReverseFunc,
-	"setintersection": stdlib.SetIntersectionFunc,
-	"setproduct":      stdlib.SetProductFunc,
-	"setunion":        stdlib.SetUnionFunc,
-	"slice":           stdlib.SliceFunc,
-	"sort":            stdlib.SortFunc,
-	"split":           stdlib.SplitFunc,
-	"strlen":          stdlib.StrlenFunc,
-	"substr":          stdlib.SubstrFunc,
-	"timeadd":         stdlib.TimeAddFunc,
-	"title":           stdlib.TitleFunc,
-	"tobool":          stdlib.MakeToFunc(cty.Bool),
-	"tolist":          stdlib.MakeToFunc(cty.List(cty.DynamicPseudoType)),
-	"tomap":           stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
-	"tonumber":        stdlib.MakeToFunc(cty.Number),
-	"toset":           stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
-	"tostring":        stdlib.MakeToFunc(cty.String),
-	"trim":            stdlib.TrimFunc,
-	"trimprefix":      stdlib.TrimPrefixFunc,
-	"trimspace":       stdlib.TrimSpaceFunc,
-	"trimsuffix":      stdlib.TrimSuffixFunc,
-	"try":             tryfunc.TryFunc,
-	"upper":           stdlib.UpperFunc,
-	"values":          stdlib.ValuesFunc,
-	"xglob":           ExclusiveGlobFunc,
-	"zipmap":          stdlib.ZipmapFunc,
+	"abs":              stdlib.AbsoluteFunc,
+	"alltrue":          AllTrueFunc,
+	"anytrue":          AnyTrueFunc,
+	"versiontmpl":      VersionTemplateFunc,
+	"base64decode":     Base64DecodeFunc,
+	"base64encode":     Base64EncodeFunc,
+	"businesshours":    BusinessHoursFunc,
+	"can":              tryfunc.CanFunc,
+	"ceil":             stdlib.CeilFunc,
+	"chomp":            stdlib.ChompFunc,
+	"coalesce":         stdlib.CoalesceFunc,
+	"compact":          stdlib.CompactFunc,
+	"concat":           stdlib.ConcatFunc,
+	"csv":              stdlib.CSVDecodeFunc,
+	"flatten":          stdlib.FlattenFunc,
+	"floor":            stdlib.FloorFunc,
+	"format":           stdlib.FormatFunc,
+	"formatdate":       stdlib.FormatDateFunc,
+	"glob":             GlobFunc,
+	"indent":           stdlib.IndentFunc,
+	"index":            stdlib.IndexFunc,
+	"int":              stdlib.IntFunc,
+	"jmespath":         JMESPathFunc,
+	"join":             stdlib.JoinFunc,
+	"jsondecode":       stdlib.JSONDecodeFunc,
+	"jsonencode":       stdlib.JSONEncodeFunc,
+	"jsonpath":         JSONPathFunc,
+	"keys":             stdlib.KeysFunc,
+	"length":           stdlib.LengthFunc,
+	"lookup":           stdlib.LookupFunc,
+	"lower":            stdlib.LowerFunc,
+	"max":              stdlib.MaxFunc,
+	"md5":              Md5Func,
+	"merge":            stdlib.MergeFunc,
+	"min":              stdlib.MinFunc,
+	"parseduration":    ParseDurationFunc,
+	"range":            stdlib.RangeFunc,
+	"regex":            stdlib.RegexAllFunc,
+	"regexreplace":     stdlib.RegexReplaceFunc,
+	"replace":          stdlib.ReplaceFunc,
+	"reverse":          stdlib.ReverseFunc,
+	"semvercmp":        SemverCmpFunc,
+	"semverconstraint": SemverConstraintFunc,
+	"setintersection":  stdlib.SetIntersectionFunc,
+	"setproduct":       stdlib.SetProductFunc,
+	"setunion":         stdlib.SetUnionFunc,
+	"sha1":             Sha1Func,
+	"sha256":           Sha256Func,
+	"sha512":           Sha512Func,
+	"slice":            stdlib.SliceFunc,
+	"sort":             stdlib.SortFunc,
+	"split":            stdlib.SplitFunc,
+	"strlen":           stdlib.StrlenFunc,
+	"substr":           stdlib.SubstrFunc,
+	"timeadd":          stdlib.TimeAddFunc,
+	"timecmp":          TimeCmpFunc,
+	"timestamp":        TimestampFunc,
+	"title":            stdlib.TitleFunc,
+	"tobool":           stdlib.MakeToFunc(cty.Bool),
+	"tolist":           stdlib.MakeToFunc(cty.List(cty.DynamicPseudoType)),
+	"tomap":            stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
+	"tonumber":         stdlib.MakeToFunc(cty.Number),
+	"toset":            stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
+	"tostring":         stdlib.MakeToFunc(cty.String),
+	"trim":             stdlib.TrimFunc,
+	"trimprefix":       stdlib.TrimPrefixFunc,
+	"trimspace":        stdlib.TrimSpaceFunc,
+	"trimsuffix":       stdlib.TrimSuffixFunc,
+	"try":              tryfunc.TryFunc,
+	"upper":            stdlib.UpperFunc,
+	"urlencode":        URLEncodeFunc,
+	"uuid":             UUIDFunc,
+	"values":           stdlib.ValuesFunc,
+	"weekday":          WeekdayFunc,
+	"xglob":            ExclusiveGlobFunc,
+	"zipmap":           stdlib.ZipmapFunc,
 }
@@ -0,0 +1,41 @@
+package funcs
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Hash functions are cty.Functions that return the hex encoded hash of a string
+var (
+	Md5Func    = makeHashFunc(md5.New)
+	Sha1Func   = makeHashFunc(sha1.New)
+	Sha256Func = makeHashFunc(sha256.New)
+	Sha512Func = makeHashFunc(sha512.New)
+)
+
+func makeHashFunc(newHash func() hash.Hash) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return Hash(newHash(), args[0]), nil
+		},
+	})
+}
+
+func Hash(h hash.Hash, str cty.Value) cty.Value {
+	h.Write([]byte(str.AsString()))
+	return cty.StringVal(hex.EncodeToString(h.Sum(nil)))
+}
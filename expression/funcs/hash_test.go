@@ -0,0 +1,35 @@
+package funcs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+func TestHashFuncs(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       function.Function
+		expected string
+	}{
+		{name: "md5", fn: Md5Func, expected: "5d41402abc4b2a76b9719d911017c592"},
+		{name: "sha1", fn: Sha1Func, expected: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{name: "sha256", fn: Sha256Func, expected: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{
+			name:     "sha512",
+			fn:       Sha512Func,
+			expected: "9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.fn.Call([]cty.Value{cty.StringVal("hello")})
+			if assert.NoError(t, err) {
+				assert.Equal(t, cty.StringVal(tc.expected), got)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package funcs
+
+import (
+	"github.com/jmespath/go-jmespath"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+
+	"github.com/hiphops-io/hops/expression/ctyconv"
+)
+
+// JMESPathFunc is a cty.Function that queries a value (usually the event) with
+// a JMESPath expression, returning null if nothing matches
+var JMESPathFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name:      "value",
+			Type:      cty.DynamicPseudoType,
+			AllowNull: true,
+		},
+		{
+			Name: "query",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return JMESPath(args[0], args[1])
+	},
+})
+
+func JMESPath(value, query cty.Value) (cty.Value, error) {
+	q, err := jmespath.Compile(query.AsString())
+	if err != nil {
+		return cty.DynamicVal, function.NewArgError(1, err)
+	}
+
+	data, err := ctyconv.CtyValueToInterface(value)
+	if err != nil {
+		return cty.DynamicVal, function.NewArgError(0, err)
+	}
+
+	result, err := q.Search(data)
+	if err != nil {
+		return cty.DynamicVal, err
+	}
+
+	return ctyconv.InterfaceToCtyVal(result)
+}
@@ -0,0 +1,57 @@
+package funcs
+
+import (
+	"context"
+
+	"github.com/PaesslerAG/gval"
+	"github.com/PaesslerAG/jsonpath"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+
+	"github.com/hiphops-io/hops/expression/ctyconv"
+)
+
+// jsonPathLang is JSONPath with arithmetic and comparisons, for filters
+var jsonPathLang = gval.Full(jsonpath.Language())
+
+// JSONPathFunc is a cty.Function that queries a value (usually the event) with
+// a JSONPath expression such as "$.labels[*].name", returning null if nothing
+// matches
+var JSONPathFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name:      "value",
+			Type:      cty.DynamicPseudoType,
+			AllowNull: true,
+		},
+		{
+			Name: "path",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return JSONPath(args[0], args[1])
+	},
+})
+
+func JSONPath(value, path cty.Value) (cty.Value, error) {
+	p, err := jsonPathLang.NewEvaluable(path.AsString())
+	if err != nil {
+		return cty.DynamicVal, function.NewArgError(1, err)
+	}
+
+	data, err := ctyconv.CtyValueToInterface(value)
+	if err != nil {
+		return cty.DynamicVal, function.NewArgError(0, err)
+	}
+
+	// Paths only fail to evaluate when they select what isn't there, such as
+	// an unknown key or an index out of bounds
+	result, err := p(context.Background(), data)
+	if err != nil {
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	}
+
+	return ctyconv.InterfaceToCtyVal(result)
+}
@@ -0,0 +1,87 @@
+package funcs
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestJSONPath(t *testing.T) {
+	event := cty.ObjectVal(map[string]cty.Value{
+		"pull_request": cty.ObjectVal(map[string]cty.Value{
+			"labels": cty.TupleVal([]cty.Value{
+				cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("bug"), "id": cty.NumberIntVal(1)}),
+				cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("urgent"), "id": cty.NumberIntVal(2)}),
+			}),
+		}),
+	})
+
+	evalCtx := &hcl.EvalContext{
+		Functions: DefaultFunctions,
+		Variables: map[string]cty.Value{"event": event},
+	}
+
+	tests := []struct {
+		name        string
+		expr        string
+		expected    cty.Value
+		expectError bool
+	}{
+		{
+			name:     "Wildcard",
+			expr:     `jsonpath(event, "$.pull_request.labels[*].name")`,
+			expected: cty.TupleVal([]cty.Value{cty.StringVal("bug"), cty.StringVal("urgent")}),
+		},
+		{
+			name:     "Index",
+			expr:     `jsonpath(event, "$.pull_request.labels[1].name")`,
+			expected: cty.StringVal("urgent"),
+		},
+		{
+			name:     "Filter",
+			expr:     `jsonpath(event, "$.pull_request.labels[?(@.id > 1)].name")`,
+			expected: cty.TupleVal([]cty.Value{cty.StringVal("urgent")}),
+		},
+		{
+			name:     "Recursive descent",
+			expr:     `length(jsonpath(event, "$..id")) == 2`,
+			expected: cty.True,
+		},
+		{
+			name:     "No match",
+			expr:     `jsonpath(event, "$.issue.title")`,
+			expected: cty.NullVal(cty.DynamicPseudoType),
+		},
+		{
+			name:     "Index out of bounds",
+			expr:     `jsonpath(event, "$.pull_request.labels[5]")`,
+			expected: cty.NullVal(cty.DynamicPseudoType),
+		},
+		{
+			name:        "Invalid path",
+			expr:        `jsonpath(event, "$.pull_request[")`,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			expr, diags := hclsyntax.ParseExpression([]byte(tc.expr), "test", hcl.InitialPos)
+			require.False(t, diags.HasErrors(), diags.Error())
+
+			got, diags := expr.Value(evalCtx)
+			if tc.expectError {
+				assert.True(t, diags.HasErrors())
+				return
+			}
+
+			if assert.False(t, diags.HasErrors(), diags.Error()) {
+				assert.True(t, tc.expected.RawEquals(got), "Expected %#v, got %#v", tc.expected, got)
+			}
+		})
+	}
+}
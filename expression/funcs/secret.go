@@ -0,0 +1,97 @@
+package funcs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// ErrSecretNotFound is returned by secret providers for unknown secrets
+var ErrSecretNotFound = errors.New("secret not found")
+
+type (
+	// SecretProvider looks up secrets by name
+	//
+	// Errors must never include the value of a secret, as they may be logged
+	SecretProvider interface {
+		Secret(name string) (string, error)
+	}
+
+	// DirSecretProvider reads each secret from a file of the same name in a
+	// directory, as with docker and kubernetes secrets mounted as files
+	DirSecretProvider struct {
+		Dir string
+	}
+
+	// EnvSecretProvider reads each secret from an env var of the same name
+	// with a prefix, so secrets don't need to be in the env allow list
+	EnvSecretProvider struct {
+		Prefix string
+	}
+)
+
+// SecretFunc is a stateful cty function that returns a secret from the
+// given provider
+func SecretFunc(provider SecretProvider) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "name",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return Secret(provider, args[0])
+		},
+	})
+}
+
+func Secret(provider SecretProvider, name cty.Value) (cty.Value, error) {
+	if provider == nil {
+		return cty.StringVal(""), errors.New("no secrets provider is configured")
+	}
+
+	secret, err := provider.Secret(name.AsString())
+	if err != nil {
+		return cty.StringVal(""), err
+	}
+
+	return cty.StringVal(secret), nil
+}
+
+func (d DirSecretProvider) Secret(name string) (string, error) {
+	// Names are file names within the directory, never paths
+	if name == "" || strings.HasPrefix(name, ".") || filepath.Base(name) != name {
+		return "", fmt.Errorf("invalid secret name '%s'", name)
+	}
+
+	content, err := os.ReadFile(filepath.Join(d.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: '%s'", ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret '%s': %w", name, err)
+	}
+
+	// Files commonly end with a newline that isn't part of the secret
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func (e EnvSecretProvider) Secret(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("invalid secret name '%s'", name)
+	}
+
+	secret, ok := os.LookupEnv(e.Prefix + name)
+	if !ok {
+		return "", fmt.Errorf("%w: '%s'", ErrSecretNotFound, name)
+	}
+
+	return secret, nil
+}
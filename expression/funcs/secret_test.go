@@ -0,0 +1,88 @@
+package funcs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSecretProviders(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api_key"), []byte("dir-secret\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("hidden"), 0o600))
+	t.Setenv("TEST_SECRET_api_key", "env-secret")
+
+	tests := []struct {
+		name          string
+		provider      SecretProvider
+		secretName    string
+		expected      string
+		expectErr     bool
+		expectMissing bool
+	}{
+		{
+			name:       "Dir secret",
+			provider:   DirSecretProvider{Dir: dir},
+			secretName: "api_key",
+			expected:   "dir-secret",
+		},
+		{
+			name:          "Missing dir secret",
+			provider:      DirSecretProvider{Dir: dir},
+			secretName:    "nope",
+			expectErr:     true,
+			expectMissing: true,
+		},
+		{
+			name:       "Dir secret outside of dir",
+			provider:   DirSecretProvider{Dir: filepath.Join(dir, "sub")},
+			secretName: "../api_key",
+			expectErr:  true,
+		},
+		{
+			name:       "Hidden dir secret",
+			provider:   DirSecretProvider{Dir: dir},
+			secretName: ".hidden",
+			expectErr:  true,
+		},
+		{
+			name:       "Env secret",
+			provider:   EnvSecretProvider{Prefix: "TEST_SECRET_"},
+			secretName: "api_key",
+			expected:   "env-secret",
+		},
+		{
+			name:          "Missing env secret",
+			provider:      EnvSecretProvider{Prefix: "TEST_SECRET_"},
+			secretName:    "nope",
+			expectErr:     true,
+			expectMissing: true,
+		},
+		{
+			name:       "No provider",
+			secretName: "api_key",
+			expectErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SecretFunc(tc.provider).Call([]cty.Value{cty.StringVal(tc.secretName)})
+			if tc.expectErr {
+				assert.Error(t, err)
+				if tc.expectMissing {
+					assert.ErrorIs(t, err, ErrSecretNotFound)
+				}
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, cty.StringVal(tc.expected), got)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package funcs
+
+import (
+	"github.com/Masterminds/semver/v3"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// SemverCmpFunc is a cty.Function that compares two semantic versions,
+// returning -1 if the first is lower than the second, 0 if they're equal or 1
+// if it's higher
+var SemverCmpFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "version_a",
+			Type: cty.String,
+		},
+		{
+			Name: "version_b",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return SemverCmp(args[0], args[1])
+	},
+})
+
+func SemverCmp(versionA, versionB cty.Value) (cty.Value, error) {
+	a, err := semver.NewVersion(versionA.AsString())
+	if err != nil {
+		return cty.UnknownVal(cty.Number), function.NewArgError(0, err)
+	}
+
+	b, err := semver.NewVersion(versionB.AsString())
+	if err != nil {
+		return cty.UnknownVal(cty.Number), function.NewArgError(1, err)
+	}
+
+	return cty.NumberIntVal(int64(a.Compare(b))), nil
+}
+
+// SemverConstraintFunc is a cty.Function that returns true if a semantic
+// version is in a range such as ">= 1.2.0, < 2.0.0", "^1.2", "~1.4" or "1.x".
+// Ranges joined with || are met if any one of them is. Pre-releases only meet
+// ranges that include a pre-release of the same version
+
+var SemverConstraintFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "version",
+			Type: cty.String,
+		},
+		{
+			Name: "constraint",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return SemverConstraint(args[0], args[1])
+	},
+})
+
+func SemverConstraint(ver, constraint cty.Value) (cty.Value, error) {
+	v, err := semver.NewVersion(ver.AsString())
+	if err != nil {
+		return cty.UnknownVal(cty.Bool), function.NewArgError(0, err)
+	}
+
+	c, err := semver.NewConstraint(constraint.AsString())
+	if err != nil {
+		return cty.UnknownVal(cty.Bool), function.NewArgError(1, err)
+	}
+
+	return cty.BoolVal(c.Check(v)), nil
+}
@@ -0,0 +1,72 @@
+package funcs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSemverCmp(t *testing.T) {
+	tests := []struct {
+		a           string
+		b           string
+		expected    int64
+		expectError bool
+	}{
+		{a: "1.2.3", b: "1.10.0", expected: -1},
+		{a: "v2.0.0", b: "2.0.0", expected: 0},
+		{a: "2.0.0", b: "2.0.0-rc.1", expected: 1},
+		{a: "not.a.version", b: "1.0.0", expectError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			got, err := SemverCmp(cty.StringVal(tc.a), cty.StringVal(tc.b))
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, cty.NumberIntVal(tc.expected), got)
+			}
+		})
+	}
+}
+
+func TestSemverConstraint(t *testing.T) {
+	tests := []struct {
+		version     string
+		constraint  string
+		expected    cty.Value
+		expectError bool
+	}{
+		{version: "1.4.2", constraint: ">= 1.2.0, < 2.0.0", expected: cty.True},
+		{version: "2.0.0", constraint: ">= 1.2.0, < 2.0.0", expected: cty.False},
+		{version: "1.9.0", constraint: "^1.2", expected: cty.True},
+		{version: "2.0.0", constraint: "^1.2", expected: cty.False},
+		{version: "1.4.9", constraint: "~1.4", expected: cty.True},
+		{version: "1.5.0", constraint: "~1.4", expected: cty.False},
+		{version: "1.7.3", constraint: "1.x", expected: cty.True},
+		{version: "v3.1.0", constraint: "^1.2 || ^3.0", expected: cty.True},
+		{version: "1.3.0-beta.1", constraint: "^1.2", expected: cty.False},
+		{version: "1.3.0-beta.1", constraint: ">= 1.3.0-0", expected: cty.True},
+		{version: "1.0.0", constraint: "about 1", expectError: true},
+		{version: "latest", constraint: ">= 1.0.0", expectError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.version+" "+tc.constraint, func(t *testing.T) {
+			got, err := SemverConstraint(cty.StringVal(tc.version), cty.StringVal(tc.constraint))
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package funcs
+
+import (
+	"fmt"
+	"time"
+	// Embed the timezone database, so timezones work without system tzdata
+	_ "time/tzdata"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// TimestampFunc is a cty.Function that returns the current time as an RFC3339
+// timestamp in UTC
+var TimestampFunc = function.New(&function.Spec{
+	Params: []function.Parameter{},
+	Type:   function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return Timestamp(time.Now()), nil
+	},
+})
+
+func Timestamp(now time.Time) cty.Value {
+	return cty.StringVal(now.UTC().Format(time.RFC3339))
+}
+
+// ParseDurationFunc is a cty.Function that parses a duration such as "1h30m"
+// into a number of seconds
+var ParseDurationFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "duration",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return ParseDuration(args[0])
+	},
+})
+
+func ParseDuration(duration cty.Value) (cty.Value, error) {
+	d, err := time.ParseDuration(duration.AsString())
+	if err != nil {
+		return cty.UnknownVal(cty.Number), function.NewArgError(0, err)
+	}
+
+	return cty.NumberFloatVal(d.Seconds()), nil
+}
+
+// TimeCmpFunc is a cty.Function that compares two RFC3339 timestamps, returning
+// -1 if the first is before the second, 0 if they're equal or 1 if it's after
+var TimeCmpFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "timestamp_a",
+			Type: cty.String,
+		},
+		{
+			Name: "timestamp_b",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return TimeCmp(args[0], args[1])
+	},
+})
+
+func TimeCmp(timestampA, timestampB cty.Value) (cty.Value, error) {
+	a, err := time.Parse(time.RFC3339, timestampA.AsString())
+	if err != nil {
+		return cty.UnknownVal(cty.Number), function.NewArgError(0, err)
+	}
+
+	b, err := time.Parse(time.RFC3339, timestampB.AsString())
+	if err != nil {
+		return cty.UnknownVal(cty.Number), function.NewArgError(1, err)
+	}
+
+	return cty.NumberIntVal(int64(a.Compare(b))), nil
+}
+
+// WeekdayFunc is a cty.Function that returns the day of the week of an RFC3339
+// timestamp in the given timezone, such as "Monday"
+var WeekdayFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "timestamp",
+			Type: cty.String,
+		},
+		{
+			Name: "timezone",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return Weekday(args[0], args[1])
+	},
+})
+
+func Weekday(timestamp, timezone cty.Value) (cty.Value, error) {
+	t, err := localTime(timestamp, timezone)
+	if err != nil {
+		return cty.UnknownVal(cty.String), err
+	}
+
+	return cty.StringVal(t.Weekday().String()), nil
+}
+
+// BusinessHoursFunc is a cty.Function that returns true if an RFC3339 timestamp
+// falls on a weekday between the start and end times (given as "15:04") in the
+// given timezone. The end time is exclusive.
+var BusinessHoursFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "timestamp",
+			Type: cty.String,
+		},
+		{
+			Name: "timezone",
+			Type: cty.String,
+		},
+		{
+			Name: "start",
+			Type: cty.String,
+		},
+		{
+			Name: "end",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return BusinessHours(args[0], args[1], args[2], args[3])
+	},
+})
+
+func BusinessHours(timestamp, timezone, start, end cty.Value) (cty.Value, error) {
+	t, err := localTime(timestamp, timezone)
+	if err != nil {
+		return cty.UnknownVal(cty.Bool), err
+	}
+
+	startTime, err := time.Parse("15:04", start.AsString())
+	if err != nil {
+		return cty.UnknownVal(cty.Bool), function.NewArgErrorf(2, "start must be a time such as 09:00")
+	}
+
+	endTime, err := time.Parse("15:04", end.AsString())
+	if err != nil {
+		return cty.UnknownVal(cty.Bool), function.NewArgErrorf(3, "end must be a time such as 17:30")
+	}
+
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return cty.False, nil
+	}
+
+	minutes := t.Hour()*60 + t.Minute()
+	startMinutes := startTime.Hour()*60 + startTime.Minute()
+	endMinutes := endTime.Hour()*60 + endTime.Minute()
+
+	return cty.BoolVal(minutes >= startMinutes && minutes < endMinutes), nil
+}
+
+// localTime parses an RFC3339 timestamp, converting it to the given timezone
+func localTime(timestamp, timezone cty.Value) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, timestamp.AsString())
+	if err != nil {
+		return time.Time{}, function.NewArgError(0, err)
+	}
+
+	loc, err := time.LoadLocation(timezone.AsString())
+	if err != nil {
+		return time.Time{}, function.NewArgError(1, fmt.Errorf("unknown timezone: %w", err))
+	}
+
+	return t.In(loc), nil
+}
@@ -0,0 +1,181 @@
+package funcs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestTimestamp(t *testing.T) {
+	now := time.Date(2024, 2, 29, 13, 30, 0, 0, time.FixedZone("CET", 3600))
+	assert.Equal(t, cty.StringVal("2024-02-29T12:30:00Z"), Timestamp(now))
+
+	val, err := TimestampFunc.Call([]cty.Value{})
+	if assert.NoError(t, err) {
+		_, err := time.Parse(time.RFC3339, val.AsString())
+		assert.NoError(t, err, "timestamp() should return an RFC3339 timestamp")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		duration    string
+		expected    cty.Value
+		expectError bool
+	}{
+		{duration: "90s", expected: cty.NumberFloatVal(90)},
+		{duration: "1h30m", expected: cty.NumberFloatVal(5400)},
+		{duration: "1.5s", expected: cty.NumberFloatVal(1.5)},
+		{duration: "-2m", expected: cty.NumberFloatVal(-120)},
+		{duration: "3 days", expectError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.duration, func(t *testing.T) {
+			got, err := ParseDuration(cty.StringVal(tc.duration))
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.True(t, tc.expected.Equals(got).True(), "Expected %#v, got %#v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestTimeCmp(t *testing.T) {
+	tests := []struct {
+		name        string
+		a           string
+		b           string
+		expected    int64
+		expectError bool
+	}{
+		{name: "Before", a: "2024-01-01T00:00:00Z", b: "2024-01-02T00:00:00Z", expected: -1},
+		{name: "Equal across timezones", a: "2024-01-01T01:00:00+01:00", b: "2024-01-01T00:00:00Z", expected: 0},
+		{name: "After", a: "2024-01-02T00:00:00Z", b: "2024-01-01T00:00:00Z", expected: 1},
+		{name: "Invalid first timestamp", a: "yesterday", b: "2024-01-01T00:00:00Z", expectError: true},
+		{name: "Invalid second timestamp", a: "2024-01-01T00:00:00Z", b: "2024-01-01", expectError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := TimeCmp(cty.StringVal(tc.a), cty.StringVal(tc.b))
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, cty.NumberIntVal(tc.expected), got)
+			}
+		})
+	}
+}
+
+func TestWeekday(t *testing.T) {
+	got, err := Weekday(cty.StringVal("2024-03-03T23:30:00Z"), cty.StringVal("UTC"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, cty.StringVal("Sunday"), got)
+	}
+
+	got, err = Weekday(cty.StringVal("2024-03-03T23:30:00Z"), cty.StringVal("Europe/Berlin"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, cty.StringVal("Monday"), got, "Weekday should be in the given timezone")
+	}
+
+	_, err = Weekday(cty.StringVal("2024-03-03T23:30:00Z"), cty.StringVal("Mars/Olympus_Mons"))
+	assert.Error(t, err, "Unknown timezones should error")
+}
+
+func TestBusinessHours(t *testing.T) {
+	tests := []struct {
+		name        string
+		timestamp   string
+		timezone    string
+		start       string
+		end         string
+		expected    cty.Value
+		expectError bool
+	}{
+		{
+			name:      "Within hours",
+			timestamp: "2024-03-04T10:00:00Z",
+			timezone:  "UTC",
+			start:     "09:00",
+			end:       "17:30",
+			expected:  cty.True,
+		},
+		{
+			name:      "At start",
+			timestamp: "2024-03-04T09:00:00Z",
+			timezone:  "UTC",
+			start:     "09:00",
+			end:       "17:30",
+			expected:  cty.True,
+		},
+		{
+			name:      "At end",
+			timestamp: "2024-03-04T17:30:00Z",
+			timezone:  "UTC",
+			start:     "09:00",
+			end:       "17:30",
+			expected:  cty.False,
+		},
+		{
+			name:      "Within hours in another timezone",
+			timestamp: "2024-03-04T16:00:00Z",
+			timezone:  "America/New_York",
+			start:     "09:00",
+			end:       "17:00",
+			expected:  cty.True,
+		},
+		{
+			name:      "Outside hours in another timezone",
+			timestamp: "2024-03-04T10:00:00Z",
+			timezone:  "America/New_York",
+			start:     "09:00",
+			end:       "17:00",
+			expected:  cty.False,
+		},
+		{
+			name:      "Weekend",
+			timestamp: "2024-03-02T10:00:00Z",
+			timezone:  "UTC",
+			start:     "09:00",
+			end:       "17:00",
+			expected:  cty.False,
+		},
+		{
+			name:        "Invalid start",
+			timestamp:   "2024-03-04T10:00:00Z",
+			timezone:    "UTC",
+			start:       "9am",
+			end:         "17:00",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := BusinessHours(
+				cty.StringVal(tc.timestamp),
+				cty.StringVal(tc.timezone),
+				cty.StringVal(tc.start),
+				cty.StringVal(tc.end),
+			)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expected, got)
+			}
+		})
+	}
+}
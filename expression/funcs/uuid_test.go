@@ -0,0 +1,27 @@
+package funcs
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestUUID(t *testing.T) {
+	first, err := UUIDFunc.Call([]cty.Value{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	second, err := UUIDFunc.Call([]cty.Value{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	parsed, err := uuid.Parse(first.AsString())
+	if assert.NoError(t, err) {
+		assert.Equal(t, uuid.Version(4), parsed.Version())
+	}
+	assert.NotEqual(t, first, second, "Each call should return a new UUID")
+}
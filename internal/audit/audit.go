@@ -0,0 +1,180 @@
+// Package audit keeps an append only trail of the decisions hops makes about
+// events, published to the audit stream
+//
+// Records have a stable JSON schema, versioned by SchemaVersion. Fields may
+// be added to records without changing the version, but are never renamed,
+// removed or given a new meaning
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/hiphops-io/hops/nats"
+)
+
+// SchemaVersion is the version of the record schema, which is only changed if
+// records change in a way that isn't backwards compatible
+const SchemaVersion = 1
+
+// Types of record, one for each decision made when handling an event
+const (
+	// TypeEventReceived is recorded for every event the runner handles
+	TypeEventReceived = "event_received"
+	// TypeFlowEvaluated is recorded for each flow triggered by an event, with
+	// whether it matched the flow's conditions
+	TypeFlowEvaluated = "flow_evaluated"
+	// TypeCommandRequested is recorded when a user asks for a command's form
+	TypeCommandRequested = "command_requested"
+	// TypeCommandSubmitted is recorded when a user submits a command to run it,
+	// including approval decisions
+	TypeCommandSubmitted = "command_submitted"
+	// TypeFlowDispatched is recorded when a flow is sent to its worker, or
+	// approval is requested for it
+	TypeFlowDispatched = "flow_dispatched"
+	// TypeFlowResult is recorded when a worker reports the result of a flow
+	TypeFlowResult = "flow_result"
+)
+
+// Types are the types of record, in the order they're recorded for an event
+var Types = []string{
+	TypeEventReceived,
+	TypeFlowEvaluated,
+	TypeCommandRequested,
+	TypeCommandSubmitted,
+	TypeFlowDispatched,
+	TypeFlowResult,
+}
+
+// Outcomes of decisions
+const (
+	// OutcomeMatched is a flow or command whose conditions were met
+	OutcomeMatched = "matched"
+	// OutcomeIfFalse is a flow or command whose 'if' was false
+	OutcomeIfFalse = "if_false"
+	// OutcomeIfError is a flow or command whose 'if' couldn't be evaluated
+	OutcomeIfError = "if_error"
+	// OutcomeNotFound is a command that doesn't exist
+	OutcomeNotFound = "not_found"
+	// OutcomeDenied is a command the user's roles don't allow them to run
+	OutcomeDenied = "denied"
+	// OutcomeApproved and OutcomeRejected are approval decisions
+	OutcomeApproved = "approved"
+	OutcomeRejected = "rejected"
+	// OutcomeDispatched is a flow sent to its worker
+	OutcomeDispatched = "dispatched"
+	// OutcomeApprovalRequested is a flow waiting for approval to be dispatched
+	OutcomeApprovalRequested = "approval_requested"
+	// OutcomeSucceeded and OutcomeFailed are the results of flows
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+	// OutcomeError is a decision that couldn't be carried out, such as a flow
+	// that couldn't be dispatched
+	OutcomeError = "error"
+)
+
+var publishErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "hops_audit_publish_errors_total",
+	Help: "Audit records that couldn't be published to the audit stream",
+})
+
+type (
+	// Record is a decision made about an event
+	Record struct {
+		Version int       `json:"version"`
+		Type    string    `json:"type"`
+		Time    time.Time `json:"time"`
+		// SequenceID is the sequence of the event the decision was about
+		SequenceID string `json:"sequence_id"`
+		Source     string `json:"source,omitempty"`
+		Event      string `json:"event,omitempty"`
+		Action     string `json:"action,omitempty"`
+		Flow       string `json:"flow,omitempty"`
+		Worker     string `json:"worker,omitempty"`
+		Outcome    string `json:"outcome,omitempty"`
+		// User is who requested or submitted a command, as identified by the
+		// source of the command
+		User  string `json:"user,omitempty"`
+		Error string `json:"error,omitempty"`
+		// StreamSequence is the record's position in the audit stream, set when
+		// records are queried
+		StreamSequence uint64 `json:"stream_sequence,omitempty"`
+	}
+
+	// Log publishes records to the audit stream and queries them
+	//
+	// Failing to publish a record doesn't fail handling the event, so errors
+	// are given to the error handler instead
+	Log struct {
+		js      jetstream.JetStream
+		maxScan uint64
+		now     func() time.Time
+		onError func(error)
+	}
+
+	LogOpt func(*Log)
+)
+
+func NewLog(js jetstream.JetStream, opts ...LogOpt) *Log {
+	l := &Log{
+		js:      js,
+		maxScan: MaxScan,
+		now:     time.Now,
+		onError: func(error) {},
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// WithErrorHandlerOpt handles errors publishing records, such as to log them
+func WithErrorHandlerOpt(fn func(error)) LogOpt {
+	return func(l *Log) {
+		l.onError = fn
+	}
+}
+
+// Record publishes a record, setting its version and time
+//
+// A nil log records nothing, so auditing can be disabled
+func (l *Log) Record(ctx context.Context, rec Record) {
+	if l == nil {
+		return
+	}
+
+	rec.Version = SchemaVersion
+	rec.StreamSequence = 0
+	if rec.Time.IsZero() {
+		rec.Time = l.now().UTC()
+	}
+
+	data, err := json.Marshal(rec)
+	if err == nil {
+		_, err = l.js.Publish(ctx, nats.AuditSubject(rec.SequenceID, rec.Type), data)
+	}
+
+	if err != nil {
+		publishErrors.Inc()
+		l.onError(err)
+	}
+}
+
+// NewRecord is a record of the given type about an event, to which the
+// decision should be added
+func NewRecord(recordType string, hopsMsg *nats.HopsMsg) Record {
+	return Record{
+		Type:       recordType,
+		SequenceID: hopsMsg.SequenceId,
+		Source:     hopsMsg.Source,
+		Event:      hopsMsg.Event,
+		Action:     hopsMsg.Action,
+	}
+}
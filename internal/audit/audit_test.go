@@ -0,0 +1,240 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/logs"
+	"github.com/hiphops-io/hops/nats"
+)
+
+func TestLogQuery(t *testing.T) {
+	ctx := context.Background()
+	log := setupLog(t)
+
+	start := time.Now().UTC()
+	now := start
+	log.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	pr := &nats.HopsMsg{SequenceId: "seq-1", Source: "github", Event: "pull_request", Action: "closed"}
+	cmd := &nats.HopsMsg{SequenceId: "seq-2", Source: "slack", Event: "command", Action: "deploy"}
+
+	log.Record(ctx, NewRecord(TypeEventReceived, pr))
+	matched := NewRecord(TypeFlowEvaluated, pr)
+	matched.Flow, matched.Outcome = "review.merged", OutcomeMatched
+	log.Record(ctx, matched)
+	ifErr := NewRecord(TypeFlowEvaluated, pr)
+	ifErr.Flow, ifErr.Outcome, ifErr.Error = "review.labelled", OutcomeIfError, "unknown key"
+	log.Record(ctx, ifErr)
+	log.Record(ctx, NewRecord(TypeEventReceived, cmd))
+	submitted := NewRecord(TypeCommandSubmitted, cmd)
+	submitted.Flow, submitted.Outcome, submitted.User = "deploy", OutcomeMatched, "U012AB3CD"
+	log.Record(ctx, submitted)
+
+	type testCase struct {
+		name          string
+		filter        Filter
+		expectedTypes []string
+		expectedFlows []string
+	}
+
+	tests := []testCase{
+		{
+			name:          "All, newest first",
+			expectedTypes: []string{TypeCommandSubmitted, TypeEventReceived, TypeFlowEvaluated, TypeFlowEvaluated, TypeEventReceived},
+		},
+		{
+			name:          "By sequence",
+			filter:        Filter{SequenceID: "seq-1"},
+			expectedTypes: []string{TypeFlowEvaluated, TypeFlowEvaluated, TypeEventReceived},
+		},
+		{
+			name:          "By type",
+			filter:        Filter{Type: TypeFlowEvaluated},
+			expectedTypes: []string{TypeFlowEvaluated, TypeFlowEvaluated},
+			expectedFlows: []string{"review.labelled", "review.merged"},
+		},
+		{
+			name:          "By outcome",
+			filter:        Filter{Outcome: OutcomeIfError},
+			expectedTypes: []string{TypeFlowEvaluated},
+			expectedFlows: []string{"review.labelled"},
+		},
+		{
+			name:          "By user",
+			filter:        Filter{User: "U012AB3CD"},
+			expectedTypes: []string{TypeCommandSubmitted},
+		},
+		{
+			name:          "By source and time",
+			filter:        Filter{Source: "github", Until: start.Add(2 * time.Minute)},
+			expectedTypes: []string{TypeFlowEvaluated, TypeEventReceived},
+		},
+		{
+			name:          "Limited to most recent",
+			filter:        Filter{Limit: 2},
+			expectedTypes: []string{TypeCommandSubmitted, TypeEventReceived},
+		},
+		{
+			name:   "No matches",
+			filter: Filter{SequenceID: "seq-3"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			records, err := log.Query(ctx, tc.filter)
+			require.NoError(t, err)
+
+			types, flows := []string{}, []string{}
+			for _, rec := range records {
+				types = append(types, rec.Type)
+				if rec.Flow != "" {
+					flows = append(flows, rec.Flow)
+				}
+				assert.Equal(t, SchemaVersion, rec.Version)
+				assert.NotZero(t, rec.StreamSequence)
+			}
+
+			assert.Equal(t, append([]string{}, tc.expectedTypes...), types)
+			if tc.expectedFlows != nil {
+				assert.Equal(t, tc.expectedFlows, flows)
+			}
+		})
+	}
+
+	records, err := log.Query(ctx, Filter{Outcome: OutcomeIfError})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, Record{
+		Version:        SchemaVersion,
+		Type:           TypeFlowEvaluated,
+		Time:           start.Add(3 * time.Minute),
+		SequenceID:     "seq-1",
+		Source:         "github",
+		Event:          "pull_request",
+		Action:         "closed",
+		Flow:           "review.labelled",
+		Outcome:        OutcomeIfError,
+		Error:          "unknown key",
+		StreamSequence: 3,
+	}, records[0])
+}
+
+func TestLogQueryBounds(t *testing.T) {
+	ctx := context.Background()
+	log := setupLog(t)
+
+	now := time.Now().UTC()
+	log.now = func() time.Time { return now }
+
+	old := Record{Type: TypeEventReceived, SequenceID: "seq-1", Time: now.Add(-2 * DefaultWindow)}
+	log.Record(ctx, old)
+	for range 3 {
+		log.Record(ctx, Record{Type: TypeEventReceived, SequenceID: "seq-2"})
+	}
+
+	type testCase struct {
+		name              string
+		filter            Filter
+		maxScan           uint64
+		expectedSequences []string
+	}
+
+	tests := []testCase{
+		{
+			name:              "Recent by default",
+			expectedSequences: []string{"seq-2", "seq-2", "seq-2"},
+		},
+		{
+			name:              "Since",
+			filter:            Filter{Since: old.Time},
+			expectedSequences: []string{"seq-2", "seq-2", "seq-2", "seq-1"},
+		},
+		{
+			name:              "Whole sequence",
+			filter:            Filter{SequenceID: "seq-1"},
+			expectedSequences: []string{"seq-1"},
+		},
+		{
+			name:              "Scan capped to most recent",
+			filter:            Filter{Since: old.Time},
+			maxScan:           2,
+			expectedSequences: []string{"seq-2", "seq-2"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			log.maxScan = MaxScan
+			if tc.maxScan != 0 {
+				log.maxScan = tc.maxScan
+			}
+
+			records, err := log.Query(ctx, tc.filter)
+			require.NoError(t, err)
+
+			sequences := []string{}
+			for _, rec := range records {
+				sequences = append(sequences, rec.SequenceID)
+			}
+			assert.Equal(t, tc.expectedSequences, sequences)
+		})
+	}
+}
+
+func TestLogAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	log := setupLog(t)
+
+	log.Record(ctx, Record{Type: TypeEventReceived, SequenceID: "seq-1"})
+
+	stream, err := log.js.Stream(ctx, nats.ChannelAudit)
+	require.NoError(t, err)
+	assert.Error(t, stream.DeleteMsg(ctx, 1), "Records shouldn't be deletable")
+	assert.Error(t, stream.Purge(ctx), "Records shouldn't be purgeable")
+}
+
+func TestLogErrors(t *testing.T) {
+	ctx := context.Background()
+	log := setupLog(t)
+
+	var publishErr error
+	WithErrorHandlerOpt(func(err error) { publishErr = err })(log)
+
+	log.Record(ctx, Record{Type: TypeEventReceived})
+	assert.Error(t, publishErr, "Records without a sequence should fail to publish")
+
+	var disabled *Log
+	disabled.Record(ctx, Record{Type: TypeEventReceived, SequenceID: "seq-1"})
+
+	_, err := log.Query(ctx, Filter{Type: "unknown"})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+	_, err = log.Query(ctx, Filter{SequenceID: "seq.>"})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+	_, err = log.Query(ctx, Filter{Limit: MaxLimit + 1})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
+
+// setupLog is a test helper to create an audit log on a local NATS server
+func setupLog(t *testing.T) *Log {
+	logger := logs.NoOpLogger()
+	natsLogger := logs.NewNatsZeroLogger(logger)
+
+	natsServer, err := nats.NewNatsServer("./testdata/embedded-nats.conf", false, &natsLogger, nats.WithDataDirOpt(t.TempDir()))
+	require.NoError(t, err, "Test setup: Embedded NATS server should start without errors")
+	t.Cleanup(natsServer.Close)
+
+	client, err := nats.NewClient(natsServer.URL(), "")
+	require.NoError(t, err, "Test setup: NATS client should connect without errors")
+	t.Cleanup(func() { client.Close() })
+
+	return NewLog(client.JetStream)
+}
@@ -0,0 +1,229 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/hiphops-io/hops/nats"
+)
+
+const (
+	// DefaultLimit is how many records are returned if no limit is given
+	DefaultLimit = 100
+	// MaxLimit is the most records returned by a query
+	MaxLimit = 1000
+	// DefaultWindow is how far back records are queried if since isn't set
+	DefaultWindow = 24 * time.Hour
+	// MaxScan is the most records a query reads, where only the most recent
+	// are read if there are more in its time range
+	MaxScan = 100_000
+
+	queryBatchSize = 256
+	queryFetchWait = 2 * time.Second
+	// untilSlack is how long after a record's time it may be stored, as
+	// records published at the same time can be stored in either order
+	untilSlack = time.Minute
+)
+
+var ErrInvalidFilter = errors.New("invalid audit filter")
+
+// Filter selects records, where empty fields match any record
+type Filter struct {
+	SequenceID string
+	Type       string
+	Source     string
+	Event      string
+	Action     string
+	Flow       string
+	Outcome    string
+	User       string
+	// Since and Until limit records to those recorded within a time range,
+	// where since defaults to DefaultWindow before until
+	Since time.Time
+	Until time.Time
+	// Limit is how many of the most recent matching records are returned,
+	// defaulting to DefaultLimit
+	Limit int
+}
+
+// Validate errors if the filter can't be queried
+func (f Filter) Validate() error {
+	if f.Type != "" && !slices.Contains(Types, f.Type) {
+		return fmt.Errorf("%w: unknown type '%s', must be one of %s", ErrInvalidFilter, f.Type, strings.Join(Types, ", "))
+	}
+
+	if strings.ContainsAny(f.SequenceID, ".*> \t") {
+		return fmt.Errorf("%w: invalid sequence ID '%s'", ErrInvalidFilter, f.SequenceID)
+	}
+
+	if f.Limit < 0 || f.Limit > MaxLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidFilter, MaxLimit)
+	}
+
+	if !f.Since.IsZero() && !f.Until.IsZero() && f.Until.Before(f.Since) {
+		return fmt.Errorf("%w: until must be after since", ErrInvalidFilter)
+	}
+
+	return nil
+}
+
+// Matches is true if the record is selected by the filter
+func (f Filter) Matches(rec Record) bool {
+	fields := []struct{ want, got string }{
+		{f.SequenceID, rec.SequenceID},
+		{f.Type, rec.Type},
+		{f.Source, rec.Source},
+		{f.Event, rec.Event},
+		{f.Action, rec.Action},
+		{f.Flow, rec.Flow},
+		{f.Outcome, rec.Outcome},
+		{f.User, rec.User},
+	}
+	for _, field := range fields {
+		if field.want != "" && field.want != field.got {
+			return false
+		}
+	}
+
+	if !f.Since.IsZero() && rec.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && rec.Time.After(f.Until) {
+		return false
+	}
+
+	return true
+}
+
+// Query returns the most recent records matching filter, newest first
+//
+// Sequence and type are filtered by subject, and records are read from since.
+// If since isn't set, only records from DefaultWindow before until (or now)
+// are read, unless the query is for a single sequence. At most MaxScan of the
+// most recent records in the range are read, so older records in busy ranges
+// can be missed
+func (l *Log) Query(ctx context.Context, filter Filter) ([]Record, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	if filter.Since.IsZero() && filter.SequenceID == "" {
+		end := filter.Until
+		if end.IsZero() {
+			end = l.now()
+		}
+		filter.Since = end.Add(-DefaultWindow)
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+
+	stream, err := l.js.Stream(ctx, nats.ChannelAudit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get audit stream: %w", err)
+	}
+
+	cfg := jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{nats.AuditFilterSubject(filter.SequenceID, filter.Type)},
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+	}
+	if !filter.Since.IsZero() {
+		cfg.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+		cfg.OptStartTime = &filter.Since
+	}
+
+	// Records published while querying aren't read, so busy streams are finite
+	lastSeq := stream.CachedInfo().State.LastSeq
+
+	consumer, err := stream.OrderedConsumer(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read audit stream: %w", err)
+	}
+
+	info, err := consumer.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read audit stream: %w", err)
+	}
+
+	// Too many records in range, so read from the most recent that can be read
+	if info.NumPending > l.maxScan && lastSeq > l.maxScan {
+		cfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		cfg.OptStartTime = nil
+		cfg.OptStartSeq = lastSeq - l.maxScan + 1
+
+		consumer, err = stream.OrderedConsumer(ctx, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read audit stream: %w", err)
+		}
+
+		info, err = consumer.Info(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read audit stream: %w", err)
+		}
+	}
+
+	records := []Record{}
+	pending := info.NumPending
+	for pending > 0 {
+		batch, err := consumer.Fetch(int(min(pending, queryBatchSize)), jetstream.FetchMaxWait(queryFetchWait))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read audit stream: %w", err)
+		}
+
+		received := 0
+		for msg := range batch.Messages() {
+			received++
+
+			meta, err := msg.Metadata()
+			if err != nil {
+				return nil, fmt.Errorf("unable to read audit record: %w", err)
+			}
+			pending = meta.NumPending
+			if meta.Sequence.Stream > lastSeq {
+				pending = 0
+				break
+			}
+
+			// Records are stored in about the order they're made, so none stored
+			// well after until match
+			if !filter.Until.IsZero() && meta.Timestamp.After(filter.Until.Add(untilSlack)) {
+				pending = 0
+				break
+			}
+
+			rec := Record{}
+			if err := json.Unmarshal(msg.Data(), &rec); err != nil {
+				return nil, fmt.Errorf("unable to parse audit record %d: %w", meta.Sequence.Stream, err)
+			}
+			rec.StreamSequence = meta.Sequence.Stream
+
+			if !filter.Matches(rec) {
+				continue
+			}
+
+			records = append(records, rec)
+			if len(records) > limit {
+				records = records[1:]
+			}
+		}
+		if err := batch.Error(); err != nil {
+			return nil, fmt.Errorf("unable to read audit stream: %w", err)
+		}
+
+		if received == 0 {
+			break
+		}
+	}
+
+	slices.Reverse(records)
+	return records, nil
+}
@@ -0,0 +1,79 @@
+// Package auth authenticates requests to the hops API and authorizes what
+// they may do
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrUnauthenticated is returned when a token isn't valid for any
+	// authenticator
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrUnrecognised is returned by an authenticator for tokens it doesn't
+	// issue, so the next authenticator can be tried
+	ErrUnrecognised = errors.New("unrecognised token")
+)
+
+type (
+	// Principal is who a request was made by
+	Principal struct {
+		Subject string   `json:"subject"`
+		Groups  []string `json:"groups,omitempty"`
+		// Method is how the principal was authenticated
+		Method string `json:"method"`
+	}
+
+	// Authenticator finds the principal a bearer token belongs to
+	Authenticator interface {
+		// Authenticate returns ErrUnrecognised if the token isn't one the
+		// authenticator handles, or another error if it is but isn't valid
+		Authenticate(ctx context.Context, token string) (Principal, error)
+	}
+
+	// Chain tries each of its authenticators in turn
+	Chain []Authenticator
+
+	principalKey struct{}
+)
+
+func (c Chain) Authenticate(ctx context.Context, token string) (Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(ctx, token)
+		if errors.Is(err, ErrUnrecognised) {
+			continue
+		}
+		if err != nil {
+			return Principal{}, errors.Join(ErrUnauthenticated, err)
+		}
+
+		return p, nil
+	}
+
+	return Principal{}, ErrUnauthenticated
+}
+
+// BearerToken returns the token of an Authorization header, empty if it
+// doesn't have one
+func BearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// WithPrincipal returns a context carrying the principal a request was made by
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal a request was made by, false if
+// the request wasn't authenticated
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,382 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+)
+
+// MethodOIDC is the method of principals authenticated by an OIDC token
+const MethodOIDC = "oidc"
+
+const (
+	// clockLeeway allows for clock drift when checking token times
+	clockLeeway = time.Minute
+	// jwksRefreshInterval limits how often keys are reloaded when a token is
+	// signed by an unknown key, such as after the provider rotates its keys
+	jwksRefreshInterval = time.Minute
+	// maxFetchBytes is the largest discovery document or key set read from
+	// a provider
+	maxFetchBytes = 1 << 20
+)
+
+var (
+	// signatureAlgorithms are the asymmetric algorithms used by OIDC
+	// providers, where symmetric algorithms are never accepted
+	signatureAlgorithms = []jose.SignatureAlgorithm{
+		jose.RS256, jose.RS384, jose.RS512,
+		jose.PS256, jose.PS384, jose.PS512,
+		jose.ES256, jose.ES384, jose.ES512,
+		jose.EdDSA,
+	}
+
+	// ecdsaCurves are the curves each ECDSA algorithm must be used with
+	ecdsaCurves = map[string]elliptic.Curve{
+		string(jose.ES256): elliptic.P256(),
+		string(jose.ES384): elliptic.P384(),
+		string(jose.ES512): elliptic.P521(),
+	}
+)
+
+type (
+	// OIDCConfig configures the validation of JWT bearer tokens issued by an
+	// OIDC provider
+	OIDCConfig struct {
+		// Issuer must match the iss claim of tokens, and is used to discover
+		// the provider's keys if JWKSURL and JWKSFile aren't set
+		Issuer string
+		// Audience must be one of the aud claims of tokens, so tokens the
+		// provider issued to other clients aren't accepted
+		Audience string
+		// JWKSURL is where the provider's signing keys are fetched from
+		JWKSURL string
+		// JWKSFile reads the signing keys from a local file instead
+		JWKSFile string
+		// SubjectClaim is the claim principals are named by, sub by default
+		SubjectClaim string
+		// GroupsClaim is the claim listing a principal's groups, groups by
+		// default
+		GroupsClaim string
+	}
+
+	// OIDC authenticates JWT bearer tokens signed by the keys of an OIDC
+	// provider
+	OIDC struct {
+		client   *http.Client
+		config   OIDCConfig
+		jwksURL  string
+		keys     map[string]jose.JSONWebKey
+		loadedAt time.Time
+		logger   zerolog.Logger
+		mutex    sync.Mutex
+		now      func() time.Time
+	}
+)
+
+// NewOIDC validates tokens with config, using client to fetch keys or the
+// default client if nil
+//
+// Keys from a JWKS file are loaded straight away, while keys from a provider
+// are fetched when the first token is validated
+func NewOIDC(config OIDCConfig, client *http.Client, logger zerolog.Logger) (*OIDC, error) {
+	if config.Issuer == "" && config.JWKSURL == "" && config.JWKSFile == "" {
+		return nil, errors.New("OIDC requires an issuer, JWKS URL or JWKS file")
+	}
+	if config.Audience == "" {
+		return nil, errors.New("OIDC requires an audience, so tokens issued to other clients aren't accepted")
+	}
+	if config.SubjectClaim == "" {
+		config.SubjectClaim = "sub"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	o := &OIDC{
+		client:  client,
+		config:  config,
+		jwksURL: config.JWKSURL,
+		keys:    map[string]jose.JSONWebKey{},
+		logger:  logger,
+		now:     time.Now,
+	}
+
+	if config.JWKSFile != "" {
+		if err := o.loadKeys(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+func (o *OIDC) Authenticate(ctx context.Context, token string) (Principal, error) {
+	if strings.Count(token, ".") != 2 {
+		return Principal{}, ErrUnrecognised
+	}
+
+	parsed, err := jwt.ParseSigned(token, signatureAlgorithms)
+	if err != nil {
+		return Principal{}, fmt.Errorf("invalid token: %w", err)
+	}
+	header := parsed.Headers[0]
+
+	key, err := o.key(ctx, header.KeyID)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	if err := checkKeyAlgorithm(key, header.Algorithm); err != nil {
+		return Principal{}, err
+	}
+
+	claims := map[string]any{}
+	if err := parsed.Claims(key.Key, &claims); err != nil {
+		return Principal{}, errors.New("invalid token signature")
+	}
+
+	if err := o.validateClaims(claims); err != nil {
+		return Principal{}, err
+	}
+
+	subject, _ := claims[o.config.SubjectClaim].(string)
+	if subject == "" {
+		return Principal{}, fmt.Errorf("token is missing the %s claim", o.config.SubjectClaim)
+	}
+
+	return Principal{
+		Subject: subject,
+		Groups:  stringsClaim(claims[o.config.GroupsClaim]),
+		Method:  MethodOIDC,
+	}, nil
+}
+
+func (o *OIDC) validateClaims(claims map[string]any) error {
+	now := o.now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token is missing its expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(clockLeeway)) {
+		return errors.New("token has expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-clockLeeway)) {
+		return errors.New("token isn't valid yet")
+	}
+
+	if o.config.Issuer != "" && claims["iss"] != o.config.Issuer {
+		return errors.New("token has the wrong issuer")
+	}
+
+	if !slices.Contains(stringsClaim(claims["aud"]), o.config.Audience) {
+		return errors.New("token has the wrong audience")
+	}
+
+	return nil
+}
+
+// key returns the key with the given ID, reloading the keys if it's unknown
+func (o *OIDC) key(ctx context.Context, kid string) (jose.JSONWebKey, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+
+	if !o.loadedAt.IsZero() && o.now().Sub(o.loadedAt) < jwksRefreshInterval {
+		return jose.JSONWebKey{}, fmt.Errorf("token signed by unknown key '%s'", kid)
+	}
+
+	if err := o.loadKeys(ctx); err != nil {
+		return jose.JSONWebKey{}, err
+	}
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+
+	return jose.JSONWebKey{}, fmt.Errorf("token signed by unknown key '%s'", kid)
+}
+
+// loadKeys replaces the keys with those read from the JWKS file or fetched
+// from the provider. Callers must hold the mutex, other than on creation
+//
+// Keys that can't be used are skipped, so one key of an unsupported type
+// doesn't stop the provider's other keys from being used
+func (o *OIDC) loadKeys(ctx context.Context) error {
+	o.loadedAt = o.now()
+
+	set := struct {
+		Keys []json.RawMessage `json:"keys"`
+	}{}
+	if o.config.JWKSFile != "" {
+		content, err := os.ReadFile(o.config.JWKSFile)
+		if err != nil {
+			return fmt.Errorf("unable to read JWKS file: %w", err)
+		}
+		if err := json.Unmarshal(content, &set); err != nil {
+			return fmt.Errorf("unable to parse JWKS file: %w", err)
+		}
+	} else {
+		if o.jwksURL == "" {
+			discovery := struct {
+				JWKSURI string `json:"jwks_uri"`
+			}{}
+			discoveryURL := strings.TrimRight(o.config.Issuer, "/") + "/.well-known/openid-configuration"
+			if err := o.fetchJSON(ctx, discoveryURL, &discovery); err != nil {
+				return fmt.Errorf("unable to discover OIDC provider keys: %w", err)
+			}
+			if discovery.JWKSURI == "" {
+				return errors.New("OIDC provider doesn't list its keys")
+			}
+			o.jwksURL = discovery.JWKSURI
+		}
+
+		if err := o.fetchJSON(ctx, o.jwksURL, &set); err != nil {
+			return fmt.Errorf("unable to fetch OIDC provider keys: %w", err)
+		}
+	}
+
+	keys := map[string]jose.JSONWebKey{}
+	for _, raw := range set.Keys {
+		key, err := parseKey(raw)
+		if err != nil {
+			o.logger.Debug().Err(err).Str("kid", key.KeyID).Msg("Skipping OIDC provider key")
+			continue
+		}
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		keys[key.KeyID] = key
+	}
+
+	o.keys = keys
+
+	return nil
+}
+
+func (o *OIDC) fetchJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(content) > maxFetchBytes {
+		return fmt.Errorf("response from %s is over %d bytes", url, maxFetchBytes)
+	}
+
+	return json.Unmarshal(content, v)
+}
+
+// parseKey parses a public signing key from a key set, returning the key with
+// only its ID set if it can't be used
+func parseKey(raw []byte) (jose.JSONWebKey, error) {
+	params := struct {
+		Kid string `json:"kid"`
+		E   string `json:"e"`
+	}{}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	invalid := jose.JSONWebKey{KeyID: params.Kid}
+
+	key := jose.JSONWebKey{}
+	if err := key.UnmarshalJSON(raw); err != nil {
+		return invalid, err
+	}
+
+	// Symmetric keys have no public key, and are never accepted
+	key = key.Public()
+	if !key.Valid() {
+		return invalid, errors.New("not a public key")
+	}
+
+	// Exponents are parsed without checking they fit an int
+	if _, ok := key.Key.(*rsa.PublicKey); ok && !validRSAExponent(params.E) {
+		return invalid, errors.New("invalid RSA exponent")
+	}
+
+	return key, nil
+}
+
+func validRSAExponent(e string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil || len(b) == 0 || len(b) > 4 {
+		return false
+	}
+
+	exponent := new(big.Int).SetBytes(b)
+	return exponent.Int64() > 1 && exponent.Int64() <= math.MaxInt32 && exponent.Bit(0) == 1
+}
+
+// checkKeyAlgorithm checks a token's algorithm can be used with its key, as
+// keys are only matched to tokens by ID
+func checkKeyAlgorithm(key jose.JSONWebKey, alg string) error {
+	if key.Algorithm != "" && key.Algorithm != alg {
+		return fmt.Errorf("token algorithm %s doesn't match its key", alg)
+	}
+
+	// ECDSA signatures are only as strong as the curve their algorithm names
+	if pub, ok := key.Key.(*ecdsa.PublicKey); ok && ecdsaCurves[alg] != pub.Curve {
+		return fmt.Errorf("token algorithm %s can't be used with a %s key", alg, pub.Curve.Params().Name)
+	}
+
+	return nil
+}
+
+// stringsClaim reads a claim that may be a single string or a list of them
+func stringsClaim(claim any) []string {
+	switch c := claim.(type) {
+	case string:
+		return []string{c}
+	case []any:
+		values := []string{}
+		for _, v := range c {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
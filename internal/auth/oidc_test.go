@@ -0,0 +1,332 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ecdsa   *ecdsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Test setup error")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "Test setup error")
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err, "Test setup error")
+
+	return testKeys{rsa: rsaKey, ecdsa: ecKey, ed25519: edKey}
+}
+
+// jwks is the key set of the test keys, with the RSA key under kids rsa and
+// rsa-pss
+func (k testKeys) jwks() map[string]any {
+	b64 := base64.RawURLEncoding.EncodeToString
+	rsaKey := func(kid string) map[string]any {
+		return map[string]any{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   b64(k.rsa.N.Bytes()),
+			"e":   b64(big.NewInt(int64(k.rsa.E)).Bytes()),
+		}
+	}
+
+	return map[string]any{"keys": []any{
+		rsaKey("rsa"),
+		rsaKey("rsa-pss"),
+		map[string]any{
+			"kty": "EC",
+			"kid": "ec",
+			"crv": "P-256",
+			"x":   b64(k.ecdsa.X.FillBytes(make([]byte, 32))),
+			"y":   b64(k.ecdsa.Y.FillBytes(make([]byte, 32))),
+		},
+		map[string]any{
+			"kty": "OKP",
+			"kid": "ed",
+			"crv": "Ed25519",
+			"x":   b64(k.ed25519.Public().(ed25519.PublicKey)),
+		},
+		map[string]any{"kty": "RSA", "kid": "enc", "use": "enc"},
+	}}
+}
+
+// sign creates a token signed with the test key for kid
+func (k testKeys) sign(t *testing.T, kid string, claims map[string]any) string {
+	alg := map[string]string{"rsa": "RS256", "rsa-pss": "PS256", "ec": "ES256", "ed": "EdDSA"}[kid]
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err, "Test setup error")
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err, "Test setup error")
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch kid {
+	case "rsa":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+	case "rsa-pss":
+		signature, err = rsa.SignPSS(rand.Reader, k.rsa, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ec":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k.ecdsa, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "ed":
+		signature = ed25519.Sign(k.ed25519, []byte(signed))
+	}
+	require.NoError(t, err, "Test setup error")
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJWKS(t *testing.T, set map[string]any) string {
+	content, err := json.Marshal(set)
+	require.NoError(t, err, "Test setup error")
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, content, 0644), "Test setup error")
+
+	return path
+}
+
+func TestOIDCAuthenticate(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+
+	oidc, err := NewOIDC(OIDCConfig{
+		Issuer:   "https://id.example.com",
+		Audience: "hops",
+		JWKSFile: writeJWKS(t, keys.jwks()),
+	}, nil, zerolog.Nop())
+	require.NoError(t, err)
+	oidc.now = func() time.Time { return now }
+
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"sub":    "alice",
+			"iss":    "https://id.example.com",
+			"aud":    []any{"other", "hops"},
+			"exp":    now.Add(time.Hour).Unix(),
+			"groups": []any{"ops", "dev"},
+		}
+	}
+	with := func(name string, value any) map[string]any {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	type testCase struct {
+		name          string
+		token         string
+		expected      Principal
+		expectedError error
+		expectError   bool
+	}
+
+	expected := Principal{Subject: "alice", Groups: []string{"ops", "dev"}, Method: MethodOIDC}
+	forged := keys.sign(t, "rsa", validClaims())
+	forged = forged[:len(forged)-4] + "AAAA"
+
+	tests := []testCase{
+		{name: "RSA", token: keys.sign(t, "rsa", validClaims()), expected: expected},
+		{name: "RSA PSS", token: keys.sign(t, "rsa-pss", validClaims()), expected: expected},
+		{name: "ECDSA", token: keys.sign(t, "ec", validClaims()), expected: expected},
+		{name: "Ed25519", token: keys.sign(t, "ed", validClaims()), expected: expected},
+		{name: "Single audience", token: keys.sign(t, "ec", with("aud", "hops")), expected: expected},
+		{name: "Not a JWT", token: "static-token", expectedError: ErrUnrecognised},
+		{name: "Forged signature", token: forged, expectError: true},
+		{name: "Expired", token: keys.sign(t, "rsa", with("exp", now.Add(-2*time.Minute).Unix())), expectError: true},
+		{name: "Expired within leeway", token: keys.sign(t, "rsa", with("exp", now.Add(-30*time.Second).Unix())), expected: expected},
+		{name: "Missing expiry", token: keys.sign(t, "rsa", with("exp", nil)), expectError: true},
+		{name: "Not yet valid", token: keys.sign(t, "rsa", with("nbf", now.Add(time.Hour).Unix())), expectError: true},
+		{name: "Wrong issuer", token: keys.sign(t, "rsa", with("iss", "https://evil.example.com")), expectError: true},
+		{name: "Wrong audience", token: keys.sign(t, "rsa", with("aud", "other")), expectError: true},
+		{name: "Missing audience", token: keys.sign(t, "rsa", with("aud", nil)), expectError: true},
+		{name: "Missing subject", token: keys.sign(t, "rsa", with("sub", nil)), expectError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := oidc.Authenticate(context.Background(), tc.token)
+			switch {
+			case tc.expectedError != nil:
+				assert.ErrorIs(t, err, tc.expectedError)
+			case tc.expectError:
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, ErrUnrecognised, "JWTs should be recognised even if invalid")
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, p)
+			}
+		})
+	}
+
+	oidc.config.SubjectClaim = "email"
+	oidc.config.GroupsClaim = "team"
+	p, err := oidc.Authenticate(context.Background(), keys.sign(t, "rsa", with("email", "alice@example.com")))
+	require.NoError(t, err)
+	assert.Equal(t, Principal{Subject: "alice@example.com", Method: MethodOIDC}, p, "Claims should be configurable")
+
+	p, err = oidc.Authenticate(context.Background(), keys.sign(t, "rsa", map[string]any{
+		"email": "alice@example.com",
+		"iss":   "https://id.example.com",
+		"aud":   "hops",
+		"exp":   now.Add(time.Hour).Unix(),
+		"team":  "dev",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dev"}, p.Groups, "A single group should be read")
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	keys := newTestKeys(t)
+	served := keys.jwks()
+	// The EC key is added later, as if the provider rotated its keys
+	served["keys"] = served["keys"].([]any)[:2]
+	fetches := 0
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"jwks_uri": server.URL + "/keys"})
+		case "/keys":
+			fetches++
+			json.NewEncoder(w).Encode(served)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	now := time.Now()
+	oidc, err := NewOIDC(OIDCConfig{Issuer: server.URL, Audience: "hops"}, server.Client(), zerolog.Nop())
+	require.NoError(t, err)
+	oidc.now = func() time.Time { return now }
+	assert.Equal(t, 0, fetches, "Keys shouldn't be fetched until needed")
+
+	claims := map[string]any{"sub": "bob", "iss": server.URL, "aud": "hops", "exp": now.Add(time.Hour).Unix()}
+
+	p, err := oidc.Authenticate(context.Background(), keys.sign(t, "rsa", claims))
+	require.NoError(t, err)
+	assert.Equal(t, "bob", p.Subject)
+	assert.Equal(t, 1, fetches)
+
+	_, err = oidc.Authenticate(context.Background(), keys.sign(t, "rsa-pss", claims))
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetches, "Keys should be cached")
+
+	served = keys.jwks()
+	_, err = oidc.Authenticate(context.Background(), keys.sign(t, "ec", claims))
+	assert.Error(t, err, "Unknown keys shouldn't be refetched too often")
+	assert.Equal(t, 1, fetches)
+
+	now = now.Add(2 * jwksRefreshInterval)
+	_, err = oidc.Authenticate(context.Background(), keys.sign(t, "ec", claims))
+	require.NoError(t, err, "Unknown keys should be refetched")
+	assert.Equal(t, 2, fetches)
+
+	_, err = NewOIDC(OIDCConfig{Audience: "hops"}, nil, zerolog.Nop())
+	assert.Error(t, err, "OIDC requires somewhere to get keys")
+
+	_, err = NewOIDC(OIDCConfig{Issuer: server.URL}, nil, zerolog.Nop())
+	assert.Error(t, err, "OIDC requires an audience")
+}
+
+func TestOIDCKeys(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Now()
+	claims := map[string]any{"sub": "alice", "aud": "hops", "exp": now.Add(time.Hour).Unix()}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err, "Test setup error")
+
+	set := keys.jwks()
+	set["keys"] = append(
+		set["keys"].([]any),
+		map[string]any{"kty": "EC", "kid": "unsupported-curve", "crv": "P-192", "x": "AA", "y": "AA"},
+		map[string]any{"kty": "nope", "kid": "unsupported-type"},
+		map[string]any{"kty": "oct", "kid": "symmetric", "k": b64([]byte("secret"))},
+		map[string]any{"kty": "RSA", "kid": "large-exponent", "n": b64(keys.rsa.N.Bytes()), "e": b64(bytes.Repeat([]byte{0xff}, 9))},
+		map[string]any{"kty": "RSA", "kid": "even-exponent", "n": b64(keys.rsa.N.Bytes()), "e": b64([]byte{2})},
+		map[string]any{
+			"kty": "EC",
+			"kid": "p384",
+			"crv": "P-384",
+			"x":   b64(p384Key.X.FillBytes(make([]byte, 48))),
+			"y":   b64(p384Key.Y.FillBytes(make([]byte, 48))),
+		},
+	)
+
+	logs := &bytes.Buffer{}
+	oidc, err := NewOIDC(OIDCConfig{Audience: "hops", JWKSFile: writeJWKS(t, set)}, nil, zerolog.New(logs).Level(zerolog.DebugLevel))
+	require.NoError(t, err, "Keys that can't be used shouldn't stop the others loading")
+
+	_, err = oidc.Authenticate(context.Background(), keys.sign(t, "ec", claims))
+	assert.NoError(t, err)
+
+	for _, kid := range []string{"unsupported-curve", "unsupported-type", "symmetric", "large-exponent", "even-exponent"} {
+		assert.NotContains(t, oidc.keys, kid)
+		assert.Contains(t, logs.String(), kid, "Skipped keys should be logged")
+	}
+
+	// A token claiming ES256, signed by the P-256 key, but naming the P-384 key
+	token := keys.sign(t, "ec", claims)
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "kid": "p384"})
+	require.NoError(t, err, "Test setup error")
+	token = b64(header) + token[strings.Index(token, "."):]
+
+	_, err = oidc.Authenticate(context.Background(), token)
+	assert.ErrorContains(t, err, "P-384", "Algorithms should be bound to their curve")
+}
+
+func TestOIDCFetchLimit(t *testing.T) {
+	keys := newTestKeys(t)
+	set := keys.jwks()
+	set["padding"] = strings.Repeat("a", maxFetchBytes)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+
+	oidc, err := NewOIDC(OIDCConfig{Audience: "hops", JWKSURL: server.URL}, server.Client(), zerolog.Nop())
+	require.NoError(t, err)
+
+	claims := map[string]any{"sub": "alice", "aud": "hops", "exp": time.Now().Add(time.Hour).Unix()}
+	_, err = oidc.Authenticate(context.Background(), keys.sign(t, "rsa", claims))
+	assert.ErrorContains(t, err, "over", "Large responses shouldn't be read")
+}
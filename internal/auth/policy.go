@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+type (
+	// Role grants the users and groups it lists access to commands and flows
+	Role struct {
+		Name   string
+		Users  []string
+		Groups []string
+		// Run are patterns of the command actions the role may run
+		Run []string
+		// View are patterns of the IDs of flows whose runs the role may view
+		View []string
+		// Audit allows the role to query the audit trail of every event
+		Audit bool
+	}
+
+	// Policy decides what principals may do from their roles
+	//
+	// Principals may do anything if there are no roles, and otherwise only
+	// what one of the roles they have grants
+	Policy struct {
+		roles []Role
+	}
+)
+
+func NewPolicy(roles []Role) (*Policy, error) {
+	for _, r := range roles {
+		if r.Name == "" {
+			return nil, fmt.Errorf("roles must have a name")
+		}
+
+		for _, pattern := range slices.Concat(r.Run, r.View) {
+			if !doublestar.ValidatePattern(pattern) {
+				return nil, fmt.Errorf("role '%s' has invalid pattern '%s'", r.Name, pattern)
+			}
+		}
+	}
+
+	return &Policy{roles: roles}, nil
+}
+
+// CanRun is true if the principal may run the command with the given action
+func (p *Policy) CanRun(principal Principal, action string) bool {
+	return p.allows(principal, action, func(r Role) []string { return r.Run })
+}
+
+// CanView is true if the principal may view the runs of the given flow
+func (p *Policy) CanView(principal Principal, flowID string) bool {
+	return p.allows(principal, flowID, func(r Role) []string { return r.View })
+}
+
+// CanAudit is true if the principal may query the audit trail
+func (p *Policy) CanAudit(principal Principal) bool {
+	if p == nil || len(p.roles) == 0 {
+		return true
+	}
+
+	for _, r := range p.roles {
+		if r.Audit && r.has(principal) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) allows(principal Principal, name string, patterns func(Role) []string) bool {
+	if p == nil || len(p.roles) == 0 {
+		return true
+	}
+
+	for _, r := range p.roles {
+		if !r.has(principal) {
+			continue
+		}
+
+		for _, pattern := range patterns(r) {
+			if ok, _ := doublestar.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// has is true if the role is given to the principal, where "*" in a role's
+// users gives it to everyone authenticated. Principals without a subject
+// weren't authenticated, so have no roles
+func (r Role) has(principal Principal) bool {
+	if principal.Subject == "" {
+		return false
+	}
+
+	if slices.Contains(r.Users, "*") || slices.Contains(r.Users, principal.Subject) {
+		return true
+	}
+
+	for _, g := range principal.Groups {
+		if slices.Contains(r.Groups, g) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy(t *testing.T) {
+	policy, err := NewPolicy([]Role{
+		{Name: "deployers", Groups: []string{"ops"}, Run: []string{"deploy*"}, View: []string{"deploy.*"}},
+		{Name: "viewers", Users: []string{"*"}, View: []string{"reports.*"}},
+		{Name: "admin", Users: []string{"root", "slack:U012AB3CD"}, Run: []string{"**"}, View: []string{"**"}},
+		{Name: "auditors", Groups: []string{"compliance"}, Audit: true},
+	})
+	require.NoError(t, err)
+
+	ops := Principal{Subject: "alice", Groups: []string{"dev", "ops"}}
+	dev := Principal{Subject: "bob", Groups: []string{"dev"}}
+	root := Principal{Subject: "root"}
+
+	type testCase struct {
+		name      string
+		principal Principal
+		run       string
+		view      string
+		expected  bool
+	}
+
+	tests := []testCase{
+		{name: "Group can run", principal: ops, run: "deploy-app", expected: true},
+		{name: "Group can view", principal: ops, view: "deploy.app", expected: true},
+		{name: "Group can't run others", principal: ops, run: "restart", expected: false},
+		{name: "Everyone can view", principal: dev, view: "reports.weekly", expected: true},
+		{name: "Other groups can't run", principal: dev, run: "deploy-app", expected: false},
+		{name: "Other groups can't view", principal: dev, view: "deploy.app", expected: false},
+		{name: "User can run anything", principal: root, run: "restart", expected: true},
+		{name: "User can view anything", principal: root, view: "review.label", expected: true},
+		{name: "Unauthenticated can't view", principal: Principal{}, view: "reports.weekly", expected: false},
+		{name: "Chat user can run", principal: Principal{Subject: "slack:U012AB3CD"}, run: "restart", expected: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.run != "" {
+				assert.Equal(t, tc.expected, policy.CanRun(tc.principal, tc.run))
+			}
+			if tc.view != "" {
+				assert.Equal(t, tc.expected, policy.CanView(tc.principal, tc.view))
+			}
+		})
+	}
+
+	auditor := Principal{Subject: "carol", Groups: []string{"compliance"}}
+	assert.True(t, policy.CanAudit(auditor))
+	assert.False(t, policy.CanAudit(root), "Roles should only audit if granted it")
+	assert.False(t, policy.CanView(auditor, "deploy.app"), "Auditing shouldn't grant viewing runs")
+
+	open, err := NewPolicy(nil)
+	require.NoError(t, err)
+	assert.True(t, open.CanRun(dev, "anything"), "No roles should allow everything")
+	assert.True(t, open.CanAudit(dev), "No roles should allow everything")
+
+	var unset *Policy
+	assert.True(t, unset.CanView(dev, "anything"), "No policy should allow everything")
+
+	_, err = NewPolicy([]Role{{Name: "bad", Run: []string{"[a-"}}})
+	assert.Error(t, err, "Invalid patterns should be rejected")
+
+	_, err = NewPolicy([]Role{{Run: []string{"*"}}})
+	assert.Error(t, err, "Roles should have names")
+}
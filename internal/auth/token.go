@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+// MethodToken is the method of principals authenticated by a static token
+const MethodToken = "token"
+
+type (
+	// StaticToken is an API token from config, such as for CI jobs
+	StaticToken struct {
+		// Name is the subject of requests made with the token
+		Name   string
+		Token  string
+		Groups []string
+	}
+
+	// StaticTokens authenticates the API tokens set in config
+	StaticTokens struct {
+		tokens []staticToken
+	}
+
+	staticToken struct {
+		hash      [sha256.Size]byte
+		principal Principal
+	}
+)
+
+func NewStaticTokens(tokens []StaticToken) (*StaticTokens, error) {
+	s := &StaticTokens{}
+	names := map[string]bool{}
+
+	for _, t := range tokens {
+		if t.Name == "" {
+			return nil, errors.New("API tokens must have a name")
+		}
+		if t.Token == "" {
+			return nil, fmt.Errorf("API token '%s' is empty", t.Name)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("API token '%s' is set more than once", t.Name)
+		}
+		names[t.Name] = true
+
+		s.tokens = append(s.tokens, staticToken{
+			hash: sha256.Sum256([]byte(t.Token)),
+			principal: Principal{
+				Subject: t.Name,
+				Groups:  t.Groups,
+				Method:  MethodToken,
+			},
+		})
+	}
+
+	return s, nil
+}
+
+// Authenticate compares the token to every static token in constant time, so
+// tokens can't be guessed from how long they take to reject
+func (s *StaticTokens) Authenticate(ctx context.Context, token string) (Principal, error) {
+	hash := sha256.Sum256([]byte(token))
+
+	var match *Principal
+	for i := range s.tokens {
+		if subtle.ConstantTimeCompare(hash[:], s.tokens[i].hash[:]) == 1 {
+			match = &s.tokens[i].principal
+		}
+	}
+
+	if match == nil {
+		return Principal{}, ErrUnrecognised
+	}
+
+	return *match, nil
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticTokens(t *testing.T) {
+	tokens, err := NewStaticTokens([]StaticToken{
+		{Name: "ci", Token: "ci-secret", Groups: []string{"deployers"}},
+		{Name: "bot", Token: "bot-secret"},
+	})
+	require.NoError(t, err)
+
+	p, err := tokens.Authenticate(context.Background(), "ci-secret")
+	require.NoError(t, err)
+	assert.Equal(t, Principal{Subject: "ci", Groups: []string{"deployers"}, Method: MethodToken}, p)
+
+	_, err = tokens.Authenticate(context.Background(), "nope")
+	assert.ErrorIs(t, err, ErrUnrecognised)
+
+	_, err = NewStaticTokens([]StaticToken{{Name: "ci"}})
+	assert.Error(t, err, "Empty tokens should be rejected")
+
+	_, err = NewStaticTokens([]StaticToken{{Name: "ci", Token: "a"}, {Name: "ci", Token: "b"}})
+	assert.Error(t, err, "Duplicate token names should be rejected")
+}
+
+type stubAuthenticator struct {
+	token string
+	err   error
+}
+
+func (s stubAuthenticator) Authenticate(ctx context.Context, token string) (Principal, error) {
+	if token != s.token {
+		return Principal{}, ErrUnrecognised
+	}
+	if s.err != nil {
+		return Principal{}, s.err
+	}
+
+	return Principal{Subject: s.token}, nil
+}
+
+func TestChain(t *testing.T) {
+	chain := Chain{
+		stubAuthenticator{token: "first"},
+		stubAuthenticator{token: "invalid", err: errors.New("expired")},
+		stubAuthenticator{token: "last"},
+	}
+
+	p, err := chain.Authenticate(context.Background(), "last")
+	require.NoError(t, err)
+	assert.Equal(t, "last", p.Subject)
+
+	_, err = chain.Authenticate(context.Background(), "invalid")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	assert.ErrorContains(t, err, "expired")
+
+	_, err = chain.Authenticate(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	assert.Equal(t, "abc", BearerToken("Bearer abc"))
+	assert.Equal(t, "abc", BearerToken("bearer  abc"))
+	assert.Equal(t, "", BearerToken("Basic abc"))
+	assert.Equal(t, "", BearerToken(""))
+
+	ctx := WithPrincipal(context.Background(), p)
+	fromCtx, ok := PrincipalFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, p, fromCtx)
+
+	_, ok = PrincipalFromContext(context.Background())
+	assert.False(t, ok)
+}
@@ -1,8 +1,10 @@
-package main
+// Package dirnotify watches directories for changes, notifying reloaders
+package dirnotify
 
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"math"
 	"os"
 	"path/filepath"
@@ -40,11 +42,16 @@ func (d *DirNotifier) Close() error {
 	return d.watcher.Close()
 }
 
+// Path returns the watched path, which is also the ID of reload notifications
+func (d *DirNotifier) Path() string {
+	return d.path
+}
+
 func (d *DirNotifier) Notifier(ctx context.Context) reload.Notifier {
 	// Using a timer to debounce file change events, preventing multiple events
 	// triggering hops reload for a single action
 	notifyChan := make(chan string)
-	t := time.AfterFunc(math.MaxInt64, func() { notifyChan <- "file-watch" })
+	t := time.AfterFunc(math.MaxInt64, func() { notifyChan <- d.path })
 	t.Stop()
 	waitFor := 150 * time.Millisecond
 
@@ -115,21 +122,24 @@ func (d *DirNotifier) initWatcher(path string) error {
 		return fmt.Errorf("Unable to add file watcher for %s: %w", path, err)
 	}
 
-	// Add subdirectories
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return fmt.Errorf("Unable to read subdirectories for %s: %w", path, err)
-	}
-
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+	// Add subdirectories at any depth
+	err = filepath.WalkDir(path, func(subPath string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !de.IsDir() || subPath == path {
+			return nil
 		}
 
-		err = watcher.Add(filepath.Join(path, entry.Name()))
-		if err != nil {
-			return fmt.Errorf("Unable to add file watcher for %s, %w", entry.Name(), err)
+		if err := watcher.Add(subPath); err != nil {
+			return fmt.Errorf("Unable to add file watcher for %s, %w", subPath, err)
 		}
+
+		return nil
+	})
+	if err != nil {
+		watcher.Close()
+		return fmt.Errorf("Unable to read subdirectories for %s: %w", path, err)
 	}
 
 	d.watcher = watcher
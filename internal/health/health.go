@@ -0,0 +1,149 @@
+// Package health reports whether hops is alive and ready to handle events,
+// as checked by Kubernetes probes
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// checkTimeout is how long each check may take before failing, which is
+// shorter than probes' timeout so they get a report of what's slow
+const checkTimeout = 3 * time.Second
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+type (
+	// Check errors with the reason something is unhealthy
+	Check func(ctx context.Context) error
+
+	// Checker runs checks for liveness and readiness
+	//
+	// Liveness checks fail if hops is broken and must be restarted, whereas
+	// readiness checks fail if it can't handle events for now
+	Checker struct {
+		checks []check
+		mutex  sync.Mutex
+	}
+
+	// Report is the outcome of the checks run for a probe
+	Report struct {
+		Status string            `json:"status"`
+		Checks map[string]Result `json:"checks"`
+	}
+
+	Result struct {
+		Status     string  `json:"status"`
+		Error      string  `json:"error,omitempty"`
+		DurationMS float64 `json:"duration_ms"`
+	}
+
+	check struct {
+		fn   Check
+		live bool
+		name string
+	}
+)
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// AddLive adds a check that hops isn't broken, which is also a check of
+// readiness
+func (c *Checker) AddLive(name string, fn Check) {
+	c.add(check{fn: fn, live: true, name: name})
+}
+
+// AddReady adds a check that hops can handle events
+func (c *Checker) AddReady(name string, fn Check) {
+	c.add(check{fn: fn, name: name})
+}
+
+func (c *Checker) add(ch check) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.checks = append(c.checks, ch)
+}
+
+// Live runs the liveness checks
+func (c *Checker) Live(ctx context.Context) Report {
+	return c.run(ctx, true)
+}
+
+// Ready runs every check
+func (c *Checker) Ready(ctx context.Context) Report {
+	return c.run(ctx, false)
+}
+
+// OK is true if every check passed
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// run runs checks concurrently, so one slow check doesn't time out the probe
+func (c *Checker) run(ctx context.Context, liveOnly bool) Report {
+	c.mutex.Lock()
+	checks := []check{}
+	for _, ch := range c.checks {
+		if ch.live || !liveOnly {
+			checks = append(checks, ch)
+		}
+	}
+	c.mutex.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, ch.fn)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: map[string]Result{}}
+	for i, ch := range checks {
+		report.Checks[ch.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	return report
+}
+
+func runCheck(ctx context.Context, fn Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errChan:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{
+		Status:     StatusOK,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+	checker := NewChecker()
+	checker.AddLive("nats", func(ctx context.Context) error { return nil })
+	checker.AddReady("flows", func(ctx context.Context) error { return errors.New("flows failed to load") })
+	checker.AddReady("scheduler", func(ctx context.Context) error { return nil })
+
+	live := checker.Live(context.Background())
+	assert.True(t, live.OK(), "Readiness checks shouldn't fail liveness")
+	assert.Equal(t, []string{"nats"}, keys(live.Checks))
+
+	ready := checker.Ready(context.Background())
+	assert.False(t, ready.OK())
+	assert.Equal(t, StatusFail, ready.Status)
+	assert.Equal(t, []string{"flows", "nats", "scheduler"}, keys(ready.Checks))
+	assert.Equal(t, StatusOK, ready.Checks["nats"].Status)
+	assert.Equal(t, StatusFail, ready.Checks["flows"].Status)
+	assert.Equal(t, "flows failed to load", ready.Checks["flows"].Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	checker.AddLive("stuck", func(ctx context.Context) error {
+		select {}
+	})
+	live = checker.Live(ctx)
+	assert.False(t, live.OK(), "Checks that don't finish should fail")
+	assert.Equal(t, context.Canceled.Error(), live.Checks["stuck"].Error)
+}
+
+func keys(checks map[string]Result) []string {
+	names := []string{}
+	for name := range checks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
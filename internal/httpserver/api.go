@@ -0,0 +1,306 @@
+package httpserver
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+
+	"github.com/hiphops-io/hops/internal/audit"
+	"github.com/hiphops-io/hops/internal/auth"
+	"github.com/hiphops-io/hops/internal/runner"
+	"github.com/hiphops-io/hops/markdown"
+)
+
+// defaultRunsLimit is how many runs of a flow are listed if no limit is given
+const defaultRunsLimit = 10
+
+type (
+	// api serves the hops API the site's forms and shortcodes are hydrated from
+	//
+	// Requests must be authenticated if authn is set, and are then limited to
+	// what the policy allows
+	api struct {
+		audit   *audit.Log
+		authn   auth.Authenticator
+		history *runner.RunHistory
+		policy  *auth.Policy
+		web     *runner.WebFrontend
+	}
+
+	apiError struct {
+		Error string `json:"error"`
+	}
+
+	// commandInfo describes a command, so a form can be built for it
+	commandInfo struct {
+		Action string         `json:"action"`
+		Name   string         `json:"name"`
+		Params []commandParam `json:"params"`
+	}
+
+	commandParam struct {
+		Name        string   `json:"name"`
+		Label       string   `json:"label"`
+		Type        string   `json:"type"`
+		Required    bool     `json:"required"`
+		Default     any      `json:"default,omitempty"`
+		Options     []string `json:"options,omitempty"`
+		OptionsFrom string   `json:"options_from,omitempty"`
+	}
+
+	auditRecords struct {
+		Records []audit.Record `json:"records"`
+	}
+
+	flowRuns struct {
+		Flow string           `json:"flow"`
+		Name string           `json:"name"`
+		Runs []runner.FlowRun `json:"runs"`
+	}
+)
+
+func (a *api) register(e *echo.Echo) {
+	g := e.Group("/api", a.authenticate)
+
+	if a.web != nil {
+		g.GET("/commands/:action", a.command)
+		g.POST("/commands/:action", a.submit)
+		g.GET("/runs/:id", a.run)
+	}
+
+	if a.history != nil {
+		g.GET("/flows/:id/runs", a.flowRuns)
+	}
+
+	if a.audit != nil {
+		g.GET("/audit", a.auditRecords)
+	}
+}
+
+// authenticate requires a valid bearer token, adding the principal it belongs
+// to to the request's context
+func (a *api) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if a.authn == nil {
+			return next(c)
+		}
+
+		req := c.Request()
+		token := auth.BearerToken(req.Header.Get(echo.HeaderAuthorization))
+		if token == "" {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="hops"`)
+			return c.JSON(http.StatusUnauthorized, apiError{Error: "a bearer token is required"})
+		}
+
+		principal, err := a.authn.Authenticate(req.Context(), token)
+		if err != nil {
+			c.Logger().Debug(err)
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="hops", error="invalid_token"`)
+			return c.JSON(http.StatusUnauthorized, apiError{Error: "invalid bearer token"})
+		}
+
+		c.SetRequest(req.WithContext(auth.WithPrincipal(req.Context(), principal)))
+
+		return next(c)
+	}
+}
+
+// canRun is true if the request may run the command with the given action
+func (a *api) canRun(c echo.Context, action string) bool {
+	if a.authn == nil {
+		return true
+	}
+
+	principal, _ := auth.PrincipalFromContext(c.Request().Context())
+	return a.policy.CanRun(principal, action)
+}
+
+// canView is true if the request may view the runs of the given flow
+func (a *api) canView(c echo.Context, flowID string) bool {
+	if a.authn == nil {
+		return true
+	}
+
+	principal, _ := auth.PrincipalFromContext(c.Request().Context())
+	return a.policy.CanView(principal, flowID)
+}
+
+// canAudit is true if the request may query the audit trail
+func (a *api) canAudit(c echo.Context) bool {
+	if a.authn == nil {
+		return true
+	}
+
+	principal, _ := auth.PrincipalFromContext(c.Request().Context())
+	return a.policy.CanAudit(principal)
+}
+
+func forbidden(c echo.Context) error {
+	return c.JSON(http.StatusForbidden, apiError{Error: "forbidden"})
+}
+
+func (a *api) command(c echo.Context) error {
+	if !a.canRun(c, c.Param("action")) {
+		return forbidden(c)
+	}
+
+	flow, ok := a.web.Command(c.Param("action"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, apiError{Error: markdown.ErrCommandNotFound.Error()})
+	}
+
+	info := commandInfo{
+		Action: flow.ActionName(),
+		Name:   flow.DisplayName(),
+		Params: []commandParam{},
+	}
+	for _, pi := range flow.Command {
+		name, param := pi.Param()
+		info.Params = append(info.Params, commandParam{
+			Name:        name,
+			Label:       pi.DisplayName(),
+			Type:        param.Type,
+			Required:    param.Required,
+			Default:     param.Default,
+			Options:     param.Options,
+			OptionsFrom: param.OptionsFrom,
+		})
+	}
+
+	return c.JSON(http.StatusOK, info)
+}
+
+// submit runs a command with the params in the JSON body of the request,
+// responding with the run to poll for its status
+//
+// Only JSON bodies are accepted, as forms can be posted cross site without a
+// CORS preflight. Params are only read from the body, never the path or query
+func (a *api) submit(c echo.Context) error {
+	if !a.canRun(c, c.Param("action")) {
+		return forbidden(c)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != echo.MIMEApplicationJSON {
+		return c.JSON(http.StatusUnsupportedMediaType, apiError{Error: "params must be sent as application/json"})
+	}
+
+	params := map[string]any{}
+	err := json.NewDecoder(c.Request().Body).Decode(&params)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return c.JSON(http.StatusBadRequest, apiError{Error: "params must be a JSON object"})
+	}
+
+	run, err := a.web.Submit(c.Request().Context(), c.Param("action"), params)
+	switch {
+	case errors.Is(err, markdown.ErrCommandNotFound):
+		return c.JSON(http.StatusNotFound, apiError{Error: err.Error()})
+	case errors.Is(err, runner.ErrInvalidCommand):
+		return c.JSON(http.StatusBadRequest, apiError{Error: err.Error()})
+	case err != nil:
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, apiError{Error: "unable to run command"})
+	}
+
+	return c.JSON(http.StatusAccepted, run)
+}
+
+func (a *api) run(c echo.Context) error {
+	run, ok := a.web.Run(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, apiError{Error: "run not found"})
+	}
+
+	if !a.canRun(c, run.Action) && !a.canView(c, run.Flow) {
+		return forbidden(c)
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, run)
+}
+
+// flowRuns lists the most recent runs of a flow, newest first
+func (a *api) flowRuns(c echo.Context) error {
+	if !a.canView(c, c.Param("id")) {
+		return forbidden(c)
+	}
+
+	flow, ok := a.history.Flow(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, apiError{Error: "flow not found"})
+	}
+
+	limit := defaultRunsLimit
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			return c.JSON(http.StatusBadRequest, apiError{Error: "limit must be a positive number"})
+		}
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, flowRuns{
+		Flow: flow.ID,
+		Name: flow.DisplayName(),
+		Runs: a.history.Runs(flow.ID, limit),
+	})
+}
+
+// auditRecords lists the most recent audit records matching the filters in
+// the query params, newest first
+func (a *api) auditRecords(c echo.Context) error {
+	if !a.canAudit(c) {
+		return forbidden(c)
+	}
+
+	filter := audit.Filter{
+		SequenceID: c.QueryParam("sequence_id"),
+		Type:       c.QueryParam("type"),
+		Source:     c.QueryParam("source"),
+		Event:      c.QueryParam("event"),
+		Action:     c.QueryParam("action"),
+		Flow:       c.QueryParam("flow"),
+		Outcome:    c.QueryParam("outcome"),
+		User:       c.QueryParam("user"),
+	}
+
+	for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		v := c.QueryParam(param)
+		if v == "" {
+			continue
+		}
+
+		var err error
+		*t, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, apiError{Error: param + " must be an RFC 3339 time"})
+		}
+	}
+
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		filter.Limit, err = strconv.Atoi(l)
+		if err != nil || filter.Limit < 1 {
+			return c.JSON(http.StatusBadRequest, apiError{Error: "limit must be a positive number"})
+		}
+	}
+
+	records, err := a.audit.Query(c.Request().Context(), filter)
+	switch {
+	case errors.Is(err, audit.ErrInvalidFilter):
+		return c.JSON(http.StatusBadRequest, apiError{Error: err.Error()})
+	case err != nil:
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, apiError{Error: "unable to query audit trail"})
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, auditRecords{Records: records})
+}
@@ -0,0 +1,225 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/internal/audit"
+	"github.com/hiphops-io/hops/internal/auth"
+	"github.com/hiphops-io/hops/internal/runner"
+	"github.com/hiphops-io/hops/markdown"
+)
+
+type stubPublisher struct{}
+
+func (stubPublisher) Publish(ctx context.Context, data []byte, subject string) (*jetstream.PubAck, bool, error) {
+	return &jetstream.PubAck{}, true, nil
+}
+
+// testFlowReader reads a flow with the command deploy, with the ID deploy.index
+func testFlowReader(t *testing.T) *markdown.FlowReader {
+	flowsDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(flowsDir, "deploy"), 0744), "Test setup error")
+	err := os.WriteFile(filepath.Join(flowsDir, "deploy", "index.md"), []byte(`---
+command:
+- environment: {type: select, options: [staging, production], required: true}
+---
+# Deploy
+`), 0644)
+	require.NoError(t, err, "Test setup error")
+
+	fr := markdown.NewFlowReader(flowsDir)
+	require.NoError(t, fr.ReadAll(), "Test setup error")
+
+	return fr
+}
+
+// apiRequester registers the API and returns a func to make requests to it
+// with an optional bearer token
+func apiRequester(t *testing.T, a *api) func(method, path, token, body string) (int, map[string]any) {
+	e := echo.New()
+	a.register(e)
+
+	return func(method, path, token, body string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		e.ServeHTTP(rec, req)
+
+		resp := map[string]any{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return rec.Code, resp
+	}
+}
+
+func TestAPI(t *testing.T) {
+	fr := testFlowReader(t)
+	request := apiRequester(t, &api{
+		history: runner.NewRunHistory(fr),
+		web:     runner.NewWebFrontend(fr, stubPublisher{}),
+	})
+	do := func(method, path, body string) (int, map[string]any) {
+		return request(method, path, "", body)
+	}
+
+	code, command := do(http.MethodGet, "/api/commands/deploy", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Deploy", command["name"])
+	assert.Equal(t, []any{map[string]any{
+		"name":     "environment",
+		"label":    "Environment",
+		"type":     "select",
+		"required": true,
+		"options":  []any{"staging", "production"},
+	}}, command["params"])
+
+	code, run := do(http.MethodPost, "/api/commands/deploy", `{"environment": "staging"}`)
+	require.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, runner.RunStatusPending, run["status"])
+
+	code, polled := do(http.MethodGet, "/api/runs/"+run["id"].(string), "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, run["id"], polled["id"])
+
+	code, resp := do(http.MethodPost, "/api/commands/deploy", `{}`)
+	assert.Equal(t, http.StatusBadRequest, code, "Missing required params should be rejected")
+	assert.Contains(t, resp["error"], "environment")
+
+	code, _ = do(http.MethodPost, "/api/commands/deploy", `["staging"]`)
+	assert.Equal(t, http.StatusBadRequest, code, "Params that aren't an object should be rejected")
+
+	code, _ = do(http.MethodPost, "/api/commands/nope", `{}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(http.MethodGet, "/api/runs/nope", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(http.MethodGet, "/api/commands/nope", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, runs := do(http.MethodGet, "/api/flows/deploy.index/runs?limit=5", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"flow": "deploy.index", "name": "Deploy", "runs": []any{}}, runs)
+
+	code, _ = do(http.MethodGet, "/api/flows/deploy.index/runs?limit=0", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = do(http.MethodGet, "/api/flows/nope/runs", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestAPISubmitContentType(t *testing.T) {
+	fr := testFlowReader(t)
+	e := echo.New()
+	(&api{
+		history: runner.NewRunHistory(fr),
+		web:     runner.NewWebFrontend(fr, stubPublisher{}),
+	}).register(e)
+
+	type testCase struct {
+		name         string
+		contentType  string
+		body         string
+		expectedCode int
+	}
+
+	tests := []testCase{
+		{name: "JSON", contentType: echo.MIMEApplicationJSON, body: `{"environment": "staging"}`, expectedCode: http.StatusAccepted},
+		{name: "JSON with charset", contentType: echo.MIMEApplicationJSONCharsetUTF8, body: `{"environment": "staging"}`, expectedCode: http.StatusAccepted},
+		{name: "Form", contentType: echo.MIMEApplicationForm, body: "environment=staging", expectedCode: http.StatusUnsupportedMediaType},
+		{name: "Multipart form", contentType: echo.MIMEMultipartForm + "; boundary=x", body: "--x--", expectedCode: http.StatusUnsupportedMediaType},
+		{name: "Plain text", contentType: echo.MIMETextPlain, body: `{"environment": "staging"}`, expectedCode: http.StatusUnsupportedMediaType},
+		{name: "No content type", body: `{"environment": "staging"}`, expectedCode: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/commands/deploy", strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, tc.contentType)
+			}
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestAPIAuth(t *testing.T) {
+	fr := testFlowReader(t)
+
+	tokens, err := auth.NewStaticTokens([]auth.StaticToken{
+		{Name: "admin", Token: "admin-token", Groups: []string{"admins"}},
+		{Name: "viewer", Token: "viewer-token", Groups: []string{"viewers"}},
+		{Name: "outsider", Token: "outsider-token"},
+		{Name: "auditor", Token: "auditor-token", Groups: []string{"compliance"}},
+	})
+	require.NoError(t, err, "Test setup error")
+	policy, err := auth.NewPolicy([]auth.Role{
+		{Name: "admins", Groups: []string{"admins"}, Run: []string{"*"}},
+		{Name: "viewers", Groups: []string{"viewers"}, View: []string{"deploy.**"}},
+		{Name: "auditors", Groups: []string{"compliance"}, Audit: true},
+	})
+	require.NoError(t, err, "Test setup error")
+
+	do := apiRequester(t, &api{
+		audit:   audit.NewLog(nil),
+		authn:   tokens,
+		history: runner.NewRunHistory(fr),
+		policy:  policy,
+		web:     runner.NewWebFrontend(fr, stubPublisher{}),
+	})
+
+	type testCase struct {
+		name         string
+		method       string
+		path         string
+		token        string
+		body         string
+		expectedCode int
+	}
+
+	code, run := do(http.MethodPost, "/api/commands/deploy", "admin-token", `{"environment": "staging"}`)
+	require.Equal(t, http.StatusAccepted, code, "Test setup error")
+	runPath := "/api/runs/" + run["id"].(string)
+
+	tests := []testCase{
+		{name: "No token", method: http.MethodGet, path: "/api/commands/deploy", expectedCode: http.StatusUnauthorized},
+		{name: "Invalid token", method: http.MethodGet, path: "/api/commands/deploy", token: "nope", expectedCode: http.StatusUnauthorized},
+		{name: "Run allowed", method: http.MethodPost, path: "/api/commands/deploy", token: "admin-token", body: `{"environment": "staging"}`, expectedCode: http.StatusAccepted},
+		{name: "Run forbidden", method: http.MethodPost, path: "/api/commands/deploy", token: "viewer-token", body: `{"environment": "staging"}`, expectedCode: http.StatusForbidden},
+		{name: "Command forbidden", method: http.MethodGet, path: "/api/commands/deploy", token: "viewer-token", expectedCode: http.StatusForbidden},
+		{name: "Run status of runnable command", method: http.MethodGet, path: runPath, token: "admin-token", expectedCode: http.StatusOK},
+		{name: "Run status of viewable flow", method: http.MethodGet, path: runPath, token: "viewer-token", expectedCode: http.StatusOK},
+		{name: "Run status forbidden", method: http.MethodGet, path: runPath, token: "outsider-token", expectedCode: http.StatusForbidden},
+		{name: "Flow runs allowed", method: http.MethodGet, path: "/api/flows/deploy.index/runs", token: "viewer-token", expectedCode: http.StatusOK},
+		{name: "Flow runs forbidden", method: http.MethodGet, path: "/api/flows/deploy.index/runs", token: "admin-token", expectedCode: http.StatusForbidden},
+		{name: "Audit forbidden", method: http.MethodGet, path: "/api/audit", token: "admin-token", expectedCode: http.StatusForbidden},
+		{name: "Audit invalid type", method: http.MethodGet, path: "/api/audit?type=nope", token: "auditor-token", expectedCode: http.StatusBadRequest},
+		{name: "Audit invalid time", method: http.MethodGet, path: "/api/audit?since=yesterday", token: "auditor-token", expectedCode: http.StatusBadRequest},
+		{name: "Audit invalid limit", method: http.MethodGet, path: "/api/audit?limit=0", token: "auditor-token", expectedCode: http.StatusBadRequest},
+		{name: "Forbidden before not found", method: http.MethodGet, path: "/api/commands/nope", token: "outsider-token", expectedCode: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _ := do(tc.method, tc.path, tc.token, tc.body)
+			assert.Equal(t, tc.expectedCode, code)
+		})
+	}
+}
@@ -0,0 +1,276 @@
+// Hydrates the command forms and shortcodes of pages built by hops build from
+// the hops API
+(() => {
+  // refreshInterval is how often shortcodes showing runs are refreshed
+  const refreshInterval = 10000;
+
+  const statusLabels = {
+    pending: "Queued",
+    awaiting_approval: "Waiting for approval",
+    running: "Running",
+    succeeded: "Succeeded",
+    failed: "Failed",
+    rejected: "Rejected",
+  };
+
+  const isDone = (status) => status === "succeeded" || status === "failed" || status === "rejected";
+
+  // tokenKey is where the API token signed in with is kept for the session
+  const tokenKey = "hops_token";
+
+  // signIn asks for an API token once per page, shared by every request the
+  // API rejects, so hydrating a page doesn't prompt for each shortcode
+  let signingIn = null;
+  const signIn = () => {
+    signingIn =
+      signingIn ||
+      new Promise((resolve) =>
+        setTimeout(() => {
+          const token = (window.prompt("Sign in to hops with an API token") || "").trim();
+          if (token) {
+            sessionStorage.setItem(tokenKey, token);
+          }
+          resolve(token !== "");
+        }),
+      );
+    return signingIn;
+  };
+
+  const request = async (url, options, retry = true) => {
+    const token = sessionStorage.getItem(tokenKey);
+    const headers = { ...(options && options.headers) };
+    if (token) {
+      headers.Authorization = "Bearer " + token;
+    }
+
+    const response = await fetch(url, { ...options, headers });
+    const body = await response.json().catch(() => ({}));
+    if (response.status === 401 && retry) {
+      const signedIn = sessionStorage.getItem(tokenKey) !== token || (await signIn());
+      if (signedIn) {
+        return request(url, options, false);
+      }
+    }
+    if (!response.ok) {
+      throw new Error(body.error || response.statusText);
+    }
+    return body;
+  };
+
+  const element = (tag, attrs, ...children) => {
+    const el = document.createElement(tag);
+    Object.entries(attrs || {}).forEach(([name, value]) => {
+      if (value === true) {
+        el.setAttribute(name, "");
+      } else if (value !== false && value !== undefined && value !== null) {
+        el.setAttribute(name, value);
+      }
+    });
+    el.append(...children);
+    return el;
+  };
+
+  const formatDuration = (ms) => (ms / 1000).toFixed(1) + "s";
+
+  const formatTime = (iso) => new Date(iso).toLocaleString();
+
+  // hydrateCommandForm runs a form's command through the API on submit,
+  // polling until its run finishes
+  const hydrateCommandForm = (form) => {
+    const button = form.querySelector("button[type=submit]");
+    const status = form.querySelector(".command_status");
+
+    const show = (run) => {
+      let text = statusLabels[run.status] || run.status;
+      if (run.duration_ms) {
+        text += " in " + formatDuration(run.duration_ms);
+      }
+      if (run.error) {
+        text += "\n\n" + run.error;
+      }
+      if (run.output) {
+        text += "\n\n" + run.output;
+      }
+
+      status.dataset.status = run.status;
+      status.textContent = text;
+      status.hidden = false;
+    };
+
+    form.addEventListener("submit", async (event) => {
+      event.preventDefault();
+
+      const params = {};
+      form.querySelectorAll("[name]").forEach((field) => {
+        if (field.type === "checkbox") {
+          params[field.name] = field.checked;
+        } else if (field.multiple) {
+          params[field.name] = Array.from(field.selectedOptions, (option) => option.value);
+        } else {
+          params[field.name] = field.value;
+        }
+      });
+
+      button.disabled = true;
+      try {
+        let run = await request("/api/commands/" + encodeURIComponent(form.dataset.action), {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify(params),
+        });
+        show(run);
+
+        while (!isDone(run.status)) {
+          await new Promise((resolve) => setTimeout(resolve, 1000));
+          run = await request("/api/runs/" + encodeURIComponent(run.id));
+          show(run);
+        }
+      } catch (err) {
+        show({ status: "failed", error: "Unable to run command: " + err.message });
+      } finally {
+        button.disabled = false;
+      }
+    });
+  };
+
+  // paramField builds the field of a command param, matching the command
+  // forms of flow pages
+  const paramField = (param) => {
+    const id = "param-" + param.name;
+    const attrs = { id: id, name: param.name, required: param.required && param.type !== "bool" };
+    const defaults = [].concat(param.default ?? []).map(String);
+    let field;
+
+    if ((param.type === "select" || param.type === "multiselect") && param.options) {
+      field = element("select", { ...attrs, multiple: param.type === "multiselect" });
+      if (param.type === "select" && !param.required) {
+        field.append(element("option", { value: "" }));
+      }
+      param.options.forEach((option) => {
+        field.append(element("option", { selected: defaults.includes(option) }, option));
+      });
+    } else if (param.type === "bool") {
+      field = element("input", { ...attrs, type: "checkbox", checked: param.default === true });
+    } else if (param.type === "text") {
+      field = element("textarea", attrs, defaults.join(""));
+    } else {
+      const types = { number: "number", date: "date", datetime: "datetime-local" };
+      let value = defaults.join(",");
+      if (param.type === "datetime" && value) {
+        value = value.slice(0, 16);
+      }
+      field = element("input", {
+        ...attrs,
+        type: types[param.type] || "text",
+        value: value,
+        step: param.type === "number" ? "any" : undefined,
+        placeholder: ["user", "channel", "conversation"].includes(param.type) ? param.type : undefined,
+      });
+    }
+
+    const p = element("p", {}, element("label", { for: id }, param.label + (param.required ? " *" : "")), field);
+    if (param.options_from && !param.options) {
+      p.append(element("small", {}, "Options from ", element("code", {}, param.options_from)));
+    }
+    return p;
+  };
+
+  const statusBadge = (status) =>
+    element("span", { class: "hops_status", "data-status": status }, statusLabels[status] || status);
+
+  const shortcodes = {
+    command: async (el) => {
+      const command = await request("/api/commands/" + encodeURIComponent(el.dataset.action));
+      const form = element("form", { class: "command_form", "data-action": command.action });
+      command.params.forEach((param) => form.append(paramField(param)));
+      form.append(
+        element("button", { type: "submit" }, "Run " + command.name),
+        element("div", { class: "command_status", role: "status", hidden: true }),
+      );
+
+      el.replaceChildren(form);
+      hydrateCommandForm(form);
+    },
+
+    "flow-status": async (el) => {
+      const flow = await request("/api/flows/" + encodeURIComponent(el.dataset.id) + "/runs?limit=1");
+      const run = flow.runs[0];
+      const status = run
+        ? [statusBadge(run.status), " " + formatTime(run.updated_at)]
+        : [element("span", { class: "hops_status" }, "No recent runs")];
+
+      el.replaceChildren(element("strong", {}, flow.name), " ", ...status);
+      return true;
+    },
+
+    "run-history": async (el) => {
+      const limit = el.dataset.limit || "10";
+      const flow = await request("/api/flows/" + encodeURIComponent(el.dataset.flow) + "/runs?limit=" + limit);
+      if (flow.runs.length === 0) {
+        el.replaceChildren(element("p", {}, "No recent runs of " + flow.name));
+        return true;
+      }
+
+      const rows = flow.runs.map((run) =>
+        element(
+          "tr",
+          {},
+          element("td", {}, formatTime(run.started_at)),
+          element("td", {}, element("code", {}, run.source + "." + run.event)),
+          element("td", { title: run.error || undefined }, statusBadge(run.status)),
+          element("td", {}, run.duration_ms ? formatDuration(run.duration_ms) : ""),
+        ),
+      );
+
+      el.replaceChildren(
+        element(
+          "table",
+          {},
+          element("caption", {}, "Recent runs of " + flow.name),
+          element(
+            "tr",
+            {},
+            ...["Started", "Trigger", "Status", "Duration"].map((h) => element("th", {}, h)),
+          ),
+          ...rows,
+        ),
+      );
+      return true;
+    },
+  };
+
+  // hydrate renders a shortcode, refreshing shortcodes that show runs
+  const hydrate = async (el) => {
+    const render = shortcodes[el.dataset.shortcode];
+    if (!render) {
+      return;
+    }
+
+    el.setAttribute("aria-busy", "true");
+    let refresh = false;
+    try {
+      refresh = await render(el);
+      el.classList.remove("hops_shortcode_unavailable");
+    } catch (err) {
+      el.classList.add("hops_shortcode_unavailable");
+      el.replaceChildren("Unavailable: " + err.message);
+    } finally {
+      el.removeAttribute("aria-busy");
+    }
+
+    if (refresh) {
+      setTimeout(() => hydrate(el), refreshInterval);
+    }
+  };
+
+  const init = () => {
+    document.querySelectorAll("form.command_form").forEach(hydrateCommandForm);
+    document.querySelectorAll(".hops_shortcode").forEach(hydrate);
+  };
+
+  if (document.readyState === "loading") {
+    document.addEventListener("DOMContentLoaded", init);
+  } else {
+    init();
+  }
+})();
@@ -2,28 +2,88 @@ package httpserver
 
 import (
 	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/hiphops-io/hops/internal/audit"
+	"github.com/hiphops-io/hops/internal/auth"
+	"github.com/hiphops-io/hops/internal/health"
+	"github.com/hiphops-io/hops/internal/runner"
 	"github.com/hiphops-io/hops/nats"
 )
 
+// DefaultAllowedOrigins are the origins allowed to make cross origin requests
+// if none are configured
+var DefaultAllowedOrigins = []string{"http://localhost:*", "http://0.0.0.0:*", "https://*.hiphops.io"}
+
 type (
 	HTTPServer struct {
-		address    string
-		natsClient *nats.Client
-		server     *echo.Echo
+		address        string
+		allowedOrigins []string
+		audit          *audit.Log
+		authn          auth.Authenticator
+		commands       *runner.WebFrontend
+		health         *health.Checker
+		history        *runner.RunHistory
+		metrics        prometheus.Gatherer
+		natsClient     *nats.Client
+		policy         *auth.Policy
+		readTimeout    time.Duration
+		server         *echo.Echo
+		siteDir        string
+		tlsCert        string
+		tlsKey         string
+		trustedProxies []*net.IPNet
+		writeTimeout   time.Duration
 	}
+
+	HTTPServerOpt func(*HTTPServer)
 )
 
-func NewHTTPServer(addr string, natsClient *nats.Client) *HTTPServer {
+func NewHTTPServer(addr string, natsClient *nats.Client, opts ...HTTPServerOpt) *HTTPServer {
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
+
+	h := &HTTPServer{
+		address:        addr,
+		allowedOrigins: DefaultAllowedOrigins,
+		natsClient:     natsClient,
+		server:         e,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	e.Server.ReadTimeout = h.readTimeout
+	e.Server.WriteTimeout = h.writeTimeout
+	e.TLSServer.ReadTimeout = h.readTimeout
+	e.TLSServer.WriteTimeout = h.writeTimeout
+
+	// Client IPs are only read from X-Forwarded-For when set by a trusted proxy
+	e.IPExtractor = echo.ExtractIPDirect()
+	if len(h.trustedProxies) > 0 {
+		trustOpts := []echo.TrustOption{
+			echo.TrustLoopback(false),
+			echo.TrustLinkLocal(false),
+			echo.TrustPrivateNet(false),
+		}
+		for _, ipRange := range h.trustedProxies {
+			trustOpts = append(trustOpts, echo.TrustIPRange(ipRange))
+		}
+		e.IPExtractor = echo.ExtractIPFromXFFHeader(trustOpts...)
+	}
+
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		// TODO: The host names etc here will require user config, given this will be self hosted
-		AllowOrigins:     []string{"http://localhost:*", "http://0.0.0.0:*", "https://*.hiphops.io"},
+		AllowOrigins:     h.allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{echo.HeaderAccept, echo.HeaderAuthorization, echo.HeaderContentType, echo.HeaderXCSRFToken},
 		AllowCredentials: true,
@@ -31,17 +91,161 @@ func NewHTTPServer(addr string, natsClient *nats.Client) *HTTPServer {
 	}))
 	e.Use(echo.WrapMiddleware(nats.HealthcheckMiddleware(natsClient, "/health")))
 
-	return &HTTPServer{
-		address:    addr,
-		natsClient: natsClient,
-		server:     e,
+	(&api{
+		audit:   h.audit,
+		authn:   h.authn,
+		history: h.history,
+		policy:  h.policy,
+		web:     h.commands,
+	}).register(e)
+
+	if h.health != nil {
+		live := healthHandler(h.health.Live)
+		e.GET("/health/live", live)
+		e.HEAD("/health/live", live)
+
+		ready := healthHandler(h.health.Ready)
+		e.GET("/health/ready", ready)
+		e.HEAD("/health/ready", ready)
+	}
+
+	if h.metrics != nil {
+		e.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(h.metrics, promhttp.HandlerOpts{})))
+	}
+
+	if h.siteDir != "" {
+		e.GET(HopsScriptPath, echo.WrapHandler(HopsScriptHandler()))
+
+		site := echo.WrapHandler(NewSiteHandler(h.siteDir))
+		e.GET("/*", site)
+		e.HEAD("/*", site)
+	}
+
+	return h
+}
+
+// WithAllowedOriginsOpt sets the origins allowed to make cross origin
+// requests, which may contain wildcards
+func WithAllowedOriginsOpt(origins []string) HTTPServerOpt {
+	return func(h *HTTPServer) {
+		if len(origins) > 0 {
+			h.allowedOrigins = origins
+		}
+	}
+}
+
+// WithAuditOpt serves an API to query the audit trail of decisions made about
+// events
+func WithAuditOpt(log *audit.Log) HTTPServerOpt {
+	return func(h *HTTPServer) {
+		h.audit = log
+	}
+}
+
+// WithAuthOpt requires API requests to be authenticated by authn, limiting
+// what they may do to what policy allows
+func WithAuthOpt(authn auth.Authenticator, policy *auth.Policy) HTTPServerOpt {
+	return func(h *HTTPServer) {
+		h.authn = authn
+		h.policy = policy
+	}
+}
+
+// WithCommandsOpt serves an API to run commands from the site's forms
+func WithCommandsOpt(web *runner.WebFrontend) HTTPServerOpt {
+	return func(h *HTTPServer) {
+		h.commands = web
 	}
 }
 
+// WithHealthOpt serves the checker's liveness and readiness reports at
+// /health/live and /health/ready, for Kubernetes probes
+func WithHealthOpt(checker *health.Checker) HTTPServerOpt {
+	return func(h *HTTPServer) {
+		h.health = checker
+	}
+}
+
+// WithMetricsOpt serves the gatherer's metrics at /metrics, for Prometheus
+func WithMetricsOpt(gatherer prometheus.Gatherer) HTTPServerOpt {
+	return func(h *HTTPServer) {
+		h.metrics = gatherer
+	}
+}
+
+// WithRunHistoryOpt serves an API listing the recent runs of flows, as shown
+// by the site's shortcodes
+func WithRunHistoryOpt(history *runner.RunHistory) HTTPServerOpt {
+	return func(h *HTTPServer) {
+		h.history = history
+	}
+}
+
+// WithSiteDirOpt serves the site built by hops build from dir
+func WithSiteDirOpt(dir string) HTTPServerOpt {
+	return func(h *HTTPServer) {
+		h.siteDir = dir
+	}
+}
+
+// WithTimeoutsOpt limits how long reading requests and writing responses may
+// take, where zero is no limit
+func WithTimeoutsOpt(read, write time.Duration) HTTPServerOpt {
+	return func(h *HTTPServer) {
+		h.readTimeout = read
+		h.writeTimeout = write
+	}
+}
+
+// WithTLSOpt serves HTTPS using the given cert and key files
+func WithTLSOpt(certFile, keyFile string) HTTPServerOpt {
+	return func(h *HTTPServer) {
+		h.tlsCert = certFile
+		h.tlsKey = keyFile
+	}
+}
+
+// WithTrustedProxiesOpt trusts the X-Forwarded-For header of requests from the
+// given IP ranges when reading clients' IPs
+func WithTrustedProxiesOpt(ranges []*net.IPNet) HTTPServerOpt {
+	return func(h *HTTPServer) {
+		h.trustedProxies = ranges
+	}
+}
+
+// healthHandler responds with the report from probe, which is unavailable if
+// any check failed
+func healthHandler(probe func(context.Context) health.Report) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		report := probe(c.Request().Context())
+
+		status := http.StatusOK
+		if !report.OK() {
+			status = http.StatusServiceUnavailable
+		}
+
+		return c.JSON(status, report)
+	}
+}
+
+// Serve blocks until the server is shut down, which isn't an error
 func (h *HTTPServer) Serve() error {
-	return h.server.Start(h.address)
+	var err error
+	if h.tlsCert != "" {
+		err = h.server.StartTLS(h.address, h.tlsCert, h.tlsKey)
+	} else {
+		err = h.server.Start(h.address)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
 }
 
+// Shutdown stops accepting requests and waits for those in flight to finish,
+// until ctx is done
 func (h *HTTPServer) Shutdown(ctx context.Context) error {
 	return h.server.Shutdown(ctx)
 }
@@ -0,0 +1,159 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/internal/health"
+)
+
+func TestHTTPServerCORS(t *testing.T) {
+	type testCase struct {
+		name        string
+		opts        []HTTPServerOpt
+		origin      string
+		expectAllow bool
+	}
+
+	tests := []testCase{
+		{name: "Default origins", origin: "https://app.hiphops.io", expectAllow: true},
+		{name: "Default origins disallowed", origin: "https://hops.example.com"},
+		{
+			name:        "Configured origins",
+			opts:        []HTTPServerOpt{WithAllowedOriginsOpt([]string{"https://hops.example.com"})},
+			origin:      "https://hops.example.com",
+			expectAllow: true,
+		},
+		{
+			name:   "Configured origins replace defaults",
+			opts:   []HTTPServerOpt{WithAllowedOriginsOpt([]string{"https://hops.example.com"})},
+			origin: "https://app.hiphops.io",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHTTPServer(":0", nil, tc.opts...)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodOptions, "/api/commands/deploy", nil)
+			req.Header.Set(echo.HeaderOrigin, tc.origin)
+			req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+			h.server.ServeHTTP(rec, req)
+
+			if tc.expectAllow {
+				assert.Equal(t, tc.origin, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+			} else {
+				assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+			}
+		})
+	}
+}
+
+func TestHTTPServerTrustedProxies(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err, "Test setup error")
+
+	type testCase struct {
+		name       string
+		opts       []HTTPServerOpt
+		remoteAddr string
+		expectedIP string
+	}
+
+	tests := []testCase{
+		{name: "No trusted proxies", remoteAddr: "10.0.0.5:1234", expectedIP: "10.0.0.5"},
+		{
+			name:       "Trusted proxy",
+			opts:       []HTTPServerOpt{WithTrustedProxiesOpt([]*net.IPNet{proxies})},
+			remoteAddr: "10.0.0.5:1234",
+			expectedIP: "203.0.113.7",
+		},
+		{
+			name:       "Untrusted proxy",
+			opts:       []HTTPServerOpt{WithTrustedProxiesOpt([]*net.IPNet{proxies})},
+			remoteAddr: "192.168.0.5:1234",
+			expectedIP: "192.168.0.5",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHTTPServer(":0", nil, tc.opts...)
+			h.server.GET("/ip", func(c echo.Context) error {
+				return c.String(http.StatusOK, c.RealIP())
+			})
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7")
+			h.server.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedIP, rec.Body.String())
+		})
+	}
+}
+
+func TestHTTPServerMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	promauto.With(registry).NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "Test"})
+
+	h := NewHTTPServer(":0", nil, WithMetricsOpt(registry))
+
+	rec := httptest.NewRecorder()
+	h.server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "# TYPE test_total counter\ntest_total 0\n")
+}
+
+func TestHTTPServerHealth(t *testing.T) {
+	checker := health.NewChecker()
+	checker.AddLive("nats", func(ctx context.Context) error { return nil })
+	checker.AddReady("flows", func(ctx context.Context) error { return errors.New("flows failed to load") })
+
+	h := NewHTTPServer(":0", nil, WithHealthOpt(checker))
+
+	rec := httptest.NewRecorder()
+	h.server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status": "ok", "checks": {"nats": {"status": "ok", "duration_ms": 0}}}`, zeroDurations(t, rec.Body.Bytes()))
+
+	rec = httptest.NewRecorder()
+	h.server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"status": "fail", "checks": {
+		"nats": {"status": "ok", "duration_ms": 0},
+		"flows": {"status": "fail", "error": "flows failed to load", "duration_ms": 0}
+	}}`, zeroDurations(t, rec.Body.Bytes()))
+
+	rec = httptest.NewRecorder()
+	h.server.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/health/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+// zeroDurations zeroes how long health checks took, which varies between runs
+func zeroDurations(t *testing.T, body []byte) string {
+	report := health.Report{}
+	require.NoError(t, json.Unmarshal(body, &report))
+	for name, result := range report.Checks {
+		result.DurationMS = 0
+		report.Checks[name] = result
+	}
+
+	out, err := json.Marshal(report)
+	require.NoError(t, err)
+	return string(out)
+}
@@ -0,0 +1,76 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// LiveReloadPath is the endpoint pages listen to for reloads
+const LiveReloadPath = "/_hops/livereload"
+
+// LiveReloadSnippet reloads a page when the site is rebuilt
+const LiveReloadSnippet = `<script>new EventSource("` + LiveReloadPath + `").addEventListener("reload", () => location.reload());</script>`
+
+// LiveReload pushes reloads to connected browsers as server-sent events
+type LiveReload struct {
+	clients map[chan struct{}]bool
+	mutex   sync.Mutex
+}
+
+func NewLiveReload() *LiveReload {
+	return &LiveReload{clients: map[chan struct{}]bool{}}
+}
+
+// Reload tells every connected browser to reload
+func (l *LiveReload) Reload() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for client := range l.clients {
+		// Clients with a reload already pending don't need another
+		select {
+		case client <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (l *LiveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client := make(chan struct{}, 1)
+	l.mutex.Lock()
+	l.clients[client] = true
+	l.mutex.Unlock()
+
+	defer func() {
+		l.mutex.Lock()
+		delete(l.clients, client)
+		l.mutex.Unlock()
+	}()
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// A comment lets the browser know it's connected
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-client:
+			fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package httpserver
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveReload(t *testing.T) {
+	liveReload := NewLiveReload()
+	server := httptest.NewServer(liveReload)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+				events <- strings.TrimPrefix(line, "event: ")
+			}
+		}
+		close(events)
+	}()
+
+	// The client is registered once its stream has started
+	require.Eventually(t, func() bool {
+		liveReload.mutex.Lock()
+		defer liveReload.mutex.Unlock()
+		return len(liveReload.clients) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	liveReload.Reload()
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "reload", event)
+	case <-time.After(time.Second):
+		t.Fatal("Reload event should be sent to connected clients")
+	}
+}
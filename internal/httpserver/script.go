@@ -0,0 +1,24 @@
+package httpserver
+
+import (
+	"bytes"
+	_ "embed"
+	"net/http"
+	"time"
+)
+
+// HopsScriptPath is where the script that hydrates the site's command forms
+// and shortcodes from the hops API is served
+const HopsScriptPath = "/_hops/hops.js"
+
+//go:embed assets/hops.js
+var hopsScript []byte
+
+// HopsScriptHandler serves the script that hydrates the site
+func HopsScriptHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", assetCacheControl)
+		http.ServeContent(w, r, "hops.js", time.Time{}, bytes.NewReader(hopsScript))
+	})
+}
@@ -0,0 +1,177 @@
+package httpserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// htmlCacheControl makes browsers revalidate pages, so changes to the
+	// site are seen straight away
+	htmlCacheControl = "no-cache"
+	// assetCacheControl lets browsers cache other files for a short time, as
+	// their names don't change with their content
+	assetCacheControl = "public, max-age=300"
+	// notFoundPage is served with a 404 status if present in the site
+	notFoundPage = "404.html"
+)
+
+type (
+	// SiteHandler serves the static site built by hops build
+	//
+	// The dir may be a link that's swapped to a new build, which is resolved
+	// once per request so each request reads from a single build
+	SiteHandler struct {
+		dir string
+		// snippet is inserted before the closing body tag of HTML pages
+		snippet []byte
+	}
+
+	SiteHandlerOpt func(*SiteHandler)
+)
+
+func NewSiteHandler(dir string, opts ...SiteHandlerOpt) *SiteHandler {
+	s := &SiteHandler{dir: dir}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithHTMLSnippetOpt inserts a snippet of HTML into every page served
+func WithHTMLSnippetOpt(snippet string) SiteHandlerOpt {
+	return func(s *SiteHandler) {
+		s.snippet = []byte(snippet)
+	}
+}
+
+func (s *SiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	root, err := filepath.EvalSymlinks(s.dir)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	filePath, ok := resolve(root, r.URL.Path)
+	if !ok {
+		s.serveNotFound(w, r, root)
+		return
+	}
+
+	if err := s.serveFile(w, r, filePath, http.StatusOK); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// resolve finds the file in root for a URL path, where directories are served
+// by their index page and '.html' is optional
+func resolve(root, urlPath string) (string, bool) {
+	// Cleaning a rooted path removes any '..', so files outside of dir can't
+	// be reached
+	cleaned := path.Clean("/" + urlPath)
+
+	// Hidden files such as the build manifest aren't part of the site
+	if strings.Contains(cleaned, "/.") {
+		return "", false
+	}
+
+	candidates := []string{cleaned}
+	if strings.HasSuffix(urlPath, "/") || cleaned == "/" {
+		candidates = []string{path.Join(cleaned, "index.html")}
+	} else if path.Ext(cleaned) == "" {
+		candidates = append(candidates, cleaned+".html", path.Join(cleaned, "index.html"))
+	}
+
+	for _, candidate := range candidates {
+		filePath := filepath.Join(root, filepath.FromSlash(candidate))
+
+		info, err := os.Stat(filePath)
+		if err == nil && info.Mode().IsRegular() {
+			return filePath, true
+		}
+	}
+
+	return "", false
+}
+
+func (s *SiteHandler) serveNotFound(w http.ResponseWriter, r *http.Request, root string) {
+	filePath := filepath.Join(root, notFoundPage)
+	err := s.serveFile(w, r, filePath, http.StatusNotFound)
+	if err != nil {
+		http.NotFound(w, r)
+	}
+}
+
+// serveFile writes a file of the site, with a status other than 200 skipping
+// conditional request handling
+func (s *SiteHandler) serveFile(w http.ResponseWriter, r *http.Request, filePath string, status int) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return fmt.Errorf("unable to read site file: %w", err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+
+	isHTML := strings.EqualFold(filepath.Ext(filePath), ".html")
+	if isHTML && len(s.snippet) > 0 {
+		content = injectSnippet(content, s.snippet)
+	}
+
+	header := w.Header()
+	if isHTML {
+		header.Set("Cache-Control", htmlCacheControl)
+	} else {
+		header.Set("Cache-Control", assetCacheControl)
+	}
+
+	if status != http.StatusOK {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			w.Write(content)
+		}
+		return nil
+	}
+
+	header.Set("ETag", fmt.Sprintf(`W/"%x-%x"`, info.ModTime().UnixNano(), len(content)))
+	http.ServeContent(w, r, filePath, info.ModTime(), bytes.NewReader(content))
+
+	return nil
+}
+
+// injectSnippet inserts snippet before the closing body tag of a page, or at
+// the end if there isn't one
+func injectSnippet(content, snippet []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(content), []byte("</body>"))
+	if i < 0 {
+		return append(content, snippet...)
+	}
+
+	injected := make([]byte, 0, len(content)+len(snippet))
+	injected = append(injected, content[:i]...)
+	injected = append(injected, snippet...)
+	injected = append(injected, content[i:]...)
+
+	return injected
+}
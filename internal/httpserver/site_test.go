@@ -0,0 +1,147 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSiteHandler(t *testing.T) {
+	siteDir := setupSiteDir(t, map[string]string{
+		"index.html":      "<html><body>Home</body></html>",
+		"404.html":        "<html><body>Missing</body></html>",
+		"docs/index.html": "<html><body>Docs</body></html>",
+		"docs/setup.html": "<html><body>Setup</body></html>",
+		"css/base.css":    "body {}",
+		".manifest.json":  "{}",
+	})
+
+	type testCase struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   string
+		expectedCache  string
+	}
+
+	tests := []testCase{
+		{name: "Root", path: "/", expectedStatus: 200, expectedBody: "Home", expectedCache: htmlCacheControl},
+		{name: "Page", path: "/docs/setup.html", expectedStatus: 200, expectedBody: "Setup", expectedCache: htmlCacheControl},
+		{name: "Page without extension", path: "/docs/setup", expectedStatus: 200, expectedBody: "Setup"},
+		{name: "Directory index", path: "/docs/", expectedStatus: 200, expectedBody: "Docs"},
+		{name: "Directory without slash", path: "/docs", expectedStatus: 200, expectedBody: "Docs"},
+		{name: "Asset", path: "/css/base.css", expectedStatus: 200, expectedBody: "body {}", expectedCache: assetCacheControl},
+		{name: "Missing page", path: "/nope", expectedStatus: 404, expectedBody: "Missing"},
+		{name: "Hidden file", path: "/.manifest.json", expectedStatus: 404, expectedBody: "Missing"},
+		{name: "Outside site", path: "/../secret.txt", expectedStatus: 404, expectedBody: "Missing"},
+		{name: "Unsupported method", method: http.MethodPost, path: "/", expectedStatus: 405},
+	}
+
+	handler := NewSiteHandler(siteDir)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(method, "/", nil)
+			req.URL.Path = tc.path
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatus, rec.Code)
+			assert.Contains(t, rec.Body.String(), tc.expectedBody)
+			if tc.expectedCache != "" {
+				assert.Equal(t, tc.expectedCache, rec.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestSiteHandlerConditional(t *testing.T) {
+	siteDir := setupSiteDir(t, map[string]string{"index.html": "Home"})
+	handler := NewSiteHandler(siteDir)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag, "Pages should have an ETag")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+}
+
+func TestSiteHandlerSnippet(t *testing.T) {
+	siteDir := setupSiteDir(t, map[string]string{
+		"index.html":   "<html><BODY>Home</BODY></html>",
+		"partial.html": "<p>No body</p>",
+		"app.js":       "console.log('</body>')",
+	})
+	handler := NewSiteHandler(siteDir, WithHTMLSnippetOpt("<script></script>"))
+
+	expected := map[string]string{
+		"/":             "<html><BODY>Home<script></script></BODY></html>",
+		"/partial.html": "<p>No body</p><script></script>",
+		"/app.js":       "console.log('</body>')",
+	}
+
+	for path, body := range expected {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, body, rec.Body.String(), "Snippet should only be added to HTML pages")
+	}
+
+	// Without a 404 page, the default is served
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestSiteHandlerLink(t *testing.T) {
+	first := setupSiteDir(t, map[string]string{"index.html": "First"})
+	second := setupSiteDir(t, map[string]string{"index.html": "Second"})
+
+	link := filepath.Join(t.TempDir(), "current")
+	handler := NewSiteHandler(link)
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNotFound, get().Code, "Nothing should be served before the first build")
+
+	require.NoError(t, os.Symlink(first, link))
+	assert.Equal(t, "First", get().Body.String())
+
+	// Builds are published by renaming a new link over the current one
+	require.NoError(t, os.Symlink(second, link+".tmp"))
+	require.NoError(t, os.Rename(link+".tmp", link))
+	assert.Equal(t, "Second", get().Body.String(), "The new build should be served once linked")
+}
+
+func setupSiteDir(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for relPath, content := range files {
+		path := filepath.Join(dir, relPath)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	return dir
+}
@@ -0,0 +1,482 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/manterfield/go-mapreader"
+	"github.com/rs/zerolog"
+
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+const (
+	// botFrameworkTenant issues tokens for multi tenant bots
+	botFrameworkTenant = "botframework.com"
+	botFrameworkScope  = "https://api.botframework.com/.default"
+	// botFrameworkTokenLeeway is how long before expiry tokens are refreshed
+	botFrameworkTokenLeeway = 5 * time.Minute
+
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+	adaptiveCardSchema      = "http://adaptivecards.io/schemas/adaptive-card.json"
+	adaptiveCardVersion     = "1.5"
+	// adaptiveCardTimeSuffix is appended to the ID of the time input of datetime params
+	adaptiveCardTimeSuffix = "__time"
+	// adaptiveCardSubmitKey holds the command metadata in a card's submitted value
+	adaptiveCardSubmitKey = "hops_command"
+)
+
+// botFrameworkOrigins are the origins bot framework services may be at, as
+// given by the serviceUrl of activities. Replies carry the bot's access token,
+// so are never posted to services elsewhere
+var botFrameworkOrigins = []string{
+	"https://smba.trafficmanager.net",
+	"https://*.botframework.com",
+	"https://*.botframework.azure.us",
+	"https://smba.infra.gcc.teams.microsoft.com",
+	"https://smba.infra.gov.teams.microsoft.us",
+	"https://smba.infra.dod.teams.microsoft.us",
+}
+
+type (
+	// AdaptiveCardFrontend runs commands from bot framework conversations such
+	// as microsoft teams, presenting each command as an adaptive card
+	//
+	// Replies are posted to the conversation the command came from, as bot
+	// framework has no messages visible only to a single user
+	AdaptiveCardFrontend struct {
+		api *APIClient
+		// serviceOrigins are the patterns of origins replies may be posted to
+		serviceOrigins []string
+	}
+
+	// BotFrameworkTokens fetches access tokens for a bot framework bot with its
+	// app credentials, caching each until it's invalidated or about to expire
+	BotFrameworkTokens struct {
+		appID       string
+		appPassword string
+		httpClient  *http.Client
+		mu          sync.Mutex
+		expires     time.Time
+		token       string
+		tokenURL    string
+	}
+
+	// AdaptiveCard is an adaptive card, with elements left as maps given the
+	// number of element types
+	AdaptiveCard struct {
+		Type    string           `json:"type"`
+		Schema  string           `json:"$schema"`
+		Version string           `json:"version"`
+		Body    []map[string]any `json:"body"`
+		Actions []map[string]any `json:"actions"`
+	}
+
+	// AdaptiveCardSubmitData is submitted alongside input values when a
+	// command's card is submitted, carrying what's needed to parse them
+	AdaptiveCardSubmitData struct {
+		CommandAction string            `json:"command_action"`
+		ParamTypes    map[string]string `json:"param_types"`
+	}
+)
+
+func NewAdaptiveCardFrontend(api *APIClient) *AdaptiveCardFrontend {
+	return &AdaptiveCardFrontend{
+		api:            api,
+		serviceOrigins: botFrameworkOrigins,
+	}
+}
+
+// NewBotFrameworkTokens creates a token source for the bot with the given app
+// credentials. The tenant is only needed for single tenant bots
+func NewBotFrameworkTokens(appID, appPassword, tenantID string) *BotFrameworkTokens {
+	if tenantID == "" {
+		tenantID = botFrameworkTenant
+	}
+
+	return &BotFrameworkTokens{
+		appID:       appID,
+		appPassword: appPassword,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		tokenURL:    "https://login.microsoftonline.com/" + url.PathEscape(tenantID) + "/oauth2/v2.0/token",
+	}
+}
+
+func (b *BotFrameworkTokens) Token() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.token != "" && time.Now().Before(b.expires) {
+		return b.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {b.appID},
+		"client_secret": {b.appPassword},
+		"scope":         {botFrameworkScope},
+	}
+	resp, err := b.httpClient.PostForm(b.tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch bot framework token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("unable to read bot framework token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &APIError{StatusCode: resp.StatusCode, Body: string(body[:min(len(body), apiMaxErrorBody)])}
+	}
+
+	result := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("unable to parse bot framework token: %w", err)
+	}
+	if result.AccessToken == "" {
+		return "", errors.New("received an empty access token")
+	}
+
+	b.token = result.AccessToken
+	b.expires = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - botFrameworkTokenLeeway)
+
+	return b.token, nil
+}
+
+func (b *BotFrameworkTokens) Invalidate() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.token = ""
+}
+
+// RequestCommand replies to a command request with the command's card, or
+// lets the user know why it can't be shown
+func (a *AdaptiveCardFrontend) RequestCommand(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg, matchErr error, logger zerolog.Logger) error {
+	replyURL, err := a.activityReplyURL(hopsMsg.Data)
+	if err != nil {
+		return fmt.Errorf("%w: unable to reply to command request: %w", nats.ErrEventFatal, err)
+	}
+
+	commandText := mapreader.Str(hopsMsg.Data, "text")
+	logger = logger.With().Str("command", commandText).Logger()
+
+	if msg := commandRequestError(flow, matchErr, commandText, logger); msg != "" {
+		return a.api.Post(ctx, replyURL, textActivity(msg, hopsMsg.Data), nil)
+	}
+
+	logger = logger.With().Str("flow", flow.ID).Logger()
+
+	evalCtx, err := markdown.EventEvalContext(hopsMsg)
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to create evaluation context for command")
+		return a.api.Post(ctx, replyURL, textActivity("command failed", hopsMsg.Data), nil)
+	}
+
+	card, err := CommandToAdaptiveCard(flow, evalCtx)
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to render command as adaptive card")
+		return a.api.Post(ctx, replyURL, textActivity("command failed", hopsMsg.Data), nil)
+	}
+
+	activity := map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{
+			{
+				"contentType": adaptiveCardContentType,
+				"content":     card,
+			},
+		},
+	}
+
+	if err := a.api.Post(ctx, replyURL, activity, nil); err != nil {
+		logger.Error().Err(err).Msg("Unable to send command card")
+		return a.api.Post(ctx, replyURL, textActivity("command failed - unable to show form", hopsMsg.Data), nil)
+	}
+
+	logger.Debug().Msg("Sent command card")
+
+	return nil
+}
+
+// ParseCommand converts a submitted card into a command event
+func (a *AdaptiveCardFrontend) ParseCommand(hopsMsg *nats.HopsMsg, commands map[string]*markdown.Flow) error {
+	data, err := parseAdaptiveCardSubmission(hopsMsg.Data, commands)
+	if err != nil {
+		return fmt.Errorf("unable to parse command from event: %w", err)
+	}
+
+	hopsMsg.Action = mapreader.Str(data, "hops.action")
+	hopsMsg.Data = data
+
+	return nil
+}
+
+func (a *AdaptiveCardFrontend) CommandDispatched(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg) error {
+	return a.reply(ctx, hopsMsg.Data, markdownDispatchedText(flow))
+}
+
+func (a *AdaptiveCardFrontend) CommandResult(ctx context.Context, name string, hopsMsg *nats.HopsMsg, result nats.ResultMsg, duration time.Duration) error {
+	return a.reply(ctx, hopsMsg.Data, markdownResultText(name, result, duration))
+}
+
+// CommandToAdaptiveCard renders a command as an adaptive card
+//
+// evalCtx is used to evaluate the options of select params that use options_from
+func CommandToAdaptiveCard(flow *markdown.Flow, evalCtx *hcl.EvalContext) (*AdaptiveCard, error) {
+	description, err := flow.Markdown()
+	if err != nil {
+		return nil, err
+	}
+
+	flowCtx := flow.EvalContext(evalCtx)
+
+	submitData := AdaptiveCardSubmitData{
+		CommandAction: flow.ActionName(),
+		ParamTypes:    map[string]string{},
+	}
+
+	body := []map[string]any{
+		{
+			"type":   "TextBlock",
+			"text":   flow.DisplayName(),
+			"size":   "Large",
+			"weight": "Bolder",
+			"wrap":   true,
+		},
+		{
+			"type": "TextBlock",
+			"text": description,
+			"wrap": true,
+		},
+	}
+
+	for _, p := range flow.Command {
+		name, param := p.Param()
+		submitData.ParamTypes[name] = param.Type
+
+		input := map[string]any{
+			"id":         name,
+			"label":      p.DisplayName(),
+			"isRequired": param.Required,
+		}
+
+		if param.Default != nil {
+			input["value"] = fmt.Sprintf("%v", param.Default)
+		}
+
+		switch param.Type {
+		case "text":
+			input["type"] = "Input.Text"
+			input["isMultiline"] = true
+		case "string", "user", "channel", "conversation":
+			input["type"] = "Input.Text"
+		case "number":
+			input["type"] = "Input.Number"
+			if param.Default != nil {
+				input["value"] = param.Default
+			}
+		case "bool":
+			input["type"] = "Input.Toggle"
+			input["title"] = p.DisplayName()
+			input["valueOn"] = "true"
+			input["valueOff"] = "false"
+		case "select", "multiselect":
+			options, err := param.OptionValues(flowCtx)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get options for param '%s': %w", name, err)
+			}
+
+			choices := make([]map[string]any, len(options))
+			for i, o := range options {
+				choices[i] = map[string]any{"title": o, "value": o}
+			}
+
+			input["type"] = "Input.ChoiceSet"
+			input["choices"] = choices
+
+			if param.Type == "multiselect" {
+				input["isMultiSelect"] = true
+				if defaults, ok := param.Default.([]any); ok {
+					input["value"] = joinAny(defaults, ",")
+				}
+			}
+		case "date":
+			input["type"] = "Input.Date"
+		case "datetime":
+			// Cards have no datetime input, so the date and time are input separately
+			input["type"] = "Input.Date"
+			delete(input, "value")
+			timeInput := map[string]any{
+				"type":       "Input.Time",
+				"id":         name + adaptiveCardTimeSuffix,
+				"isRequired": param.Required,
+			}
+
+			if defaultVal, ok := param.Default.(string); ok {
+				if t, err := time.Parse(markdown.ParamDateTimeFormat, defaultVal); err == nil {
+					t = t.UTC()
+					input["value"] = t.Format(markdown.ParamDateFormat)
+					timeInput["value"] = t.Format("15:04")
+				}
+			}
+
+			body = append(body, input, timeInput)
+			continue
+		default:
+			return nil, fmt.Errorf("unable to parse param '%s' - unknown type '%s'", name, param.Type)
+		}
+
+		body = append(body, input)
+	}
+
+	return &AdaptiveCard{
+		Type:    "AdaptiveCard",
+		Schema:  adaptiveCardSchema,
+		Version: adaptiveCardVersion,
+		Body:    body,
+		Actions: []map[string]any{
+			{
+				"type":  "Action.Submit",
+				"title": "Run",
+				"data":  map[string]any{adaptiveCardSubmitKey: submitData},
+			},
+		},
+	}, nil
+}
+
+func parseAdaptiveCardSubmission(payload map[string]any, commands map[string]*markdown.Flow) (map[string]any, error) {
+	hops := mapreader.Map[any](payload, "hops")
+	if hops == nil {
+		hops = map[string]any{}
+	}
+
+	commandPayload := map[string]any{
+		"hops": hops,
+		"ctx":  payload,
+	}
+
+	values := mapreader.Map[any](payload, "value")
+	if len(values) == 0 {
+		return nil, errors.New("activity has no submitted card values")
+	}
+
+	s, err := json.Marshal(values[adaptiveCardSubmitKey])
+	if err != nil {
+		return nil, errors.New("unable to read required metadata for command")
+	}
+
+	submitData := AdaptiveCardSubmitData{}
+	if err := json.Unmarshal(s, &submitData); err != nil || submitData.CommandAction == "" {
+		return nil, errors.New("unable to parse required metadata for command")
+	}
+
+	hops["action"] = submitData.CommandAction
+
+	for name, paramType := range submitData.ParamTypes {
+		value := values[name]
+
+		if paramType == "datetime" {
+			date, _ := value.(string)
+			clock, _ := values[name+adaptiveCardTimeSuffix].(string)
+			value = strings.TrimSpace(date + " " + clock)
+			if date == "" {
+				value = nil
+			}
+		}
+
+		param := submittedParam(commands, submitData.CommandAction, name, paramType)
+		paramValue, err := parseFormParamValue(param, value)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse command param '%s': %w", name, err)
+		}
+
+		commandPayload[name] = paramValue
+	}
+
+	return commandPayload, nil
+}
+
+// reply posts a message to the conversation a command was submitted from
+func (a *AdaptiveCardFrontend) reply(ctx context.Context, commandData map[string]any, msg string) error {
+	activity, _ := commandData["ctx"].(map[string]any)
+
+	replyURL, err := a.activityReplyURL(activity)
+	if err != nil {
+		return err
+	}
+
+	return a.api.Post(ctx, replyURL, textActivity(msg, activity), nil)
+}
+
+// activityReplyURL is the bot framework URL for replies to an activity,
+// erroring if the activity's service isn't a bot framework service
+func (a *AdaptiveCardFrontend) activityReplyURL(activity map[string]any) (string, error) {
+	serviceURL := mapreader.Str(activity, "serviceUrl")
+	conversationID := mapreader.Str(activity, "conversation.id")
+	if serviceURL == "" || conversationID == "" {
+		return "", errors.New("activity is missing the service or conversation to reply to")
+	}
+
+	if !a.isServiceURL(serviceURL) {
+		return "", fmt.Errorf("activity service '%s' isn't a known bot framework service", serviceURL)
+	}
+
+	replyURL := fmt.Sprintf(
+		"%s/v3/conversations/%s/activities",
+		strings.TrimRight(serviceURL, "/"),
+		url.PathEscape(conversationID),
+	)
+
+	if activityID := mapreader.Str(activity, "id"); activityID != "" {
+		replyURL += "/" + url.PathEscape(activityID)
+	}
+
+	return replyURL, nil
+}
+
+// isServiceURL is true if the URL is at one of the allowed service origins
+func (a *AdaptiveCardFrontend) isServiceURL(serviceURL string) bool {
+	u, err := url.Parse(serviceURL)
+	if err != nil || u.User != nil || u.Host == "" {
+		return false
+	}
+
+	origin := u.Scheme + "://" + u.Host
+	for _, pattern := range a.serviceOrigins {
+		if ok, _ := path.Match(pattern, origin); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func textActivity(msg string, replyTo map[string]any) map[string]any {
+	activity := map[string]any{
+		"type":       "message",
+		"text":       msg,
+		"textFormat": "markdown",
+	}
+
+	if activityID := mapreader.Str(replyTo, "id"); activityID != "" {
+		activity["replyToId"] = activityID
+	}
+
+	return activity
+}
@@ -0,0 +1,237 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+func TestAdaptiveCardRequestCommand(t *testing.T) {
+	server := newStubServer(t)
+	frontend := NewAdaptiveCardFrontend(NewAPIClient(server.Client(), StaticToken("token"), zerolog.Nop()))
+	frontend.serviceOrigins = []string{server.URL}
+	flow := setupTestFlow(t, testCommandFlow)
+
+	hopsMsg := &nats.HopsMsg{
+		Source: "teams",
+		Event:  "command_request",
+		Action: flow.ActionName(),
+		Data: map[string]any{
+			"id":           "activity-1",
+			"text":         "deploy-app",
+			"serviceUrl":   server.URL + "/",
+			"conversation": map[string]any{"id": "conv:1"},
+		},
+	}
+
+	err := frontend.RequestCommand(context.Background(), flow, hopsMsg, nil, zerolog.Nop())
+	require.NoError(t, err)
+
+	requests := server.Requests("/v3/conversations/conv:1/activities/activity-1")
+	require.Len(t, requests, 1)
+	assert.Equal(t, []string{"Bearer token"}, server.Auth("/v3/conversations/conv:1/activities/activity-1"))
+
+	attachments, _ := requests[0]["attachments"].([]any)
+	require.Len(t, attachments, 1)
+
+	attachment := attachments[0].(map[string]any)
+	assert.Equal(t, adaptiveCardContentType, attachment["contentType"])
+
+	cardB, err := json.Marshal(attachment["content"])
+	require.NoError(t, err)
+
+	card := AdaptiveCard{}
+	require.NoError(t, json.Unmarshal(cardB, &card))
+
+	inputs := map[string]string{}
+	for _, elem := range card.Body[2:] {
+		inputs[elem["id"].(string)] = elem["type"].(string)
+	}
+
+	assert.Equal(t, "Deploy App", card.Body[0]["text"])
+	assert.Equal(t, map[string]string{
+		"environment":     "Input.ChoiceSet",
+		"replicas":        "Input.Number",
+		"dry_run":         "Input.Toggle",
+		"services":        "Input.ChoiceSet",
+		"deploy_at":       "Input.Date",
+		"deploy_at__time": "Input.Time",
+		"notes":           "Input.Text",
+	}, inputs)
+
+	require.Len(t, card.Actions, 1)
+	assert.Equal(t, "Action.Submit", card.Actions[0]["type"])
+}
+
+func TestAdaptiveCardParseCommand(t *testing.T) {
+	flow := setupTestFlow(t, testCommandFlow)
+
+	card, err := CommandToAdaptiveCard(flow, nil)
+	require.NoError(t, err)
+
+	// Cards submit their action data merged with the input values
+	value := map[string]any{
+		"environment":     "staging",
+		"replicas":        "5",
+		"dry_run":         "true",
+		"services":        "api,web",
+		"deploy_at":       "2024-02-29",
+		"deploy_at__time": "09:15",
+		"notes":           "",
+	}
+	for k, v := range card.Actions[0]["data"].(map[string]any) {
+		value[k] = v
+	}
+
+	valueB, err := json.Marshal(value)
+	require.NoError(t, err)
+
+	// Round trip the value through JSON, as it would arrive in an event
+	activityValue := map[string]any{}
+	require.NoError(t, json.Unmarshal(valueB, &activityValue))
+
+	hopsMsg := &nats.HopsMsg{
+		Source: "teams",
+		Event:  "command",
+		Data: map[string]any{
+			"type":  "message",
+			"value": activityValue,
+		},
+	}
+
+	commands := map[string]*markdown.Flow{flow.ActionName(): flow}
+	frontend := NewAdaptiveCardFrontend(nil)
+	require.NoError(t, frontend.ParseCommand(hopsMsg, commands))
+
+	assert.Equal(t, flow.ActionName(), hopsMsg.Action)
+	assert.Equal(t, "staging", hopsMsg.Data["environment"])
+	assert.Equal(t, float64(5), hopsMsg.Data["replicas"])
+	assert.Equal(t, true, hopsMsg.Data["dry_run"])
+	assert.Equal(t, []any{"api", "web"}, hopsMsg.Data["services"])
+	assert.Equal(t, "2024-02-29T09:15:00Z", hopsMsg.Data["deploy_at"])
+	assert.Equal(t, "", hopsMsg.Data["notes"])
+
+	activityValue["services"] = "api,db"
+	hopsMsg.Data = map[string]any{"type": "message", "value": activityValue}
+	assert.Error(t, frontend.ParseCommand(hopsMsg, commands), "Values that aren't options should fail to parse")
+
+	hopsMsg.Data = map[string]any{"type": "message", "text": "hello"}
+	assert.Error(t, frontend.ParseCommand(hopsMsg, commands), "Activities without card values should fail to parse")
+}
+
+func TestAdaptiveCardCommandDispatched(t *testing.T) {
+	server := newStubServer(t)
+	frontend := NewAdaptiveCardFrontend(NewAPIClient(server.Client(), StaticToken("token"), zerolog.Nop()))
+	frontend.serviceOrigins = []string{server.URL}
+	flow := setupTestFlow(t, testCommandFlow)
+
+	hopsMsg := &nats.HopsMsg{
+		Data: map[string]any{
+			"ctx": map[string]any{
+				"serviceUrl":   server.URL,
+				"conversation": map[string]any{"id": "conv-1"},
+			},
+		},
+	}
+
+	require.NoError(t, frontend.CommandDispatched(context.Background(), flow, hopsMsg))
+
+	requests := server.Requests("/v3/conversations/conv-1/activities")
+	require.Len(t, requests, 1)
+	assert.Equal(t, "⏳ **Deploy App** is running", requests[0]["text"])
+	assert.Equal(t, "markdown", requests[0]["textFormat"])
+}
+
+func TestAdaptiveCardForeignService(t *testing.T) {
+	server := newStubServer(t)
+	frontend := NewAdaptiveCardFrontend(NewAPIClient(server.Client(), StaticToken("token"), zerolog.Nop()))
+	flow := setupTestFlow(t, testCommandFlow)
+
+	activity := map[string]any{
+		"id":           "activity-1",
+		"text":         "deploy-app",
+		"serviceUrl":   server.URL,
+		"conversation": map[string]any{"id": "conv-1"},
+	}
+
+	err := frontend.RequestCommand(context.Background(), flow, &nats.HopsMsg{Data: activity}, nil, zerolog.Nop())
+	assert.ErrorContains(t, err, "isn't a known bot framework service")
+
+	err = frontend.CommandDispatched(context.Background(), flow, &nats.HopsMsg{Data: map[string]any{"ctx": activity}})
+	assert.ErrorContains(t, err, "isn't a known bot framework service")
+
+	assert.Empty(t, server.Requests("/v3/conversations/conv-1/activities/activity-1"), "Token should never be sent to services that aren't bot framework")
+	assert.Empty(t, server.Requests("/v3/conversations/conv-1/activities"), "Token should never be sent to services that aren't bot framework")
+}
+
+func TestAdaptiveCardIsServiceURL(t *testing.T) {
+	frontend := NewAdaptiveCardFrontend(nil)
+
+	tests := map[string]bool{
+		"https://smba.trafficmanager.net/emea/":         true,
+		"https://europe.webchat.botframework.com/":      true,
+		"https://smba.infra.gov.teams.microsoft.us/":    true,
+		"http://smba.trafficmanager.net/emea/":          false,
+		"https://smba.trafficmanager.net.example.com/":  false,
+		"https://example.com/.botframework.com/":        false,
+		"https://user@example.com#.botframework.com":    false,
+		"https://smba.trafficmanager.net:8443/emea/":    false,
+		"https://example.com?x=smba.trafficmanager.net": false,
+		"not a url": false,
+	}
+
+	for serviceURL, expected := range tests {
+		assert.Equal(t, expected, frontend.isServiceURL(serviceURL), serviceURL)
+	}
+}
+
+func TestBotFrameworkTokens(t *testing.T) {
+	issued := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "invalid_client"}`)
+			return
+		}
+
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "app-id", r.PostForm.Get("client_id"))
+		assert.Equal(t, botFrameworkScope, r.PostForm.Get("scope"))
+
+		issued++
+		fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": 3600}`, issued)
+	}))
+	t.Cleanup(server.Close)
+
+	tokens := NewBotFrameworkTokens("app-id", "secret", "")
+	tokens.tokenURL = server.URL
+
+	token, err := tokens.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+
+	token, err = tokens.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token, "Token should be cached until invalidated")
+
+	tokens.Invalidate()
+	token, err = tokens.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token, "Token should be fetched again once invalidated")
+
+	tokens = NewBotFrameworkTokens("app-id", "wrong", "")
+	tokens.tokenURL = server.URL
+	_, err = tokens.Token()
+	assert.ErrorContains(t, err, "invalid_client")
+}
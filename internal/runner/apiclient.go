@@ -0,0 +1,249 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+
+	"github.com/hiphops-io/hops/nats"
+)
+
+const (
+	// apiMaxRetries is the number of times a rate limited API call is retried
+	apiMaxRetries = 3
+	// apiMaxRetryWait is the longest we'll wait on a Retry-After before giving
+	// up, leaving the message to be redelivered instead
+	apiMaxRetryWait = 30 * time.Second
+	// apiMaxErrorBody is the most of an error response body included in errors
+	apiMaxErrorBody = 512
+)
+
+type (
+	// AccessTokenSource provides access tokens, fetching a fresh token after
+	// being invalidated
+	AccessTokenSource interface {
+		Token() (string, error)
+		Invalidate()
+	}
+
+	// AccessTokenStore fetches an access token from hiphops.io, caching it
+	// until it's invalidated
+	AccessTokenStore struct {
+		mu         sync.Mutex
+		natsClient *nats.Client
+		subject    string
+		token      string
+	}
+
+	// StaticToken is an access token that never changes, such as a bot token
+	// given in config
+	StaticToken string
+
+	// APIClient calls JSON HTTP APIs with bearer token auth, retrying calls
+	// that are rate limited and refreshing the access token when it's rejected
+	//
+	// Clients without tokens make unauthenticated calls, for URLs that aren't
+	// trusted with a token such as those given in events
+	APIClient struct {
+		httpClient *http.Client
+		logger     zerolog.Logger
+		tokens     AccessTokenSource
+	}
+
+	// APIError is returned for calls that responded with an unsuccessful status
+	APIError struct {
+		StatusCode int
+		Body       string
+	}
+)
+
+// NewAccessTokenStore creates a store for the access token that hiphops.io
+// replies with on the given subject
+func NewAccessTokenStore(natsClient *nats.Client, subject string) *AccessTokenStore {
+	return &AccessTokenStore{
+		natsClient: natsClient,
+		subject:    subject,
+	}
+}
+
+func (s *AccessTokenStore) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" {
+		return s.token, nil
+	}
+
+	reply, err := s.natsClient.NatsConn.Request(s.subject, nil, time.Second*3)
+	if err != nil {
+		return "", err
+	}
+
+	var token string
+	if err := json.Unmarshal(reply.Data, &token); err != nil {
+		return "", fmt.Errorf("unable to parse access token: %w", err)
+	}
+
+	if token == "" {
+		return "", errors.New("received an empty access token")
+	}
+
+	s.token = token
+
+	return token, nil
+}
+
+func (s *AccessTokenStore) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = ""
+}
+
+func (s StaticToken) Token() (string, error) {
+	if s == "" {
+		return "", errors.New("access token is not configured")
+	}
+
+	return string(s), nil
+}
+
+// Invalidate does nothing, as there's no other token to fall back to
+func (s StaticToken) Invalidate() {}
+
+// NewAPIClient creates an APIClient, using http.DefaultClient if httpClient is
+// nil. Calls are unauthenticated if tokens is nil
+func NewAPIClient(httpClient *http.Client, tokens AccessTokenSource, logger zerolog.Logger) *APIClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &APIClient{
+		httpClient: httpClient,
+		logger:     logger,
+		tokens:     tokens,
+	}
+}
+
+// Post sends body as JSON to url, decoding the response into out if it's not nil
+//
+// The token is refreshed at most once per call when the API responds with 401,
+// calls responding with 429 are retried up to apiMaxRetries times after waiting
+// as long as the Retry-After header asks us to
+func (c *APIClient) Post(ctx context.Context, url string, body any, out any) error {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	logger := c.logger.With().Str("url", url).Logger()
+	refreshed := false
+
+	for attempt := 0; ; attempt++ {
+		token := ""
+		if c.tokens != nil {
+			token, err = c.tokens.Token()
+			if err != nil {
+				return fmt.Errorf("unable to fetch access token: %w", err)
+			}
+		}
+
+		resp, err := c.post(ctx, url, token, reqBody)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests && attempt < apiMaxRetries:
+			retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+			resp.Body.Close()
+
+			if retryAfter > apiMaxRetryWait {
+				return &APIError{StatusCode: resp.StatusCode}
+			}
+
+			logger.Warn().Dur("retry_after", retryAfter).Msg("API rate limit reached, retrying")
+
+			if err := sleepCtx(ctx, retryAfter); err != nil {
+				return err
+			}
+
+			continue
+		case resp.StatusCode == http.StatusUnauthorized && c.tokens != nil && !refreshed:
+			resp.Body.Close()
+
+			logger.Warn().Msg("API access token rejected, refreshing")
+			c.tokens.Invalidate()
+			refreshed = true
+
+			continue
+		}
+
+		return decodeAPIResponse(resp, out)
+	}
+}
+
+func (c *APIClient) post(ctx context.Context, url, token string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	return c.httpClient.Do(req)
+}
+
+func (e *APIError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("API call failed with status %d", e.StatusCode)
+	}
+
+	return fmt.Sprintf("API call failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+func decodeAPIResponse(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, apiMaxErrorBody))
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       string(bytes.TrimSpace(body)),
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("unable to parse API response: %w", err)
+	}
+
+	return nil
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds, defaulting to
+// one second if it's missing or given as a date
+func parseRetryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return time.Second
+	}
+
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,119 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// testTokens is an AccessTokenSource handing out a new token each time it's invalidated
+type testTokens struct {
+	tokens      []string
+	invalidated int
+}
+
+func (t *testTokens) Token() (string, error) {
+	return t.tokens[t.invalidated], nil
+}
+
+func (t *testTokens) Invalidate() {
+	t.invalidated++
+}
+
+func TestAPIClientPost(t *testing.T) {
+	type testCase struct {
+		name            string
+		statuses        []int
+		expectedCalls   int
+		expectedAuth    string
+		expectedErrCode int
+	}
+
+	tests := []testCase{
+		{
+			name:          "Success",
+			statuses:      []int{http.StatusOK},
+			expectedCalls: 1,
+			expectedAuth:  "Bearer first",
+		},
+		{
+			name:          "Rate limited then success",
+			statuses:      []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			expectedCalls: 3,
+			expectedAuth:  "Bearer first",
+		},
+		{
+			name:            "Rate limited until retries run out",
+			statuses:        []int{429, 429, 429, 429, 429},
+			expectedCalls:   apiMaxRetries + 1,
+			expectedAuth:    "Bearer first",
+			expectedErrCode: http.StatusTooManyRequests,
+		},
+		{
+			name:          "Token refreshed once rejected",
+			statuses:      []int{http.StatusUnauthorized, http.StatusOK},
+			expectedCalls: 2,
+			expectedAuth:  "Bearer second",
+		},
+		{
+			name:            "Token only refreshed once",
+			statuses:        []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusOK},
+			expectedCalls:   2,
+			expectedAuth:    "Bearer second",
+			expectedErrCode: http.StatusUnauthorized,
+		},
+		{
+			name:            "Error response",
+			statuses:        []int{http.StatusBadRequest},
+			expectedCalls:   1,
+			expectedAuth:    "Bearer first",
+			expectedErrCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			var auth, body string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[calls]
+				calls++
+
+				auth = r.Header.Get("Authorization")
+				b, _ := io.ReadAll(r.Body)
+				body = string(b)
+
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(status)
+				w.Write([]byte(`{"ok": true}`))
+			}))
+			defer server.Close()
+
+			client := NewAPIClient(server.Client(), &testTokens{tokens: []string{"first", "second", "third"}}, zerolog.Nop())
+
+			out := map[string]any{}
+			err := client.Post(context.Background(), server.URL, map[string]any{"hello": "world"}, &out)
+
+			assert.Equal(t, tc.expectedCalls, calls)
+			assert.Equal(t, tc.expectedAuth, auth)
+			assert.JSONEq(t, `{"hello": "world"}`, body)
+
+			if tc.expectedErrCode != 0 {
+				var apiErr *APIError
+				if assert.ErrorAs(t, err, &apiErr) {
+					assert.Equal(t, tc.expectedErrCode, apiErr.StatusCode)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]any{"ok": true}, out)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+
+	"github.com/hiphops-io/hops/internal/audit"
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+// ApprovalAction is the command action given to approval decisions
+//
+// It contains a '.' so it can never clash with the action name of a flow
+const ApprovalAction = "hops.approval"
+
+type (
+	// ApprovalRequest identifies a flow run that is awaiting approval
+	ApprovalRequest struct {
+		FlowID     string `json:"flow_id"`
+		SequenceID string `json:"sequence_id"`
+	}
+
+	// ApprovalDecision is a user's response to an ApprovalRequest
+	ApprovalDecision struct {
+		ApprovalRequest
+		Approved  bool
+		ChannelID string
+		DecidedAt time.Time
+		MessageTS string
+		UserID    string
+		Username  string
+	}
+
+	// ApprovalRecord is the audit record of an approval decision
+	//
+	// Records are published to the notify stream, so flows can also be triggered
+	// by 'hiphops.approval.approved' and 'hiphops.approval.rejected' events
+	ApprovalRecord struct {
+		Hops       nats.SourceMeta `json:"hops"`
+		Approved   bool            `json:"approved"`
+		DecidedAt  time.Time       `json:"decided_at"`
+		FlowID     string          `json:"flow_id"`
+		SequenceID string          `json:"sequence_id"`
+		UserID     string          `json:"user_id"`
+		Username   string          `json:"username"`
+	}
+)
+
+func NewApprovalRecord(decision ApprovalDecision) ApprovalRecord {
+	action := "rejected"
+	if decision.Approved {
+		action = "approved"
+	}
+
+	return ApprovalRecord{
+		Hops: nats.SourceMeta{
+			Source: "hiphops",
+			Event:  nats.ApprovalId,
+			Action: action,
+		},
+		Approved:   decision.Approved,
+		DecidedAt:  decision.DecidedAt,
+		FlowID:     decision.FlowID,
+		SequenceID: decision.SequenceID,
+		UserID:     decision.UserID,
+		Username:   decision.Username,
+	}
+}
+
+// requestApproval asks for approval of a flow in place of dispatching it
+func (r *Runner) requestApproval(ctx context.Context, wg *sync.WaitGroup, flow *markdown.Flow, hopsMsg *nats.HopsMsg, errChan chan<- error, logger zerolog.Logger) {
+	defer wg.Done()
+
+	if err := SlackApprovalRequest(ctx, flow, hopsMsg, r.slack); err != nil {
+		err = fmt.Errorf("unable to request approval for flow '%s': %w", flow.ID, err)
+		r.auditDispatch(ctx, flow, hopsMsg, audit.OutcomeApprovalRequested, err)
+		errChan <- err
+		return
+	}
+
+	r.auditDispatch(ctx, flow, hopsMsg, audit.OutcomeApprovalRequested, nil)
+
+	r.history.awaitingApproval(flow, hopsMsg)
+	logger.Info().Msgf("Requested approval for flow: %s", flow.ID)
+
+	errChan <- nil
+}
+
+// handleApproval records an approval decision and dispatches the flow if approved
+//
+// The first decision recorded for a flow run wins, any later decisions are ignored
+func (r *Runner) handleApproval(ctx context.Context, hopsMsg *nats.HopsMsg, logger zerolog.Logger) error {
+	decision, ok := hopsMsg.Data["approval"].(ApprovalDecision)
+	if !ok {
+		return fmt.Errorf("%w: approval decision is missing", nats.ErrEventFatal)
+	}
+
+	logger = logger.With().Str("flow", decision.FlowID).Str("approval_sequence_id", decision.SequenceID).Logger()
+
+	flow, ok := r.flowReader.IndexedFlow(decision.FlowID)
+	if !ok || flow.Approval == nil {
+		return fmt.Errorf("%w: flow '%s' does not require approval", nats.ErrEventFatal, decision.FlowID)
+	}
+
+	rec := auditRecord(audit.TypeCommandSubmitted, hopsMsg)
+	rec.Flow = flow.ID
+	rec.User = decision.UserID
+
+	if !flow.Approval.IsApprover(decision.UserID) {
+		logger.Warn().Msgf("User %s (%s) is not an approver", decision.Username, decision.UserID)
+		rec.Outcome = audit.OutcomeError
+		rec.Error = "user is not an approver"
+		r.audit.Record(ctx, rec)
+
+		msg := fmt.Sprintf("Sorry, you're not an approver for *%s*", flow.DisplayName())
+		if err := SlackEphemeral(ctx, decision.ChannelID, decision.UserID, msg, r.slack); err != nil {
+			logger.Warn().Err(err).Msg("Unable to notify slack user they are not an approver")
+		}
+
+		return nil
+	}
+
+	record, err := r.recordApproval(ctx, flow, decision)
+	if err != nil {
+		return err
+	}
+
+	if record.UserID != decision.UserID || !record.DecidedAt.Equal(decision.DecidedAt) {
+		logger.Info().Msgf("Flow was already %s by %s", record.Hops.Action, record.Username)
+		rec.Outcome = audit.OutcomeError
+		rec.Error = fmt.Sprintf("flow was already %s by %s", record.Hops.Action, record.UserID)
+		r.audit.Record(ctx, rec)
+
+		msg := fmt.Sprintf("*%s* was already %s by <@%s>", flow.DisplayName(), record.Hops.Action, record.UserID)
+		if err := SlackEphemeral(ctx, decision.ChannelID, decision.UserID, msg, r.slack); err != nil {
+			logger.Warn().Err(err).Msg("Unable to notify slack user of existing decision")
+		}
+	} else {
+		rec.Outcome = audit.OutcomeRejected
+		if record.Approved {
+			rec.Outcome = audit.OutcomeApproved
+		}
+		r.audit.Record(ctx, rec)
+
+		logger.Info().
+			Bool("approved", record.Approved).
+			Str("user_id", record.UserID).
+			Time("decided_at", record.DecidedAt).
+			Msgf("Flow %s by %s", record.Hops.Action, record.Username)
+
+		if err := SlackApprovalDecided(ctx, flow, decision, r.slack); err != nil {
+			logger.Warn().Err(err).Msg("Unable to update slack approval request")
+		}
+	}
+
+	if !record.Approved {
+		r.history.rejected(flow, record.SequenceID)
+		return nil
+	}
+
+	// Dispatching is idempotent, so it's safe to dispatch again if we're
+	// retrying a decision that was recorded but failed to dispatch
+	sourceMsg, err := r.sourceEventMsg(ctx, record.SequenceID)
+	if err != nil {
+		return err
+	}
+
+	return r.dispatchApproved(ctx, flow, sourceMsg, logger)
+}
+
+// recordApproval publishes the audit record for a decision, returning the
+// decision that was recorded first if one already exists
+func (r *Runner) recordApproval(ctx context.Context, flow *markdown.Flow, decision ApprovalDecision) (ApprovalRecord, error) {
+	record := NewApprovalRecord(decision)
+	subject := nats.ApprovalSubject(decision.SequenceID, flow.ActionName())
+
+	recordB, err := json.Marshal(record)
+	if err != nil {
+		return record, err
+	}
+
+	_, sent, err := r.natsClient.Publish(ctx, recordB, subject)
+	if err != nil {
+		return record, fmt.Errorf("unable to record approval decision: %w", err)
+	}
+
+	if sent {
+		return record, nil
+	}
+
+	existingMsg, err := r.natsClient.NotifyMsg(ctx, subject)
+	if err != nil {
+		return record, fmt.Errorf("unable to fetch existing approval decision: %w", err)
+	}
+
+	existing := ApprovalRecord{}
+	if err := json.Unmarshal(existingMsg.Data, &existing); err != nil {
+		return record, fmt.Errorf("%w: unable to parse existing approval decision: %w", nats.ErrEventFatal, err)
+	}
+
+	return existing, nil
+}
+
+func (r *Runner) dispatchApproved(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg, logger zerolog.Logger) error {
+	var wg sync.WaitGroup
+	errChan := make(chan error, 1)
+
+	wg.Add(1)
+	r.dispatchFlow(ctx, &wg, flow, hopsMsg, errChan, logger)
+
+	return <-errChan
+}
+
+// sourceEventMsg fetches the source event of a sequence, preparing it as if it
+// had just been received
+func (r *Runner) sourceEventMsg(ctx context.Context, sequenceID string) (*nats.HopsMsg, error) {
+	rawMsg, err := r.natsClient.SourceEvent(ctx, sequenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	hopsMsg, err := parseSourceEvent(rawMsg, sequenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if frontend, ok := r.frontends[hopsMsg.Source]; ok && hopsMsg.Event == "command" {
+		if err := frontend.ParseCommand(hopsMsg, r.flowReader.IndexedCommands()); err != nil {
+			return nil, errors.Join(nats.ErrEventFatal, err)
+		}
+	}
+
+	return hopsMsg, nil
+}
+
+// parseSourceEvent parses a raw source event into a HopsMsg
+func parseSourceEvent(rawMsg *jetstream.RawStreamMsg, sequenceID string) (*nats.HopsMsg, error) {
+	data := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(rawMsg.Data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("%w: unable to parse source event: %w", nats.ErrEventFatal, err)
+	}
+
+	meta, _ := data[nats.MetadataKey].(map[string]any)
+	source, _ := meta["source"].(string)
+	event, _ := meta["event"].(string)
+	action, _ := meta["action"].(string)
+
+	if source == "" || event == "" {
+		return nil, fmt.Errorf("%w: source event is missing metadata", nats.ErrEventFatal)
+	}
+
+	return &nats.HopsMsg{
+		Action:     action,
+		Data:       data,
+		Event:      event,
+		SequenceId: sequenceID,
+		Source:     source,
+		Subject:    rawMsg.Subject,
+		Timestamp:  rawMsg.Time,
+	}, nil
+}
@@ -0,0 +1,239 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/logs"
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+type (
+	// slackStub is a local slack API that records the calls made to it,
+	// responding with respond or ok if respond is nil
+	slackStub struct {
+		*httptest.Server
+		mu      sync.Mutex
+		calls   []slackCall
+		respond func(call slackCall) (status int, header http.Header, body string)
+	}
+
+	slackCall struct {
+		Method string
+		Form   url.Values
+	}
+)
+
+func newSlackStub(t *testing.T) *slackStub {
+	s := &slackStub{}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		call := slackCall{Method: r.URL.Path[1:], Form: r.PostForm}
+
+		s.mu.Lock()
+		s.calls = append(s.calls, call)
+		respond := s.respond
+		s.mu.Unlock()
+
+		status, header, body := http.StatusOK, http.Header{}, `{"ok": true}`
+		if respond != nil {
+			status, header, body = respond(call)
+		}
+
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Calls returns the calls made to the given slack method
+func (s *slackStub) Calls(method string) []slackCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calls := []slackCall{}
+	for _, call := range s.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Client returns a slack client that calls the stub with the given tokens
+func (s *slackStub) Client(tokens AccessTokenSource) *SlackClient {
+	return NewSlackClient(tokens, logs.NoOpLogger(), slack.OptionAPIURL(s.URL+"/"))
+}
+
+func setupNatsClient(t *testing.T) *nats.Client {
+	natsLogger := logs.NewNatsZeroLogger(logs.NoOpLogger())
+
+	natsServer, err := nats.NewNatsServer("./testdata/embedded-nats.conf", false, &natsLogger, nats.WithDataDirOpt(t.TempDir()))
+	require.NoError(t, err, "Test setup: Embedded NATS server should start without errors")
+	t.Cleanup(natsServer.Close)
+
+	client, err := nats.NewClient(natsServer.URL(), "")
+	require.NoError(t, err, "Test setup: NATS client should connect without errors")
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestRunnerHandleApproval(t *testing.T) {
+	ctx := context.Background()
+	natsClient := setupNatsClient(t)
+	slackAPI := newSlackStub(t)
+
+	flowsDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(flowsDir, "deploy"), 0o744))
+	flowMd := []byte("---\non: github.push\napproval: {channel: C0DEPLOYS, approvers: [U0APPROVER, U0SECOND]}\n---\n# Deploy\n")
+	require.NoError(t, os.WriteFile(filepath.Join(flowsDir, "deploy", "index.md"), flowMd, 0o644))
+
+	flowReader := markdown.NewFlowReader(flowsDir)
+	require.NoError(t, flowReader.ReadAll(), "Test setup: Flows should be read without error")
+	flow, ok := flowReader.IndexedFlow("deploy.index")
+	require.True(t, ok, "Test setup: Flow should be indexed")
+
+	r := &Runner{
+		flowReader: flowReader,
+		history:    NewRunHistory(flowReader),
+		logger:     logs.NoOpLogger(),
+		natsClient: natsClient,
+		slack:      slackAPI.Client(StaticToken("xoxb-test")),
+	}
+
+	for _, seq := range []string{"seq-approve", "seq-reject", "seq-outsider"} {
+		event := []byte(`{"hops": {"source": "github", "event": "push"}}`)
+		_, _, err := natsClient.Publish(ctx, event, nats.SourceEventSubject(seq))
+		require.NoError(t, err, "Test setup: Source event should be published without error")
+	}
+
+	decide := func(seq, userID string, approved bool) error {
+		decision := ApprovalDecision{
+			ApprovalRequest: ApprovalRequest{FlowID: flow.ID, SequenceID: seq},
+			Approved:        approved,
+			ChannelID:       "C0DEPLOYS",
+			DecidedAt:       time.Now().UTC(),
+			MessageTS:       "1700000000.000100",
+			UserID:          userID,
+			Username:        "someone",
+		}
+		hopsMsg := &nats.HopsMsg{
+			Action:     ApprovalAction,
+			Data:       map[string]any{"approval": decision},
+			Event:      "command",
+			SequenceId: "decision-" + seq + "-" + userID,
+			Source:     "slack",
+		}
+
+		return r.handleApproval(ctx, hopsMsg, r.logger)
+	}
+
+	recorded := func(seq string) (ApprovalRecord, bool) {
+		rawMsg, err := natsClient.NotifyMsg(ctx, nats.ApprovalSubject(seq, flow.ActionName()))
+		if err != nil {
+			return ApprovalRecord{}, false
+		}
+
+		record := ApprovalRecord{}
+		require.NoError(t, json.Unmarshal(rawMsg.Data, &record))
+		return record, true
+	}
+
+	dispatched := func(seq string) bool {
+		stream, err := natsClient.JetStream.Stream(ctx, nats.ChannelWork)
+		require.NoError(t, err)
+		_, err = stream.GetLastMsgForSubject(ctx, nats.WorkSubject(seq, flow.Worker))
+		return err == nil
+	}
+
+	status := func(seq string) string {
+		for _, run := range r.history.Runs(flow.ID, 10) {
+			if run.SequenceID == seq {
+				return run.Status
+			}
+		}
+		return ""
+	}
+
+	t.Run("Approve", func(t *testing.T) {
+		require.NoError(t, decide("seq-approve", "U0APPROVER", true))
+
+		record, ok := recorded("seq-approve")
+		require.True(t, ok, "Decision should be recorded")
+		assert.True(t, record.Approved)
+		assert.Equal(t, "U0APPROVER", record.UserID)
+		assert.True(t, dispatched("seq-approve"), "Approved flows should be dispatched")
+		assert.Equal(t, RunStatusRunning, status("seq-approve"))
+
+		updates := slackAPI.Calls("chat.update")
+		require.Len(t, updates, 1, "Approval request should be updated with the decision")
+		assert.Contains(t, updates[0].Form.Get("text"), "approved by <@U0APPROVER>")
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		require.NoError(t, decide("seq-reject", "U0SECOND", false))
+
+		record, ok := recorded("seq-reject")
+		require.True(t, ok, "Decision should be recorded")
+		assert.False(t, record.Approved)
+		assert.False(t, dispatched("seq-reject"), "Rejected flows shouldn't be dispatched")
+		assert.Equal(t, RunStatusRejected, status("seq-reject"))
+		assert.Len(t, slackAPI.Calls("chat.update"), 2)
+	})
+
+	t.Run("Unauthorized approver", func(t *testing.T) {
+		require.NoError(t, decide("seq-outsider", "U0OUTSIDER", true))
+
+		_, ok := recorded("seq-outsider")
+		assert.False(t, ok, "Decisions by users that aren't approvers shouldn't be recorded")
+		assert.False(t, dispatched("seq-outsider"))
+
+		ephemerals := slackAPI.Calls("chat.postEphemeral")
+		require.Len(t, ephemerals, 1, "User should be told they aren't an approver")
+		assert.Equal(t, "U0OUTSIDER", ephemerals[0].Form.Get("user"))
+		assert.Contains(t, ephemerals[0].Form.Get("text"), "not an approver")
+	})
+
+	t.Run("Duplicate decision", func(t *testing.T) {
+		require.NoError(t, decide("seq-approve", "U0SECOND", false))
+
+		record, ok := recorded("seq-approve")
+		require.True(t, ok)
+		assert.True(t, record.Approved, "The first decision should win")
+		assert.Equal(t, "U0APPROVER", record.UserID)
+		assert.Equal(t, RunStatusRunning, status("seq-approve"))
+		assert.Len(t, slackAPI.Calls("chat.update"), 2, "Approval request shouldn't be updated again")
+
+		ephemerals := slackAPI.Calls("chat.postEphemeral")
+		require.Len(t, ephemerals, 2, "User should be told of the existing decision")
+		assert.Equal(t, "U0SECOND", ephemerals[1].Form.Get("user"))
+		assert.Contains(t, ephemerals[1].Form.Get("text"), "already approved by <@U0APPROVER>")
+	})
+}
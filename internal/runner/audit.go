@@ -0,0 +1,128 @@
+package runner
+
+import (
+	"context"
+	"errors"
+
+	"github.com/manterfield/go-mapreader"
+
+	"github.com/hiphops-io/hops/internal/audit"
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+// commandUserPaths are where each chat platform puts the user in the payloads
+// it sends, in the order they're tried. Command requests are these payloads,
+// while commands keep them under ctx, alongside the params users submitted
+var commandUserPaths = map[string][]string{
+	// Slash commands, then interactions and view submissions
+	"slack":      {"user_id", "user.id"},
+	"mattermost": {"user_id"},
+	"teams":      {"from.id"},
+}
+
+// WithAuditLogOpt records the decisions the runner makes to the audit log
+func WithAuditLogOpt(log *audit.Log) RunnerOpt {
+	return func(r *Runner) {
+		r.audit = log
+	}
+}
+
+// auditRecord is an audit record about an event, with the user that requested
+// or submitted it if it's a command
+func auditRecord(recordType string, hopsMsg *nats.HopsMsg) audit.Record {
+	rec := audit.NewRecord(recordType, hopsMsg)
+
+	if hopsMsg.Event == "command" || hopsMsg.Event == "command_request" {
+		rec.User = commandUser(hopsMsg)
+	}
+
+	return rec
+}
+
+// commandUser is the user that requested or submitted a command event, or
+// empty if the frontend it came from isn't known.
+//
+// Web commands are only ever by the principal the API authenticated, so a
+// param can't claim to be someone else
+func commandUser(hopsMsg *nats.HopsMsg) string {
+	if hopsMsg.Source == WebSource {
+		return mapreader.Str(hopsMsg.Data, "ctx.user")
+	}
+
+	payload := hopsMsg.Data
+	if hopsMsg.Event == "command" {
+		payload = mapreader.Map[any](hopsMsg.Data, "ctx")
+	}
+
+	for _, path := range commandUserPaths[hopsMsg.Source] {
+		if user := mapreader.Str(payload, path); user != "" {
+			return user
+		}
+	}
+
+	return ""
+}
+
+// auditCommand records whether a command was found and its conditions met
+func (r *Runner) auditCommand(ctx context.Context, recordType string, hopsMsg *nats.HopsMsg, flow *markdown.Flow, matchErr error) {
+	rec := auditRecord(recordType, hopsMsg)
+
+	var ifErr *markdown.IfError
+	switch {
+	case errors.Is(matchErr, markdown.ErrCommandNotFound):
+		rec.Outcome = audit.OutcomeNotFound
+	case errors.Is(matchErr, ErrCommandDenied):
+		rec.Flow = flow.ID
+		rec.Outcome = audit.OutcomeDenied
+	case errors.As(matchErr, &ifErr):
+		rec.Flow = ifErr.FlowID
+		rec.Outcome = audit.OutcomeIfError
+	case matchErr != nil:
+		rec.Outcome = audit.OutcomeError
+	case flow == nil:
+		rec.Outcome = audit.OutcomeIfFalse
+	default:
+		rec.Flow = flow.ID
+		rec.Outcome = audit.OutcomeMatched
+	}
+
+	if matchErr != nil {
+		rec.Error = matchErr.Error()
+	}
+
+	r.audit.Record(ctx, rec)
+}
+
+// auditFlowDecision records whether a flow triggered by an event matched it
+func (r *Runner) auditFlowDecision(ctx context.Context, hopsMsg *nats.HopsMsg, decision markdown.FlowDecision) {
+	rec := auditRecord(audit.TypeFlowEvaluated, hopsMsg)
+	rec.Flow = decision.Flow.ID
+
+	switch {
+	case decision.Err != nil:
+		rec.Outcome = audit.OutcomeIfError
+		rec.Error = decision.Err.Error()
+	case decision.Matched:
+		rec.Outcome = audit.OutcomeMatched
+	default:
+		rec.Outcome = audit.OutcomeIfFalse
+	}
+
+	r.audit.Record(ctx, rec)
+}
+
+// auditDispatch records a flow being dispatched, or approval requested for it
+func (r *Runner) auditDispatch(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg, outcome string, err error) {
+	rec := auditRecord(audit.TypeFlowDispatched, hopsMsg)
+	rec.Flow = flow.ID
+	rec.Worker = flow.Worker
+	rec.Outcome = outcome
+
+	if err != nil {
+		rec.Outcome = audit.OutcomeError
+		rec.Error = err.Error()
+	}
+
+	r.audit.Record(ctx, rec)
+}
@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiphops-io/hops/internal/audit"
+	"github.com/hiphops-io/hops/nats"
+)
+
+func TestAuditRecordUser(t *testing.T) {
+	type testCase struct {
+		name         string
+		source       string
+		event        string
+		data         map[string]any
+		expectedUser string
+	}
+
+	tests := []testCase{
+		{
+			name:         "Slack slash command",
+			source:       "slack",
+			event:        "command_request",
+			data:         map[string]any{"user_id": "U012AB3CD", "user_name": "casey"},
+			expectedUser: "U012AB3CD",
+		},
+		{
+			name:   "Slack command",
+			source: "slack",
+			event:  "command",
+			data: map[string]any{"ctx": map[string]any{
+				"user": map[string]any{"id": "U012AB3CD", "username": "casey"},
+			}},
+			expectedUser: "U012AB3CD",
+		},
+		{
+			name:         "Mattermost command",
+			source:       "mattermost",
+			event:        "command",
+			data:         map[string]any{"ctx": map[string]any{"user_id": "mm-user"}},
+			expectedUser: "mm-user",
+		},
+		{
+			name:         "Web command",
+			source:       WebSource,
+			event:        "command",
+			data:         map[string]any{"ctx": map[string]any{"user": "casey@example.com"}},
+			expectedUser: "casey@example.com",
+		},
+		{
+			name:         "Teams command",
+			source:       "teams",
+			event:        "command",
+			data:         map[string]any{"ctx": map[string]any{"from": map[string]any{"id": "29:teams-user"}}},
+			expectedUser: "29:teams-user",
+		},
+		{
+			name:   "Web command with params naming a user",
+			source: WebSource,
+			event:  "command",
+			data: map[string]any{
+				"user_id": "admin",
+				"user":    map[string]any{"id": "admin"},
+				"from":    map[string]any{"id": "admin"},
+				"ctx":     map[string]any{"user": "casey@example.com"},
+			},
+			expectedUser: "casey@example.com",
+		},
+		{
+			name:   "Unauthenticated web command with params naming a user",
+			source: WebSource,
+			event:  "command",
+			data:   map[string]any{"user_id": "admin", "user": "admin"},
+		},
+		{
+			name:   "Chat command with params naming a user",
+			source: "mattermost",
+			event:  "command",
+			data: map[string]any{
+				"user_id": "admin",
+				"ctx":     map[string]any{"user_id": "mm-user"},
+			},
+			expectedUser: "mm-user",
+		},
+		{
+			name:   "Command without a user",
+			source: "slack",
+			event:  "command",
+			data:   map[string]any{},
+		},
+		{
+			name:   "Unknown source",
+			source: "github",
+			event:  "command",
+			data:   map[string]any{"ctx": map[string]any{"user_id": "U012AB3CD"}},
+		},
+		{
+			name:   "Other events",
+			source: "slack",
+			event:  "pull_request",
+			data:   map[string]any{"user_id": "U012AB3CD"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hopsMsg := &nats.HopsMsg{SequenceId: "SEQ_ID", Source: tc.source, Event: tc.event, Data: tc.data}
+
+			rec := auditRecord(audit.TypeEventReceived, hopsMsg)
+			assert.Equal(t, tc.expectedUser, rec.User)
+			assert.Equal(t, "SEQ_ID", rec.SequenceID)
+			assert.Equal(t, tc.event, rec.Event)
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+// ErrCommandDenied is the error for commands the user's roles don't allow
+// them to run
+var ErrCommandDenied = errors.New("not allowed to run command")
+
+// formDateTimeFormats are the formats accepted for datetime params submitted
+// as text, with times lacking a zone taken as UTC
+var formDateTimeFormats = []string{
+	markdown.ParamDateTimeFormat,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	markdown.ParamDateFormat,
+}
+
+// CommandFrontend is a chat platform that users run commands from
+//
+// The runner picks the frontend for an event by the event's source, so each
+// frontend is registered against the source name of the events it handles
+type CommandFrontend interface {
+	// RequestCommand presents the form for a command to the user that asked
+	// for it, or tells them why it can't be run
+	//
+	// flow is nil if the command's conditions weren't met, matchErr is any
+	// error from matching the command request to a flow
+	RequestCommand(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg, matchErr error, logger zerolog.Logger) error
+	// ParseCommand converts a submitted command form into a command event,
+	// setting the action and data of hopsMsg in place. Submitted values are
+	// checked against the params of the command's flow in commands
+	ParseCommand(hopsMsg *nats.HopsMsg, commands map[string]*markdown.Flow) error
+	// CommandDispatched lets the user that submitted a command know its flow
+	// has been dispatched
+	CommandDispatched(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg) error
+	// CommandResult sends the result of a command's flow to the user that
+	// submitted it, where hopsMsg is the command event as parsed by ParseCommand
+	CommandResult(ctx context.Context, name string, hopsMsg *nats.HopsMsg, result nats.ResultMsg, duration time.Duration) error
+}
+
+// commandRequestError logs why a command request can't be presented as a
+// form, returning the message to show the user or empty if it can be presented
+func commandRequestError(flow *markdown.Flow, matchErr error, commandText string, logger zerolog.Logger) string {
+	switch {
+	case errors.Is(matchErr, markdown.ErrCommandNotFound):
+		logger.Info().Msg("Command request didn't match any commands")
+		return fmt.Sprintf("Sorry, `%s` didn't match any commands", commandText)
+	case errors.Is(matchErr, ErrCommandDenied):
+		logger.Info().Msg("Command request denied by roles")
+		return fmt.Sprintf("Sorry, you aren't allowed to run `%s`", commandText)
+	case matchErr != nil:
+		logger.Error().Err(matchErr).Msg("Unable to match command request")
+		return fmt.Sprintf("An error occurred - this could be due to a misconfiguration\n`%s`", matchErr.Error())
+	case flow == nil:
+		logger.Info().Msg("Command conditions not met")
+		return "Command conditions not met - _Perhaps the command is restricted to specific channels or users?_"
+	default:
+		return ""
+	}
+}
+
+// markdownDispatchedText is the message telling a user their command's flow
+// has been dispatched, for frontends that render standard markdown
+func markdownDispatchedText(flow *markdown.Flow) string {
+	if flow.Approval != nil {
+		return fmt.Sprintf("✋ **%s** is waiting for approval in %s", flow.DisplayName(), flow.Approval.Channel)
+	}
+
+	return fmt.Sprintf("⏳ **%s** is running", flow.DisplayName())
+}
+
+// markdownResultText is the message giving a user the result of their
+// command's flow, for frontends that render standard markdown
+func markdownResultText(name string, result nats.ResultMsg, duration time.Duration) string {
+	var b strings.Builder
+
+	duration = duration.Round(time.Millisecond)
+	if result.Errored {
+		fmt.Fprintf(&b, "❌ **%s** failed after %s", name, duration)
+		if result.Hops.Error != "" {
+			fmt.Fprintf(&b, "\n```\n%s\n```", result.Hops.Error)
+		}
+	} else {
+		fmt.Fprintf(&b, "✅ **%s** succeeded in %s", name, duration)
+	}
+
+	if result.Body != "" {
+		b.WriteString("\n\n")
+		b.WriteString(result.Body)
+	}
+
+	return b.String()
+}
+
+// parseFormParamValue converts a submitted form value to the value of a param,
+// for frontends whose forms submit values as strings
+//
+// Empty values are converted to nil, except for text params, and select values
+// must be one of the param's options
+func parseFormParamValue(param markdown.Param, value any) (any, error) {
+	parsed, err := parseFormValue(param.Type, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkParamOptions(param, parsed); err != nil {
+		return nil, err
+	}
+
+	return parsed, nil
+}
+
+// submittedParam returns the param a submitted value is for, taken from the
+// command's flow so values are checked against its options. The submitted
+// type is used if the command isn't known, as unknown commands aren't run
+func submittedParam(commands map[string]*markdown.Flow, action, name, paramType string) markdown.Param {
+	if flow, ok := commands[action]; ok {
+		if param, ok := flow.Command.Param(name); ok {
+			return param
+		}
+	}
+
+	return markdown.Param{Type: paramType}
+}
+
+// checkParamOptions checks the values of a select or multiselect param are
+// among its options, as submissions can be crafted with any value
+func checkParamOptions(param markdown.Param, value any) error {
+	if !param.HasOptions() || value == nil {
+		return nil
+	}
+
+	values, ok := value.([]any)
+	if !ok {
+		values = []any{value}
+	}
+
+	for _, v := range values {
+		option, ok := v.(string)
+		if !ok || !param.OptionAllowed(option) {
+			return fmt.Errorf("'%v' isn't one of the param's options", v)
+		}
+	}
+
+	return nil
+}
+
+// parseFormValue converts a submitted form value to a value of paramType
+func parseFormValue(paramType string, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	// Some form inputs submit native values rather than strings
+	switch v := value.(type) {
+	case bool:
+		if paramType == "bool" {
+			return v, nil
+		}
+		value = strconv.FormatBool(v)
+	case float64:
+		if paramType == "number" {
+			return v, nil
+		}
+		value = strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		value = v.String()
+	case []any:
+		if paramType != "multiselect" {
+			return nil, fmt.Errorf("unsupported list value for %s param", paramType)
+		}
+
+		values := []any{}
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported multiselect value type %T", item)
+			}
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		return values, nil
+	}
+
+	strValue, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported value type %T", value)
+	}
+
+	strValue = strings.TrimSpace(strValue)
+	if strValue == "" {
+		if paramType == "text" || paramType == "string" {
+			return "", nil
+		}
+		if paramType == "multiselect" {
+			return []any{}, nil
+		}
+
+		return nil, nil
+	}
+
+	switch paramType {
+	case "text", "string":
+		return value, nil
+	case "number":
+		return strconv.ParseFloat(strValue, 64)
+	case "bool":
+		return strconv.ParseBool(strValue)
+	case "multiselect":
+		values := []any{}
+		for _, v := range strings.Split(strValue, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values, nil
+	case "date":
+		if _, err := time.Parse(markdown.ParamDateFormat, strValue); err != nil {
+			return nil, fmt.Errorf("invalid date, expected format %s", markdown.ParamDateFormat)
+		}
+		return strValue, nil
+	case "datetime":
+		for _, layout := range formDateTimeFormats {
+			if t, err := time.Parse(layout, strValue); err == nil {
+				return t.UTC().Format(markdown.ParamDateTimeFormat), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid datetime, expected format %s", markdown.ParamDateTimeFormat)
+	case "select", "user", "channel", "conversation":
+		return strValue, nil
+	default:
+		return nil, fmt.Errorf("unknown param type '%s'", paramType)
+	}
+}
@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/markdown"
+)
+
+const testCommandFlow = `---
+command:
+- environment: {type: select, options: [staging, production], required: true}
+- replicas: {type: number, default: 2}
+- dry_run: {type: bool, default: true}
+- services: {type: multiselect, options: [api, web, worker]}
+- deploy_at: {type: datetime}
+- notes: {type: text}
+---
+# Deploy
+
+Deploys the app
+`
+
+func TestParseFormParamValue(t *testing.T) {
+	type testCase struct {
+		name        string
+		paramType   string
+		options     []string
+		value       any
+		expected    any
+		expectError bool
+	}
+
+	tests := []testCase{
+		{name: "Text", paramType: "text", value: "hello", expected: "hello"},
+		{name: "Empty text", paramType: "string", value: "", expected: ""},
+		{name: "Missing value", paramType: "number", value: nil, expected: nil},
+		{name: "Number from string", paramType: "number", value: "1.5", expected: 1.5},
+		{name: "Native number", paramType: "number", value: float64(3), expected: float64(3)},
+		{name: "JSON number", paramType: "number", value: json.Number("12"), expected: float64(12)},
+		{name: "Invalid number", paramType: "number", value: "three", expectError: true},
+		{name: "Bool from string", paramType: "bool", value: "true", expected: true},
+		{name: "Native bool", paramType: "bool", value: false, expected: false},
+		{name: "Empty select", paramType: "select", value: "", expected: nil},
+		{name: "Multiselect", paramType: "multiselect", options: []string{"api", "web"}, value: "api, web,,", expected: []any{"api", "web"}},
+		{name: "Empty multiselect", paramType: "multiselect", value: "", expected: []any{}},
+		{name: "Multiselect list", paramType: "multiselect", options: []string{"api", "web"}, value: []any{"api", " ", "web"}, expected: []any{"api", "web"}},
+		{name: "List for other type", paramType: "select", value: []any{"api"}, expectError: true},
+		{name: "Select option", paramType: "select", options: []string{"staging", "production"}, value: "staging", expected: "staging"},
+		{name: "Select not an option", paramType: "select", options: []string{"staging", "production"}, value: "qa", expectError: true},
+		{name: "Multiselect not an option", paramType: "multiselect", options: []string{"api", "web"}, value: "api,db", expectError: true},
+		{name: "Date", paramType: "date", value: "2024-02-29", expected: "2024-02-29"},
+		{name: "Invalid date", paramType: "date", value: "29/02/2024", expectError: true},
+		{name: "Datetime without zone", paramType: "datetime", value: "2024-02-29 13:30", expected: "2024-02-29T13:30:00Z"},
+		{name: "Datetime with offset", paramType: "datetime", value: "2024-02-29T13:30:00+01:00", expected: "2024-02-29T12:30:00Z"},
+		{name: "Invalid datetime", paramType: "datetime", value: "tomorrow", expectError: true},
+		{name: "Unsupported value", paramType: "text", value: []any{"a"}, expectError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := parseFormParamValue(markdown.Param{Type: tc.paramType, Options: tc.options}, tc.value)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, value)
+		})
+	}
+}
+
+// setupTestFlow is a test helper that reads the given source as a flow
+func setupTestFlow(t *testing.T, source string) *markdown.Flow {
+	dir := filepath.Join(t.TempDir(), "deploy")
+	require.NoError(t, os.Mkdir(dir, 0744))
+
+	path := filepath.Join(dir, "app.md")
+	require.NoError(t, os.WriteFile(path, []byte(source), 0644))
+
+	flow, err := markdown.NewFlowReader(filepath.Dir(dir)).ReadFlow(path)
+	require.NoError(t, err)
+
+	return flow
+}
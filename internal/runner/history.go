@@ -0,0 +1,181 @@
+package runner
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+// maxFlowRuns is how many of the most recent runs of each flow are kept
+const maxFlowRuns = 100
+
+// RunStatusRejected is the status of a run whose approval was rejected
+const RunStatusRejected = "rejected"
+
+type (
+	// RunHistory keeps the recent runs of each flow, so their status can be
+	// shown on the site
+	//
+	// Runs are only kept in memory, so the history starts empty on restart
+	RunHistory struct {
+		flows FlowIndex
+		mutex sync.RWMutex
+		now   func() time.Time
+		// runs are the runs of each flow by flow ID, oldest first
+		runs map[string][]*FlowRun
+		// work indexes runs by their sequence ID and worker, which is all a
+		// worker's result has to identify them
+		work map[string]*FlowRun
+	}
+
+	// FlowIndex provides the flows that runs are kept for, by ID
+	FlowIndex interface {
+		IndexedFlows() map[string]*markdown.Flow
+	}
+
+	// FlowRun is a run of a flow for a single event
+	FlowRun struct {
+		SequenceID string    `json:"sequence_id"`
+		Flow       string    `json:"flow"`
+		Source     string    `json:"source"`
+		Event      string    `json:"event"`
+		Action     string    `json:"action"`
+		Status     string    `json:"status"`
+		Error      string    `json:"error,omitempty"`
+		DurationMS int64     `json:"duration_ms,omitempty"`
+		StartedAt  time.Time `json:"started_at"`
+		UpdatedAt  time.Time `json:"updated_at"`
+		worker     string
+	}
+)
+
+func NewRunHistory(flows FlowIndex) *RunHistory {
+	return &RunHistory{
+		flows: flows,
+		now:   time.Now,
+		runs:  map[string][]*FlowRun{},
+		work:  map[string]*FlowRun{},
+	}
+}
+
+// Flow returns a flow that runs are kept for
+func (h *RunHistory) Flow(id string) (*markdown.Flow, bool) {
+	flow, ok := h.flows.IndexedFlows()[id]
+	return flow, ok
+}
+
+// Runs returns up to limit of the most recent runs of a flow, newest first
+func (h *RunHistory) Runs(flowID string, limit int) []FlowRun {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	flowRuns := h.runs[flowID]
+	runs := make([]FlowRun, 0, min(limit, len(flowRuns)))
+	for i := len(flowRuns) - 1; i >= 0 && len(runs) < limit; i-- {
+		runs = append(runs, *flowRuns[i])
+	}
+
+	return runs
+}
+
+func (h *RunHistory) awaitingApproval(flow *markdown.Flow, hopsMsg *nats.HopsMsg) {
+	h.update(flow, hopsMsg.SequenceId, hopsMsg, func(run *FlowRun) {
+		run.Status = RunStatusAwaitingApproval
+	})
+}
+
+func (h *RunHistory) rejected(flow *markdown.Flow, sequenceID string) {
+	h.update(flow, sequenceID, nil, func(run *FlowRun) {
+		run.Status = RunStatusRejected
+	})
+}
+
+func (h *RunHistory) dispatched(flow *markdown.Flow, hopsMsg *nats.HopsMsg) {
+	h.update(flow, hopsMsg.SequenceId, hopsMsg, func(run *FlowRun) {
+		// Dispatching is retried, which mustn't undo a result
+		if run.Status != RunStatusSucceeded && run.Status != RunStatusFailed {
+			run.Status = RunStatusRunning
+		}
+	})
+}
+
+// finished records the result of a worker, ignoring results for runs that
+// aren't in the history
+func (h *RunHistory) finished(sequenceID string, result nats.ResultMsg) {
+	now := h.now()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	run, ok := h.work[workKey(sequenceID, result.Hops.Action)]
+	if !ok {
+		return
+	}
+
+	run.Status = RunStatusSucceeded
+	if result.Errored {
+		run.Status = RunStatusFailed
+	}
+	run.Error = result.Hops.Error
+
+	// Prefer the worker's own timings, falling back to time since dispatch
+	duration := result.Duration()
+	if duration == 0 {
+		duration = now.Sub(run.StartedAt)
+	}
+	run.DurationMS = duration.Milliseconds()
+	run.UpdatedAt = now
+}
+
+// update changes the run of a flow for a sequence, adding it if it's new
+//
+// hopsMsg is the event that triggered the run, used to describe new runs
+func (h *RunHistory) update(flow *markdown.Flow, sequenceID string, hopsMsg *nats.HopsMsg, fn func(run *FlowRun)) {
+	now := h.now()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := workKey(sequenceID, flow.Worker)
+	run, ok := h.work[key]
+	if !ok {
+		run = &FlowRun{
+			SequenceID: sequenceID,
+			Flow:       flow.ID,
+			StartedAt:  now,
+			worker:     flow.Worker,
+		}
+		if hopsMsg != nil {
+			run.Source = hopsMsg.Source
+			run.Event = hopsMsg.Event
+			run.Action = hopsMsg.Action
+		}
+
+		h.work[key] = run
+		h.add(run)
+	}
+
+	fn(run)
+	run.UpdatedAt = now
+}
+
+// add appends a run to its flow's runs, forgetting the oldest run if there are
+// too many. Callers must hold the mutex
+func (h *RunHistory) add(run *FlowRun) {
+	runs := append(h.runs[run.Flow], run)
+
+	if len(runs) > maxFlowRuns {
+		oldest := runs[0]
+		delete(h.work, workKey(oldest.SequenceID, oldest.worker))
+		runs = slices.Delete(runs, 0, 1)
+	}
+
+	h.runs[run.Flow] = runs
+}
+
+func workKey(sequenceID, worker string) string {
+	return sequenceID + " " + worker
+}
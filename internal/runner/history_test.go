@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+type stubFlows map[string]*markdown.Flow
+
+func (s stubFlows) IndexedFlows() map[string]*markdown.Flow {
+	return s
+}
+
+func TestRunHistory(t *testing.T) {
+	flow := setupTestFlow(t, testCommandFlow)
+	history := NewRunHistory(stubFlows{flow.ID: flow})
+
+	now := time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+	history.now = func() time.Time { return now }
+
+	_, ok := history.Flow(flow.ID)
+	assert.True(t, ok)
+	_, ok = history.Flow("nope")
+	assert.False(t, ok)
+
+	first := &nats.HopsMsg{SequenceId: "seq-1", Source: "slack", Event: "command", Action: flow.ActionName()}
+	history.dispatched(flow, first)
+
+	now = now.Add(time.Minute)
+	second := &nats.HopsMsg{SequenceId: "seq-2", Source: "web", Event: "command", Action: flow.ActionName()}
+	history.awaitingApproval(flow, second)
+
+	runs := history.Runs(flow.ID, 10)
+	require.Len(t, runs, 2)
+	assert.Equal(t, "seq-2", runs[0].SequenceID, "Newest runs should be first")
+	assert.Equal(t, RunStatusAwaitingApproval, runs[0].Status)
+	assert.Equal(t, RunStatusRunning, runs[1].Status)
+	assert.Equal(t, "slack", runs[1].Source)
+
+	now = now.Add(time.Minute)
+	history.finished("seq-1", nats.ResultMsg{
+		Hops:    nats.HopsResultMeta{Action: flow.Worker, Error: "boom"},
+		Errored: true,
+	})
+	history.finished("seq-1", nats.ResultMsg{Hops: nats.HopsResultMeta{Action: "other.worker"}})
+	history.rejected(flow, "seq-2")
+
+	runs = history.Runs(flow.ID, 1)
+	require.Len(t, runs, 1, "Runs should be limited")
+	assert.Equal(t, RunStatusRejected, runs[0].Status)
+
+	runs = history.Runs(flow.ID, 10)
+	assert.Equal(t, RunStatusFailed, runs[1].Status, "Results of other workers should be ignored")
+	assert.Equal(t, "boom", runs[1].Error)
+	assert.Equal(t, int64(2*time.Minute/time.Millisecond), runs[1].DurationMS, "Duration should fall back to time since dispatch")
+
+	history.dispatched(flow, first)
+	runs = history.Runs(flow.ID, 10)
+	assert.Len(t, runs, 2, "Redispatching should update the existing run")
+	assert.Equal(t, RunStatusFailed, runs[1].Status, "Redispatching shouldn't undo a result")
+
+	for i := 0; i < maxFlowRuns; i++ {
+		history.dispatched(flow, &nats.HopsMsg{SequenceId: fmt.Sprintf("bulk-%d", i)})
+	}
+	runs = history.Runs(flow.ID, maxFlowRuns*2)
+	assert.Len(t, runs, maxFlowRuns, "Oldest runs should be forgotten")
+	assert.NotContains(t, history.work, workKey("seq-1", flow.Worker))
+
+	assert.Empty(t, history.Runs("nope", 10))
+}
@@ -0,0 +1,338 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/manterfield/go-mapreader"
+	"github.com/rs/zerolog"
+
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+const mattermostDialogCallbackID = "hops_command"
+
+type (
+	// MattermostFrontend runs commands from mattermost slash commands,
+	// presenting each command as an interactive dialog
+	//
+	// Dialog submissions are posted by mattermost to dialogURL, which must
+	// deliver them to hops as 'mattermost.command' events
+	//
+	// The token is only sent to serverURL. Response URLs are taken from events,
+	// so are posted to without it
+	MattermostFrontend struct {
+		api       *APIClient
+		dialogURL string
+		responses *APIClient
+		serverURL string
+	}
+
+	MattermostDialog struct {
+		CallbackID       string                    `json:"callback_id"`
+		Title            string                    `json:"title"`
+		IntroductionText string                    `json:"introduction_text,omitempty"`
+		Elements         []MattermostDialogElement `json:"elements"`
+		SubmitLabel      string                    `json:"submit_label"`
+		State            string                    `json:"state"`
+	}
+
+	MattermostDialogElement struct {
+		DisplayName string                   `json:"display_name"`
+		Name        string                   `json:"name"`
+		Type        string                   `json:"type"`
+		SubType     string                   `json:"subtype,omitempty"`
+		Default     string                   `json:"default,omitempty"`
+		Placeholder string                   `json:"placeholder,omitempty"`
+		HelpText    string                   `json:"help_text,omitempty"`
+		Optional    bool                     `json:"optional"`
+		DataSource  string                   `json:"data_source,omitempty"`
+		Options     []MattermostDialogOption `json:"options,omitempty"`
+	}
+
+	MattermostDialogOption struct {
+		Text  string `json:"text"`
+		Value string `json:"value"`
+	}
+
+	// MattermostDialogState is passed through a dialog and back on submission,
+	// carrying what's needed to parse the submitted values
+	MattermostDialogState struct {
+		CommandAction string            `json:"command_action"`
+		ParamTypes    map[string]string `json:"param_types"`
+	}
+)
+
+func NewMattermostFrontend(serverURL, dialogURL string, api *APIClient) *MattermostFrontend {
+	m := &MattermostFrontend{
+		api:       api,
+		dialogURL: dialogURL,
+		serverURL: strings.TrimRight(serverURL, "/"),
+	}
+	if api != nil {
+		m.responses = NewAPIClient(api.httpClient, nil, api.logger)
+	}
+
+	return m
+}
+
+// RequestCommand opens the dialog for a command in mattermost, or lets the
+// user know why it can't be opened
+func (m *MattermostFrontend) RequestCommand(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg, matchErr error, logger zerolog.Logger) error {
+	responseURL, err := mapreader.StrErr(hopsMsg.Data, "response_url")
+	if err != nil {
+		return fmt.Errorf("%w: unable to get response_url for command request: %w", nats.ErrEventFatal, err)
+	}
+
+	commandText := mapreader.Str(hopsMsg.Data, "text")
+	logger = logger.With().Str("command", commandText).Logger()
+
+	if msg := commandRequestError(flow, matchErr, commandText, logger); msg != "" {
+		return m.sendResponse(ctx, responseURL, msg)
+	}
+
+	logger = logger.With().Str("flow", flow.ID).Logger()
+
+	triggerID, err := mapreader.StrErr(hopsMsg.Data, "trigger_id")
+	if err != nil {
+		logger.Error().Err(err).Msg("Command request is missing trigger_id")
+		return m.sendResponse(ctx, responseURL, "command failed - unable to open form")
+	}
+
+	evalCtx, err := markdown.EventEvalContext(hopsMsg)
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to create evaluation context for command")
+		return m.sendResponse(ctx, responseURL, "command failed")
+	}
+
+	dialog, err := CommandToMattermostDialog(flow, evalCtx)
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to render command as dialog")
+		return m.sendResponse(ctx, responseURL, "command failed")
+	}
+
+	body := map[string]any{
+		"trigger_id": triggerID,
+		"url":        m.dialogURL,
+		"dialog":     dialog,
+	}
+
+	if err := m.post(ctx, "/api/v4/actions/dialogs/open", body); err != nil {
+		logger.Error().Err(err).Msg("Unable to open command dialog")
+		return m.sendResponse(ctx, responseURL, "command failed - unable to open form")
+	}
+
+	logger.Debug().Msg("Opened command dialog")
+
+	return nil
+}
+
+// ParseCommand converts a dialog submission into a command event
+func (m *MattermostFrontend) ParseCommand(hopsMsg *nats.HopsMsg, commands map[string]*markdown.Flow) error {
+	if t := mapreader.Str(hopsMsg.Data, "type"); t != "dialog_submission" {
+		return fmt.Errorf("unsupported mattermost interaction type for commands '%s'", t)
+	}
+
+	data, err := parseMattermostDialogSubmission(hopsMsg.Data, commands)
+	if err != nil {
+		return fmt.Errorf("unable to parse command from event: %w", err)
+	}
+
+	hopsMsg.Action = mapreader.Str(data, "hops.action")
+	hopsMsg.Data = data
+
+	return nil
+}
+
+func (m *MattermostFrontend) CommandDispatched(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg) error {
+	return m.sendEphemeral(ctx, hopsMsg.Data, markdownDispatchedText(flow))
+}
+
+func (m *MattermostFrontend) CommandResult(ctx context.Context, name string, hopsMsg *nats.HopsMsg, result nats.ResultMsg, duration time.Duration) error {
+	return m.sendEphemeral(ctx, hopsMsg.Data, markdownResultText(name, result, duration))
+}
+
+// CommandToMattermostDialog renders a command as a mattermost interactive dialog
+//
+// evalCtx is used to evaluate the options of select params that use options_from
+func CommandToMattermostDialog(flow *markdown.Flow, evalCtx *hcl.EvalContext) (*MattermostDialog, error) {
+	intro, err := flow.Markdown()
+	if err != nil {
+		return nil, err
+	}
+
+	flowCtx := flow.EvalContext(evalCtx)
+
+	state := MattermostDialogState{
+		CommandAction: flow.ActionName(),
+		ParamTypes:    map[string]string{},
+	}
+
+	elements := []MattermostDialogElement{}
+
+	for _, p := range flow.Command {
+		name, param := p.Param()
+		state.ParamTypes[name] = param.Type
+
+		elem := MattermostDialogElement{
+			DisplayName: p.DisplayName(),
+			Name:        name,
+			Optional:    !param.Required,
+		}
+
+		if param.Default != nil {
+			elem.Default = fmt.Sprintf("%v", param.Default)
+		}
+
+		switch param.Type {
+		case "text":
+			elem.Type = "textarea"
+		case "string":
+			elem.Type = "text"
+		case "number":
+			elem.Type = "text"
+			elem.SubType = "number"
+		case "bool":
+			elem.Type = "bool"
+		case "select", "multiselect":
+			options, err := param.OptionValues(flowCtx)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get options for param '%s': %w", name, err)
+			}
+
+			if param.Type == "select" {
+				elem.Type = "select"
+				for _, o := range options {
+					elem.Options = append(elem.Options, MattermostDialogOption{Text: o, Value: o})
+				}
+				break
+			}
+
+			// Dialogs have no multi-select element, so options are given as comma separated text
+			elem.Type = "text"
+			elem.HelpText = fmt.Sprintf("Comma separated, from: %s", strings.Join(options, ", "))
+			if defaults, ok := param.Default.([]any); ok {
+				elem.Default = joinAny(defaults, ", ")
+			}
+		case "date":
+			elem.Type = "text"
+			elem.Placeholder = "YYYY-MM-DD"
+		case "datetime":
+			elem.Type = "text"
+			elem.Placeholder = "YYYY-MM-DD HH:MM"
+			elem.HelpText = "Times are in UTC unless an offset is given"
+		case "user":
+			elem.Type = "select"
+			elem.DataSource = "users"
+		case "channel", "conversation":
+			elem.Type = "select"
+			elem.DataSource = "channels"
+		default:
+			return nil, fmt.Errorf("unable to parse param '%s' - unknown type '%s'", name, param.Type)
+		}
+
+		elements = append(elements, elem)
+	}
+
+	stateB, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MattermostDialog{
+		CallbackID:       mattermostDialogCallbackID,
+		Title:            flow.DisplayName(),
+		IntroductionText: intro,
+		Elements:         elements,
+		SubmitLabel:      "Run",
+		State:            string(stateB),
+	}, nil
+}
+
+func parseMattermostDialogSubmission(payload map[string]any, commands map[string]*markdown.Flow) (map[string]any, error) {
+	hops := mapreader.Map[any](payload, "hops")
+	if hops == nil {
+		hops = map[string]any{}
+	}
+
+	commandPayload := map[string]any{
+		"hops": hops,
+		"ctx":  payload,
+	}
+
+	s, err := mapreader.BytesErr(payload, "state")
+	if err != nil {
+		return nil, errors.New("unable to read required state for command")
+	}
+
+	state := MattermostDialogState{}
+	if err := json.Unmarshal(s, &state); err != nil {
+		return nil, fmt.Errorf("unable to parse required state for command: %w", err)
+	}
+
+	hops["action"] = state.CommandAction
+
+	submission := mapreader.Map[any](payload, "submission")
+
+	for name, paramType := range state.ParamTypes {
+		param := submittedParam(commands, state.CommandAction, name, paramType)
+		value, err := parseFormParamValue(param, submission[name])
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse command param '%s': %w", name, err)
+		}
+
+		commandPayload[name] = value
+	}
+
+	return commandPayload, nil
+}
+
+// sendEphemeral posts a message only visible to the user that submitted a command
+func (m *MattermostFrontend) sendEphemeral(ctx context.Context, commandData map[string]any, msg string) error {
+	channelID := mapreader.Str(commandData, "ctx.channel_id")
+	userID := mapreader.Str(commandData, "ctx.user_id")
+	if channelID == "" || userID == "" {
+		return errors.New("command is missing the channel or user to respond to")
+	}
+
+	body := map[string]any{
+		"user_id": userID,
+		"post": map[string]any{
+			"channel_id": channelID,
+			"message":    msg,
+		},
+	}
+
+	return m.post(ctx, "/api/v4/posts/ephemeral", body)
+}
+
+// post calls the mattermost API at the given path with the access token
+func (m *MattermostFrontend) post(ctx context.Context, path string, body any) error {
+	return m.api.Post(ctx, m.serverURL+path, body, nil)
+}
+
+// sendResponse replies to a slash command via its response URL, which is
+// called without the access token as it comes from the event
+func (m *MattermostFrontend) sendResponse(ctx context.Context, responseURL, msg string) error {
+	body := map[string]any{
+		"response_type": "ephemeral",
+		"text":          msg,
+	}
+
+	return m.responses.Post(ctx, responseURL, body, nil)
+}
+
+func joinAny(values []any, sep string) string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = fmt.Sprintf("%v", v)
+	}
+
+	return strings.Join(strs, sep)
+}
@@ -0,0 +1,256 @@
+package runner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+// stubServer is a local HTTP server that records the JSON bodies posted to it,
+// and the authorization header they were posted with
+type stubServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	auth     map[string][]string
+	requests map[string][]map[string]any
+}
+
+func newStubServer(t *testing.T) *stubServer {
+	s := &stubServer{
+		auth:     map[string][]string{},
+		requests: map[string][]map[string]any{},
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]any{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.auth[r.URL.Path] = append(s.auth[r.URL.Path], r.Header.Get("Authorization"))
+		s.requests[r.URL.Path] = append(s.requests[r.URL.Path], body)
+		s.mu.Unlock()
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *stubServer) Requests(path string) []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+// Auth returns the authorization header of each request to path
+func (s *stubServer) Auth(path string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.auth[path]
+}
+
+func TestMattermostRequestCommand(t *testing.T) {
+	server := newStubServer(t)
+	frontend := NewMattermostFrontend(server.URL+"/", "https://hooks.example.com/mm", NewAPIClient(server.Client(), StaticToken("token"), zerolog.Nop()))
+	flow := setupTestFlow(t, testCommandFlow)
+
+	hopsMsg := &nats.HopsMsg{
+		Source: "mattermost",
+		Event:  "command_request",
+		Action: flow.ActionName(),
+		Data: map[string]any{
+			"text":         "deploy-app",
+			"trigger_id":   "trigger",
+			"response_url": server.URL + "/hooks/commands/abc",
+		},
+	}
+
+	err := frontend.RequestCommand(context.Background(), flow, hopsMsg, nil, zerolog.Nop())
+	require.NoError(t, err)
+
+	requests := server.Requests("/api/v4/actions/dialogs/open")
+	require.Len(t, requests, 1)
+	assert.Equal(t, "trigger", requests[0]["trigger_id"])
+	assert.Equal(t, "https://hooks.example.com/mm", requests[0]["url"])
+
+	dialogB, err := json.Marshal(requests[0]["dialog"])
+	require.NoError(t, err)
+
+	dialog := MattermostDialog{}
+	require.NoError(t, json.Unmarshal(dialogB, &dialog))
+
+	assert.Equal(t, mattermostDialogCallbackID, dialog.CallbackID)
+	assert.Equal(t, "Deploy App", dialog.Title)
+	assert.Contains(t, dialog.IntroductionText, "Deploys the app")
+	assert.Equal(t, []MattermostDialogElement{
+		{
+			DisplayName: "Environment",
+			Name:        "environment",
+			Type:        "select",
+			Options:     []MattermostDialogOption{{Text: "staging", Value: "staging"}, {Text: "production", Value: "production"}},
+		},
+		{DisplayName: "Replicas", Name: "replicas", Type: "text", SubType: "number", Default: "2", Optional: true},
+		{DisplayName: "Dry Run", Name: "dry_run", Type: "bool", Default: "true", Optional: true},
+		{DisplayName: "Services", Name: "services", Type: "text", HelpText: "Comma separated, from: api, web, worker", Optional: true},
+		{DisplayName: "Deploy At", Name: "deploy_at", Type: "text", Placeholder: "YYYY-MM-DD HH:MM", HelpText: "Times are in UTC unless an offset is given", Optional: true},
+		{DisplayName: "Notes", Name: "notes", Type: "textarea", Optional: true},
+	}, dialog.Elements)
+
+	assert.Empty(t, server.Requests("/hooks/commands/abc"), "No error response should be sent")
+	assert.Equal(t, []string{"Bearer token"}, server.Auth("/api/v4/actions/dialogs/open"))
+}
+
+func TestMattermostRequestCommandErrors(t *testing.T) {
+	type testCase struct {
+		name        string
+		matchErr    error
+		expectedMsg string
+	}
+
+	tests := []testCase{
+		{
+			name:        "Command not found",
+			matchErr:    markdown.ErrCommandNotFound,
+			expectedMsg: "Sorry, `nope` didn't match any commands",
+		},
+		{
+			name:        "Conditions not met",
+			expectedMsg: "Command conditions not met - _Perhaps the command is restricted to specific channels or users?_",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newStubServer(t)
+			frontend := NewMattermostFrontend(server.URL, "", NewAPIClient(server.Client(), StaticToken("token"), zerolog.Nop()))
+
+			hopsMsg := &nats.HopsMsg{
+				Data: map[string]any{
+					"text":         "nope",
+					"response_url": server.URL + "/hooks/commands/abc",
+				},
+			}
+
+			err := frontend.RequestCommand(context.Background(), nil, hopsMsg, tc.matchErr, zerolog.Nop())
+			require.NoError(t, err)
+
+			requests := server.Requests("/hooks/commands/abc")
+			require.Len(t, requests, 1)
+			assert.Equal(t, "ephemeral", requests[0]["response_type"])
+			assert.Equal(t, tc.expectedMsg, requests[0]["text"])
+			assert.Equal(t, []string{""}, server.Auth("/hooks/commands/abc"), "Token shouldn't be sent to response URLs")
+		})
+	}
+}
+
+func TestMattermostForeignResponseURL(t *testing.T) {
+	server := newStubServer(t)
+	foreign := newStubServer(t)
+	frontend := NewMattermostFrontend(server.URL, "", NewAPIClient(server.Client(), StaticToken("token"), zerolog.Nop()))
+
+	hopsMsg := &nats.HopsMsg{
+		Data: map[string]any{
+			"text":         "nope",
+			"response_url": foreign.URL + "/steal",
+		},
+	}
+
+	err := frontend.RequestCommand(context.Background(), nil, hopsMsg, markdown.ErrCommandNotFound, zerolog.Nop())
+	require.NoError(t, err)
+
+	require.Len(t, foreign.Requests("/steal"), 1)
+	assert.Equal(t, []string{""}, foreign.Auth("/steal"), "Token should never be sent to hosts other than the server")
+}
+
+func TestMattermostParseCommand(t *testing.T) {
+	flow := setupTestFlow(t, testCommandFlow)
+
+	dialog, err := CommandToMattermostDialog(flow, nil)
+	require.NoError(t, err)
+
+	hopsMsg := &nats.HopsMsg{
+		Source: "mattermost",
+		Event:  "command",
+		Data: map[string]any{
+			"hops":        map[string]any{"source": "mattermost", "event": "command"},
+			"type":        "dialog_submission",
+			"callback_id": dialog.CallbackID,
+			"state":       dialog.State,
+			"user_id":     "user-1",
+			"channel_id":  "channel-1",
+			"submission": map[string]any{
+				"environment": "production",
+				"replicas":    "3",
+				"dry_run":     false,
+				"services":    "api, worker",
+				"deploy_at":   "2024-02-29 13:30",
+			},
+		},
+	}
+
+	commands := map[string]*markdown.Flow{flow.ActionName(): flow}
+	frontend := NewMattermostFrontend("", "", nil)
+	require.NoError(t, frontend.ParseCommand(hopsMsg, commands))
+
+	assert.Equal(t, flow.ActionName(), hopsMsg.Action)
+	assert.Equal(t, flow.ActionName(), hopsMsg.Data["hops"].(map[string]any)["action"])
+	assert.Equal(t, "production", hopsMsg.Data["environment"])
+	assert.Equal(t, float64(3), hopsMsg.Data["replicas"])
+	assert.Equal(t, false, hopsMsg.Data["dry_run"])
+	assert.Equal(t, []any{"api", "worker"}, hopsMsg.Data["services"])
+	assert.Equal(t, "2024-02-29T13:30:00Z", hopsMsg.Data["deploy_at"])
+	assert.Nil(t, hopsMsg.Data["notes"], "Missing values should be nil")
+
+	hopsMsg.Data = map[string]any{
+		"type":       "dialog_submission",
+		"state":      dialog.State,
+		"submission": map[string]any{"environment": "qa"},
+	}
+	assert.Error(t, frontend.ParseCommand(hopsMsg, commands), "Values that aren't options should fail to parse")
+
+	hopsMsg.Data = map[string]any{"type": "dialog_submission", "state": "not json"}
+	assert.Error(t, frontend.ParseCommand(hopsMsg, commands), "Invalid state should fail to parse")
+}
+
+func TestMattermostCommandResult(t *testing.T) {
+	server := newStubServer(t)
+	frontend := NewMattermostFrontend(server.URL, "", NewAPIClient(server.Client(), StaticToken("token"), zerolog.Nop()))
+
+	hopsMsg := &nats.HopsMsg{
+		Data: map[string]any{
+			"ctx": map[string]any{"user_id": "user-1", "channel_id": "channel-1"},
+		},
+	}
+
+	result := nats.ResultMsg{Errored: true, Hops: nats.HopsResultMeta{Error: "boom"}}
+	err := frontend.CommandResult(context.Background(), "Deploy", hopsMsg, result, 1500*time.Millisecond)
+	require.NoError(t, err)
+
+	requests := server.Requests("/api/v4/posts/ephemeral")
+	require.Len(t, requests, 1)
+	assert.Equal(t, "user-1", requests[0]["user_id"])
+	assert.Equal(t, map[string]any{
+		"channel_id": "channel-1",
+		"message":    "❌ **Deploy** failed after 1.5s\n```\nboom\n```",
+	}, requests[0]["post"])
+
+	hopsMsg.Data = map[string]any{}
+	assert.Error(t, frontend.CommandResult(context.Background(), "Deploy", hopsMsg, result, time.Second), "Missing user should error")
+}
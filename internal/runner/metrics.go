@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	eventsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hops_events_received_total",
+		Help: "Events received by the runner",
+	}, []string{"source", "event"})
+	flowsMatched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hops_flows_matched_total",
+		Help: "Times a flow matched an event or command",
+	}, []string{"flow"})
+	flowsDispatched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hops_flows_dispatched_total",
+		Help: "Times a flow was dispatched to its worker",
+	}, []string{"flow"})
+	flowDispatchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hops_flow_dispatch_errors_total",
+		Help: "Failures to dispatch a flow to its worker",
+	}, []string{"flow"})
+	flowIfErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hops_flow_if_errors_total",
+		Help: "Failures to evaluate a flow's 'if' condition against an event",
+	}, []string{"flow"})
+	dispatchLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hops_dispatch_latency_seconds",
+		Help:    "Time from an event being received to flows being dispatched for it, excluding flows that need approval",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"flow"})
+	scheduleTriggers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hops_schedule_triggers_total",
+		Help: "Times a scheduled flow was triggered, by whether its event was published",
+	}, []string{"flow", "outcome"})
+	flowLoads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hops_flow_loads_total",
+		Help: "Loads and reloads of flows, by outcome",
+	}, []string{"outcome"})
+)
+
+const (
+	outcomeError   = "error"
+	outcomeSuccess = "success"
+)
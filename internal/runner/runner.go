@@ -5,33 +5,66 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"sync"
 	"time"
 
 	"github.com/goccy/go-json"
+	"github.com/manterfield/go-mapreader"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/robfig/cron"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/hiphops-io/hops/internal/audit"
+	"github.com/hiphops-io/hops/internal/auth"
+	"github.com/hiphops-io/hops/internal/tracing"
 	"github.com/hiphops-io/hops/markdown"
 	"github.com/hiphops-io/hops/nats"
 )
 
-type Runner struct {
-	flowReader *markdown.FlowReader
-	consumer   jetstream.Consumer
-	cron       *cron.Cron
-	logger     zerolog.Logger
-	natsClient *nats.Client
-	schedules  []*Schedule
-}
+type (
+	Runner struct {
+		audit      *audit.Log
+		flowReader *markdown.FlowReader
+		consumer   jetstream.Consumer
+		cron       *cron.Cron
+		frontends  map[string]CommandFrontend
+		history    *RunHistory
+		logger     zerolog.Logger
+		natsClient *nats.Client
+		policy     *auth.Policy
+		schedules  []*Schedule
+		slack      *SlackClient
+		// mutex guards the cron scheduler and health, as flows can be reloaded
+		// while running
+		mutex       sync.Mutex
+		cronRunning bool
+		loadErr     error
+	}
 
-func NewRunner(natsClient *nats.Client, flowReader *markdown.FlowReader, consumer jetstream.Consumer, logger zerolog.Logger) (*Runner, error) {
+	RunnerOpt func(*Runner)
+)
+
+// NewRunner creates a runner, with the slack command frontend registered by
+// default
+func NewRunner(natsClient *nats.Client, flowReader *markdown.FlowReader, consumer jetstream.Consumer, logger zerolog.Logger, opts ...RunnerOpt) (*Runner, error) {
 	r := &Runner{
 		flowReader: flowReader,
 		consumer:   consumer,
+		history:    NewRunHistory(flowReader),
 		logger:     logger,
 		natsClient: natsClient,
+		slack:      NewSlackClient(NewAccessTokenStore(natsClient, slackAccessTokenSubject), logger),
+	}
+
+	r.frontends = map[string]CommandFrontend{
+		"slack": NewSlackFrontend(r.slack),
+	}
+
+	for _, opt := range opts {
+		opt(r)
 	}
 
 	err := r.Load(context.Background())
@@ -42,7 +75,47 @@ func NewRunner(natsClient *nats.Client, flowReader *markdown.FlowReader, consume
 	return r, nil
 }
 
+// WithCommandFrontendOpt registers a command frontend for events from source,
+// replacing any frontend already registered for it
+func WithCommandFrontendOpt(source string, frontend CommandFrontend) RunnerOpt {
+	return func(r *Runner) {
+		r.frontends[source] = frontend
+	}
+}
+
+// WithPolicyOpt limits the commands users may run to those their roles allow,
+// as is done for the API
+func WithPolicyOpt(policy *auth.Policy) RunnerOpt {
+	return func(r *Runner) {
+		r.policy = policy
+	}
+}
+
+// WithRunHistoryOpt records the runs of flows in history, in place of a
+// history only the runner can read
+func WithRunHistoryOpt(history *RunHistory) RunnerOpt {
+	return func(r *Runner) {
+		r.history = history
+	}
+}
+
 func (r *Runner) Load(ctx context.Context) error {
+	err := r.load()
+
+	r.mutex.Lock()
+	r.loadErr = err
+	r.mutex.Unlock()
+
+	if err != nil {
+		flowLoads.WithLabelValues(outcomeError).Inc()
+		return err
+	}
+
+	flowLoads.WithLabelValues(outcomeSuccess).Inc()
+	return nil
+}
+
+func (r *Runner) load() error {
 	if err := r.flowReader.ReadAll(); err != nil {
 		return err
 	}
@@ -57,15 +130,36 @@ func (r *Runner) Load(ctx context.Context) error {
 }
 
 func (r *Runner) Run(ctx context.Context) error {
-	defer func() {
-		if r.cron != nil {
-			r.cron.Stop()
-		}
-	}()
+	defer r.stopCron()
 
 	return r.natsClient.Consume(ctx, r.consumer, r.MessageHandler)
 }
 
+// FlowsHealth errors if flows failed to load when last (re)loaded
+func (r *Runner) FlowsHealth(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.loadErr != nil {
+		return fmt.Errorf("flows failed to load: %w", r.loadErr)
+	}
+
+	return nil
+}
+
+// SchedulerHealth errors if the cron scheduler for scheduled flows isn't
+// running
+func (r *Runner) SchedulerHealth(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.cronRunning {
+		return errors.New("scheduler isn't running")
+	}
+
+	return nil
+}
+
 func (r *Runner) MessageHandler(
 	ctx context.Context,
 	hopsMsg *nats.HopsMsg,
@@ -73,12 +167,16 @@ func (r *Runner) MessageHandler(
 ) error {
 	logger := r.logger.With().Str("sequence_id", hopsMsg.SequenceId).Logger()
 	logger.Debug().Msgf("Received event '%s'", hopsMsg.Subject)
+	eventsReceived.WithLabelValues(hopsMsg.Source, hopsMsg.Event).Inc()
+	r.audit.Record(ctx, auditRecord(audit.TypeEventReceived, hopsMsg))
 
 	switch hopsMsg.Event {
 	case "command_request":
-		return r.handleCommandRequest(hopsMsg)
+		return r.handleCommandRequest(ctx, hopsMsg, logger)
 	case "command":
 		return r.handleCommand(ctx, hopsMsg, logger)
+	case nats.ResultEventId:
+		return r.handleResult(ctx, hopsMsg, logger)
 	default:
 		return r.handleSourceEvent(ctx, hopsMsg, logger)
 	}
@@ -87,23 +185,88 @@ func (r *Runner) MessageHandler(
 func (r *Runner) dispatchFlow(ctx context.Context, wg *sync.WaitGroup, flow *markdown.Flow, hopsMsg *nats.HopsMsg, errChan chan<- error, logger zerolog.Logger) {
 	defer wg.Done()
 
-	dataB, err := json.Marshal(hopsMsg.Data)
-	if err != nil {
+	ctx, span := tracing.Start(
+		ctx,
+		"hops.dispatch",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("hops.flow", flow.ID),
+			attribute.String("hops.worker", flow.Worker),
+		),
+	)
+	defer span.End()
+
+	if err := r.publishWork(ctx, flow, hopsMsg); err != nil {
+		tracing.RecordError(span, err)
+		flowDispatchErrors.WithLabelValues(flow.ID).Inc()
+		r.auditDispatch(ctx, flow, hopsMsg, audit.OutcomeDispatched, err)
 		errChan <- err
 		return
 	}
 
-	subject := nats.WorkSubject(hopsMsg.SequenceId, flow.Worker)
-	if _, _, err := r.natsClient.Publish(ctx, dataB, subject); err != nil {
-		errChan <- err
-		return
-	}
+	r.auditDispatch(ctx, flow, hopsMsg, audit.OutcomeDispatched, nil)
 
+	r.history.dispatched(flow, hopsMsg)
+	flowsDispatched.WithLabelValues(flow.ID).Inc()
+	// Approved flows are dispatched long after their event, which isn't latency
+	if flow.Approval == nil && !hopsMsg.Timestamp.IsZero() {
+		dispatchLatency.WithLabelValues(flow.ID).Observe(time.Since(hopsMsg.Timestamp).Seconds())
+	}
 	logger.Info().Msgf("Dispatched flow: %s", flow.ID)
 
 	errChan <- nil
 }
 
+// publishWork publishes the event to the flow's worker, which continues the
+// trace in ctx from the message's headers
+func (r *Runner) publishWork(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg) error {
+	data, err := workerPayload(flow, hopsMsg)
+	if err != nil {
+		return fmt.Errorf("%w: unable to prepare event for flow '%s': %w", nats.ErrEventFatal, flow.ID, err)
+	}
+
+	dataB, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	subject := nats.WorkSubject(hopsMsg.SequenceId, flow.Worker)
+	_, _, err = r.natsClient.Publish(ctx, dataB, subject)
+
+	return err
+}
+
+// workerPayload is the event sent to a flow's worker, with the flow's computed
+// inputs added under the hops.inputs key
+func workerPayload(flow *markdown.Flow, hopsMsg *nats.HopsMsg) (map[string]any, error) {
+	if len(flow.Inputs) == 0 {
+		return hopsMsg.Data, nil
+	}
+
+	evalCtx, err := markdown.EventEvalContext(hopsMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, err := flow.InputValues(evalCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy rather than modify the event, as it's shared by all flows being dispatched
+	meta := map[string]any{}
+	if existing, ok := hopsMsg.Data[nats.MetadataKey].(map[string]any); ok {
+		maps.Copy(meta, existing)
+	}
+	meta["inputs"] = inputs
+
+	data := map[string]any{}
+	maps.Copy(data, hopsMsg.Data)
+	data[nats.MetadataKey] = meta
+
+	return data, nil
+}
+
 func (r *Runner) dispatchFlows(ctx context.Context, flows []*markdown.Flow, hopsMsg *nats.HopsMsg, logger zerolog.Logger) error {
 	if len(flows) == 0 {
 		return nil
@@ -117,6 +280,12 @@ func (r *Runner) dispatchFlows(ctx context.Context, flows []*markdown.Flow, hops
 		flow := flow
 		wg.Add(1)
 		flowLogger := logger.With().Str("flow", flow.ID).Logger()
+
+		if flow.Approval != nil {
+			go r.requestApproval(ctx, &wg, flow, hopsMsg, errChan, flowLogger)
+			continue
+		}
+
 		go r.dispatchFlow(ctx, &wg, flow, hopsMsg, errChan, flowLogger)
 	}
 
@@ -134,46 +303,196 @@ func (r *Runner) dispatchFlows(ctx context.Context, flows []*markdown.Flow, hops
 	return err
 }
 
-func (r *Runner) handleCommandRequest(hopsMsg *nats.HopsMsg) error {
-	flow, err := markdown.MatchCommandFlows(r.flowReader.IndexedCommands(), hopsMsg, nil)
+func (r *Runner) handleCommandRequest(ctx context.Context, hopsMsg *nats.HopsMsg, logger zerolog.Logger) error {
+	flow, err := markdown.MatchCommandFlows(ctx, r.flowReader.IndexedCommands(), hopsMsg, nil)
+	if flow != nil && err == nil && !r.canRun(hopsMsg, flow.ActionName()) {
+		err = fmt.Errorf("%w '%s'", ErrCommandDenied, flow.ActionName())
+	}
+	r.auditCommand(ctx, audit.TypeCommandRequested, hopsMsg, flow, err)
 
-	switch hopsMsg.Source {
-	case "slack":
-		return SlackCommandRequest(flow, hopsMsg, err, SlackAccessTokenFunc(r.natsClient))
-	default:
+	frontend, ok := r.frontends[hopsMsg.Source]
+	if !ok {
 		if err != nil {
 			return err
 		}
 
 		return fmt.Errorf("unsupported command request source '%s'", hopsMsg.Source)
 	}
+
+	return frontend.RequestCommand(ctx, flow, hopsMsg, err, logger)
 }
 
 func (r *Runner) handleCommand(ctx context.Context, hopsMsg *nats.HopsMsg, logger zerolog.Logger) error {
-	switch hopsMsg.Source {
-	case "slack":
-		if err := SlackBlocksToCommandEvent(hopsMsg); err != nil {
-			return fmt.Errorf("unable to process slack command: %w", err)
-		}
-	default:
+	frontend, ok := r.frontends[hopsMsg.Source]
+	if !ok {
 		return fmt.Errorf("unsupported command source '%s'", hopsMsg.Source)
 	}
 
+	if err := frontend.ParseCommand(hopsMsg, r.flowReader.IndexedCommands()); err != nil {
+		return fmt.Errorf("unable to process %s command: %w", hopsMsg.Source, err)
+	}
+
+	if hopsMsg.Action == ApprovalAction {
+		return r.handleApproval(ctx, hopsMsg, logger)
+	}
+
 	// Get the flow for this command and trigger it
 	cmd, ok := r.flowReader.IndexedCommands()[hopsMsg.Action]
 	if !ok {
+		r.auditCommand(ctx, audit.TypeCommandSubmitted, hopsMsg, nil, markdown.ErrCommandNotFound)
 		return fmt.Errorf("unknown command received '%s'", hopsMsg.Action)
 	}
 
-	return r.dispatchFlows(ctx, []*markdown.Flow{cmd}, hopsMsg, logger)
+	if !r.canRun(hopsMsg, hopsMsg.Action) {
+		err := fmt.Errorf("%w '%s'", ErrCommandDenied, hopsMsg.Action)
+		r.auditCommand(ctx, audit.TypeCommandSubmitted, hopsMsg, cmd, err)
+		return fmt.Errorf("%w: %w", nats.ErrEventFatal, err)
+	}
+
+	r.auditCommand(ctx, audit.TypeCommandSubmitted, hopsMsg, cmd, nil)
+	flowsMatched.WithLabelValues(cmd.ID).Inc()
+
+	if err := r.dispatchFlows(ctx, []*markdown.Flow{cmd}, hopsMsg, logger); err != nil {
+		return err
+	}
+
+	// Failing to notify the user shouldn't fail the command, as it has already been dispatched
+	if err := frontend.CommandDispatched(ctx, cmd, hopsMsg); err != nil {
+		logger.Warn().Err(err).Msgf("Unable to notify %s that command was dispatched", hopsMsg.Source)
+	}
+
+	return nil
+}
+
+// canRun is true if the user that requested or submitted a command may run
+// it, where there's no check if the runner has no policy
+func (r *Runner) canRun(hopsMsg *nats.HopsMsg, action string) bool {
+	if r.policy == nil {
+		return true
+	}
+
+	return r.policy.CanRun(commandPrincipal(hopsMsg), action)
+}
+
+// commandPrincipal is who requested or submitted a command. Web commands are
+// by the principal the API authenticated, while chat users are named by their
+// source and ID such as slack:U012AB3CD, as chat platforms have no groups
+func commandPrincipal(hopsMsg *nats.HopsMsg) auth.Principal {
+	if hopsMsg.Source == WebSource {
+		webCtx := mapreader.Map[any](hopsMsg.Data, "ctx")
+		principal := auth.Principal{}
+		principal.Subject, _ = webCtx["user"].(string)
+		principal.Method, _ = webCtx["auth_method"].(string)
+
+		groups, _ := webCtx["groups"].([]any)
+		for _, g := range groups {
+			if group, ok := g.(string); ok {
+				principal.Groups = append(principal.Groups, group)
+			}
+		}
+
+		return principal
+	}
+
+	user := commandUser(hopsMsg)
+	if user == "" {
+		return auth.Principal{}
+	}
+
+	return auth.Principal{Subject: hopsMsg.Source + ":" + user, Method: hopsMsg.Source}
+}
+
+// handleResult reports the result of a flow back to the source that triggered
+// it, where that source was a command
+func (r *Runner) handleResult(ctx context.Context, hopsMsg *nats.HopsMsg, logger zerolog.Logger) error {
+	result := nats.ResultMsg{}
+	if err := json.Unmarshal(hopsMsg.Msg().Data(), &result); err != nil {
+		return fmt.Errorf("%w: unable to parse result: %w", nats.ErrEventFatal, err)
+	}
+
+	rec := auditRecord(audit.TypeFlowResult, hopsMsg)
+	rec.Worker = result.Hops.Action
+	rec.Outcome = audit.OutcomeSucceeded
+	if result.Errored {
+		rec.Outcome = audit.OutcomeFailed
+		rec.Error = result.Hops.Error
+	}
+	r.audit.Record(ctx, rec)
+
+	r.history.finished(hopsMsg.SequenceId, result)
+
+	rawMsg, err := r.natsClient.SourceEvent(ctx, hopsMsg.SequenceId)
+	if err != nil {
+		return fmt.Errorf("unable to fetch source event for result: %w", err)
+	}
+
+	sourceMsg, err := parseSourceEvent(rawMsg, hopsMsg.SequenceId)
+	if err != nil {
+		return fmt.Errorf("unable to parse source event for result: %w", err)
+	}
+
+	if sourceMsg.Event != "command" {
+		return nil
+	}
+
+	frontend, ok := r.frontends[sourceMsg.Source]
+	if !ok {
+		return nil
+	}
+
+	if err := frontend.ParseCommand(sourceMsg, r.flowReader.IndexedCommands()); err != nil {
+		return fmt.Errorf("%w: unable to parse command from source event: %w", nats.ErrEventFatal, err)
+	}
+
+	// Prefer the worker's own timings, falling back to time since the command was received
+	duration := result.Duration()
+	if duration == 0 {
+		duration = hopsMsg.Timestamp.Sub(sourceMsg.Timestamp)
+	}
+
+	name := sourceMsg.Action
+	if flow, ok := r.flowReader.IndexedCommands()[name]; ok {
+		name = flow.DisplayName()
+	}
+
+	if err := frontend.CommandResult(ctx, name, sourceMsg, result, duration); err != nil {
+		logger.Warn().Err(err).Msgf("Unable to send command result to %s", sourceMsg.Source)
+	}
+
+	return nil
 }
 
 func (r *Runner) handleSourceEvent(ctx context.Context, hopsMsg *nats.HopsMsg, logger zerolog.Logger) error {
-	matchedFlows, err := markdown.MatchFlows(r.flowReader.IndexedSensors(), hopsMsg, nil)
+	decisions, err := markdown.EvaluateFlows(ctx, r.flowReader.IndexedSensors(), hopsMsg, nil)
 	if err != nil {
 		return fmt.Errorf("%w: %w", nats.ErrEventFatal, err)
 	}
 
+	// Every decision is audited before failing on flows that couldn't be evaluated
+	var ifErr error
+	matchedFlows := []*markdown.Flow{}
+	for _, d := range decisions {
+		r.auditFlowDecision(ctx, hopsMsg, d)
+
+		switch {
+		case d.Err != nil:
+			flowIfErrors.WithLabelValues(d.Flow.ID).Inc()
+			if ifErr == nil {
+				ifErr = d.Err
+			}
+		case d.Matched:
+			matchedFlows = append(matchedFlows, d.Flow)
+		}
+	}
+
+	if ifErr != nil {
+		return fmt.Errorf("%w: %w", nats.ErrEventFatal, ifErr)
+	}
+
+	for _, flow := range matchedFlows {
+		flowsMatched.WithLabelValues(flow.ID).Inc()
+	}
+
 	return r.dispatchFlows(ctx, matchedFlows, hopsMsg, logger)
 }
 
@@ -200,6 +519,9 @@ func (r *Runner) prepareHopsSchedules() error {
 }
 
 func (r *Runner) startCron() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	if r.cron != nil {
 		r.cron.Stop()
 	}
@@ -210,4 +532,15 @@ func (r *Runner) startCron() {
 		r.cron.Schedule(schedule.CronSchedule, schedule)
 	}
 	r.cron.Start()
+	r.cronRunning = true
+}
+
+func (r *Runner) stopCron() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.cron != nil {
+		r.cron.Stop()
+	}
+	r.cronRunning = false
 }
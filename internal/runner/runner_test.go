@@ -0,0 +1,178 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/internal/auth"
+	"github.com/hiphops-io/hops/logs"
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+func TestRunnerHealth(t *testing.T) {
+	ctx := context.Background()
+	flowsDir := t.TempDir()
+	r := &Runner{flowReader: markdown.NewFlowReader(flowsDir)}
+
+	assert.Error(t, r.SchedulerHealth(ctx), "Scheduler shouldn't be running before flows are loaded")
+
+	flow := []byte("---\non: github.push\n---\nFlow\n")
+	require.NoError(t, os.WriteFile(filepath.Join(flowsDir, "push.md"), flow, 0o644))
+	require.NoError(t, r.Load(ctx))
+	assert.NoError(t, r.FlowsHealth(ctx))
+	assert.NoError(t, r.SchedulerHealth(ctx))
+
+	invalid := []byte("---\non: [\n---\nFlow\n")
+	require.NoError(t, os.WriteFile(filepath.Join(flowsDir, "invalid.md"), invalid, 0o644))
+	require.Error(t, r.Load(ctx))
+	assert.ErrorContains(t, r.FlowsHealth(ctx), "flows failed to load")
+
+	require.NoError(t, os.Remove(filepath.Join(flowsDir, "invalid.md")))
+	require.NoError(t, r.Load(ctx))
+	assert.NoError(t, r.FlowsHealth(ctx), "Reloading fixed flows should be healthy again")
+
+	r.stopCron()
+	assert.Error(t, r.SchedulerHealth(ctx))
+}
+
+func TestWorkerPayload(t *testing.T) {
+	hopsMsg := &nats.HopsMsg{
+		Source: "github",
+		Event:  "push",
+		Data: map[string]any{
+			"hops": map[string]any{"source": "github", "event": "push"},
+			"ref":  "refs/heads/main",
+		},
+	}
+
+	plain := setupTestFlow(t, "---\non: push\n---\nFlow\n")
+
+	data, err := workerPayload(plain, hopsMsg)
+	require.NoError(t, err)
+	assert.Equal(t, hopsMsg.Data, data, "Flows without inputs should get the event as-is")
+
+	withInputs := setupTestFlow(t, "---\non: push\ninputs:\n  branch: trimprefix(event.ref, \"refs/heads/\")\n---\nFlow\n")
+
+	data, err = workerPayload(withInputs, hopsMsg)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"hops": map[string]any{
+			"source": "github",
+			"event":  "push",
+			"inputs": map[string]any{"branch": "main"},
+		},
+		"ref": "refs/heads/main",
+	}, data)
+	assert.NotContains(t, hopsMsg.Data["hops"], "inputs", "The original event should not be modified")
+}
+
+func TestRunnerCommandPolicy(t *testing.T) {
+	ctx := context.Background()
+	natsClient := setupNatsClient(t)
+	server := newStubServer(t)
+
+	flowsDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(flowsDir, "deploy"), 0o744))
+	require.NoError(t, os.WriteFile(filepath.Join(flowsDir, "deploy", "app.md"), []byte(testCommandFlow), 0o644))
+
+	flowReader := markdown.NewFlowReader(flowsDir)
+	require.NoError(t, flowReader.ReadAll(), "Test setup: Flows should be read without error")
+	flow, ok := flowReader.IndexedFlow("deploy.app")
+	require.True(t, ok, "Test setup: Flow should be indexed")
+
+	policy, err := auth.NewPolicy([]auth.Role{
+		{Name: "deployers", Users: []string{"mattermost:mm-deployer"}, Groups: []string{"ops"}, Run: []string{"deploy*"}},
+	})
+	require.NoError(t, err)
+
+	mattermost := NewMattermostFrontend(server.URL, "", NewAPIClient(server.Client(), StaticToken("token"), zerolog.Nop()))
+	r := &Runner{
+		flowReader: flowReader,
+		frontends: map[string]CommandFrontend{
+			"mattermost": mattermost,
+			WebSource:    NewWebFrontend(flowReader, natsClient),
+		},
+		history:    NewRunHistory(flowReader),
+		logger:     logs.NoOpLogger(),
+		natsClient: natsClient,
+		policy:     policy,
+	}
+
+	t.Run("Request allowed", func(t *testing.T) {
+		hopsMsg := &nats.HopsMsg{
+			Source: "mattermost",
+			Event:  "command_request",
+			Action: flow.ActionName(),
+			Data: map[string]any{
+				"text":         "deploy-app",
+				"trigger_id":   "trigger",
+				"user_id":      "mm-deployer",
+				"response_url": server.URL + "/hooks/allowed",
+			},
+		}
+
+		require.NoError(t, r.handleCommandRequest(ctx, hopsMsg, r.logger))
+		assert.Len(t, server.Requests("/api/v4/actions/dialogs/open"), 1, "Allowed users should be shown the command")
+		assert.Empty(t, server.Requests("/hooks/allowed"))
+	})
+
+	t.Run("Request denied", func(t *testing.T) {
+		hopsMsg := &nats.HopsMsg{
+			Source: "mattermost",
+			Event:  "command_request",
+			Action: flow.ActionName(),
+			Data: map[string]any{
+				"text":         "deploy-app",
+				"trigger_id":   "trigger",
+				"user_id":      "mm-outsider",
+				"response_url": server.URL + "/hooks/denied",
+			},
+		}
+
+		require.NoError(t, r.handleCommandRequest(ctx, hopsMsg, r.logger))
+		assert.Len(t, server.Requests("/api/v4/actions/dialogs/open"), 1, "Denied users shouldn't be shown the command")
+
+		responses := server.Requests("/hooks/denied")
+		require.Len(t, responses, 1)
+		assert.Equal(t, "Sorry, you aren't allowed to run `deploy-app`", responses[0]["text"])
+	})
+
+	dispatched := func(seq string) bool {
+		stream, err := natsClient.JetStream.Stream(ctx, nats.ChannelWork)
+		require.NoError(t, err)
+		_, err = stream.GetLastMsgForSubject(ctx, nats.WorkSubject(seq, flow.Worker))
+		return err == nil
+	}
+
+	webCommand := func(seq string, groups []any) *nats.HopsMsg {
+		return &nats.HopsMsg{
+			Source:     WebSource,
+			Event:      "command",
+			Action:     flow.ActionName(),
+			SequenceId: seq,
+			Data: map[string]any{
+				"environment": "staging",
+				"ctx":         map[string]any{"user": "casey", "groups": groups, "auth_method": auth.MethodOIDC},
+			},
+		}
+	}
+
+	t.Run("Submit allowed", func(t *testing.T) {
+		require.NoError(t, r.handleCommand(ctx, webCommand("seq-allowed", []any{"dev", "ops"}), r.logger))
+		assert.True(t, dispatched("seq-allowed"), "Commands users are allowed to run should be dispatched")
+	})
+
+	t.Run("Submit denied", func(t *testing.T) {
+		err := r.handleCommand(ctx, webCommand("seq-denied", []any{"dev"}), r.logger)
+		assert.ErrorIs(t, err, ErrCommandDenied)
+		assert.ErrorIs(t, err, nats.ErrEventFatal, "Denied commands shouldn't be retried")
+		assert.False(t, dispatched("seq-denied"), "Commands users aren't allowed to run shouldn't be dispatched")
+	})
+}
@@ -6,7 +6,10 @@ import (
 
 	"github.com/robfig/cron"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/hiphops-io/hops/internal/tracing"
 	"github.com/hiphops-io/hops/markdown"
 	"github.com/hiphops-io/hops/nats"
 )
@@ -36,7 +39,15 @@ func NewSchedule(flow *markdown.Flow, natsClient *nats.Client, logger zerolog.Lo
 
 func (s *Schedule) Run() {
 	s.logger.Info().Msgf("Triggering schedule %s", s.flow.ID)
-	ctx := context.Background()
+
+	// Scheduled runs start their own traces, continued by the runner
+	ctx, span := tracing.Start(
+		context.Background(),
+		"hops.schedule",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("hops.flow", s.flow.ID)),
+	)
+	defer span.End()
 
 	now := time.Now().UTC()
 	// Timestamp without seconds to create 'buckets' for idempotency
@@ -48,6 +59,8 @@ func (s *Schedule) Run() {
 	// Construct the source event
 	sourceEvent, sequenceID, err := nats.CreateSourceEvent(schedulePayload, "hiphops", "schedule", s.flow.ActionName(), "")
 	if err != nil {
+		tracing.RecordError(span, err)
+		scheduleTriggers.WithLabelValues(s.flow.ID, outcomeError).Inc()
 		s.logger.Error().Err(err).Msgf("Unable to create source event for schedule: %s", s.flow.ID)
 		return
 	}
@@ -56,6 +69,11 @@ func (s *Schedule) Run() {
 	subject := nats.SourceEventSubject(sequenceID)
 	_, _, err = s.natsClient.Publish(ctx, sourceEvent, subject)
 	if err != nil {
+		tracing.RecordError(span, err)
+		scheduleTriggers.WithLabelValues(s.flow.ID, outcomeError).Inc()
 		s.logger.Error().Err(err).Msgf("Unable to dispatch source event for schedule: %s", s.flow.ID)
+		return
 	}
+
+	scheduleTriggers.WithLabelValues(s.flow.ID, outcomeSuccess).Inc()
 }
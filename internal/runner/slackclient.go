@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/slack-go/slack"
+)
+
+const slackAccessTokenSubject = "hiphops.slack.accesstoken"
+
+// SlackClient calls the slack API, retrying calls that are rate limited and
+// refreshing the access token when slack rejects it
+type SlackClient struct {
+	logger  zerolog.Logger
+	options []slack.Option
+	tokens  AccessTokenSource
+}
+
+// NewSlackClient creates a SlackClient, passing options to each slack API
+// client it creates, such as slack.OptionAPIURL
+func NewSlackClient(tokens AccessTokenSource, logger zerolog.Logger, options ...slack.Option) *SlackClient {
+	return &SlackClient{
+		logger:  logger,
+		options: options,
+		tokens:  tokens,
+	}
+}
+
+// Call runs a slack API call, retrying it if slack rate limits the call or
+// rejects the access token
+//
+// The token is refreshed at most once per call, rate limited calls are retried
+// up to apiMaxRetries times after waiting as long as slack asks us to
+func (s *SlackClient) Call(ctx context.Context, method string, call func(api *slack.Client) error) error {
+	logger := s.logger.With().Str("slack_method", method).Logger()
+	refreshed := false
+
+	for attempt := 0; ; attempt++ {
+		token, err := s.tokens.Token()
+		if err != nil {
+			return fmt.Errorf("unable to fetch slack access token: %w", err)
+		}
+
+		err = call(slack.New(token, s.options...))
+		if err == nil {
+			return nil
+		}
+
+		var rateLimitErr *slack.RateLimitedError
+		var slackErr slack.SlackErrorResponse
+
+		switch {
+		case errors.As(err, &rateLimitErr):
+			if attempt >= apiMaxRetries || rateLimitErr.RetryAfter > apiMaxRetryWait {
+				return err
+			}
+
+			logger.Warn().Dur("retry_after", rateLimitErr.RetryAfter).Msg("Slack rate limit reached, retrying")
+
+			if err := sleepCtx(ctx, rateLimitErr.RetryAfter); err != nil {
+				return err
+			}
+		case errors.As(err, &slackErr) && isInvalidTokenErr(slackErr.Err) && !refreshed:
+			logger.Warn().Str("slack_error", slackErr.Err).Msg("Slack access token rejected, refreshing")
+			s.tokens.Invalidate()
+			refreshed = true
+		default:
+			return err
+		}
+	}
+}
+
+func isInvalidTokenErr(slackErr string) bool {
+	switch slackErr {
+	case "invalid_auth", "token_expired", "token_revoked", "not_authed":
+		return true
+	default:
+		return false
+	}
+}
+
+// sleepCtx waits for the given duration, returning early if ctx is cancelled
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
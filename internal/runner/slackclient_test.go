@@ -0,0 +1,138 @@
+package runner
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlackClientCall(t *testing.T) {
+	postMessage := func(client *SlackClient) error {
+		return client.Call(context.Background(), "chat.postMessage", func(api *slack.Client) error {
+			_, _, err := api.PostMessage("C0CHANNEL", slack.MsgOptionText("Hello", false))
+			return err
+		})
+	}
+
+	type testCase struct {
+		name string
+		// responses are returned in order for each call, the last repeating
+		responses           []string
+		retryAfter          string
+		expectError         string
+		expectedCalls       int
+		expectedTokens      []string
+		expectedInvalidated int
+		expectedMinWait     time.Duration
+	}
+
+	tests := []testCase{
+		{
+			name:           "Success",
+			responses:      []string{`{"ok": true}`},
+			expectedCalls:  1,
+			expectedTokens: []string{"xoxb-0"},
+		},
+		{
+			name:            "Rate limited then succeeds",
+			responses:       []string{"rate_limited", `{"ok": true}`},
+			retryAfter:      "1",
+			expectedCalls:   2,
+			expectedTokens:  []string{"xoxb-0", "xoxb-0"},
+			expectedMinWait: time.Second,
+		},
+		{
+			name:           "Rate limited beyond max wait",
+			responses:      []string{"rate_limited"},
+			retryAfter:     "60",
+			expectError:    "slack rate limit exceeded",
+			expectedCalls:  1,
+			expectedTokens: []string{"xoxb-0"},
+		},
+		{
+			name:                "Invalid auth refreshes token",
+			responses:           []string{`{"ok": false, "error": "invalid_auth"}`, `{"ok": true}`},
+			expectedCalls:       2,
+			expectedTokens:      []string{"xoxb-0", "xoxb-1"},
+			expectedInvalidated: 1,
+		},
+		{
+			name:                "Expired token refreshes token",
+			responses:           []string{`{"ok": false, "error": "token_expired"}`, `{"ok": true}`},
+			expectedCalls:       2,
+			expectedTokens:      []string{"xoxb-0", "xoxb-1"},
+			expectedInvalidated: 1,
+		},
+		{
+			name:                "Refreshed token rejected gives up",
+			responses:           []string{`{"ok": false, "error": "invalid_auth"}`},
+			expectError:         "invalid_auth",
+			expectedCalls:       2,
+			expectedTokens:      []string{"xoxb-0", "xoxb-1"},
+			expectedInvalidated: 1,
+		},
+		{
+			name:           "Other errors aren't retried",
+			responses:      []string{`{"ok": false, "error": "channel_not_found"}`},
+			expectError:    "channel_not_found",
+			expectedCalls:  1,
+			expectedTokens: []string{"xoxb-0"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			slackAPI := newSlackStub(t)
+			calls := 0
+			slackAPI.respond = func(call slackCall) (int, http.Header, string) {
+				resp := tc.responses[min(calls, len(tc.responses)-1)]
+				calls++
+
+				if resp == "rate_limited" {
+					return http.StatusTooManyRequests, http.Header{"Retry-After": {tc.retryAfter}}, ""
+				}
+				return http.StatusOK, nil, resp
+			}
+
+			tokens := &testTokens{tokens: []string{"xoxb-0", "xoxb-1", "xoxb-2"}}
+			started := time.Now()
+			err := postMessage(slackAPI.Client(tokens))
+
+			if tc.expectError != "" {
+				assert.ErrorContains(t, err, tc.expectError)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			sent := []string{}
+			for _, call := range slackAPI.Calls("chat.postMessage") {
+				sent = append(sent, call.Form.Get("token"))
+			}
+			require.Len(t, sent, tc.expectedCalls)
+			assert.Equal(t, tc.expectedTokens, sent)
+			assert.Equal(t, tc.expectedInvalidated, tokens.invalidated)
+			assert.GreaterOrEqual(t, time.Since(started), tc.expectedMinWait, "Retries should wait as long as slack asks")
+		})
+	}
+}
+
+func TestSlackClientCallCancelled(t *testing.T) {
+	slackAPI := newSlackStub(t)
+	slackAPI.respond = func(call slackCall) (int, http.Header, string) {
+		return http.StatusTooManyRequests, http.Header{"Retry-After": {"10"}}, ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := slackAPI.Client(StaticToken("xoxb-0")).Call(ctx, "chat.postMessage", func(api *slack.Client) error {
+		_, _, err := api.PostMessageContext(ctx, "C0CHANNEL", slack.MsgOptionText("Hello", false))
+		return err
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "Waiting to retry should stop when the context is done")
+}
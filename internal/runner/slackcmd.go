@@ -1,95 +1,122 @@
 package runner
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	mdconv "github.com/eritikass/githubmarkdownconvertergo"
 	"github.com/goccy/go-json"
+	"github.com/hashicorp/hcl/v2"
 	"github.com/manterfield/go-mapreader"
+	"github.com/rs/zerolog"
 	"github.com/slack-go/slack"
 
 	"github.com/hiphops-io/hops/markdown"
 	"github.com/hiphops-io/hops/nats"
 )
 
-type (
-	AccessTokenGetter func() (string, error)
+const (
+	// maxSlackOptions is the maximum number of options slack allows in a static select
+	maxSlackOptions = 100
+
+	approveActionID = "hops_approval_approve"
+	rejectActionID  = "hops_approval_reject"
+)
 
+type (
 	CommandPrivateMeta struct {
 		CommandAction string `json:"command_action"`
 		ChannelID     string `json:"channel_id"`
 	}
+
+	// SlackFrontend runs commands from slack slash commands, presenting each
+	// command as a modal
+	SlackFrontend struct {
+		client *SlackClient
+	}
 )
 
-func SlackAccessTokenFunc(natsClient *nats.Client) AccessTokenGetter {
-	var token string
+func NewSlackFrontend(client *SlackClient) *SlackFrontend {
+	return &SlackFrontend{client: client}
+}
 
-	return func() (string, error) {
-		if token != "" {
-			return token, nil
-		}
+func (s *SlackFrontend) RequestCommand(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg, matchErr error, logger zerolog.Logger) error {
+	return SlackCommandRequest(ctx, flow, hopsMsg, matchErr, s.client, logger)
+}
 
-		reply, err := natsClient.NatsConn.Request("hiphops.slack.accesstoken", nil, time.Second*3)
-		if err != nil {
-			return "", err
-		}
+func (s *SlackFrontend) ParseCommand(hopsMsg *nats.HopsMsg, commands map[string]*markdown.Flow) error {
+	return SlackBlocksToCommandEvent(hopsMsg, commands)
+}
 
-		json.Unmarshal(reply.Data, &token)
+func (s *SlackFrontend) CommandDispatched(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg) error {
+	return SlackCommandDispatched(ctx, flow, hopsMsg, s.client)
+}
 
-		return token, nil
+// CommandResult posts the result of a command's flow back to the user that
+// submitted it, in the channel it was submitted from
+func (s *SlackFrontend) CommandResult(ctx context.Context, name string, hopsMsg *nats.HopsMsg, result nats.ResultMsg, duration time.Duration) error {
+	channelID := mapreader.Str(hopsMsg.Data, "ctx.channel_id")
+	userID := mapreader.Str(hopsMsg.Data, "ctx.user.id")
+	if channelID == "" || userID == "" {
+		return errors.New("command is missing the channel or user to respond to")
 	}
+
+	return sendEphemeralMessage(ctx, s.client, channelID, userID, commandResultText(name, result, duration))
 }
 
-func SlackCommandRequest(flow *markdown.Flow, hopsMsg *nats.HopsMsg, matchError error, t AccessTokenGetter) error {
-	token, err := t()
+// SlackCommandRequest opens the form for a command in slack, or lets the user
+// know why it can't be opened
+func SlackCommandRequest(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg, matchError error, client *SlackClient, logger zerolog.Logger) error {
+	responseURL, err := mapreader.StrErr(hopsMsg.Data, "response_url")
 	if err != nil {
-		return fmt.Errorf("unable to fetch slack access token: %w", err)
+		return fmt.Errorf("%w: unable to get response_url for command request: %w", nats.ErrEventFatal, err)
 	}
-	api := slack.New(token)
 
-	responseURL, err := mapreader.StrErr(hopsMsg.Data, "response_url")
-	if err != nil {
-		return fmt.Errorf("unable to get response_url for command request: %w", err)
+	commandText := mapreader.Str(hopsMsg.Data, "text")
+	logger = logger.With().Str("command", commandText).Logger()
+
+	if msg := commandRequestError(flow, matchError, commandText, logger); msg != "" {
+		return sendErrorResponse(ctx, client, msg, responseURL)
 	}
 
-	if errors.Is(matchError, markdown.ErrCommandNotFound) {
-		return sendErrorResponse(api, fmt.Sprintf("Sorry, `%s` didn't match any commands", mapreader.Str(hopsMsg.Data, "text")), responseURL)
-		// TODO: Log this
-		// return err
-	} else if matchError != nil {
-		return sendErrorResponse(api, fmt.Sprintf("An error occurred - this could be due to a misconfiguration\n`%s`", matchError.Error()), responseURL)
-		// TODO: Log this
-		// return err
-	} else if flow == nil {
-		return sendErrorResponse(api, "Command conditions not met - _Perhaps the command is restricted to specific channels or users?_", responseURL)
+	logger = logger.With().Str("flow", flow.ID).Logger()
+
+	triggerID, err := mapreader.StrErr(hopsMsg.Data, "trigger_id")
+	if err != nil {
+		logger.Error().Err(err).Msg("Command request is missing trigger_id")
+		return sendErrorResponse(ctx, client, "command failed - unable to open form", responseURL)
 	}
 
 	// If we get here then we've got an actual command to present. Yay.
-	blocks, err := CommandToSlackBlocks(flow.Command)
+	evalCtx, err := markdown.EventEvalContext(hopsMsg)
 	if err != nil {
-		return sendErrorResponse(api, "command failed", responseURL)
-		// TODO: Log this
-		// return fmt.Errorf("unable to render command as modal: %w", err)
+		logger.Error().Err(err).Msg("Unable to create evaluation context for command")
+		return sendErrorResponse(ctx, client, "command failed", responseURL)
+	}
+
+	blocks, err := CommandToSlackBlocks(flow.Command, flow.EvalContext(evalCtx))
+	if err != nil {
+		logger.Error().Err(err).Msg("Unable to render command as modal")
+		return sendErrorResponse(ctx, client, "command failed", responseURL)
 	}
 
 	privateMeta, err := json.Marshal(CommandPrivateMeta{
 		CommandAction: flow.ActionName(),
 		ChannelID:     mapreader.Str(hopsMsg.Data, "channel_id"),
 	})
-
 	if err != nil {
-		return sendErrorResponse(api, "command failed", responseURL)
-		// TODO: Log this
-		// return fmt.Errorf("unable to marshal private metadata: %w", err)
+		logger.Error().Err(err).Msg("Unable to marshal private metadata for command")
+		return sendErrorResponse(ctx, client, "command failed", responseURL)
 	}
 
 	headerBlock, err := FlowHeaderBlock(flow)
 	if err != nil {
-		return sendErrorResponse(api, "command failed", responseURL)
-		// TODO: Log this error
+		logger.Error().Err(err).Msg("Unable to render flow description for command")
+		return sendErrorResponse(ctx, client, "command failed", responseURL)
 	}
 
 	blocks = append(
@@ -97,37 +124,136 @@ func SlackCommandRequest(flow *markdown.Flow, hopsMsg *nats.HopsMsg, matchError
 		blocks...,
 	)
 
-	r, err := api.OpenView(
-		hopsMsg.Data["trigger_id"].(string),
-		slack.ModalViewRequest{
-			Type:  slack.VTModal,
-			Title: slack.NewTextBlockObject("plain_text", flow.DisplayName(), false, false),
-			Blocks: slack.Blocks{
-				BlockSet: blocks,
-			},
-			PrivateMetadata: string(privateMeta),
-			CallbackID:      "command",
-			Submit:          slack.NewTextBlockObject("plain_text", "Run", false, false),
-			Close:           slack.NewTextBlockObject("plain_text", "Close", false, false),
+	view := slack.ModalViewRequest{
+		Type:  slack.VTModal,
+		Title: slack.NewTextBlockObject("plain_text", flow.DisplayName(), false, false),
+		Blocks: slack.Blocks{
+			BlockSet: blocks,
 		},
-	)
+		PrivateMetadata: string(privateMeta),
+		CallbackID:      "command",
+		Submit:          slack.NewTextBlockObject("plain_text", "Run", false, false),
+		Close:           slack.NewTextBlockObject("plain_text", "Close", false, false),
+	}
+
+	err = client.Call(ctx, "views.open", func(api *slack.Client) error {
+		resp, err := api.OpenViewContext(ctx, triggerID, view)
+		if err != nil && resp != nil {
+			logger = logger.With().Strs("slack_messages", resp.ResponseMetadata.Messages).Logger()
+		}
+
+		return err
+	})
 	if err != nil {
-		fmt.Println("Got error opening form:", err.Error())
-		fmt.Printf("%v\n", r)
-		return sendErrorResponse(api, "command failed - unable to open form", responseURL)
-		// TODO: Log this
-		// return fmt.Errorf("unable to open slack view: %w", err)
+		logger.Error().Err(err).Msg("Unable to open command form")
+		return sendErrorResponse(ctx, client, "command failed - unable to open form", responseURL)
 	}
 
+	logger.Debug().Msg("Opened command form")
+
 	return nil
 }
 
-func SlackBlocksToCommandEvent(hopsMsg *nats.HopsMsg) error {
-	if t := mapreader.Str(hopsMsg.Data, "type"); t != "view_submission" {
-		return fmt.Errorf("unsupported slack interaction type for commands '%s'", t)
+// SlackCommandDispatched lets the user that submitted a command know its flow
+// has been dispatched
+func SlackCommandDispatched(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg, client *SlackClient) error {
+	channelID := mapreader.Str(hopsMsg.Data, "ctx.channel_id")
+	userID := mapreader.Str(hopsMsg.Data, "ctx.user.id")
+	if channelID == "" || userID == "" {
+		return errors.New("command is missing the channel or user to respond to")
+	}
+
+	msg := fmt.Sprintf(":hourglass_flowing_sand: *%s* is running", flow.DisplayName())
+	if flow.Approval != nil {
+		msg = fmt.Sprintf(":raised_hand: *%s* is waiting for approval in %s", flow.DisplayName(), flow.Approval.Channel)
+	}
+
+	return sendEphemeralMessage(ctx, client, channelID, userID, msg)
+}
+
+// SlackApprovalRequest posts a message with approve and reject buttons for a
+// flow to the flow's approval channel
+func SlackApprovalRequest(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg, client *SlackClient) error {
+	value, err := json.Marshal(ApprovalRequest{
+		FlowID:     flow.ID,
+		SequenceID: hopsMsg.SequenceId,
+	})
+	if err != nil {
+		return err
 	}
 
-	data, err := parseViewSubmissionCommand(hopsMsg.Data)
+	descriptionBlock, err := FlowHeaderBlock(flow)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf(":raised_hand: *%s* is waiting for approval", flow.DisplayName())
+	trigger := strings.Trim(strings.Join([]string{hopsMsg.Source, hopsMsg.Event, hopsMsg.Action}, "."), ".")
+
+	approveButton := slack.NewButtonBlockElement(approveActionID, string(value), slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false))
+	approveButton.Style = slack.StylePrimary
+	rejectButton := slack.NewButtonBlockElement(rejectActionID, string(value), slack.NewTextBlockObject(slack.PlainTextType, "Reject", false, false))
+	rejectButton.Style = slack.StyleDanger
+
+	return client.Call(ctx, "chat.postMessage", func(api *slack.Client) error {
+		_, _, err := api.PostMessageContext(
+			ctx,
+			flow.Approval.Channel,
+			slack.MsgOptionText(text, false),
+			slack.MsgOptionBlocks(
+				slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+				descriptionBlock,
+				slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("Triggered by `%s`", trigger), false, false)),
+				slack.NewActionBlock("", approveButton, rejectButton),
+			),
+		)
+
+		return err
+	})
+}
+
+// SlackApprovalDecided replaces the buttons of an approval request with the
+// decision that was made
+func SlackApprovalDecided(ctx context.Context, flow *markdown.Flow, decision ApprovalDecision, client *SlackClient) error {
+	text := fmt.Sprintf(":x: *%s* was rejected by <@%s>", flow.DisplayName(), decision.UserID)
+	if decision.Approved {
+		text = fmt.Sprintf(":white_check_mark: *%s* was approved by <@%s>", flow.DisplayName(), decision.UserID)
+	}
+	decidedAt := decision.DecidedAt.UTC().Format(time.RFC1123)
+
+	return client.Call(ctx, "chat.update", func(api *slack.Client) error {
+		_, _, _, err := api.UpdateMessageContext(
+			ctx,
+			decision.ChannelID,
+			decision.MessageTS,
+			slack.MsgOptionText(text, false),
+			slack.MsgOptionBlocks(
+				slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+				slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, decidedAt, false, false)),
+			),
+		)
+
+		return err
+	})
+}
+
+// SlackEphemeral sends a message only visible to the given user
+func SlackEphemeral(ctx context.Context, channelID, userID, msg string, client *SlackClient) error {
+	return sendEphemeralMessage(ctx, client, channelID, userID, msg)
+}
+
+func SlackBlocksToCommandEvent(hopsMsg *nats.HopsMsg, commands map[string]*markdown.Flow) error {
+	var data map[string]any
+	var err error
+
+	switch t := mapreader.Str(hopsMsg.Data, "type"); t {
+	case "view_submission":
+		data, err = parseViewSubmissionCommand(hopsMsg.Data, commands)
+	case "block_actions":
+		data, err = parseApprovalAction(hopsMsg.Data, hopsMsg.Timestamp)
+	default:
+		return fmt.Errorf("unsupported slack interaction type for commands '%s'", t)
+	}
 	if err != nil {
 		return fmt.Errorf("unable to parse command from event: %w", err)
 	}
@@ -138,7 +264,10 @@ func SlackBlocksToCommandEvent(hopsMsg *nats.HopsMsg) error {
 	return nil
 }
 
-func CommandToSlackBlocks(command markdown.Command) ([]slack.Block, error) {
+// CommandToSlackBlocks renders a command's params as slack input blocks
+//
+// evalCtx is used to evaluate the options of select params that use options_from
+func CommandToSlackBlocks(command markdown.Command, evalCtx *hcl.EvalContext) ([]slack.Block, error) {
 	blocks := []slack.Block{}
 
 	for _, p := range command {
@@ -152,6 +281,23 @@ func CommandToSlackBlocks(command markdown.Command) ([]slack.Block, error) {
 			blocks = append(blocks, ParamToBooleanInputBlock(name, displayName, param))
 		case "number":
 			blocks = append(blocks, ParamToNumberInputBlock(name, displayName, param))
+		case "select", "multiselect":
+			options, err := param.OptionValues(evalCtx)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get options for param '%s': %w", name, err)
+			}
+
+			if param.Type == "select" {
+				blocks = append(blocks, ParamToSelectInputBlock(name, displayName, param, options))
+			} else {
+				blocks = append(blocks, ParamToMultiSelectInputBlock(name, displayName, param, options))
+			}
+		case "date":
+			blocks = append(blocks, ParamToDateInputBlock(name, displayName, param))
+		case "datetime":
+			blocks = append(blocks, ParamToDateTimeInputBlock(name, displayName, param))
+		case "user", "channel", "conversation":
+			blocks = append(blocks, ParamToConversationInputBlock(name, displayName, param))
 		default:
 			return nil, fmt.Errorf("unable to parse param '%s' - unknown type '%s'", name, param.Type)
 		}
@@ -247,6 +393,72 @@ func ParamToBooleanInputBlock(name, displayName string, param markdown.Param) sl
 	return ParamInputBlock(name, displayName, param, elem)
 }
 
+func ParamToDateInputBlock(name, displayName string, param markdown.Param) slack.Block {
+	elem := slack.NewDatePickerBlockElement(name)
+
+	if defaultVal, ok := param.Default.(string); ok {
+		elem.InitialDate = defaultVal
+	}
+
+	return ParamInputBlock(name, displayName, param, elem)
+}
+
+func ParamToDateTimeInputBlock(name, displayName string, param markdown.Param) slack.Block {
+	elem := slack.NewDateTimePickerBlockElement(name)
+
+	if defaultVal, ok := param.Default.(string); ok {
+		if t, err := time.Parse(markdown.ParamDateTimeFormat, defaultVal); err == nil {
+			elem.InitialDateTime = t.Unix()
+		}
+	}
+
+	return ParamInputBlock(name, displayName, param, elem)
+}
+
+// ParamToConversationInputBlock renders user, channel and conversation params
+// as the matching slack select menu
+func ParamToConversationInputBlock(name, displayName string, param markdown.Param) slack.Block {
+	defaultVal, _ := param.Default.(string)
+	elem := slack.NewOptionsSelectBlockElement("", nil, name)
+
+	switch param.Type {
+	case "user":
+		elem.Type = slack.OptTypeUser
+		elem.InitialUser = defaultVal
+	case "channel":
+		elem.Type = slack.OptTypeChannels
+		elem.InitialChannel = defaultVal
+	case "conversation":
+		elem.Type = slack.OptTypeConversations
+		elem.InitialConversation = defaultVal
+	}
+
+	return ParamInputBlock(name, displayName, param, elem)
+}
+
+func ParamToMultiSelectInputBlock(name, displayName string, param markdown.Param, options []string) slack.Block {
+	optionBlocks := paramOptionBlocks(options)
+	elem := slack.NewOptionsMultiSelectBlockElement(slack.MultiOptTypeStatic, nil, name, optionBlocks...)
+
+	defaultVals, _ := param.Default.([]any)
+	for _, d := range defaultVals {
+		if o := findOptionBlock(optionBlocks, d); o != nil {
+			elem.InitialOptions = append(elem.InitialOptions, o)
+		}
+	}
+
+	return ParamInputBlock(name, displayName, param, elem)
+}
+
+func ParamToSelectInputBlock(name, displayName string, param markdown.Param, options []string) slack.Block {
+	optionBlocks := paramOptionBlocks(options)
+	elem := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, nil, name, optionBlocks...)
+
+	elem.InitialOption = findOptionBlock(optionBlocks, param.Default)
+
+	return ParamInputBlock(name, displayName, param, elem)
+}
+
 func ParamToTextInputBlock(name, displayName string, param markdown.Param) slack.Block {
 	elem := slack.PlainTextInputBlockElement{
 		Type:        slack.METPlainTextInput,
@@ -263,9 +475,50 @@ func ParamToTextInputBlock(name, displayName string, param markdown.Param) slack
 	return ParamInputBlock(name, displayName, param, elem)
 }
 
-func parseViewSubmissionCommand(payload map[string]any) (map[string]any, error) {
+// paramOptionBlocks converts option values into slack option objects
+//
+// Slack static selects allow at most 100 options. Static options are limited
+// to that when flows are read, but any beyond it from options_from are dropped
+func paramOptionBlocks(options []string) []*slack.OptionBlockObject {
+	optionBlocks := []*slack.OptionBlockObject{}
+
+	for i, o := range options {
+		if i >= maxSlackOptions {
+			break
+		}
+
+		optionBlocks = append(
+			optionBlocks,
+			slack.NewOptionBlockObject(o, slack.NewTextBlockObject(slack.PlainTextType, o, false, false), nil),
+		)
+	}
+
+	return optionBlocks
+}
+
+func findOptionBlock(optionBlocks []*slack.OptionBlockObject, value any) *slack.OptionBlockObject {
+	strVal, ok := value.(string)
+	if !ok {
+		return nil
+	}
+
+	for _, o := range optionBlocks {
+		if o.Value == strVal {
+			return o
+		}
+	}
+
+	return nil
+}
+
+func parseViewSubmissionCommand(payload map[string]any, commands map[string]*markdown.Flow) (map[string]any, error) {
+	hops := mapreader.Map[any](payload, "hops")
+	if hops == nil {
+		hops = map[string]any{}
+	}
+
 	commandPayload := map[string]any{
-		"hops": mapreader.Map[any](payload, "hops"),
+		"hops": hops,
 		"ctx":  payload,
 	}
 
@@ -279,8 +532,8 @@ func parseViewSubmissionCommand(payload map[string]any) (map[string]any, error)
 		return nil, fmt.Errorf("unable to parse required metadata for command: %w", err)
 	}
 
-	commandPayload["ctx"].(map[string]any)["channel_id"] = privateMeta.ChannelID
-	commandPayload["hops"].(map[string]any)["action"] = privateMeta.CommandAction
+	payload["channel_id"] = privateMeta.ChannelID
+	hops["action"] = privateMeta.CommandAction
 
 	values, err := mapreader.MapErr[map[string]any](payload, "view.state.values")
 	if err != nil {
@@ -293,7 +546,7 @@ func parseViewSubmissionCommand(payload map[string]any) (map[string]any, error)
 			return nil, fmt.Errorf("unable to parse command param '%s'", k)
 		}
 
-		paramValue, err := parseViewInputValue(param)
+		paramValue, err := parseViewInputValue(param, submittedParam(commands, privateMeta.CommandAction, k, ""))
 		if err != nil {
 			return nil, fmt.Errorf("unable to parse command param '%s' value ", k)
 		}
@@ -304,7 +557,78 @@ func parseViewSubmissionCommand(payload map[string]any) (map[string]any, error)
 	return commandPayload, nil
 }
 
-func parseViewInputValue(paramState map[string]any) (any, error) {
+// parseApprovalAction parses an approve/reject button click into an approval
+// decision command
+func parseApprovalAction(payload map[string]any, receivedAt time.Time) (map[string]any, error) {
+	actions, _ := payload["actions"].([]any)
+	if len(actions) == 0 {
+		return nil, errors.New("interaction has no actions")
+	}
+
+	action, ok := actions[0].(map[string]any)
+	if !ok {
+		return nil, errors.New("unable to read interaction action")
+	}
+
+	decision := ApprovalDecision{
+		ChannelID: mapreader.Str(payload, "container.channel_id"),
+		DecidedAt: receivedAt.UTC(),
+		MessageTS: mapreader.Str(payload, "container.message_ts"),
+		UserID:    mapreader.Str(payload, "user.id"),
+		Username:  mapreader.Str(payload, "user.username"),
+	}
+
+	if decision.DecidedAt.IsZero() {
+		decision.DecidedAt = time.Now().UTC()
+	}
+
+	switch actionID := mapreader.Str(action, "action_id"); actionID {
+	case approveActionID:
+		decision.Approved = true
+	case rejectActionID:
+		decision.Approved = false
+	default:
+		return nil, fmt.Errorf("unsupported action '%s'", actionID)
+	}
+
+	value, err := mapreader.BytesErr(action, "value")
+	if err != nil {
+		return nil, errors.New("unable to read approval request from action")
+	}
+
+	if err := json.Unmarshal(value, &decision.ApprovalRequest); err != nil {
+		return nil, fmt.Errorf("unable to parse approval request: %w", err)
+	}
+
+	hops := mapreader.Map[any](payload, "hops")
+	if hops == nil {
+		hops = map[string]any{}
+	}
+	hops["action"] = ApprovalAction
+
+	return map[string]any{
+		"hops":     hops,
+		"ctx":      payload,
+		"approval": decision,
+	}, nil
+}
+
+// parseViewInputValue converts the state of a modal input to the value of a
+// param, where select values must be one of the param's options
+func parseViewInputValue(paramState map[string]any, param markdown.Param) (any, error) {
+	value, err := parseViewInput(paramState)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkParamOptions(param, value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func parseViewInput(paramState map[string]any) (any, error) {
 	inputType := mapreader.Str(paramState, "type")
 	switch inputType {
 	case "number_input":
@@ -325,20 +649,110 @@ func parseViewInputValue(paramState map[string]any) (any, error) {
 		}
 	case "plain_text_input":
 		return mapreader.Str(paramState, "value"), nil
+	case slack.OptTypeStatic:
+		value := mapreader.Str(paramState, "selected_option.value")
+		if value == "" {
+			return nil, nil
+		}
+		return value, nil
+	case slack.MultiOptTypeStatic:
+		selected, _ := paramState["selected_options"].([]any)
+		values := []any{}
+		for _, s := range selected {
+			option, ok := s.(map[string]any)
+			if !ok {
+				return nil, errors.New("invalid selected option")
+			}
+			values = append(values, mapreader.Str(option, "value"))
+		}
+		return values, nil
+	case string(slack.METDatepicker):
+		value := mapreader.Str(paramState, "selected_date")
+		if value == "" {
+			return nil, nil
+		}
+		return value, nil
+	case string(slack.METDatetimepicker):
+		var value int64
+		switch v := paramState["selected_date_time"].(type) {
+		case float64:
+			value = int64(v)
+		case json.Number:
+			f, err := v.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("invalid datetime '%s': %w", v, err)
+			}
+			value = int64(f)
+		default:
+			return nil, nil
+		}
+		return time.Unix(value, 0).UTC().Format(markdown.ParamDateTimeFormat), nil
+	case slack.OptTypeUser:
+		return optionalStr(mapreader.Str(paramState, "selected_user")), nil
+	case slack.OptTypeChannels:
+		return optionalStr(mapreader.Str(paramState, "selected_channel")), nil
+	case slack.OptTypeConversations:
+		return optionalStr(mapreader.Str(paramState, "selected_conversation")), nil
 	default:
 		return nil, fmt.Errorf("unsupported input type '%s'", inputType)
 	}
 }
 
-func sendErrorResponse(api *slack.Client, msg string, responseURL string) error {
-	_, _, err := api.PostMessage(
-		"",
-		slack.MsgOptionText(msg, false),
-		slack.MsgOptionResponseURL(
-			responseURL,
-			slack.ResponseTypeEphemeral,
-		),
-	)
+func commandResultText(name string, result nats.ResultMsg, duration time.Duration) string {
+	var b strings.Builder
+
+	duration = duration.Round(time.Millisecond)
+	if result.Errored {
+		fmt.Fprintf(&b, ":x: *%s* failed after %s", name, duration)
+		if result.Hops.Error != "" {
+			fmt.Fprintf(&b, "\n```%s```", result.Hops.Error)
+		}
+	} else {
+		fmt.Fprintf(&b, ":white_check_mark: *%s* succeeded in %s", name, duration)
+	}
+
+	if result.Body != "" {
+		b.WriteString("\n\n")
+		b.WriteString(mdconv.Slack(result.Body, mdconv.SlackConvertOptions{Headlines: true}))
+	}
+
+	return b.String()
+}
+
+// optionalStr returns nil for empty strings, matching unset inputs of other types
+func optionalStr(value string) any {
+	if value == "" {
+		return nil
+	}
+
+	return value
+}
 
-	return err
+func sendEphemeralMessage(ctx context.Context, client *SlackClient, channelID, userID, msg string) error {
+	return client.Call(ctx, "chat.postEphemeral", func(api *slack.Client) error {
+		_, err := api.PostEphemeralContext(
+			ctx,
+			channelID,
+			userID,
+			slack.MsgOptionText(msg, false),
+		)
+
+		return err
+	})
+}
+
+func sendErrorResponse(ctx context.Context, client *SlackClient, msg string, responseURL string) error {
+	return client.Call(ctx, "response_url", func(api *slack.Client) error {
+		_, _, err := api.PostMessageContext(
+			ctx,
+			"",
+			slack.MsgOptionText(msg, false),
+			slack.MsgOptionResponseURL(
+				responseURL,
+				slack.ResponseTypeEphemeral,
+			),
+		)
+
+		return err
+	})
 }
@@ -0,0 +1,96 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+func TestSlackParseCommand(t *testing.T) {
+	flow := setupTestFlow(t, testCommandFlow)
+	commands := map[string]*markdown.Flow{flow.ActionName(): flow}
+
+	privateMeta, err := json.Marshal(CommandPrivateMeta{CommandAction: flow.ActionName(), ChannelID: "C123"})
+	require.NoError(t, err)
+
+	type testCase struct {
+		name        string
+		values      map[string]any
+		expected    map[string]any
+		expectError bool
+	}
+
+	tests := []testCase{
+		{
+			name: "Options",
+			values: map[string]any{
+				"environment": map[string]any{"type": "static_select", "selected_option": map[string]any{"value": "production"}},
+				"services": map[string]any{"type": "multi_static_select", "selected_options": []any{
+					map[string]any{"value": "api"},
+					map[string]any{"value": "worker"},
+				}},
+				"replicas": map[string]any{"type": "number_input", "value": "3"},
+			},
+			expected: map[string]any{
+				"environment": "production",
+				"services":    []any{"api", "worker"},
+				"replicas":    float64(3),
+			},
+		},
+		{
+			name: "Select value that isn't an option",
+			values: map[string]any{
+				"environment": map[string]any{"type": "static_select", "selected_option": map[string]any{"value": "qa"}},
+			},
+			expectError: true,
+		},
+		{
+			name: "Multiselect value that isn't an option",
+			values: map[string]any{
+				"services": map[string]any{"type": "multi_static_select", "selected_options": []any{
+					map[string]any{"value": "api"},
+					map[string]any{"value": "db"},
+				}},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			state := map[string]any{}
+			for name, value := range tc.values {
+				state[name] = map[string]any{name: value}
+			}
+
+			hopsMsg := &nats.HopsMsg{
+				Source: "slack",
+				Event:  "command",
+				Data: map[string]any{
+					"type": "view_submission",
+					"view": map[string]any{
+						"private_metadata": string(privateMeta),
+						"state":            map[string]any{"values": state},
+					},
+				},
+			}
+
+			err := SlackBlocksToCommandEvent(hopsMsg, commands)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, flow.ActionName(), hopsMsg.Action)
+			for name, value := range tc.expected {
+				assert.Equal(t, value, hopsMsg.Data[name])
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+
+	"github.com/hiphops-io/hops/internal/auth"
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+const (
+	// WebSource is the source of command events submitted from the site
+	WebSource = "web"
+	// webRunTTL is how long the status of a finished run is kept for
+	webRunTTL = time.Hour
+)
+
+// Statuses of a command run submitted from the site
+const (
+	RunStatusPending          = "pending"
+	RunStatusAwaitingApproval = "awaiting_approval"
+	RunStatusRunning          = "running"
+	RunStatusSucceeded        = "succeeded"
+	RunStatusFailed           = "failed"
+)
+
+// ErrInvalidCommand is returned when submitted params don't suit a command
+var ErrInvalidCommand = errors.New("invalid command")
+
+type (
+	// WebFrontend runs commands submitted from the forms of the built site,
+	// keeping the status of each run so the site can show it
+	//
+	// Run statuses are only kept in memory, so are lost on restart
+	WebFrontend struct {
+		commands  CommandIndex
+		mutex     sync.Mutex
+		now       func() time.Time
+		publisher Publisher
+		runs      map[string]*WebRun
+	}
+
+	// CommandIndex provides the commands that can be run, by action name
+	CommandIndex interface {
+		IndexedCommands() map[string]*markdown.Flow
+	}
+
+	// Publisher publishes events to hops
+	Publisher interface {
+		Publish(ctx context.Context, data []byte, subject string) (*jetstream.PubAck, bool, error)
+	}
+
+	// WebRun is the status of a command run submitted from the site
+	WebRun struct {
+		ID         string    `json:"id"`
+		Action     string    `json:"action"`
+		Flow       string    `json:"flow"`
+		Name       string    `json:"name"`
+		Status     string    `json:"status"`
+		Error      string    `json:"error,omitempty"`
+		Output     string    `json:"output,omitempty"`
+		DurationMS int64     `json:"duration_ms,omitempty"`
+		CreatedAt  time.Time `json:"created_at"`
+		UpdatedAt  time.Time `json:"updated_at"`
+	}
+)
+
+func NewWebFrontend(commands CommandIndex, publisher Publisher) *WebFrontend {
+	return &WebFrontend{
+		commands:  commands,
+		now:       time.Now,
+		publisher: publisher,
+		runs:      map[string]*WebRun{},
+	}
+}
+
+// Done is true once a run has finished, successfully or not
+func (r WebRun) Done() bool {
+	return r.Status == RunStatusSucceeded || r.Status == RunStatusFailed
+}
+
+// Submit validates the params submitted for a command and publishes the
+// command event, returning the run to follow its status by
+//
+// Missing params take their default. Every submission is a new run, even if
+// the params are identical to an earlier one
+func (w *WebFrontend) Submit(ctx context.Context, action string, params map[string]any) (WebRun, error) {
+	flow, ok := w.Command(action)
+	if !ok {
+		return WebRun{}, fmt.Errorf("%w: '%s'", markdown.ErrCommandNotFound, action)
+	}
+
+	payload, err := webCommandPayload(flow, params)
+	if err != nil {
+		return WebRun{}, err
+	}
+
+	// Flows can see who ran them, when the API requires authentication
+	if principal, ok := auth.PrincipalFromContext(ctx); ok {
+		payload["ctx"] = map[string]any{
+			"user":        principal.Subject,
+			"groups":      principal.Groups,
+			"auth_method": principal.Method,
+		}
+	}
+
+	event, sequenceID, err := nats.CreateSourceEvent(payload, WebSource, "command", action, uuid.NewString())
+	if err != nil {
+		return WebRun{}, err
+	}
+
+	if _, _, err := w.publisher.Publish(ctx, event, nats.SourceEventSubject(sequenceID)); err != nil {
+		return WebRun{}, fmt.Errorf("unable to publish command: %w", err)
+	}
+
+	now := w.now()
+	run := &WebRun{
+		ID:        sequenceID,
+		Action:    action,
+		Flow:      flow.ID,
+		Name:      flow.DisplayName(),
+		Status:    RunStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.pruneRuns(now)
+	w.runs[sequenceID] = run
+
+	return *run, nil
+}
+
+// Command returns the flow of a command that can be run from the site
+func (w *WebFrontend) Command(action string) (*markdown.Flow, bool) {
+	flow, ok := w.commands.IndexedCommands()[action]
+	return flow, ok
+}
+
+// Run returns the status of a run submitted from the site
+func (w *WebFrontend) Run(id string) (WebRun, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	run, ok := w.runs[id]
+	if !ok {
+		return WebRun{}, false
+	}
+
+	return *run, true
+}
+
+// RequestCommand isn't supported, as the site renders its forms when built
+func (w *WebFrontend) RequestCommand(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg, matchErr error, logger zerolog.Logger) error {
+	return errors.New("command requests aren't supported from the web, commands are run from the site's forms")
+}
+
+// ParseCommand needs no conversion, as params are validated on submission
+func (w *WebFrontend) ParseCommand(hopsMsg *nats.HopsMsg, commands map[string]*markdown.Flow) error {
+	if hopsMsg.Action == "" {
+		return errors.New("web command is missing its action")
+	}
+
+	return nil
+}
+
+func (w *WebFrontend) CommandDispatched(ctx context.Context, flow *markdown.Flow, hopsMsg *nats.HopsMsg) error {
+	status := RunStatusRunning
+	if flow.Approval != nil {
+		status = RunStatusAwaitingApproval
+	}
+
+	w.updateRun(hopsMsg, func(run *WebRun) {
+		// A result may arrive before the dispatch is recorded
+		if !run.Done() {
+			run.Status = status
+		}
+	})
+
+	return nil
+}
+
+func (w *WebFrontend) CommandResult(ctx context.Context, name string, hopsMsg *nats.HopsMsg, result nats.ResultMsg, duration time.Duration) error {
+	w.updateRun(hopsMsg, func(run *WebRun) {
+		run.Status = RunStatusSucceeded
+		if result.Errored {
+			run.Status = RunStatusFailed
+		}
+		run.Name = name
+		run.Error = result.Hops.Error
+		run.Output = result.Body
+		run.DurationMS = duration.Milliseconds()
+	})
+
+	return nil
+}
+
+// updateRun changes the status of a run, recreating it if it was submitted
+// before a restart
+func (w *WebFrontend) updateRun(hopsMsg *nats.HopsMsg, update func(run *WebRun)) {
+	now := w.now()
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	run, ok := w.runs[hopsMsg.SequenceId]
+	if !ok {
+		createdAt := hopsMsg.Timestamp
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+
+		run = &WebRun{
+			ID:        hopsMsg.SequenceId,
+			Action:    hopsMsg.Action,
+			Name:      hopsMsg.Action,
+			Status:    RunStatusPending,
+			CreatedAt: createdAt,
+		}
+		w.runs[hopsMsg.SequenceId] = run
+	}
+
+	update(run)
+	run.UpdatedAt = now
+}
+
+// pruneRuns forgets runs that finished over webRunTTL ago, or that never
+// finished within a day. Callers must hold the mutex
+func (w *WebFrontend) pruneRuns(now time.Time) {
+	for id, run := range w.runs {
+		if run.Done() && now.Sub(run.UpdatedAt) > webRunTTL || now.Sub(run.CreatedAt) > 24*time.Hour {
+			delete(w.runs, id)
+		}
+	}
+}
+
+// webCommandPayload converts submitted params to the values of a command's
+// params, as the payload of its command event
+func webCommandPayload(flow *markdown.Flow, params map[string]any) (map[string]any, error) {
+	payload := map[string]any{}
+
+	for _, pi := range flow.Command {
+		name, param := pi.Param()
+
+		value, err := parseFormParamValue(param, params[name])
+		if err != nil {
+			return nil, fmt.Errorf("%w: param '%s': %w", ErrInvalidCommand, name, err)
+		}
+
+		if value == nil {
+			value = param.Default
+		}
+
+		if param.Required && isEmptyParamValue(value) {
+			return nil, fmt.Errorf("%w: param '%s' is required", ErrInvalidCommand, name)
+		}
+
+		payload[name] = value
+	}
+
+	return payload, nil
+}
+
+func isEmptyParamValue(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
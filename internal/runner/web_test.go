@@ -0,0 +1,151 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/internal/auth"
+	"github.com/hiphops-io/hops/markdown"
+	"github.com/hiphops-io/hops/nats"
+)
+
+type (
+	stubCommands map[string]*markdown.Flow
+
+	// stubPublisher records the events published to it
+	stubPublisher struct {
+		err    error
+		events map[string][]byte
+	}
+)
+
+func (s stubCommands) IndexedCommands() map[string]*markdown.Flow {
+	return s
+}
+
+func (s *stubPublisher) Publish(ctx context.Context, data []byte, subject string) (*jetstream.PubAck, bool, error) {
+	if s.err != nil {
+		return nil, false, s.err
+	}
+
+	s.events[subject] = data
+	return &jetstream.PubAck{}, true, nil
+}
+
+func TestWebSubmit(t *testing.T) {
+	flow := setupTestFlow(t, testCommandFlow)
+	publisher := &stubPublisher{events: map[string][]byte{}}
+	web := NewWebFrontend(stubCommands{flow.ActionName(): flow}, publisher)
+
+	run, err := web.Submit(context.Background(), flow.ActionName(), map[string]any{
+		"environment": "staging",
+		"services":    []any{"api", "web"},
+		"replicas":    "3",
+		"dry_run":     false,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, RunStatusPending, run.Status)
+	assert.Equal(t, flow.DisplayName(), run.Name)
+
+	event := map[string]any{}
+	require.Contains(t, publisher.events, nats.SourceEventSubject(run.ID))
+	require.NoError(t, json.Unmarshal(publisher.events[nats.SourceEventSubject(run.ID)], &event))
+	assert.Equal(t, "staging", event["environment"])
+	assert.Equal(t, []any{"api", "web"}, event["services"])
+	assert.Equal(t, float64(3), event["replicas"])
+	assert.Equal(t, false, event["dry_run"])
+	assert.Nil(t, event["deploy_at"])
+
+	hops, _ := event["hops"].(map[string]any)
+	assert.Equal(t, WebSource, hops["source"])
+	assert.Equal(t, "command", hops["event"])
+	assert.Equal(t, flow.ActionName(), hops["action"])
+
+	assert.Nil(t, event["ctx"], "Runs should only have a user if the API is authenticated")
+
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "alice", Groups: []string{"ops"}, Method: auth.MethodOIDC})
+	again, err := web.Submit(ctx, flow.ActionName(), map[string]any{"environment": "staging"})
+	require.NoError(t, err)
+	assert.NotEqual(t, run.ID, again.ID, "Identical submissions should be separate runs")
+	assert.Equal(t, flow.ID, again.Flow)
+
+	event = map[string]any{}
+	require.NoError(t, json.Unmarshal(publisher.events[nats.SourceEventSubject(again.ID)], &event))
+	assert.Equal(t, map[string]any{"user": "alice", "groups": []any{"ops"}, "auth_method": auth.MethodOIDC}, event["ctx"])
+
+	stored, ok := web.Run(run.ID)
+	require.True(t, ok)
+	assert.Equal(t, run, stored)
+
+	_, err = web.Submit(context.Background(), "nope", nil)
+	assert.ErrorIs(t, err, markdown.ErrCommandNotFound)
+
+	_, err = web.Submit(context.Background(), flow.ActionName(), map[string]any{"replicas": 2})
+	assert.ErrorIs(t, err, ErrInvalidCommand, "Missing required params should be invalid")
+
+	_, err = web.Submit(context.Background(), flow.ActionName(), map[string]any{"environment": "staging", "replicas": "many"})
+	assert.ErrorIs(t, err, ErrInvalidCommand, "Unparseable params should be invalid")
+
+	_, err = web.Submit(context.Background(), flow.ActionName(), map[string]any{"environment": "qa"})
+	assert.ErrorIs(t, err, ErrInvalidCommand, "Values that aren't options should be invalid")
+
+	publisher.err = errors.New("down")
+	_, err = web.Submit(context.Background(), flow.ActionName(), map[string]any{"environment": "staging"})
+	assert.Error(t, err)
+}
+
+func TestWebRunStatus(t *testing.T) {
+	flow := setupTestFlow(t, testCommandFlow)
+	web := NewWebFrontend(stubCommands{flow.ActionName(): flow}, &stubPublisher{events: map[string][]byte{}})
+
+	now := time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+	web.now = func() time.Time { return now }
+
+	run, err := web.Submit(context.Background(), flow.ActionName(), map[string]any{"environment": "staging"})
+	require.NoError(t, err)
+
+	hopsMsg := &nats.HopsMsg{Action: flow.ActionName(), SequenceId: run.ID, Source: WebSource}
+	require.NoError(t, web.ParseCommand(hopsMsg, nil))
+
+	require.NoError(t, web.CommandDispatched(context.Background(), flow, hopsMsg))
+	run, _ = web.Run(run.ID)
+	assert.Equal(t, RunStatusRunning, run.Status)
+
+	result := nats.ResultMsg{Body: "Partial deploy", Errored: true, Hops: nats.HopsResultMeta{Error: "boom"}}
+	require.NoError(t, web.CommandResult(context.Background(), "Deploy", hopsMsg, result, 1500*time.Millisecond))
+	run, _ = web.Run(run.ID)
+	assert.Equal(t, RunStatusFailed, run.Status)
+	assert.Equal(t, "boom", run.Error)
+	assert.Equal(t, "Partial deploy", run.Output)
+	assert.Equal(t, int64(1500), run.DurationMS)
+	assert.True(t, run.Done())
+
+	require.NoError(t, web.CommandDispatched(context.Background(), flow, hopsMsg))
+	run, _ = web.Run(run.ID)
+	assert.Equal(t, RunStatusFailed, run.Status, "Late dispatch shouldn't replace a result")
+
+	// Runs from before a restart are recreated from their events
+	restarted := &nats.HopsMsg{Action: flow.ActionName(), SequenceId: "earlier", Source: WebSource}
+	require.NoError(t, web.CommandResult(context.Background(), "Deploy", restarted, nats.ResultMsg{}, time.Second))
+	earlier, ok := web.Run("earlier")
+	require.True(t, ok)
+	assert.Equal(t, RunStatusSucceeded, earlier.Status)
+
+	// Finished runs are forgotten once they expire
+	now = now.Add(webRunTTL + time.Minute)
+	_, err = web.Submit(context.Background(), flow.ActionName(), map[string]any{"environment": "staging"})
+	require.NoError(t, err)
+	_, ok = web.Run(run.ID)
+	assert.False(t, ok, "Expired runs should be pruned")
+
+	assert.Error(t, web.ParseCommand(&nats.HopsMsg{Source: WebSource}, nil), "Commands without an action should error")
+	assert.Error(t, web.RequestCommand(context.Background(), flow, hopsMsg, nil, zerolog.Nop()))
+}
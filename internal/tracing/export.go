@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// DefaultServiceName is the service spans are exported as if none is set
+const DefaultServiceName = "hops"
+
+// NewOTLPExporter creates an exporter to the collector at endpoint, its base
+// URL such as http://localhost:4318, which spans are posted to at /v1/traces
+// using OTLP with protobuf over HTTP. Headers are sent with every export, such
+// as for auth
+func NewOTLPExporter(endpoint string, headers map[string]string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("an OTLP endpoint must be an http or https URL, got '%s'", endpoint)
+	}
+	if !strings.HasSuffix(u.Path, "/v1/traces") {
+		u.Path += "/v1/traces"
+	}
+
+	return otlptracehttp.New(
+		context.Background(),
+		otlptracehttp.WithEndpointURL(u.String()),
+		otlptracehttp.WithHeaders(headers),
+	)
+}
+
+// NewStdoutExporter writes spans as JSON, for debugging
+func NewStdoutExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+func newResource(serviceName string) *resource.Resource {
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+
+	return resource.NewSchemaless(semconv.ServiceName(serviceName))
+}
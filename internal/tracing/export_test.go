@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func testSpans() []sdktrace.ReadOnlySpan {
+	start := time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+	root := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	scope := instrumentation.Scope{Name: instrumentationName}
+
+	return tracetest.SpanStubs{
+		{
+			Name:                 "hops.dispatch",
+			SpanKind:             trace.SpanKindProducer,
+			SpanContext:          root.WithSpanID(trace.SpanID{3}),
+			Parent:               root,
+			StartTime:            start.Add(time.Millisecond),
+			EndTime:              start.Add(3 * time.Millisecond),
+			Attributes:           []attribute.KeyValue{attribute.String("hops.flow", "deploy"), attribute.Int("hops.pending", 4)},
+			Status:               sdktrace.Status{Code: codes.Error, Description: "no worker"},
+			Resource:             newResource(""),
+			InstrumentationScope: scope,
+		},
+		{
+			Name:                 "hops.consume",
+			SpanKind:             trace.SpanKindConsumer,
+			SpanContext:          root,
+			StartTime:            start,
+			EndTime:              start.Add(5 * time.Millisecond),
+			Resource:             newResource(""),
+			InstrumentationScope: scope,
+		},
+	}.Snapshots()
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := &coltracepb.ExportTraceServiceRequest{}
+	var headers http.Header
+	var path string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		headers = r.Header
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(t, proto.Unmarshal(body, received))
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	exporter, err := NewOTLPExporter(server.URL+"/", map[string]string{"Authorization": "Bearer otlp-token"})
+	require.NoError(t, err)
+	t.Cleanup(func() { exporter.Shutdown(ctx) })
+
+	require.NoError(t, exporter.ExportSpans(ctx, testSpans()))
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "application/x-protobuf", headers.Get("Content-Type"))
+	assert.Equal(t, "Bearer otlp-token", headers.Get("Authorization"))
+
+	require.Len(t, received.ResourceSpans, 1)
+	resourceSpans := received.ResourceSpans[0]
+	require.Len(t, resourceSpans.Resource.Attributes, 1)
+	assert.Equal(t, "service.name", resourceSpans.Resource.Attributes[0].Key)
+	assert.Equal(t, "hops", resourceSpans.Resource.Attributes[0].Value.GetStringValue())
+
+	require.Len(t, resourceSpans.ScopeSpans, 1)
+	assert.Equal(t, instrumentationName, resourceSpans.ScopeSpans[0].Scope.Name)
+
+	spans := resourceSpans.ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, "hops.dispatch", spans[0].Name)
+	assert.Equal(t, []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, spans[0].TraceId)
+	assert.Equal(t, []byte{2, 0, 0, 0, 0, 0, 0, 0}, spans[0].ParentSpanId)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_PRODUCER, spans[0].Kind)
+	assert.Equal(t, uint64(1709208000001000000), spans[0].StartTimeUnixNano)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, spans[0].Status.Code)
+	assert.Equal(t, "no worker", spans[0].Status.Message)
+	assert.Empty(t, spans[1].ParentSpanId, "Root spans shouldn't have a parent")
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(failing.Close)
+
+	exporter, err = NewOTLPExporter(failing.URL+"/v1/traces", nil)
+	require.NoError(t, err)
+	assert.Error(t, exporter.ExportSpans(ctx, testSpans()))
+
+	for _, endpoint := range []string{"", "localhost:4318", "ftp://localhost:4318"} {
+		_, err = NewOTLPExporter(endpoint, nil)
+		assert.Error(t, err, "Endpoint '%s' should be rejected", endpoint)
+	}
+}
+
+func TestStdoutExporter(t *testing.T) {
+	out := &bytes.Buffer{}
+	exporter, err := NewStdoutExporter(out)
+	require.NoError(t, err)
+
+	require.NoError(t, exporter.ExportSpans(context.Background(), testSpans()))
+	assert.Contains(t, out.String(), `"Name":"hops.dispatch"`)
+	assert.Contains(t, out.String(), `"TraceID":"01000000000000000000000000000000"`)
+}
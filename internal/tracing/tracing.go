@@ -0,0 +1,114 @@
+// Package tracing traces how hops handles events with OpenTelemetry, where
+// spans are propagated to other services with W3C traceparent headers
+//
+// Like metrics, spans are started from a default tracer set once at startup.
+// Spans do nothing if tracing is disabled, though trace context from upstream
+// is still propagated
+package tracing
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// TraceparentHeader is the W3C trace context header, as set on NATS messages
+const TraceparentHeader = "traceparent"
+
+// instrumentationName is the scope spans from hops are exported in
+const instrumentationName = "github.com/hiphops-io/hops"
+
+// HeaderCarrier propagates traces in message headers, such as nats.Header,
+// keeping header names as they're given rather than canonicalising them as
+// for HTTP
+type HeaderCarrier map[string][]string
+
+var (
+	defaultTracer atomic.Pointer[trace.Tracer]
+	noopTracer    = noop.NewTracerProvider().Tracer(instrumentationName)
+	propagator    = propagation.TraceContext{}
+)
+
+// NewTracerProvider records spans and exports them in batches. Only ratio of
+// the traces started by hops are recorded, while traces continued from
+// upstream are recorded if upstream sampled them.
+//
+// Unsampled spans still carry their trace, so the decision is propagated to
+// their children and to workers
+func NewTracerProvider(exporter sdktrace.SpanExporter, serviceName string, ratio float64) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(newResource(serviceName)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+}
+
+// SetDefault sets the provider spans are started from, or disables tracing if
+// tp is nil
+func SetDefault(tp trace.TracerProvider) {
+	if tp == nil {
+		defaultTracer.Store(nil)
+		return
+	}
+
+	tracer := tp.Tracer(instrumentationName)
+	defaultTracer.Store(&tracer)
+}
+
+// Start starts a span from the default tracer, as a child of any span in ctx,
+// returning a context with the new span to start its children from
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	tracer := noopTracer
+	if t := defaultTracer.Load(); t != nil {
+		tracer = *t
+	}
+
+	return tracer.Start(ctx, name, opts...)
+}
+
+// RecordError marks the span's operation as failed, if err isn't nil
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Inject sets the traceparent header from the span in ctx, if there is one
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	propagator.Inject(ctx, carrier)
+}
+
+// Extract returns a context continuing the trace in the traceparent header,
+// or ctx unchanged if there isn't a valid one
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return propagator.Extract(ctx, carrier)
+}
+
+func (c HeaderCarrier) Get(key string) string {
+	if values := c[key]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	c[key] = []string{value}
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
@@ -0,0 +1,187 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStart(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := NewTracerProvider(exporter, "", 1)
+	SetDefault(tp)
+	t.Cleanup(func() {
+		SetDefault(nil)
+		tp.Shutdown(context.Background())
+	})
+
+	ctx, root := Start(
+		context.Background(),
+		"root",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("hops.source", "github")),
+	)
+	_, child := Start(ctx, "child")
+	child.SetAttributes(attribute.String("hops.flow", "deploy"))
+	RecordError(child, errors.New("boom"))
+	RecordError(root, nil)
+	child.End()
+	root.End()
+
+	require.NoError(t, tp.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, trace.SpanKindInternal, spans[0].SpanKind)
+	assert.Equal(t, root.SpanContext().TraceID(), spans[0].SpanContext.TraceID(), "Children should be in their parent's trace")
+	assert.Equal(t, root.SpanContext().SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, []attribute.KeyValue{attribute.String("hops.flow", "deploy")}, spans[0].Attributes)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "boom", spans[0].Status.Description)
+
+	assert.Equal(t, "root", spans[1].Name)
+	assert.Equal(t, trace.SpanKindConsumer, spans[1].SpanKind)
+	assert.False(t, spans[1].Parent.IsValid())
+	assert.Equal(t, []attribute.KeyValue{attribute.String("hops.source", "github")}, spans[1].Attributes)
+	assert.Equal(t, codes.Unset, spans[1].Status.Code, "Nil errors shouldn't fail the span")
+
+	serviceName, _ := spans[1].Resource.Set().Value("service.name")
+	assert.Equal(t, DefaultServiceName, serviceName.AsString())
+}
+
+func TestSampling(t *testing.T) {
+	ctx := context.Background()
+
+	exporter := tracetest.NewInMemoryExporter()
+	never := NewTracerProvider(exporter, "", 0)
+	always := NewTracerProvider(exporter, "", 1)
+	half := NewTracerProvider(exporter, "", 0.5)
+	t.Cleanup(func() {
+		SetDefault(nil)
+		never.Shutdown(ctx)
+		always.Shutdown(ctx)
+		half.Shutdown(ctx)
+	})
+
+	SetDefault(never)
+
+	rootCtx, root := Start(ctx, "root")
+	assert.False(t, root.IsRecording(), "Unsampled spans shouldn't be recorded")
+
+	sc := trace.SpanContextFromContext(rootCtx)
+	require.True(t, sc.IsValid(), "Unsampled spans should still be in the context")
+	assert.False(t, sc.IsSampled())
+
+	_, child := Start(rootCtx, "child")
+	assert.False(t, child.IsRecording(), "Children of unsampled spans shouldn't be recorded")
+	assert.Equal(t, sc.TraceID(), child.SpanContext().TraceID())
+
+	header := HeaderCarrier{}
+	Inject(rootCtx, header)
+	assert.Equal(t, "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-00", header.Get(TraceparentHeader), "The decision not to sample should be propagated")
+
+	upstream := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	_, span := Start(trace.ContextWithRemoteSpanContext(ctx, upstream), "continued")
+	assert.True(t, span.IsRecording(), "Traces sampled upstream should be recorded")
+	assert.Equal(t, upstream.TraceID(), span.SpanContext().TraceID())
+
+	SetDefault(always)
+	_, span = Start(trace.ContextWithRemoteSpanContext(ctx, upstream.WithTraceFlags(0)), "continued")
+	assert.False(t, span.IsRecording(), "Traces unsampled upstream shouldn't be recorded")
+
+	SetDefault(half)
+	sampled := 0
+	for range 1000 {
+		if _, span := Start(ctx, "root"); span.IsRecording() {
+			sampled++
+		}
+	}
+	assert.InDelta(t, 500, sampled, 100)
+}
+
+func TestDisabledTracing(t *testing.T) {
+	SetDefault(nil)
+
+	upstream := HeaderCarrier{}
+	upstream.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, span := Start(Extract(context.Background(), upstream), "noop")
+	assert.False(t, span.IsRecording())
+
+	// Spans should be safe to use
+	span.SetAttributes(attribute.String("key", "value"))
+	RecordError(span, errors.New("boom"))
+	span.End()
+
+	header := HeaderCarrier{}
+	Inject(ctx, header)
+	assert.Equal(t, upstream.Get(TraceparentHeader), header.Get(TraceparentHeader), "Upstream traces should still be propagated")
+}
+
+func TestPropagation(t *testing.T) {
+	type testCase struct {
+		name            string
+		header          string
+		expectedSampled bool
+		expectInvalid   bool
+	}
+
+	tests := []testCase{
+		{
+			name:            "Sampled",
+			header:          "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expectedSampled: true,
+		},
+		{
+			name:   "Unsampled",
+			header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		},
+		{
+			name:            "Future version with more fields",
+			header:          "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			expectedSampled: true,
+		},
+		{name: "Empty", header: "", expectInvalid: true},
+		{name: "Version 00 with more fields", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", expectInvalid: true},
+		{name: "Invalid version", header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", expectInvalid: true},
+		{name: "Zero trace ID", header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", expectInvalid: true},
+		{name: "Zero span ID", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", expectInvalid: true},
+		{name: "Not hex", header: "00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01", expectInvalid: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			header := HeaderCarrier{}
+			header.Set(TraceparentHeader, tc.header)
+
+			sc := trace.SpanContextFromContext(Extract(context.Background(), header))
+			if tc.expectInvalid {
+				assert.False(t, sc.IsValid())
+				return
+			}
+
+			require.True(t, sc.IsValid())
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+			assert.Equal(t, "00f067aa0ba902b7", sc.SpanID().String())
+			assert.Equal(t, tc.expectedSampled, sc.IsSampled())
+			assert.True(t, sc.IsRemote())
+		})
+	}
+
+	header := HeaderCarrier{}
+	Inject(context.Background(), header)
+	assert.Empty(t, header, "Nothing should be injected without a span")
+}
@@ -0,0 +1,361 @@
+package markdown
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-json"
+)
+
+// buildManifest is written into the build dir, recording the content hash of
+// each file so unchanged files are skipped on the next build
+const buildManifest = ".hops-build.json"
+
+const (
+	// currentBuildLink links to the current build in a build dir
+	currentBuildLink = "current"
+	// buildVersionPrefix starts the name of each build in a build dir
+	buildVersionPrefix = ".build-"
+)
+
+type (
+	// BuildError reports every file that failed to build
+	BuildError struct {
+		Errors []FileError
+	}
+
+	// FileError is a failure to build a single file
+	FileError struct {
+		// Path is the file's path in the build dir
+		Path string
+		Err  error
+	}
+
+	// manifest maps paths in the build dir to the hash of their content
+	manifest map[string]string
+)
+
+func (e *BuildError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "unable to build %d file(s):", len(e.Errors))
+	for _, fe := range e.Errors {
+		fmt.Fprintf(&b, "\n  %s: %s", fe.Path, fe.Err)
+	}
+
+	return b.String()
+}
+
+func (e *BuildError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, fe := range e.Errors {
+		errs[i] = fe.Err
+	}
+
+	return errs
+}
+
+// add records a failure, and is safe to call concurrently
+func (e *BuildError) add(mutex *sync.Mutex, relPath string, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	e.Errors = append(e.Errors, FileError{Path: filepath.ToSlash(relPath), Err: err})
+}
+
+// errOrNil returns the error sorted by path if any files failed, or nil
+func (e *BuildError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	slices.SortFunc(e.Errors, func(a, b FileError) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return e
+}
+
+// parallel calls fn for every index up to n, across as many goroutines as
+// there are CPUs
+func parallel(n int, fn func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < min(runtime.GOMAXPROCS(0), n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+
+	wg.Wait()
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// readManifest reads the manifest of a build dir, empty if it has none
+func readManifest(build string) manifest {
+	m := manifest{}
+
+	content, err := os.ReadFile(filepath.Join(build, buildManifest))
+	if err != nil {
+		return m
+	}
+
+	// An unreadable manifest means everything is rebuilt
+	if err := json.Unmarshal(content, &m); err != nil {
+		return manifest{}
+	}
+
+	return m
+}
+
+func (m manifest) write(build string) error {
+	content, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(build, buildManifest), content)
+}
+
+// unchanged is true if the file at relPath in build has the given content
+func (m manifest) unchanged(build, relPath, hash string) bool {
+	if m[filepath.ToSlash(relPath)] != hash {
+		return false
+	}
+
+	_, err := os.Stat(filepath.Join(build, relPath))
+	return err == nil
+}
+
+// writeFile replaces a file rather than writing over it, so other links to
+// the file are left untouched
+func writeFile(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// Temp files are only readable by their owner, but the site is served
+	// by other processes
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// linkTree recreates the files of src in dst as hard links, so a new build
+// can start from the previous one without copying it
+//
+// Files are copied instead if they can't be linked, and dst is left empty if
+// src doesn't exist
+func linkTree(src, dst string) error {
+	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+		return err
+	}
+
+	err := filepath.WalkDir(src, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dst, relPath)
+
+		if de.IsDir() {
+			return os.MkdirAll(dstPath, os.ModePerm)
+		}
+
+		if !de.Type().IsRegular() {
+			return nil
+		}
+
+		if err := os.Link(path, dstPath); err == nil {
+			return nil
+		}
+
+		return copyFile(path, dstPath)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// removeStale removes files from build that aren't in keep, along with any
+// directories left empty
+func removeStale(build string, keep map[string]bool) error {
+	dirs := []string{}
+
+	err := filepath.WalkDir(build, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(build, path)
+		if err != nil {
+			return err
+		}
+
+		if de.IsDir() {
+			if relPath != "." {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+
+		if keep[filepath.ToSlash(relPath)] {
+			return nil
+		}
+
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Deepest dirs are removed first, so their parents can become empty.
+	// Removing a dir that isn't empty fails, which is ignored
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+
+	return nil
+}
+
+// currentBuild is the dir of the build currently linked to, empty if there
+// isn't one
+func currentBuild(build string) (string, error) {
+	target, err := os.Readlink(CurrentBuild(build))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(build, filepath.Base(target)), nil
+}
+
+// newBuild creates an empty dir for the next build alongside the current one
+func newBuild(build string) (string, error) {
+	if err := os.MkdirAll(build, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp(build, buildVersionPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	// Temp dirs are only readable by their owner, but the site is served by
+	// other processes
+	if err := os.Chmod(dir, 0755); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// swapLink points the current build link at next. The link is replaced with
+// a single rename, so it always points at a complete build
+func swapLink(build, next string) error {
+	tmp := CurrentBuild(build) + ".tmp"
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Relative links still resolve when the build dir is mounted elsewhere,
+	// such as in a container
+	if err := os.Symlink(filepath.Base(next), tmp); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, CurrentBuild(build)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// removeOldBuilds removes everything in build besides the current link and
+// the builds in keep. The build before the current one is kept, as requests
+// that started before the swap may still be reading from it
+func removeOldBuilds(build string, keep ...string) error {
+	entries, err := os.ReadDir(build)
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == currentBuildLink || slices.ContainsFunc(keep, func(k string) bool { return k != "" && filepath.Base(k) == name }) {
+			continue
+		}
+
+		errs = append(errs, os.RemoveAll(filepath.Join(build, name)))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,227 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// catalogueDir is the directory of the build dir that flow pages are written to
+const catalogueDir = "flows"
+
+// nextRunFormat is how the next run of scheduled flows is shown
+const nextRunFormat = "Mon, 02 Jan 2006 15:04 MST"
+
+type (
+	// flowPageData is the data of a flow's catalogue page
+	flowPageData struct {
+		Flow        *Flow
+		Description template.HTML
+		NextRun     string
+		Params      []paramField
+		Triggers    []string
+		URL         string
+	}
+
+	// paramField is a command param as a field of the command's form
+	paramField struct {
+		Name     string
+		Label    string
+		Type     string
+		Required bool
+		// InputType is the type of input element for params that use one
+		InputType string
+		Value     string
+		Checked   bool
+		Options   []paramOption
+		// OptionsFrom is the expression options are read from when the command
+		// is run, with the field taking free text instead as they aren't known
+		// when the site is built
+		OptionsFrom string
+	}
+
+	paramOption struct {
+		Value    string
+		Selected bool
+	}
+)
+
+// flowPages renders a catalogue page for each flow and an index page linking
+// them, none if the builder has no flows
+//
+// Flows that fail to render are reported and left out of the catalogue
+func (s *StaticBuilder) flowPages() ([]*sitePage, []FileError) {
+	if len(s.flows) == 0 {
+		return nil, nil
+	}
+
+	flows := make([]*Flow, 0, len(s.flows))
+	for _, f := range s.flows {
+		flows = append(flows, f)
+	}
+	slices.SortFunc(flows, func(a, b *Flow) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	now := s.now()
+	pages := make([]*sitePage, 0, len(flows)+1)
+	flowsData := make([]flowPageData, 0, len(flows))
+	errs := []FileError{}
+
+	for _, f := range flows {
+		data, err := newFlowPageData(f, now)
+		if err != nil {
+			errs = append(errs, FileError{Path: filepath.ToSlash(flowPagePath(f)), Err: err})
+			continue
+		}
+
+		content, err := s.executeTemplate("flow.html", data)
+		if err != nil {
+			errs = append(errs, FileError{Path: filepath.ToSlash(flowPagePath(f)), Err: err})
+			continue
+		}
+
+		pages = append(pages, &sitePage{
+			data: PageData{
+				Content:     content,
+				Description: fmt.Sprintf("The %s flow", f.DisplayName()),
+				Title:       f.DisplayName(),
+			},
+			path: flowPagePath(f),
+		})
+		flowsData = append(flowsData, data)
+	}
+
+	indexPath := filepath.Join(catalogueDir, "index.html")
+
+	content, err := s.executeTemplate("flows.html", flowsData)
+	if err != nil {
+		return pages, append(errs, FileError{Path: filepath.ToSlash(indexPath), Err: err})
+	}
+
+	pages = append(pages, &sitePage{
+		data: PageData{
+			Content:     content,
+			Description: "The flows of this Hiphops app",
+			Title:       "Flows",
+		},
+		index: true,
+		path:  indexPath,
+	})
+
+	return pages, errs
+}
+
+func (s *StaticBuilder) executeTemplate(name string, data any) (template.HTML, error) {
+	var b bytes.Buffer
+	if err := s.templates.ExecuteTemplate(&b, name, data); err != nil {
+		return "", err
+	}
+
+	return template.HTML(b.String()), nil
+}
+
+func newFlowPageData(f *Flow, now time.Time) (flowPageData, error) {
+	description, err := f.HTML()
+	if err != nil {
+		return flowPageData{}, err
+	}
+
+	data := flowPageData{
+		Flow:        f,
+		Description: template.HTML(description),
+		Triggers:    flowTriggers(f),
+		URL:         pageURL(flowPagePath(f)),
+	}
+
+	if f.Schedule != "" {
+		schedule, err := cron.ParseStandard(f.Schedule)
+		if err != nil {
+			return flowPageData{}, err
+		}
+
+		data.NextRun = schedule.Next(now).UTC().Format(nextRunFormat)
+	}
+
+	for _, p := range f.Command {
+		data.Params = append(data.Params, newParamField(p))
+	}
+
+	return data, nil
+}
+
+// flowTriggers summarises what runs a flow
+func flowTriggers(f *Flow) []string {
+	triggers := []string{}
+	if f.On != "" {
+		triggers = append(triggers, fmt.Sprintf("On %s", f.On))
+	}
+	if f.Command != nil {
+		triggers = append(triggers, fmt.Sprintf("Command %s", f.ActionName()))
+	}
+	if f.Schedule != "" {
+		triggers = append(triggers, fmt.Sprintf("Schedule %s", f.Schedule))
+	}
+
+	return triggers
+}
+
+func flowPagePath(f *Flow) string {
+	return filepath.Join(catalogueDir, strings.ToLower(f.ID)+".html")
+}
+
+func newParamField(pi ParamItem) paramField {
+	name, param := pi.Param()
+	field := paramField{
+		Name:        name,
+		Label:       pi.DisplayName(),
+		Type:        param.Type,
+		Required:    param.Required,
+		OptionsFrom: param.OptionsFrom,
+	}
+
+	switch param.Type {
+	case "select", "multiselect":
+		selected := map[string]bool{}
+		switch d := param.Default.(type) {
+		case string:
+			selected[d] = true
+		case []any:
+			for _, v := range d {
+				selected[fmt.Sprint(v)] = true
+			}
+		}
+
+		for _, option := range param.Options {
+			field.Options = append(field.Options, paramOption{Value: option, Selected: selected[option]})
+		}
+	case "bool":
+		field.Checked, _ = param.Default.(bool)
+	case "number":
+		field.InputType = "number"
+	case "date":
+		field.InputType = "date"
+	case "datetime":
+		field.InputType = "datetime-local"
+		if d, ok := param.Default.(string); ok {
+			if t, err := time.Parse(ParamDateTimeFormat, d); err == nil {
+				field.Value = t.Format("2006-01-02T15:04")
+			}
+		}
+	case "text":
+	default:
+		field.InputType = "text"
+	}
+
+	if field.Value == "" && param.Default != nil && param.Type != "bool" && !param.HasOptions() {
+		field.Value = fmt.Sprint(param.Default)
+	}
+
+	return field
+}
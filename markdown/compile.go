@@ -0,0 +1,326 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+
+	"github.com/hiphops-io/hops/expression/ctyconv"
+)
+
+const eventVarName = "event"
+
+// uncacheableFuncs return different values per flow or per call, so
+// expressions calling them are never shared between flows
+var uncacheableFuncs = map[string]bool{
+	"file":      true,
+	"template":  true,
+	"timestamp": true,
+	"uuid":      true,
+}
+
+type (
+	// compiledExpr is an expression split on its logical operators, so operands
+	// that flows have in common are evaluated once per event
+	compiledExpr struct {
+		expr hcl.Expression
+		// key identifies the expression across flows, empty if its value can't
+		// be shared
+		key      string
+		op       *hclsyntax.Operation
+		operands []*compiledExpr
+	}
+
+	// exprCache holds the values of compiled expressions for a single event
+	exprCache map[string]cty.Value
+
+	// eventPaths is the set of paths into an event that expressions read, so
+	// only those parts of an event need to be converted for evaluation
+	eventPaths struct {
+		whole    bool
+		children map[string]*eventPaths
+	}
+)
+
+// compileExpr prepares an expression parsed from src for cached evaluation
+func compileExpr(expr hcl.Expression, src string) *compiledExpr {
+	switch e := expr.(type) {
+	case *hclsyntax.ParenthesesExpr:
+		return compileExpr(e.Expression, src)
+	case *hclsyntax.BinaryOpExpr:
+		if e.Op == hclsyntax.OpLogicalAnd || e.Op == hclsyntax.OpLogicalOr {
+			return &compiledExpr{
+				expr:     e,
+				key:      exprKey(e, src),
+				op:       e.Op,
+				operands: []*compiledExpr{compileExpr(e.LHS, src), compileExpr(e.RHS, src)},
+			}
+		}
+	case *hclsyntax.UnaryOpExpr:
+		if e.Op == hclsyntax.OpLogicalNot {
+			return &compiledExpr{
+				expr:     e,
+				key:      exprKey(e, src),
+				op:       e.Op,
+				operands: []*compiledExpr{compileExpr(e.Val, src)},
+			}
+		}
+	}
+
+	return &compiledExpr{expr: expr, key: exprKey(expr, src)}
+}
+
+// allExprs combines expressions so they must all be true, returning nil if
+// there are none
+func allExprs(exprs []*compiledExpr) *compiledExpr {
+	if len(exprs) == 0 {
+		return nil
+	}
+
+	combined := exprs[0]
+	for _, next := range exprs[1:] {
+		key := ""
+		if combined.key != "" && next.key != "" {
+			key = fmt.Sprintf("(%s) && (%s)", combined.key, next.key)
+		}
+
+		combined = &compiledExpr{
+			expr: &hclsyntax.BinaryOpExpr{
+				LHS:      combined.expr.(hclsyntax.Expression),
+				Op:       hclsyntax.OpLogicalAnd,
+				RHS:      next.expr.(hclsyntax.Expression),
+				SrcRange: next.expr.Range(),
+			},
+			key:      key,
+			op:       hclsyntax.OpLogicalAnd,
+			operands: []*compiledExpr{combined, next},
+		}
+	}
+
+	return combined
+}
+
+// notExpr inverts an expression
+func notExpr(c *compiledExpr) *compiledExpr {
+	key := ""
+	if c.key != "" {
+		key = fmt.Sprintf("!(%s)", c.key)
+	}
+
+	return &compiledExpr{
+		expr: &hclsyntax.UnaryOpExpr{
+			Op:          hclsyntax.OpLogicalNot,
+			Val:         c.expr.(hclsyntax.Expression),
+			SrcRange:    c.expr.Range(),
+			SymbolRange: c.expr.Range(),
+		},
+		key:      key,
+		op:       hclsyntax.OpLogicalNot,
+		operands: []*compiledExpr{c},
+	}
+}
+
+// exprKey is the source of an expression, or empty if it calls functions
+// whose results can't be shared between flows
+func exprKey(expr hcl.Expression, src string) string {
+	cacheable := true
+	hclsyntax.VisitAll(expr.(hclsyntax.Node), func(node hclsyntax.Node) hcl.Diagnostics {
+		if call, ok := node.(*hclsyntax.FunctionCallExpr); ok && uncacheableFuncs[call.Name] {
+			cacheable = false
+		}
+		return nil
+	})
+
+	rng := expr.Range()
+	if !cacheable || rng.End.Byte > len(src) {
+		return ""
+	}
+
+	return strings.TrimSpace(src[rng.Start.Byte:rng.End.Byte])
+}
+
+// Value evaluates the expression, using and adding to the cache if not nil
+func (c *compiledExpr) Value(evalCtx *hcl.EvalContext, cache exprCache) (cty.Value, hcl.Diagnostics) {
+	if cache != nil && c.key != "" {
+		if val, ok := cache[c.key]; ok {
+			return val, nil
+		}
+	}
+
+	var (
+		val   cty.Value
+		diags hcl.Diagnostics
+	)
+
+	if c.op == nil {
+		val, diags = c.expr.Value(evalCtx)
+	} else {
+		val, diags = c.operationValue(evalCtx, cache)
+	}
+
+	if cache != nil && c.key != "" && !diags.HasErrors() {
+		cache[c.key] = val
+	}
+
+	return val, diags
+}
+
+// operationValue evaluates a logical operation as hclsyntax would, but with
+// its operands evaluated through the cache
+func (c *compiledExpr) operationValue(evalCtx *hcl.EvalContext, cache exprCache) (cty.Value, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	args := make([]cty.Value, len(c.operands))
+	for i, operand := range c.operands {
+		val, operandDiags := operand.Value(evalCtx, cache)
+		diags = append(diags, operandDiags...)
+		if operandDiags.HasErrors() {
+			continue
+		}
+
+		boolVal, err := convert.Convert(val, cty.Bool)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity:    hcl.DiagError,
+				Summary:     "Invalid operand",
+				Detail:      fmt.Sprintf("Unsuitable value for operand: %s.", err),
+				Subject:     operand.expr.Range().Ptr(),
+				Expression:  operand.expr,
+				EvalContext: evalCtx,
+			})
+			continue
+		}
+
+		args[i] = boolVal
+	}
+
+	if diags.HasErrors() {
+		return cty.UnknownVal(cty.Bool), diags
+	}
+
+	val, err := c.op.Impl.Call(args)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity:    hcl.DiagError,
+			Summary:     "Operation failed",
+			Detail:      fmt.Sprintf("Error during operation: %s.", err),
+			Subject:     c.expr.Range().Ptr(),
+			Expression:  c.expr,
+			EvalContext: evalCtx,
+		})
+		return cty.UnknownVal(cty.Bool), diags
+	}
+
+	return val, diags
+}
+
+func newEventPaths() *eventPaths {
+	return &eventPaths{children: map[string]*eventPaths{}}
+}
+
+// addExpr adds the paths into the event that an expression reads
+func (p *eventPaths) addExpr(expr hcl.Expression) {
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != eventVarName {
+			continue
+		}
+
+		p.addTraversal(traversal[1:])
+	}
+}
+
+// addTraversal adds a path, ending it at the first step that isn't an
+// attribute as the rest of the value is needed from there
+func (p *eventPaths) addTraversal(traversal hcl.Traversal) {
+	node := p
+	for _, step := range traversal {
+		if node.whole {
+			return
+		}
+
+		var name string
+		switch s := step.(type) {
+		case hcl.TraverseAttr:
+			name = s.Name
+		case hcl.TraverseIndex:
+			if !s.Key.IsKnown() || s.Key.IsNull() || s.Key.Type() != cty.String {
+				node.setWhole()
+				return
+			}
+			name = s.Key.AsString()
+		default:
+			node.setWhole()
+			return
+		}
+
+		child, ok := node.children[name]
+		if !ok {
+			child = newEventPaths()
+			node.children[name] = child
+		}
+		node = child
+	}
+
+	node.setWhole()
+}
+
+// merge adds the paths of other to p
+func (p *eventPaths) merge(other *eventPaths) {
+	if p.whole {
+		return
+	}
+	if other.whole {
+		p.setWhole()
+		return
+	}
+
+	for name, otherChild := range other.children {
+		child, ok := p.children[name]
+		if !ok {
+			child = newEventPaths()
+			p.children[name] = child
+		}
+		child.merge(otherChild)
+	}
+}
+
+func (p *eventPaths) setWhole() {
+	p.whole = true
+	p.children = nil
+}
+
+// convert converts the parts of an event's data that are read, leaving out
+// anything else
+func (p *eventPaths) convert(data any) (cty.Value, error) {
+	if p.whole {
+		return ctyconv.InterfaceToCtyVal(data)
+	}
+
+	dataMap, ok := data.(map[string]any)
+	if !ok {
+		// Reading attributes of anything else is an error, so convert it whole
+		// for evaluation to report it
+		return ctyconv.InterfaceToCtyVal(data)
+	}
+
+	vals := make(map[string]cty.Value, len(p.children))
+	for name, child := range p.children {
+		childData, ok := dataMap[name]
+		if !ok {
+			continue
+		}
+
+		val, err := child.convert(childData)
+		if err != nil {
+			return cty.NilVal, err
+		}
+
+		vals[name] = val
+	}
+
+	return cty.ObjectVal(vals), nil
+}
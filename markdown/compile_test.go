@@ -0,0 +1,131 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+func TestEventPathsConvert(t *testing.T) {
+	data := map[string]any{
+		"ref": "refs/heads/main",
+		"repository": map[string]any{
+			"name":  "hops",
+			"owner": map[string]any{"login": "hiphops-io"},
+		},
+		"labels": []any{"bug"},
+		// Unread values are never converted, so can't cause errors
+		"unread": make(chan int),
+	}
+
+	tests := []struct {
+		name     string
+		exprs    []string
+		expected cty.Value
+	}{
+		{
+			name:     "No expressions",
+			expected: cty.EmptyObjectVal,
+		},
+		{
+			name:  "Attributes",
+			exprs: []string{`event.ref == "main"`, `event.repository.owner.login`},
+			expected: cty.ObjectVal(map[string]cty.Value{
+				"ref": cty.StringVal("refs/heads/main"),
+				"repository": cty.ObjectVal(map[string]cty.Value{
+					"owner": cty.ObjectVal(map[string]cty.Value{"login": cty.StringVal("hiphops-io")}),
+				}),
+			}),
+		},
+		{
+			name:  "Parent and child",
+			exprs: []string{`event.repository.name`, `keys(event.repository)`},
+			expected: cty.ObjectVal(map[string]cty.Value{
+				"repository": cty.ObjectVal(map[string]cty.Value{
+					"name":  cty.StringVal("hops"),
+					"owner": cty.ObjectVal(map[string]cty.Value{"login": cty.StringVal("hiphops-io")}),
+				}),
+			}),
+		},
+		{
+			name:  "Index",
+			exprs: []string{`event.labels[0] == "bug"`, `event["ref"]`},
+			expected: cty.ObjectVal(map[string]cty.Value{
+				"labels": cty.TupleVal([]cty.Value{cty.StringVal("bug")}),
+				"ref":    cty.StringVal("refs/heads/main"),
+			}),
+		},
+		{
+			name:     "Missing values",
+			exprs:    []string{`event.nope.nested`},
+			expected: cty.EmptyObjectVal,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			paths := newEventPaths()
+			for _, src := range tc.exprs {
+				expr, diags := hclsyntax.ParseExpression([]byte(src), "test", hcl.InitialPos)
+				require.False(t, diags.HasErrors(), diags.Error())
+
+				exprPaths := newEventPaths()
+				exprPaths.addExpr(expr)
+				paths.merge(exprPaths)
+			}
+
+			got, err := paths.convert(data)
+			if assert.NoError(t, err) {
+				assert.True(t, tc.expected.RawEquals(got), "Expected %#v, got %#v", tc.expected, got)
+			}
+		})
+	}
+
+	paths := newEventPaths()
+	paths.addTraversal(nil)
+	_, err := paths.convert(data)
+	assert.Error(t, err, "Reading the whole event should convert everything")
+}
+
+func TestCompiledExprCache(t *testing.T) {
+	src := `(event.count > 1) && !(file("x") == "y" || event.ok)`
+	expr, diags := hclsyntax.ParseExpression([]byte(src), "test", hcl.InitialPos)
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	compiled := compileExpr(expr, src)
+
+	assert.Equal(t, "", compiled.key, "Expressions calling file() can't be shared")
+	require.Len(t, compiled.operands, 2)
+	assert.Equal(t, "event.count > 1", compiled.operands[0].key)
+	assert.Equal(t, "", compiled.operands[1].key)
+
+	or := compiled.operands[1].operands[0]
+	require.Len(t, or.operands, 2)
+	assert.Equal(t, "", or.operands[0].key)
+	assert.Equal(t, "event.ok", or.operands[1].key)
+
+	cache := exprCache{"event.count > 1": cty.True, "event.ok": cty.False}
+	evalCtx := &hcl.EvalContext{
+		Functions: map[string]function.Function{
+			"file": function.New(&function.Spec{
+				Params: []function.Parameter{{Name: "name", Type: cty.String}},
+				Type:   function.StaticReturnType(cty.String),
+				Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+					return cty.StringVal("z"), nil
+				},
+			}),
+		},
+		// Values come from the cache, so the event isn't needed
+		Variables: map[string]cty.Value{"event": cty.EmptyObjectVal},
+	}
+
+	val, diags := compiled.Value(evalCtx, cache)
+	require.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, cty.True, val)
+	assert.Len(t, cache, 2, "Only expressions that can be shared should be cached")
+}
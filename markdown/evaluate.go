@@ -1,14 +1,18 @@
 package markdown
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/zclconf/go-cty/cty"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/hiphops-io/hops/expression/ctyconv"
 	"github.com/hiphops-io/hops/expression/funcs"
+	"github.com/hiphops-io/hops/internal/tracing"
 	"github.com/hiphops-io/hops/nats"
 )
 
@@ -16,9 +20,33 @@ const MetadataKey = "hops"
 
 var ErrCommandNotFound = errors.New("command not found")
 
-func MatchCommandFlows(flowIdx map[string]*Flow, hopsMsg *nats.HopsMsg, evalCtx *hcl.EvalContext) (*Flow, error) {
+// IfError is a failure to evaluate a flow's 'if' condition against an event
+type IfError struct {
+	FlowID string
+	Err    error
+}
+
+func (e *IfError) Error() string {
+	return fmt.Sprintf("unable to evaluate 'if' of flow '%s': %s", e.FlowID, e.Err)
+}
+
+func (e *IfError) Unwrap() error {
+	return e.Err
+}
+
+// MatchCommandFlows returns the command flow for an event if its conditions
+// are met, or nil if they aren't
+//
+// If evalCtx is nil, only the parts of the event the flow reads are converted
+// for evaluation
+func MatchCommandFlows(ctx context.Context, flowIdx map[string]*Flow, hopsMsg *nats.HopsMsg, evalCtx *hcl.EvalContext) (*Flow, error) {
+	flow, ok := flowIdx[hopsMsg.Action]
+	if !ok {
+		return nil, ErrCommandNotFound
+	}
+
 	if evalCtx == nil {
-		eval, err := EventEvalContext(hopsMsg)
+		eval, err := flowsEvalContext([]*Flow{flow}, hopsMsg)
 		if err != nil {
 			return nil, err
 		}
@@ -26,14 +54,9 @@ func MatchCommandFlows(flowIdx map[string]*Flow, hopsMsg *nats.HopsMsg, evalCtx
 		evalCtx = eval
 	}
 
-	flow, ok := flowIdx[hopsMsg.Action]
-	if !ok {
-		return nil, ErrCommandNotFound
-	}
-
-	matches, err := flow.IfValue(evalCtx)
+	matches, err := flow.tracedIfValue(ctx, evalCtx, nil)
 	if err != nil {
-		return nil, err
+		return nil, &IfError{FlowID: flow.ID, Err: err}
 	}
 
 	if !matches {
@@ -43,16 +66,47 @@ func MatchCommandFlows(flowIdx map[string]*Flow, hopsMsg *nats.HopsMsg, evalCtx
 	return flow, nil
 }
 
-func MatchFlows(flowIdx map[string][]*Flow, hopsMsg *nats.HopsMsg, evalCtx *hcl.EvalContext) ([]*Flow, error) {
-	if evalCtx == nil {
-		eval, err := EventEvalContext(hopsMsg)
-		if err != nil {
-			return nil, err
+// FlowDecision is whether a flow triggered by an event matched its conditions
+type FlowDecision struct {
+	Flow    *Flow
+	Matched bool
+	// Err is an *IfError if the flow's 'if' couldn't be evaluated
+	Err error
+}
+
+// MatchFlows returns the flows triggered by an event whose conditions are met
+//
+// If evalCtx is nil, only the parts of the event that candidate flows read are
+// converted for evaluation, and nothing is converted if there are none.
+// Expressions that flows have in common are evaluated once
+func MatchFlows(ctx context.Context, flowIdx map[string][]*Flow, hopsMsg *nats.HopsMsg, evalCtx *hcl.EvalContext) ([]*Flow, error) {
+	decisions, err := EvaluateFlows(ctx, flowIdx, hopsMsg, evalCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Omit flows with a non-matching 'if' condition
+	matchedFlows := []*Flow{}
+	for _, d := range decisions {
+		if d.Err != nil {
+			return nil, d.Err
 		}
 
-		evalCtx = eval
+		if d.Matched {
+			matchedFlows = append(matchedFlows, d.Flow)
+		}
 	}
 
+	return matchedFlows, nil
+}
+
+// EvaluateFlows decides whether each flow triggered by an event matched its
+// conditions, continuing past flows whose 'if' can't be evaluated so every
+// decision can be reported
+//
+// evalCtx is as for MatchFlows. An error is only returned if the event can't
+// be converted for evaluation
+func EvaluateFlows(ctx context.Context, flowIdx map[string][]*Flow, hopsMsg *nats.HopsMsg, evalCtx *hcl.EvalContext) (decisions []FlowDecision, err error) {
 	lookups := expandEventLookups(hopsMsg.Source, hopsMsg.Event, hopsMsg.Action)
 
 	flows := []*Flow{}
@@ -60,20 +114,52 @@ func MatchFlows(flowIdx map[string][]*Flow, hopsMsg *nats.HopsMsg, evalCtx *hcl.
 		flows = append(flows, flowIdx[l]...)
 	}
 
-	// Omit flows with a non-matching 'if' condition
-	matchedFlows := []*Flow{}
-	for _, f := range flows {
-		matches, err := f.IfValue(evalCtx)
+	ctx, span := tracing.Start(ctx, "hops.match", trace.WithAttributes(attribute.Int("hops.candidates", len(flows))))
+	defer func() {
+		matched := 0
+		spanErr := err
+		for _, d := range decisions {
+			if d.Matched {
+				matched++
+			}
+			if spanErr == nil {
+				spanErr = d.Err
+			}
+		}
+
+		span.SetAttributes(attribute.Int("hops.matched", matched))
+		tracing.RecordError(span, spanErr)
+		span.End()
+	}()
+
+	decisions = make([]FlowDecision, len(flows))
+	if len(flows) == 0 {
+		return decisions, nil
+	}
+
+	if evalCtx == nil {
+		eval, err := flowsEvalContext(flows, hopsMsg)
 		if err != nil {
 			return nil, err
 		}
 
-		if matches {
-			matchedFlows = append(matchedFlows, f)
+		evalCtx = eval
+	}
+
+	cache := exprCache{}
+	for i, f := range flows {
+		decisions[i].Flow = f
+
+		matches, err := f.tracedIfValue(ctx, evalCtx, cache)
+		if err != nil {
+			decisions[i].Err = &IfError{FlowID: f.ID, Err: err}
+			continue
 		}
+
+		decisions[i].Matched = matches
 	}
 
-	return matchedFlows, nil
+	return decisions, nil
 }
 
 func EventEvalContext(hopsMsg *nats.HopsMsg) (*hcl.EvalContext, error) {
@@ -85,7 +171,30 @@ func EventEvalContext(hopsMsg *nats.HopsMsg) (*hcl.EvalContext, error) {
 	return &hcl.EvalContext{
 		Functions: funcs.DefaultFunctions,
 		Variables: map[string]cty.Value{
-			"event": eventVal,
+			eventVarName: eventVal,
+		},
+	}, nil
+}
+
+// flowsEvalContext creates the evaluation context for flows' 'if' expressions,
+// converting only the parts of the event that they read
+func flowsEvalContext(flows []*Flow, hopsMsg *nats.HopsMsg) (*hcl.EvalContext, error) {
+	paths := newEventPaths()
+	for _, f := range flows {
+		if f.ifPaths != nil {
+			paths.merge(f.ifPaths)
+		}
+	}
+
+	eventVal, err := paths.convert(hopsMsg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hcl.EvalContext{
+		Functions: funcs.DefaultFunctions,
+		Variables: map[string]cty.Value{
+			eventVarName: eventVal,
 		},
 	}, nil
 }
@@ -1,11 +1,17 @@
 package markdown
 
 import (
+	"context"
+	"fmt"
 	"testing"
 
+	"github.com/goccy/go-json"
+	"github.com/hiphops-io/hops/internal/tracing"
 	"github.com/hiphops-io/hops/nats"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"golang.org/x/exp/maps"
 )
 
@@ -105,6 +111,240 @@ A flow
 			expectError: true,
 		},
 
+		{
+			name: "Conditional using file next to the flow",
+			source: map[string][]byte{
+				"flow/one.md": []byte(`---
+on: "pull_request"
+if: >-
+  length([for u in split("\n", file("allowed_users.txt")) : u if u == event.user]) > 0
+---
+A flow
+`),
+				"flow/allowed_users.txt": []byte("alice\nbob\n"),
+				"other/two.md": []byte(`---
+on: "pull_request"
+if: can(file("allowed_users.txt"))
+---
+A flow that can't read files of other flows
+`),
+			},
+			event:       setupTestMsg("github", "pull_request", "closed", map[string]any{"user": "bob"}),
+			expectedIDs: []string{"flow.one"},
+		},
+
+		{
+			name: "Conditional using template next to the flow",
+			source: map[string][]byte{
+				"flow/one.md": []byte(`---
+on: "pull_request"
+if: template("branch.tmpl", {prefix = "release"}) == event.branch
+---
+A flow
+`),
+				"flow/branch.tmpl": []byte("{{ prefix }}/main"),
+			},
+			event:       setupTestMsg("github", "pull_request", "closed", map[string]any{"branch": "release/main"}),
+			expectedIDs: []string{"flow.one"},
+		},
+
+		{
+			name: "Conditional using missing file",
+			source: map[string][]byte{
+				"flow/one.md": []byte(`---
+on: "pull_request"
+if: file("nope.txt") == "hello"
+---
+A flow
+`),
+				"flow/.hidden.txt":  []byte("hello"),
+				"flow/sub/nope.txt": []byte("hello"),
+			},
+			event:       setupTestMsg("github", "pull_request", "closed", nil),
+			expectError: true,
+		},
+
+		{
+			name: "Shared conditions with flow files",
+			source: map[string][]byte{
+				"a/one.md": []byte(`---
+on: "pull_request"
+if: file("env.txt") == "a" && event.data == "hello"
+---
+A flow
+`),
+				"a/env.txt": []byte("a"),
+				"b/one.md": []byte(`---
+on: "pull_request"
+if: file("env.txt") == "a" && event.data == "hello"
+---
+A flow
+`),
+				"b/env.txt": []byte("b"),
+				"c/one.md": []byte(`---
+on: "pull_request"
+if: (event.data == "hello") && !(event.count > 2)
+---
+A flow
+`),
+				"c/two.md": []byte(`---
+on: "pull_request"
+if: event.data == "hello" || event.count > 2
+---
+A flow
+`),
+			},
+			event: setupTestMsg("github", "pull_request", "closed", map[string]any{
+				"data":  "hello",
+				"count": 1,
+			}),
+			expectedIDs: []string{"a.one", "c.one", "c.two"},
+		},
+
+		{
+			name: "Conditionals reading nested and whole values",
+			source: map[string][]byte{
+				"flow/one.md": []byte(`---
+on: "pull_request"
+if: jmespath(event, "pr.labels[1]") == "urgent"
+---
+A flow
+`),
+				"flow/two.md": []byte(`---
+on: "pull_request"
+if: 'length([for l in event.pr.labels : l if l == "bug"]) > 0'
+---
+A flow
+`),
+				"flow/three.md": []byte(`---
+on: "pull_request"
+if: event.pr["labels"][0] == "bug" && event.pr.user.login == "octocat"
+---
+A flow
+`),
+				"flow/four.md": []byte(`---
+on: "pull_request"
+if: try(event.pr.missing.value, "none") == "none"
+---
+A flow
+`),
+			},
+			event: setupTestMsg("github", "pull_request", "closed", map[string]any{
+				"pr": map[string]any{
+					"labels": []any{"bug", "urgent"},
+					"user":   map[string]any{"login": "octocat", "id": 1},
+				},
+			}),
+			expectedIDs: []string{"flow.one", "flow.two", "flow.three", "flow.four"},
+		},
+
+		{
+			name: "Match shorthand with if and unless",
+			source: map[string][]byte{
+				"flow/one.md": []byte(`---
+on: push
+match:
+  branch: [main, "release/*"]
+  repo: "hiphops-io/*"
+  actor_not: ['*\[bot\]']
+  paths: "docs/**"
+---
+A flow
+`),
+				"flow/two.md": []byte(`---
+on: push
+match:
+  branch: main
+unless: event.head_commit.message == "wip"
+---
+A flow
+`),
+				"flow/three.md": []byte(`---
+on: push
+match:
+  branch_not: main
+---
+A flow
+`),
+				"flow/four.md": []byte(`---
+on: push
+match:
+  repo_not: hiphops-io/hops
+if: event.forced
+---
+A flow
+`),
+				"flow/five.md": []byte(`---
+on: push
+match:
+  actor: "*[bot]"
+  paths_not: ["**/*.md"]
+---
+A flow
+`),
+			},
+			event: setupTestMsg("github", "push", "", map[string]any{
+				"ref":         "refs/heads/release/1.2",
+				"forced":      true,
+				"repository":  map[string]any{"full_name": "hiphops-io/hops"},
+				"sender":      map[string]any{"login": "octocat"},
+				"head_commit": map[string]any{"message": "wip"},
+				"commits": []any{
+					map[string]any{"added": []any{"docs/guide.md"}, "modified": []any{}, "removed": []any{}},
+				},
+			}),
+			expectedIDs: []string{"flow.one", "flow.three"},
+		},
+
+		{
+			name: "Match labels",
+			source: map[string][]byte{
+				"flow/one.md": []byte(`---
+on: pull_request
+match:
+  branch: main
+  labels_any: [deploy, "release-*"]
+---
+A flow
+`),
+				"flow/two.md": []byte(`---
+on: pull_request
+match:
+  labels_none: [wip]
+---
+A flow
+`),
+				"flow/three.md": []byte(`---
+on: issues
+match:
+  labels_none: [wip]
+---
+A flow
+`),
+			},
+			event: setupTestMsg("github", "pull_request", "labeled", map[string]any{
+				"pull_request": map[string]any{
+					"base":   map[string]any{"ref": "main"},
+					"labels": []any{map[string]any{"name": "release-1.2"}, map[string]any{"name": "wip"}},
+				},
+			}),
+			expectedIDs: []string{"flow.one"},
+		},
+
+		{
+			name: "Invalid logical operand",
+			source: map[string][]byte{
+				"flow/one.md": []byte(`---
+on: "pull_request"
+if: event.data && true
+---
+A flow
+`),
+			},
+			event:       setupTestMsg("github", "pull_request", "closed", map[string]any{"data": "hello"}),
+			expectError: true,
+		},
+
 		{
 			name: "Invalid conditional with non-existent key",
 			source: map[string][]byte{
@@ -128,9 +368,12 @@ A flow
 			err := flowReader.ReadAll()
 			require.NoError(t, err, "Test setup: Failed to read flows")
 
-			matchedFlows, err := MatchFlows(flowReader.IndexedSensors(), tc.event, nil)
+			matchedFlows, err := MatchFlows(context.Background(), flowReader.IndexedSensors(), tc.event, nil)
 			if tc.expectError {
-				assert.Error(t, err, "Invalid flows should return an error")
+				ifErr := &IfError{}
+				if assert.ErrorAs(t, err, &ifErr, "Invalid flows should return an error") {
+					assert.Equal(t, "flow.one", ifErr.FlowID, "Errors should say which flow failed")
+				}
 				return
 			} else {
 				assert.NoError(t, err, "Valid flow & event should not return error")
@@ -146,6 +389,57 @@ A flow
 	}
 }
 
+func TestEvaluateFlows(t *testing.T) {
+	flowsDir := setupPopulatedTestDir(t, map[string][]byte{
+		"flow/matched.md": []byte(`---
+on: "pull_request"
+if: event.action == "closed"
+---
+A flow
+`),
+		"flow/unmatched.md": []byte(`---
+on: "pull_request"
+if: event.action == "opened"
+---
+A flow
+`),
+		"flow/invalid.md": []byte(`---
+on: "pull_request"
+if: event.no_such_key != "hello"
+---
+A flow
+`),
+		"flow/other.md": []byte(`---
+on: "push"
+---
+A flow for other events
+`),
+	})
+	flowReader := NewFlowReader(flowsDir)
+	require.NoError(t, flowReader.ReadAll(), "Test setup: Failed to read flows")
+
+	event := setupTestMsg("github", "pull_request", "closed", map[string]any{"action": "closed"})
+	decisions, err := EvaluateFlows(context.Background(), flowReader.IndexedSensors(), event, nil)
+	require.NoError(t, err, "Flows that fail to evaluate shouldn't stop the rest being decided")
+
+	byID := map[string]FlowDecision{}
+	for _, d := range decisions {
+		byID[d.Flow.ID] = d
+	}
+	require.Len(t, byID, 3, "Only flows triggered by the event should be decided")
+
+	assert.True(t, byID["flow.matched"].Matched)
+	assert.NoError(t, byID["flow.matched"].Err)
+	assert.False(t, byID["flow.unmatched"].Matched)
+	assert.NoError(t, byID["flow.unmatched"].Err)
+
+	assert.False(t, byID["flow.invalid"].Matched)
+	ifErr := &IfError{}
+	if assert.ErrorAs(t, byID["flow.invalid"].Err, &ifErr) {
+		assert.Equal(t, "flow.invalid", ifErr.FlowID)
+	}
+}
+
 func setupTestMsg(source, event, action string, data map[string]any) *nats.HopsMsg {
 	payload := map[string]any{
 		"hops": map[string]any{
@@ -166,3 +460,140 @@ func setupTestMsg(source, event, action string, data map[string]any) *nats.HopsM
 		Data:   payload,
 	}
 }
+
+func TestMatchFlowsTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := tracing.NewTracerProvider(exporter, "", 1)
+	tracing.SetDefault(tp)
+	t.Cleanup(func() {
+		tracing.SetDefault(nil)
+		tp.Shutdown(context.Background())
+	})
+
+	flowsDir := setupPopulatedTestDir(t, map[string][]byte{
+		"flow/one.md": []byte(`---
+on: "pull_request"
+if: event.action == "closed"
+---
+A flow
+`),
+		"flow/two.md": []byte(`---
+on: "pull_request"
+---
+A flow without conditions
+`),
+	})
+	flowReader := NewFlowReader(flowsDir)
+	require.NoError(t, flowReader.ReadAll(), "Test setup: Failed to read flows")
+
+	ctx, parent := tracing.Start(context.Background(), "parent")
+	_, err := MatchFlows(ctx, flowReader.IndexedSensors(), setupTestMsg("github", "pull_request", "opened", map[string]any{"action": "opened"}), nil)
+	require.NoError(t, err)
+	parent.End()
+
+	require.NoError(t, tp.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3, "Only flows with conditions should have 'if' spans")
+
+	ifSpan, matchSpan := spans[0], spans[1]
+	assert.Equal(t, "hops.match", matchSpan.Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), matchSpan.Parent.SpanID())
+	assert.ElementsMatch(t, []attribute.KeyValue{attribute.Int("hops.candidates", 2), attribute.Int("hops.matched", 1)}, matchSpan.Attributes)
+
+	assert.Equal(t, "hops.if", ifSpan.Name)
+	assert.Equal(t, matchSpan.SpanContext.SpanID(), ifSpan.Parent.SpanID())
+	assert.ElementsMatch(t, []attribute.KeyValue{attribute.String("hops.flow", "flow.one"), attribute.Bool("hops.matched", false)}, ifSpan.Attributes)
+}
+
+// BenchmarkMatchFlows measures matching a large push event against many flows
+// with conditions in common, as for high-volume sources
+func BenchmarkMatchFlows(b *testing.B) {
+	source := map[string][]byte{}
+	for i := 0; i < 50; i++ {
+		source[fmt.Sprintf("flow/flow%d.md", i)] = []byte(fmt.Sprintf(`---
+on: push
+if: event.repository.name == "hops" && event.ref == "refs/heads/branch-%d"
+---
+A flow
+`, i))
+	}
+
+	flowReader := NewFlowReader(setupPopulatedTestDir(b, source))
+	require.NoError(b, flowReader.ReadAll(), "Benchmark setup: Failed to read flows")
+	flowIdx := flowReader.IndexedSensors()
+
+	data := map[string]any{
+		"ref": "refs/heads/branch-7",
+		"repository": map[string]any{
+			"name":      "hops",
+			"full_name": "hiphops-io/hops",
+			"id":        json.Number("123456789012"),
+		},
+	}
+	commits := make([]any, 200)
+	for i := range commits {
+		commits[i] = map[string]any{
+			"id":       fmt.Sprintf("%040d", i),
+			"message":  "Fix all the things",
+			"added":    []any{"README.md", "markdown/evaluate.go"},
+			"modified": []any{"go.mod", "go.sum"},
+			"author":   map[string]any{"name": "Octocat", "email": "octocat@example.com"},
+		}
+	}
+	data["commits"] = commits
+
+	pushMsg := setupTestMsg("github", "push", "", data)
+	otherMsg := setupTestMsg("github", "issues", "opened", data)
+
+	b.Run("Lazy conversion", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			matched, err := MatchFlows(context.Background(), flowIdx, pushMsg, nil)
+			if err != nil || len(matched) != 1 {
+				b.Fatalf("Expected a single match, got %d: %v", len(matched), err)
+			}
+		}
+	})
+
+	b.Run("Full conversion", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			evalCtx, err := EventEvalContext(pushMsg)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			matched, err := MatchFlows(context.Background(), flowIdx, pushMsg, evalCtx)
+			if err != nil || len(matched) != 1 {
+				b.Fatalf("Expected a single match, got %d: %v", len(matched), err)
+			}
+		}
+	})
+
+	b.Run("Without cache", func(b *testing.B) {
+		b.ReportAllocs()
+		flows := flowIdx["*.push.*"]
+		for n := 0; n < b.N; n++ {
+			evalCtx, err := flowsEvalContext(flows, pushMsg)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			for _, f := range flows {
+				if _, err := f.IfValue(evalCtx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("No candidate flows", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			matched, err := MatchFlows(context.Background(), flowIdx, otherMsg, nil)
+			if err != nil || len(matched) != 0 {
+				b.Fatalf("Expected no matches, got %d: %v", len(matched), err)
+			}
+		}
+	})
+}
@@ -2,77 +2,150 @@ package markdown
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
 	"github.com/zclconf/go-cty/cty/gocty"
 	"go.abhg.dev/goldmark/frontmatter"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
+
+	"github.com/hiphops-io/hops/expression/ctyconv"
+	"github.com/hiphops-io/hops/expression/funcs"
+	"github.com/hiphops-io/hops/internal/tracing"
 )
 
+// maxFlowFileSize is the largest sibling file of a flow that is loaded for
+// use by file() and template(), larger files are skipped
+const maxFlowFileSize = 1 << 20
+
 type (
+	// Approval requires a human to approve a flow in slack before it is dispatched
+	Approval struct {
+		// Channel is the slack channel the approval request is posted to
+		Channel string `yaml:"channel" validate:"required"`
+		// Approvers are the slack user IDs allowed to approve, such as U012AB3CD.
+		// Usernames aren't accepted as users can change them. Anyone in the
+		// channel may approve if empty
+		Approvers []string `yaml:"approvers" validate:"dive,slack_user_id"`
+	}
+
 	Command []ParamItem
 
 	Flow struct {
-		If       string  `yaml:"if"`
-		Command  Command `yaml:"command" validate:"required_without_all=On Schedule,omitempty,command"`
-		On       string  `yaml:"on" validate:"required_without_all=Command Schedule"`
-		Schedule string  `yaml:"schedule" validate:"required_without_all=On Command,omitempty,standard_cron"`
-		Worker   string  `yaml:"worker"`
+		Approval *Approval `yaml:"approval"`
+		If       string    `yaml:"if"`
+		// Unless is an expression that stops the flow from running if it's true
+		Unless string `yaml:"unless"`
+		// Match is shorthand for common conditions, combined with If and Unless
+		Match Match `yaml:"match"`
+		// Inputs are expressions evaluated against the triggering event, with the
+		// results sent to the worker under the hops.inputs key of the event
+		Inputs   map[string]string `yaml:"inputs"`
+		Command  Command           `yaml:"command" validate:"required_without_all=On Schedule,omitempty,command"`
+		On       string            `yaml:"on" validate:"required_without_all=Command Schedule"`
+		Schedule string            `yaml:"schedule" validate:"required_without_all=On Command,omitempty,standard_cron"`
+		Worker   string            `yaml:"worker"`
 		// Computed fields
-		ID           string
-		dirName      string
-		fileName     string
-		ifExpression hcl.Expression
-		markdown     []byte
-		md           *Markdown
-		path         string
+		ID        string
+		dirName   string
+		fileName  string
+		functions map[string]function.Function
+		// ifCompiled combines the flow's match, if and unless conditions
+		ifCompiled  *compiledExpr
+		ifPaths     *eventPaths
+		ifSensitive bool
+		inputExprs  map[string]hcl.Expression
+		markdown    []byte
+		md          *Markdown
+		path        string
 	}
 
 	FlowIndex struct {
 		Commands  map[string]*Flow
+		Flows     map[string]*Flow
 		Schedules []*Flow
 		Sensors   map[string][]*Flow
 	}
 
 	FlowReader struct {
 		basePath   string
+		envAllow   funcs.EnvAllowList
 		index      FlowIndex
 		indexMutex sync.RWMutex
 		md         *Markdown
+		secrets    funcs.SecretProvider
 	}
 
+	FlowReaderOpt func(*FlowReader)
+
 	ParamItem map[string]Param
 
 	Param struct {
-		Type     string `yaml:"type" validate:"oneof=string text number bool"`
-		Default  any    `yaml:"default"`
-		Required bool   `yaml:"required"`
+		Type        string   `yaml:"type" validate:"oneof=string text number bool select multiselect date datetime user channel conversation"`
+		Default     any      `yaml:"default"`
+		Required    bool     `yaml:"required"`
+		Options     []string `yaml:"options"`
+		OptionsFrom string   `yaml:"options_from"`
 	}
 )
 
+// Date formats accepted for the defaults of date and datetime params
+const (
+	ParamDateFormat     = "2006-01-02"
+	ParamDateTimeFormat = time.RFC3339
+)
+
 func NewFlowIndex() FlowIndex {
 	return FlowIndex{
 		Sensors:   map[string][]*Flow{},
 		Commands:  map[string]*Flow{},
+		Flows:     map[string]*Flow{},
 		Schedules: []*Flow{},
 	}
 }
 
-func NewFlowReader(basePath string) *FlowReader {
-	return &FlowReader{
+func NewFlowReader(basePath string, opts ...FlowReaderOpt) *FlowReader {
+	fr := &FlowReader{
 		basePath: basePath,
 		index:    NewFlowIndex(),
 		md:       NewMarkdown(),
 	}
+
+	for _, opt := range opts {
+		opt(fr)
+	}
+
+	return fr
+}
+
+// WithEnvAllowListOpt sets the env vars that flows can read with env()
+func WithEnvAllowListOpt(allowed []string) FlowReaderOpt {
+	return func(fr *FlowReader) {
+		fr.envAllow = allowed
+	}
+}
+
+// WithSecretProviderOpt sets the provider of secrets read by flows with secret()
+func WithSecretProviderOpt(provider funcs.SecretProvider) FlowReaderOpt {
+	return func(fr *FlowReader) {
+		fr.secrets = provider
+	}
 }
 
 // IndexedCommands returns all indexed flows that are triggered by commands
@@ -82,6 +155,21 @@ func (fr *FlowReader) IndexedCommands() map[string]*Flow {
 	return fr.index.Commands
 }
 
+// IndexedFlow returns the indexed flow with the given ID
+func (fr *FlowReader) IndexedFlow(id string) (*Flow, bool) {
+	fr.indexMutex.RLock()
+	defer fr.indexMutex.RUnlock()
+	flow, ok := fr.index.Flows[id]
+	return flow, ok
+}
+
+// IndexedFlows returns all indexed flows, keyed by ID
+func (fr *FlowReader) IndexedFlows() map[string]*Flow {
+	fr.indexMutex.RLock()
+	defer fr.indexMutex.RUnlock()
+	return fr.index.Flows
+}
+
 // IndexedSchedules returns all indexed flows that are triggered by a schedule
 func (fr *FlowReader) IndexedSchedules() []*Flow {
 	fr.indexMutex.RLock()
@@ -176,13 +264,62 @@ func (fr *FlowReader) ReadFlow(path string) (*Flow, error) {
 		f.Worker = fmt.Sprintf("%s.%s", flowDirName, f.Worker)
 	}
 
-	if f.If != "" {
-		expr, diags := hclsyntax.ParseExpression([]byte(f.If), path, hcl.InitialPos)
+	files, err := readFlowFiles(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load files for flow: %w", err)
+	}
+
+	f.functions = map[string]function.Function{
+		"env":      funcs.EnvFunc(fr.envAllow),
+		"file":     funcs.FileFunc(files, ""),
+		"secret":   funcs.SecretFunc(fr.secrets),
+		"template": funcs.TemplateFunc(files, ""),
+	}
+	f.ifPaths = newEventPaths()
+
+	if err := fr.compileConditions(f); err != nil {
+		return nil, err
+	}
+
+	f.inputExprs = make(map[string]hcl.Expression, len(f.Inputs))
+	for name, input := range f.Inputs {
+		expr, diags := hclsyntax.ParseExpression([]byte(input), path, hcl.InitialPos)
 		if diags.HasErrors() {
-			return nil, errors.Join(diags.Errs()...)
+			return nil, fmt.Errorf("invalid expression for input '%s': %w", name, errors.Join(diags.Errs()...))
+		}
+
+		// Inputs are sent in work messages, which are kept in the work stream,
+		// so must never contain secrets
+		sensitive, err := fr.validateExprAccess(expr)
+		if err == nil && sensitive {
+			err = errors.New("secret() can't be used, as inputs are stored in work messages")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression for input '%s': %w", name, err)
 		}
 
-		f.ifExpression = expr
+		f.inputExprs[name] = expr
+	}
+
+	for _, p := range f.Command {
+		name, param := p.Param()
+		if param.OptionsFrom == "" {
+			continue
+		}
+
+		expr, diags := hclsyntax.ParseExpression([]byte(param.OptionsFrom), path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("invalid 'options_from' for param '%s': %w", name, errors.Join(diags.Errs()...))
+		}
+
+		// Options are shown to users, so must never contain secrets
+		sensitive, err := fr.validateExprAccess(expr)
+		if err == nil && sensitive {
+			err = errors.New("secret() can't be used, as options are shown to users")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'options_from' for param '%s': %w", name, err)
+		}
 	}
 
 	if err := flowValidator.validate.Struct(f); err != nil {
@@ -192,7 +329,66 @@ func (fr *FlowReader) ReadFlow(path string) (*Flow, error) {
 	return f, nil
 }
 
+// compileConditions combines the match, if and unless conditions of a flow
+// into the single expression that decides if it runs
+func (fr *FlowReader) compileConditions(f *Flow) error {
+	conditions := []*compiledExpr{}
+
+	matchExprs, err := f.Match.Expressions()
+	if err != nil {
+		return fmt.Errorf("invalid 'match': %w", err)
+	}
+
+	for _, src := range matchExprs {
+		expr, diags := hclsyntax.ParseExpression([]byte(src), f.path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return fmt.Errorf("invalid 'match': %w", errors.Join(diags.Errs()...))
+		}
+
+		f.ifPaths.addExpr(expr)
+		conditions = append(conditions, compileExpr(expr, src))
+	}
+
+	for _, field := range []struct {
+		name   string
+		src    string
+		negate bool
+	}{
+		{name: "if", src: f.If},
+		{name: "unless", src: f.Unless, negate: true},
+	} {
+		if field.src == "" {
+			continue
+		}
+
+		expr, diags := hclsyntax.ParseExpression([]byte(field.src), f.path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return fmt.Errorf("invalid '%s' expression: %w", field.name, errors.Join(diags.Errs()...))
+		}
+
+		sensitive, err := fr.validateExprAccess(expr)
+		if err != nil {
+			return fmt.Errorf("invalid '%s' expression: %w", field.name, err)
+		}
+
+		f.ifPaths.addExpr(expr)
+		f.ifSensitive = f.ifSensitive || sensitive
+
+		condition := compileExpr(expr, field.src)
+		if field.negate {
+			condition = notExpr(condition)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	f.ifCompiled = allExprs(conditions)
+
+	return nil
+}
+
 func (fr *FlowReader) indexFlow(flow *Flow) error {
+	fr.index.Flows[flow.ID] = flow
+
 	// Create index for sensor
 	// Convert the `on` statement from shorthand syntax to full
 	var on string
@@ -245,6 +441,12 @@ func (f *Flow) ActionName() string {
 	return strings.ReplaceAll(f.ID, ".", "-")
 }
 
+// IsApprover returns true if the slack user with the given ID may approve
+// the flow
+func (a *Approval) IsApprover(userID string) bool {
+	return len(a.Approvers) == 0 || slices.Contains(a.Approvers, userID)
+}
+
 func (f *Flow) DisplayName() string {
 	if strings.ToLower(f.fileName) == "index" {
 		return titleCase(f.dirName)
@@ -253,14 +455,33 @@ func (f *Flow) DisplayName() string {
 	return titleCase(f.ID)
 }
 
+// EvalContext scopes an evaluation context to the flow, adding the file() and
+// template() functions for files in the flow's directory
+func (f *Flow) EvalContext(evalCtx *hcl.EvalContext) *hcl.EvalContext {
+	if evalCtx == nil {
+		evalCtx = &hcl.EvalContext{}
+	}
+
+	flowCtx := evalCtx.NewChild()
+	flowCtx.Functions = f.functions
+
+	return flowCtx
+}
+
 func (f *Flow) IfValue(evalCtx *hcl.EvalContext) (bool, error) {
-	if f.If == "" {
+	return f.ifValue(evalCtx, nil)
+}
+
+// ifValue evaluates the flow's conditions, sharing the values of expressions
+// with other flows evaluated against the same event via cache
+func (f *Flow) ifValue(evalCtx *hcl.EvalContext, cache exprCache) (bool, error) {
+	if f.ifCompiled == nil {
 		return true, nil
 	}
 
-	ifVal, diags := f.ifExpression.Value(evalCtx)
+	ifVal, diags := f.ifCompiled.Value(f.EvalContext(evalCtx), cache)
 	if diags.HasErrors() {
-		return false, errors.Join(diags.Errs()...)
+		return false, diagsError(diags, f.ifSensitive)
 	}
 
 	var matches bool
@@ -272,6 +493,59 @@ func (f *Flow) IfValue(evalCtx *hcl.EvalContext) (bool, error) {
 	return matches, nil
 }
 
+// tracedIfValue evaluates the flow's conditions in a span, if it has any
+func (f *Flow) tracedIfValue(ctx context.Context, evalCtx *hcl.EvalContext, cache exprCache) (bool, error) {
+	if f.ifCompiled == nil {
+		return true, nil
+	}
+
+	_, span := tracing.Start(ctx, "hops.if", trace.WithAttributes(attribute.String("hops.flow", f.ID)))
+	defer span.End()
+
+	matches, err := f.ifValue(evalCtx, cache)
+	span.SetAttributes(attribute.Bool("hops.matched", matches))
+	tracing.RecordError(span, err)
+
+	return matches, err
+}
+
+// InputValues evaluates the flow's inputs against an event's evaluation context,
+// returning nil if the flow has no inputs
+func (f *Flow) InputValues(evalCtx *hcl.EvalContext) (map[string]any, error) {
+	if len(f.inputExprs) == 0 {
+		return nil, nil
+	}
+
+	flowCtx := f.EvalContext(evalCtx)
+	inputs := make(map[string]any, len(f.inputExprs))
+
+	for name, expr := range f.inputExprs {
+		val, diags := expr.Value(flowCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("unable to evaluate input '%s': %w", name, errors.Join(diags.Errs()...))
+		}
+
+		input, err := ctyconv.CtyValueToInterface(val)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert input '%s': %w", name, err)
+		}
+
+		inputs[name] = input
+	}
+
+	return inputs, nil
+}
+
+// HTML renders the flow's description as HTML
+func (f *Flow) HTML() (string, error) {
+	var b bytes.Buffer
+	if _, err := f.md.HTML(f.markdown, &b); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
 func (f *Flow) Markdown() (string, error) {
 	var b bytes.Buffer
 	if _, err := f.md.Markdown(f.markdown, &b); err != nil {
@@ -301,6 +575,116 @@ func (pi *ParamItem) Param() (string, Param) {
 	return "", Param{}
 }
 
+// HasOptions returns true if the param type is chosen from a list of options
+func (p Param) HasOptions() bool {
+	return p.Type == "select" || p.Type == "multiselect"
+}
+
+// OptionAllowed checks a value is one of the param's static options
+//
+// Options from expressions are only known at runtime, so any value is allowed
+func (p Param) OptionAllowed(value string) bool {
+	if p.OptionsFrom != "" {
+		return true
+	}
+
+	return slices.Contains(p.Options, value)
+}
+
+// Param returns the command's param with the given name, if it has one
+func (c Command) Param(name string) (Param, bool) {
+	for _, pi := range c {
+		if n, param := pi.Param(); n == name {
+			return param, true
+		}
+	}
+
+	return Param{}, false
+}
+
+// OptionValues returns the options available for a select or multiselect param
+//
+// Static options are returned as-is, whereas options_from is evaluated as an
+// expression against the given context and must produce a list of values that
+// can be converted to strings.
+func (p Param) OptionValues(evalCtx *hcl.EvalContext) ([]string, error) {
+	if p.OptionsFrom == "" {
+		return p.Options, nil
+	}
+
+	expr, diags := hclsyntax.ParseExpression([]byte(p.OptionsFrom), "options_from", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, errors.Join(diags.Errs()...)
+	}
+
+	optionsVal, diags := expr.Value(evalCtx)
+	if diags.HasErrors() {
+		return nil, errors.Join(diags.Errs()...)
+	}
+
+	if optionsVal.IsNull() || !optionsVal.IsWhollyKnown() {
+		return []string{}, nil
+	}
+
+	if !optionsVal.CanIterateElements() {
+		return nil, fmt.Errorf("'options_from' must evaluate to a list, got %s", optionsVal.Type().FriendlyName())
+	}
+
+	options := []string{}
+	for it := optionsVal.ElementIterator(); it.Next(); {
+		_, v := it.Element()
+
+		strVal, err := convert.Convert(v, cty.String)
+		if err != nil {
+			return nil, fmt.Errorf("'options_from' values must be strings: %w", err)
+		}
+		if strVal.IsNull() {
+			continue
+		}
+
+		options = append(options, strVal.AsString())
+	}
+
+	return options, nil
+}
+
+// readFlowFiles reads the sibling files of flows in a directory, keyed by
+// file name
+//
+// Hidden files and sub-directories are skipped, as are files over maxFlowFileSize
+func readFlowFiles(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+
+	for _, de := range entries {
+		if !de.Type().IsRegular() || strings.HasPrefix(de.Name(), ".") {
+			continue
+		}
+
+		info, err := de.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Size() > maxFlowFileSize {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, de.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		files[de.Name()] = content
+	}
+
+	return files, nil
+}
+
 var titleCaseReplacer = strings.NewReplacer("_", " ", ".", " ")
 
 func titleCase(label string) string {
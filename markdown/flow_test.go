@@ -1,9 +1,16 @@
 package markdown
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hiphops-io/hops/expression/funcs"
 )
 
 func TestFlowReader(t *testing.T) {
@@ -37,7 +44,7 @@ This is a basic flow that runs on closed PRs
 						ID:       "first_flow.hello",
 						If:       `event.branch == "main"`,
 						Command: Command{
-							{"p": Param{"text", "Hello", false}},
+							{"p": Param{Type: "text", Default: "Hello", Required: false}},
 						},
 					},
 				},
@@ -49,7 +56,7 @@ This is a basic flow that runs on closed PRs
 						ID:       "first_flow.hello",
 						If:       `event.branch == "main"`,
 						Command: Command{
-							{"p": Param{"text", "Hello", false}},
+							{"p": Param{Type: "text", Default: "Hello", Required: false}},
 						},
 					},
 				},
@@ -61,7 +68,7 @@ This is a basic flow that runs on closed PRs
 						ID:       "first_flow.hello",
 						If:       `event.branch == "main"`,
 						Command: Command{
-							{"p": Param{"text", "Hello", false}},
+							{"p": Param{Type: "text", Default: "Hello", Required: false}},
 						},
 					},
 				},
@@ -257,6 +264,205 @@ command:
 - foo: {type: "number", default: "Hello!"}
 ---
 Flow
+`),
+			},
+			expectError: true,
+		},
+
+		{
+			name: "Select and picker params",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+command:
+- env: {type: select, options: [dev, prod], default: dev}
+- regions: {type: multiselect, options_from: 'split(",", "eu,us")', default: [eu]}
+- on_date: {type: date, default: "2024-06-01"}
+- at: {type: datetime, default: "2024-06-01T09:00:00Z"}
+- approver: {type: user}
+- notify: {type: channel}
+- where: {type: conversation}
+---
+Flow
+`),
+			},
+			expected: map[string][]*Flow{
+				"*.command.first_flow-hello": {
+					{
+						Worker: "first_flow.hello",
+						ID:     "first_flow.hello",
+						Command: Command{
+							{"env": Param{Type: "select", Default: "dev", Options: []string{"dev", "prod"}}},
+							{"regions": Param{Type: "multiselect", Default: []any{"eu"}, OptionsFrom: `split(",", "eu,us")`}},
+							{"on_date": Param{Type: "date", Default: "2024-06-01"}},
+							{"at": Param{Type: "datetime", Default: "2024-06-01T09:00:00Z"}},
+							{"approver": Param{Type: "user"}},
+							{"notify": Param{Type: "channel"}},
+							{"where": Param{Type: "conversation"}},
+						},
+					},
+				},
+			},
+		},
+
+		{
+			name: "Select param without options",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+command:
+- foo: {type: "select"}
+---
+Flow
+`),
+			},
+			expectError: true,
+		},
+
+		{
+			name: "Select param with static and expression options",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+command:
+- foo: {type: "select", options: [a], options_from: '["b"]'}
+---
+Flow
+`),
+			},
+			expectError: true,
+		},
+
+		{
+			name: "Select default not in options",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+command:
+- foo: {type: "select", options: [a, b], default: c}
+---
+Flow
+`),
+			},
+			expectError: true,
+		},
+
+		{
+			name: "Multiselect default not a list",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+command:
+- foo: {type: "multiselect", options: [a, b], default: a}
+---
+Flow
+`),
+			},
+			expectError: true,
+		},
+
+		{
+			name: "Too many select options",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+command:
+- foo: {type: "select", options: [` + strings.Repeat("a, ", MaxParamOptions) + `a]}
+---
+Flow
+`),
+			},
+			expectError: true,
+		},
+
+		{
+			name: "Invalid options expression",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+command:
+- foo: {type: "select", options_from: 'split(",",'}
+---
+Flow
+`),
+			},
+			expectError: true,
+		},
+
+		{
+			name: "Options on non-select param",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+command:
+- foo: {type: "string", options: [a, b]}
+---
+Flow
+`),
+			},
+			expectError: true,
+		},
+
+		{
+			name: "Invalid date default",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+command:
+- foo: {type: "date", default: "01/06/2024"}
+---
+Flow
+`),
+			},
+			expectError: true,
+		},
+
+		{
+			name: "Invalid datetime default",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+command:
+- foo: {type: "datetime", default: "2024-06-01"}
+---
+Flow
+`),
+			},
+			expectError: true,
+		},
+
+		{
+			name: "Flow with approval",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+on: "github.pull_request.closed"
+approval: {channel: "#deploys", approvers: ["U012AB3CD", "W0123ABCD"]}
+---
+Flow
+`),
+			},
+			expected: map[string][]*Flow{
+				"github.pull_request.closed": {
+					{
+						On:       "github.pull_request.closed",
+						Worker:   "first_flow.hello",
+						ID:       "first_flow.hello",
+						Approval: &Approval{Channel: "#deploys", Approvers: []string{"U012AB3CD", "W0123ABCD"}},
+					},
+				},
+			},
+		},
+
+		{
+			name: "Approval without channel",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+on: "github.pull_request.closed"
+approval: {approvers: ["U012AB3CD"]}
+---
+Flow
+`),
+			},
+			expectError: true,
+		},
+		{
+			name: "Approval by username",
+			source: map[string][]byte{
+				"first_flow/hello.md": []byte(`---
+on: "github.pull_request.closed"
+approval: {channel: "#deploys", approvers: ["@casey"]}
+---
+Flow
 `),
 			},
 			expectError: true,
@@ -289,3 +495,307 @@ Flow
 		})
 	}
 }
+
+func TestParamOptionValues(t *testing.T) {
+	type testCase struct {
+		name        string
+		param       Param
+		expected    []string
+		expectError bool
+	}
+
+	evalCtx := &hcl.EvalContext{
+		Functions: funcs.DefaultFunctions,
+		Variables: map[string]cty.Value{
+			"event": cty.ObjectVal(map[string]cty.Value{
+				"envs": cty.TupleVal([]cty.Value{cty.StringVal("dev"), cty.StringVal("prod")}),
+				"ids":  cty.TupleVal([]cty.Value{cty.NumberIntVal(1), cty.NumberIntVal(2)}),
+			}),
+		},
+	}
+
+	tests := []testCase{
+		{
+			name:     "Static options",
+			param:    Param{Type: "select", Options: []string{"a", "b"}},
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "Options from event",
+			param:    Param{Type: "select", OptionsFrom: "event.envs"},
+			expected: []string{"dev", "prod"},
+		},
+		{
+			name:     "Options from function",
+			param:    Param{Type: "multiselect", OptionsFrom: `split(",", "a,b,c")`},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name:     "Numeric options are converted",
+			param:    Param{Type: "select", OptionsFrom: "event.ids"},
+			expected: []string{"1", "2"},
+		},
+		{
+			name:        "Options must be a list",
+			param:       Param{Type: "select", OptionsFrom: `"a"`},
+			expectError: true,
+		},
+		{
+			name:        "Options must be strings",
+			param:       Param{Type: "select", OptionsFrom: `[{a = 1}]`},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			options, err := tc.param.OptionValues(evalCtx)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expected, options)
+			}
+		})
+	}
+}
+
+func TestApprovalIsApprover(t *testing.T) {
+	restricted := &Approval{Channel: "#deploys", Approvers: []string{"U012AB3CD"}}
+	open := &Approval{Channel: "#deploys"}
+
+	assert.True(t, restricted.IsApprover("U012AB3CD"), "Approvers should match by user ID")
+	assert.False(t, restricted.IsApprover("U999"), "Unlisted users should not be approvers")
+	assert.True(t, open.IsApprover("U999"), "Anyone should approve when no approvers are listed")
+}
+
+func TestFlowInputValues(t *testing.T) {
+	type testCase struct {
+		name            string
+		inputs          string
+		data            map[string]any
+		expected        map[string]any
+		expectReadError bool
+		expectError     bool
+	}
+
+	tests := []testCase{
+		{
+			name:     "No inputs",
+			expected: nil,
+		},
+		{
+			name: "Computed inputs",
+			inputs: `
+  branch: event.ref
+  short_sha: substr(event.sha, 0, 7)
+  is_release: length(regex("^release/", event.ref)) > 0
+  labels: "[for l in event.labels : upper(l)]"
+  config: file("config.txt")
+  missing: try(event.nope, null)`,
+			data: map[string]any{
+				"ref":    "release/1.2",
+				"sha":    "0123456789abcdef",
+				"labels": []any{"bug", "urgent"},
+			},
+			expected: map[string]any{
+				"branch":     "release/1.2",
+				"short_sha":  "0123456",
+				"is_release": true,
+				"labels":     []any{"BUG", "URGENT"},
+				"config":     "debug=true",
+				"missing":    nil,
+			},
+		},
+		{
+			name:            "Invalid expression",
+			inputs:          "\n  branch: event..ref",
+			expectReadError: true,
+		},
+		{
+			name:        "Failing expression",
+			inputs:      "\n  branch: event.no_such_key",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			source := "---\non: push\n"
+			if tc.inputs != "" {
+				source += "inputs:" + tc.inputs + "\n"
+			}
+			source += "---\nFlow\n"
+
+			flowsDir := setupPopulatedTestDir(t, map[string][]byte{
+				"flow/one.md":     []byte(source),
+				"flow/config.txt": []byte("debug=true"),
+			})
+
+			flow, err := NewFlowReader(flowsDir).ReadFlow(filepath.Join(flowsDir, "flow", "one.md"))
+			if tc.expectReadError {
+				assert.Error(t, err, "Invalid input expressions should fail at load")
+				return
+			}
+			require.NoError(t, err)
+
+			evalCtx, err := EventEvalContext(setupTestMsg("github", "push", "", tc.data))
+			require.NoError(t, err)
+
+			inputs, err := flow.InputValues(evalCtx)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, inputs)
+		})
+	}
+}
+
+func TestFlowExpressionAccess(t *testing.T) {
+	t.Setenv("DEPLOY_ENV", "production")
+	t.Setenv("APP_REGION", "eu-west-1")
+
+	secrets := funcs.EnvSecretProvider{Prefix: "TEST_SECRET_"}
+	t.Setenv("TEST_SECRET_webhook_token", "s3cr3t")
+
+	tests := []struct {
+		name            string
+		frontmatter     string
+		data            map[string]any
+		expectReadError bool
+		expectIfError   bool
+		expectedIf      bool
+		expectedInputs  map[string]any
+	}{
+		{
+			name:        "Allowed env vars",
+			frontmatter: "if: env(\"DEPLOY_ENV\", \"\") == \"production\"\ninputs:\n  region: env(\"APP_REGION\", \"us-east-1\")",
+			expectedIf:  true,
+			expectedInputs: map[string]any{
+				"region": "eu-west-1",
+			},
+		},
+		{
+			name:            "Env var not in allow list",
+			frontmatter:     "if: env(\"HOME\", \"\") != \"\"",
+			expectReadError: true,
+		},
+		{
+			name:            "Env var not in allow list in inputs",
+			frontmatter:     "inputs:\n  token: env(\"SLACK_TOKEN\", \"\")",
+			expectReadError: true,
+		},
+		{
+			name:            "Env var name not literal",
+			frontmatter:     "if: env(event.name, \"\") != \"\"",
+			expectReadError: true,
+		},
+		{
+			name:        "Secret",
+			frontmatter: "if: event.token == secret(\"webhook_token\")",
+			data:        map[string]any{"token": "s3cr3t"},
+			expectedIf:  true,
+		},
+		{
+			name:            "Missing secret",
+			frontmatter:     "if: event.token == secret(\"nope\")",
+			expectReadError: true,
+		},
+		{
+			name:            "Secret in options",
+			frontmatter:     "command:\n  - token:\n      type: select\n      options_from: '[secret(\"webhook_token\")]'",
+			expectReadError: true,
+		},
+		{
+			name:            "Secret in inputs",
+			frontmatter:     "inputs:\n  token: secret(\"webhook_token\")",
+			expectReadError: true,
+		},
+		{
+			name:          "Secret errors are redacted",
+			frontmatter:   "if: tonumber(secret(\"webhook_token\")) > 1",
+			expectIfError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			flowsDir := setupPopulatedTestDir(t, map[string][]byte{
+				"flow/one.md": []byte("---\non: push\n" + tc.frontmatter + "\n---\nFlow\n"),
+			})
+
+			flowReader := NewFlowReader(
+				flowsDir,
+				WithEnvAllowListOpt([]string{"DEPLOY_ENV", "APP_*"}),
+				WithSecretProviderOpt(secrets),
+			)
+
+			flow, err := flowReader.ReadFlow(filepath.Join(flowsDir, "flow", "one.md"))
+			if tc.expectReadError {
+				assert.Error(t, err, "Flows should fail at load if they can't read env vars or secrets")
+				return
+			}
+			require.NoError(t, err)
+
+			evalCtx, err := EventEvalContext(setupTestMsg("github", "push", "", tc.data))
+			require.NoError(t, err)
+
+			matches, err := flow.IfValue(evalCtx)
+			if tc.expectIfError {
+				if assert.Error(t, err) {
+					assert.NotContains(t, err.Error(), "s3cr3t", "Errors must never include secrets")
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedIf, matches)
+
+			inputs, err := flow.InputValues(evalCtx)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedInputs, inputs)
+		})
+	}
+}
+
+func TestFlowConditionErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		frontmatter string
+	}{
+		{name: "Unknown matcher", frontmatter: "match:\n  brnch: main"},
+		{name: "Empty patterns", frontmatter: "match:\n  branch: []"},
+		{name: "Invalid pattern", frontmatter: "match:\n  branch: 'release/[abc'"},
+		{name: "Non-string patterns", frontmatter: "match:\n  branch: {name: main}"},
+		{name: "Invalid unless", frontmatter: "unless: event..ref"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			flowsDir := setupPopulatedTestDir(t, map[string][]byte{
+				"flow/one.md": []byte("---\non: push\n" + tc.frontmatter + "\n---\nFlow\n"),
+			})
+
+			_, err := NewFlowReader(flowsDir).ReadFlow(filepath.Join(flowsDir, "flow", "one.md"))
+			assert.Error(t, err, "Invalid conditions should fail at load")
+		})
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	exprs, err := Match{
+		"repo":   Patterns{"org/*"},
+		"branch": Patterns{"main", "${oops}"},
+	}.Expressions()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		`glob(trimprefix(try(event.pull_request.base.ref, event.ref, ""), "refs/heads/"), ["main", "$${oops}"])`,
+		`glob(try(event.repository.full_name, ""), ["org/*"])`,
+	}, exprs, "Matchers should be ordered by name, with patterns escaped")
+}
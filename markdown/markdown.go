@@ -13,6 +13,7 @@ import (
 	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/renderer/html"
 	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 	"go.abhg.dev/goldmark/frontmatter"
 )
 
@@ -30,6 +31,7 @@ func NewMarkdown() *Markdown {
 			&frontmatter.Extender{
 				Formats: []frontmatter.Format{frontmatter.YAML},
 			},
+			&shortcodeExtension{},
 		),
 	)
 
@@ -37,6 +39,9 @@ func NewMarkdown() *Markdown {
 	htmlRend.AddOptions(html.WithUnsafe())
 
 	mdRend := mdrender.NewRenderer()
+	mdRend.AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&shortcodeMarkdownRenderer{}, 500),
+	))
 
 	return &Markdown{
 		md:               md,
@@ -56,6 +61,20 @@ func (m *Markdown) HTML(source []byte, w io.Writer) (parser.Context, error) {
 	return ctx, nil
 }
 
+// HTMLWithTOC renders source as HTML, giving headings in the table of contents
+// IDs to link to and returning the table of contents
+func (m *Markdown) HTMLWithTOC(source []byte, w io.Writer) (parser.Context, []*TOCEntry, error) {
+	ctx := parser.NewContext()
+	doc := m.md.Parser().Parse(text.NewReader(source), parser.WithContext(ctx))
+	toc := tableOfContents(doc, source, ctx)
+
+	if err := m.htmlRenderer.Render(w, source, doc); err != nil {
+		return nil, nil, err
+	}
+
+	return ctx, toc, nil
+}
+
 func (m *Markdown) Markdown(source []byte, w io.Writer) (parser.Context, error) {
 	ctx := parser.NewContext()
 	m.md.SetRenderer(m.markdownRenderer)
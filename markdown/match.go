@@ -0,0 +1,118 @@
+package markdown
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+)
+
+type (
+	// Match is shorthand for common conditions on events, keyed by matcher name
+	// with the glob patterns to match against
+	//
+	// Each matcher is compiled into an expression, all of which must be true
+	// alongside the flow's 'if' and 'unless' for the flow to run
+	Match map[string]Patterns
+
+	// Patterns are glob patterns, given in YAML as a single string or a list
+	Patterns []string
+
+	matcher struct {
+		// value is an expression for the string or list of strings to match
+		value string
+		// negate inverts the matcher, so it's true if nothing matches
+		negate bool
+	}
+)
+
+const (
+	matchBranchValue = `trimprefix(try(event.pull_request.base.ref, event.ref, ""), "refs/heads/")`
+	matchRepoValue   = `try(event.repository.full_name, "")`
+	matchLabelsValue = `[for l in try(event.pull_request.labels, event.issue.labels, []) : try(l.name, "")]`
+	matchActorValue  = `try(event.sender.login, "")`
+	matchPathsValue  = `flatten([for c in try(event.commits, []) : concat(try(c.added, []), try(c.modified, []), try(c.removed, []))])`
+)
+
+// matchers are the conditions available in a flow's 'match' block, which read
+// github's webhook events
+var matchers = map[string]matcher{
+	// branch is the branch pushed to, or the base branch of pull requests
+	"branch":     {value: matchBranchValue},
+	"branch_not": {value: matchBranchValue, negate: true},
+	// repo is the full name of the repository, as 'org/name'
+	"repo":     {value: matchRepoValue},
+	"repo_not": {value: matchRepoValue, negate: true},
+	// labels are those of the pull request or issue
+	"labels_any":  {value: matchLabelsValue},
+	"labels_none": {value: matchLabelsValue, negate: true},
+	// actor is the login of the user that triggered the event
+	"actor":     {value: matchActorValue},
+	"actor_not": {value: matchActorValue, negate: true},
+	// paths are the files added, modified or removed by the commits of a push
+	"paths":     {value: matchPathsValue},
+	"paths_not": {value: matchPathsValue, negate: true},
+}
+
+func (p *Patterns) UnmarshalYAML(unmarshal func(any) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*p = Patterns{single}
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return fmt.Errorf("match patterns must be a string or list of strings")
+	}
+
+	*p = list
+
+	return nil
+}
+
+// Expressions returns the source of the expression for each matcher, ordered
+// by matcher name
+func (m Match) Expressions() ([]string, error) {
+	names := maps.Keys(m)
+	slices.Sort(names)
+
+	exprs := make([]string, 0, len(m))
+	for _, name := range names {
+		matcher, ok := matchers[name]
+		if !ok {
+			known := maps.Keys(matchers)
+			slices.Sort(known)
+			return nil, fmt.Errorf("unknown matcher '%s', must be one of: %s", name, strings.Join(known, ", "))
+		}
+
+		patterns := m[name]
+		if len(patterns) == 0 {
+			return nil, fmt.Errorf("matcher '%s' must have at least one pattern", name)
+		}
+
+		patternVals := make([]cty.Value, len(patterns))
+		for i, pattern := range patterns {
+			if pattern == "" || !doublestar.ValidatePattern(pattern) {
+				return nil, fmt.Errorf("matcher '%s' has an invalid pattern '%s'", name, pattern)
+			}
+
+			patternVals[i] = cty.StringVal(pattern)
+		}
+
+		// Patterns are written as an HCL literal, so they're escaped correctly
+		patternsSrc := hclwrite.TokensForValue(cty.TupleVal(patternVals)).Bytes()
+		expr := fmt.Sprintf("glob(%s, %s)", matcher.value, patternsSrc)
+		if matcher.negate {
+			expr = "!" + expr
+		}
+
+		exprs = append(exprs, expr)
+	}
+
+	return exprs, nil
+}
@@ -0,0 +1,198 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	// KindShortcode is the kind of shortcode nodes
+	KindShortcode = ast.NewNodeKind("Shortcode")
+
+	shortcodeRegex    = regexp.MustCompile(`^\{\{<\s*([a-z][a-z0-9-]*)((?:\s+[a-z][a-z0-9_-]*=(?:"[^"]*"|[^\s"]+))*)\s*>\}\}$`)
+	shortcodeArgRegex = regexp.MustCompile(`([a-z][a-z0-9_-]*)=(?:"([^"]*)"|([^\s"]+))`)
+)
+
+type (
+	// Shortcode is a shortcode such as {{< flow-status id="deploy.prod" >}},
+	// on a line of its own in a page
+	Shortcode struct {
+		ast.BaseBlock
+		Name string
+		Args map[string]string
+	}
+
+	// shortcodeDef describes the args a shortcode takes
+	shortcodeDef struct {
+		required []string
+		// ints are args that must be positive integers
+		ints []string
+	}
+
+	shortcodeExtension struct{}
+
+	shortcodeParser struct{}
+
+	shortcodeHTMLRenderer struct{}
+
+	// shortcodeMarkdownRenderer leaves shortcodes out of markdown output, as
+	// they're only hydrated on the site
+	shortcodeMarkdownRenderer struct{}
+)
+
+// shortcodes are the shortcodes that can be used in pages, each rendered as a
+// placeholder that is hydrated from the hops API when the page is viewed
+var shortcodes = map[string]shortcodeDef{
+	"command":     {required: []string{"action"}},
+	"flow-status": {required: []string{"id"}},
+	"run-history": {required: []string{"flow"}, ints: []string{"limit"}},
+}
+
+func (n *Shortcode) Kind() ast.NodeKind {
+	return KindShortcode
+}
+
+func (n *Shortcode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.Name}, nil)
+}
+
+func (e *shortcodeExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithBlockParsers(
+		util.Prioritized(&shortcodeParser{}, 150),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&shortcodeHTMLRenderer{}, 500),
+	))
+}
+
+func (p *shortcodeParser) Trigger() []byte {
+	return []byte{'{'}
+}
+
+func (p *shortcodeParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+
+	node, ok := parseShortcode(line)
+	if !ok {
+		return nil, parser.NoChildren
+	}
+
+	reader.Advance(segment.Len() - 1)
+	return node, parser.NoChildren
+}
+
+func (p *shortcodeParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	return parser.Close
+}
+
+func (p *shortcodeParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (p *shortcodeParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *shortcodeParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// parseShortcode parses a line holding a shortcode, which must be one of the
+// known shortcodes to be parsed
+func parseShortcode(line []byte) (*Shortcode, bool) {
+	match := shortcodeRegex.FindSubmatch(util.TrimRightSpace(util.TrimLeftSpace(line)))
+	if match == nil {
+		return nil, false
+	}
+
+	name := string(match[1])
+	if _, ok := shortcodes[name]; !ok {
+		return nil, false
+	}
+
+	node := &Shortcode{Name: name, Args: map[string]string{}}
+	for _, arg := range shortcodeArgRegex.FindAllSubmatch(match[2], -1) {
+		value := arg[2]
+		if len(arg[3]) > 0 {
+			value = arg[3]
+		}
+		node.Args[string(arg[1])] = string(value)
+	}
+
+	return node, true
+}
+
+func (r *shortcodeHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindShortcode, r.render)
+}
+
+// render writes a shortcode as a placeholder element, with the shortcode's
+// args as data attributes
+func (r *shortcodeHTMLRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	node := n.(*Shortcode)
+	if err := node.validate(); err != nil {
+		return ast.WalkStop, err
+	}
+
+	names := make([]string, 0, len(node.Args))
+	for name := range node.Args {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	fmt.Fprintf(w, `<div class="hops_shortcode hops_%s" data-shortcode="%s"`, strings.ReplaceAll(node.Name, "-", "_"), node.Name)
+	for _, name := range names {
+		fmt.Fprintf(w, ` data-%s="%s"`, name, html.EscapeString(node.Args[name]))
+	}
+	w.WriteString(` aria-live="polite"></div>` + "\n")
+
+	return ast.WalkSkipChildren, nil
+}
+
+func (n *Shortcode) validate() error {
+	def := shortcodes[n.Name]
+
+	for _, name := range def.required {
+		if n.Args[name] == "" {
+			return fmt.Errorf("shortcode '%s' requires '%s'", n.Name, name)
+		}
+	}
+
+	for _, name := range def.ints {
+		value, ok := n.Args[name]
+		if !ok {
+			continue
+		}
+
+		if i, err := strconv.Atoi(value); err != nil || i < 1 {
+			return fmt.Errorf("shortcode '%s' requires '%s' to be a positive number", n.Name, name)
+		}
+	}
+
+	for name := range n.Args {
+		if !slices.Contains(def.required, name) && !slices.Contains(def.ints, name) {
+			return fmt.Errorf("shortcode '%s' has unknown arg '%s'", n.Name, name)
+		}
+	}
+
+	return nil
+}
+
+func (r *shortcodeMarkdownRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindShortcode, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		return ast.WalkSkipChildren, nil
+	})
+}
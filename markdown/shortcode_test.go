@@ -0,0 +1,92 @@
+package markdown
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortcodeHTML(t *testing.T) {
+	type testCase struct {
+		name        string
+		source      string
+		expected    string
+		expectError bool
+	}
+
+	tests := []testCase{
+		{
+			name:     "Flow status",
+			source:   `{{< flow-status id="deploy.prod" >}}`,
+			expected: `<div class="hops_shortcode hops_flow_status" data-shortcode="flow-status" data-id="deploy.prod" aria-live="polite"></div>` + "\n",
+		},
+		{
+			name:     "Unquoted args in order",
+			source:   `{{<run-history limit=5 flow=deploy.prod>}}`,
+			expected: `<div class="hops_shortcode hops_run_history" data-shortcode="run-history" data-flow="deploy.prod" data-limit="5" aria-live="polite"></div>` + "\n",
+		},
+		{
+			name:     "Between paragraphs",
+			source:   "Before\n{{< command action=\"deploy\" >}}\nAfter",
+			expected: "<p>Before</p>\n" + `<div class="hops_shortcode hops_command" data-shortcode="command" data-action="deploy" aria-live="polite"></div>` + "\n<p>After</p>\n",
+		},
+		{
+			name:     "Escaped args",
+			source:   `{{< command action="a&quot;<b>" >}}`,
+			expected: `<div class="hops_shortcode hops_command" data-shortcode="command" data-action="a&amp;quot;&lt;b&gt;" aria-live="polite"></div>` + "\n",
+		},
+		{
+			name:     "Unknown shortcode",
+			source:   `{{< unknown id="x" >}}`,
+			expected: "<p>{{&lt; unknown id=&quot;x&quot; &gt;}}</p>\n",
+		},
+		{
+			name:     "In code block",
+			source:   "```\n{{< flow-status id=\"x\" >}}\n```",
+			expected: "<pre><code>{{&lt; flow-status id=&quot;x&quot; &gt;}}\n</code></pre>\n",
+		},
+		{
+			name:        "Missing required arg",
+			source:      `{{< run-history limit=10 >}}`,
+			expectError: true,
+		},
+		{
+			name:        "Invalid limit",
+			source:      `{{< run-history flow="x" limit=none >}}`,
+			expectError: true,
+		},
+		{
+			name:        "Unknown arg",
+			source:      `{{< flow-status id="x" colour="red" >}}`,
+			expectError: true,
+		},
+	}
+
+	md := NewMarkdown()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			_, err := md.HTML([]byte(tc.source), &b)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, b.String())
+		})
+	}
+}
+
+func TestShortcodeMarkdown(t *testing.T) {
+	var b bytes.Buffer
+	_, err := NewMarkdown().Markdown([]byte("Before\n\n{{< flow-status id=\"deploy\" >}}\n\nAfter\n"), &b)
+	require.NoError(t, err)
+
+	assert.NotContains(t, b.String(), "flow-status", "Shortcodes should be left out of markdown")
+	assert.Contains(t, b.String(), "Before")
+	assert.Contains(t, b.String(), "After")
+}
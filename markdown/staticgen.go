@@ -3,11 +3,17 @@ package markdown
 import (
 	"bytes"
 	"embed"
+	"errors"
+	"fmt"
 	"html/template"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"go.abhg.dev/goldmark/frontmatter"
 )
@@ -15,38 +21,172 @@ import (
 //go:embed templates
 var templates embed.FS
 
+// defaultLayout is the layout of pages that don't set one in their frontmatter
+const defaultLayout = "page"
+
+// notFoundPage is served for missing pages, generated if pages doesn't have one
+const notFoundPage = "404.html"
+
 type (
 	PageData struct {
 		Content     template.HTML
 		Description string `yaml:"description"`
-		Title       string `yaml:"title"`
+		// Layout is the name of the template in layouts/ the page is rendered
+		// with, defaulting to 'page'
+		Layout string `yaml:"layout"`
+		Title  string `yaml:"title"`
+		// Weight orders the page amongst its siblings in the navigation, lowest
+		// first with pages of equal weight ordered by title
+		Weight int `yaml:"weight"`
+		// TOC is the table of contents, generated from the page's headings
+		TOC []*TOCEntry `yaml:"-"`
+		// Nav is the navigation tree of the site's pages
+		Nav []*NavItem `yaml:"-"`
+		// URL is the page's path within the site
+		URL string `yaml:"-"`
+	}
+
+	// NavItem is a page in the navigation tree, with any pages beneath it
+	NavItem struct {
+		Title    string
+		URL      string
+		Children []*NavItem
 	}
 
 	StaticBuilder struct {
-		md           *Markdown
-		pageTemplate *template.Template
+		flows   map[string]*Flow
+		layouts map[string]bool
+		mdPool  sync.Pool
+		now     func() time.Time
+		// templatesDir holds a project's templates, replacing or adding to the
+		// embedded ones
+		templatesDir string
+		templates    *template.Template
+	}
+
+	StaticBuilderOpt func(*StaticBuilder)
+
+	// sitePage is a rendered page waiting for the navigation tree to be complete
+	sitePage struct {
+		data PageData
+		// hidden pages are left out of the navigation
+		hidden bool
+		// index is true for the index page of a directory
+		index bool
+		// path is the page's output file, relative to the build dir
+		path string
+	}
+
+	// navList is passed to the recursive navigation template along with the
+	// URL of the page being rendered
+	navList struct {
+		Items   []*NavItem
+		Current string
 	}
 )
 
-func NewStaticBuilder() (*StaticBuilder, error) {
-	pageTemplate, err := template.ParseFS(templates, "templates/page.html")
+func NewStaticBuilder(opts ...StaticBuilderOpt) (*StaticBuilder, error) {
+	s := &StaticBuilder{
+		layouts: map[string]bool{},
+		mdPool: sync.Pool{
+			New: func() any { return NewMarkdown() },
+		},
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.templates = template.New("").Funcs(template.FuncMap{"navList": newNavList})
+
+	embedded, err := fs.Sub(templates, "templates")
 	if err != nil {
 		return nil, err
 	}
 
-	s := &StaticBuilder{
-		md:           NewMarkdown(),
-		pageTemplate: pageTemplate,
+	if err := s.parseTemplates(embedded); err != nil {
+		return nil, err
+	}
+
+	if s.templatesDir != "" {
+		if err := s.parseTemplates(os.DirFS(s.templatesDir)); err != nil {
+			return nil, fmt.Errorf("unable to parse templates in '%s': %w", s.templatesDir, err)
+		}
 	}
 
 	return s, nil
 }
 
+// WithFlowsOpt adds a catalogue of the given flows to the site
+func WithFlowsOpt(flows map[string]*Flow) StaticBuilderOpt {
+	return func(s *StaticBuilder) {
+		s.flows = flows
+	}
+}
+
+// WithTemplatesDirOpt adds templates from a dir to the embedded ones, where
+// files with the same name as an embedded template replace it
+//
+// Layouts are read from layouts/ in the dir, the dir is ignored if missing
+func WithTemplatesDirOpt(dir string) StaticBuilderOpt {
+	return func(s *StaticBuilder) {
+		s.templatesDir = dir
+	}
+}
+
+// Build builds the site from source into a new dir in build, linking to it
+// from CurrentBuild(build) only once the whole site has built without error
+//
+// Files whose content hasn't changed since the last build are left as they
+// are, and every file that fails is reported in a BuildError
 func (s *StaticBuilder) Build(source, build string) error {
-	if err := os.RemoveAll(build); err != nil {
+	current, err := currentBuild(build)
+	if err != nil {
+		return fmt.Errorf("unable to find current build: %w", err)
+	}
+
+	staging, err := newBuild(build)
+	if err != nil {
+		return fmt.Errorf("unable to prepare build dir: %w", err)
+	}
+
+	// The new build starts as a copy of the current one, so unchanged files
+	// can be skipped while the current site stays intact until the swap
+	if current != "" {
+		if err := linkTree(current, staging); err != nil {
+			os.RemoveAll(staging)
+			return fmt.Errorf("unable to prepare build dir: %w", err)
+		}
+	}
+
+	if err := s.build(source, staging); err != nil {
+		os.RemoveAll(staging)
 		return err
 	}
 
+	if err := swapLink(build, staging); err != nil {
+		os.RemoveAll(staging)
+		return fmt.Errorf("unable to publish build: %w", err)
+	}
+
+	return removeOldBuilds(build, staging, current)
+}
+
+// CurrentBuild is the link to the current build in a build dir, which the
+// site is served from
+func CurrentBuild(build string) string {
+	return filepath.Join(build, currentBuildLink)
+}
+
+func (s *StaticBuilder) build(source, build string) error {
+	var (
+		buildErr   = &BuildError{}
+		errMutex   sync.Mutex
+		plainPaths []string
+		mdPaths    []string
+	)
+
 	err := filepath.WalkDir(source, func(path string, de fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -56,22 +196,138 @@ func (s *StaticBuilder) Build(source, build string) error {
 		if err != nil {
 			return err
 		}
-		buildPath := filepath.Join(build, relPath)
 
 		if de.IsDir() {
-			return os.MkdirAll(buildPath, os.ModePerm)
+			return os.MkdirAll(filepath.Join(build, relPath), os.ModePerm)
 		}
 
-		return s.BuildFile(path, filepath.Dir(buildPath))
-	})
+		if strings.ToLower(filepath.Ext(path)) == ".md" {
+			mdPaths = append(mdPaths, relPath)
+		} else {
+			plainPaths = append(plainPaths, relPath)
+		}
 
-	// Attempt to wipe the dir if we had an error
+		return nil
+	})
 	if err != nil {
-		os.RemoveAll(build)
+		return err
 	}
-	return err
+
+	prevManifest := readManifest(build)
+	nextManifest := manifest{}
+	var manifestMutex sync.Mutex
+
+	// output writes a file into the build dir unless it's unchanged
+	output := func(relPath string, content []byte) error {
+		hash := contentHash(content)
+
+		manifestMutex.Lock()
+		nextManifest[filepath.ToSlash(relPath)] = hash
+		manifestMutex.Unlock()
+
+		if prevManifest.unchanged(build, relPath, hash) {
+			return nil
+		}
+
+		path := filepath.Join(build, relPath)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return err
+		}
+
+		return writeFile(path, content)
+	}
+
+	plainOutputs := make([]string, len(plainPaths))
+	parallel(len(plainPaths), func(i int) {
+		sourcePath := filepath.Join(source, plainPaths[i])
+		relPath := buildPath(sourcePath, filepath.Dir(plainPaths[i]), "")
+		plainOutputs[i] = relPath
+
+		content, err := os.ReadFile(sourcePath)
+		if err == nil {
+			err = output(relPath, content)
+		}
+		if err != nil {
+			buildErr.add(&errMutex, relPath, err)
+		}
+	})
+
+	mdPages := make([]*sitePage, len(mdPaths))
+	parallel(len(mdPaths), func(i int) {
+		page, err := s.readPage(filepath.Join(source, mdPaths[i]), filepath.Dir(mdPaths[i]))
+		if err != nil {
+			buildErr.add(&errMutex, buildPath(mdPaths[i], filepath.Dir(mdPaths[i]), ".html"), err)
+			return
+		}
+
+		mdPages[i] = page
+	})
+
+	pages := []*sitePage{}
+	outputPaths := map[string]bool{}
+	for _, relPath := range plainOutputs {
+		outputPaths[relPath] = true
+	}
+	for _, page := range mdPages {
+		if page != nil {
+			pages = append(pages, page)
+			outputPaths[page.path] = true
+		}
+	}
+
+	flowPages, flowErrs := s.flowPages()
+	buildErr.Errors = append(buildErr.Errors, flowErrs...)
+
+	for _, page := range flowPages {
+		if outputPaths[page.path] {
+			buildErr.add(&errMutex, page.path, errors.New("a file in pages conflicts with the generated flow catalogue"))
+			continue
+		}
+
+		pages = append(pages, page)
+	}
+
+	if !outputPaths[notFoundPage] {
+		pages = append(pages, &sitePage{
+			data: PageData{
+				Content: `<h1>Page not found</h1><p>This page doesn't exist, head back <a href="/">home</a>.</p>`,
+				Title:   "Page not found",
+			},
+			hidden: true,
+			path:   notFoundPage,
+		})
+	}
+
+	nav := navTree(pages)
+
+	parallel(len(pages), func(i int) {
+		content, err := s.renderPage(pages[i], nav)
+		if err == nil {
+			err = output(pages[i].path, content)
+		}
+		if err != nil {
+			buildErr.add(&errMutex, pages[i].path, err)
+		}
+	})
+
+	if err := buildErr.errOrNil(); err != nil {
+		return err
+	}
+
+	keep := map[string]bool{buildManifest: true}
+	for relPath := range nextManifest {
+		keep[relPath] = true
+	}
+
+	if err := removeStale(build, keep); err != nil {
+		return err
+	}
+
+	return nextManifest.write(build)
 }
 
+// BuildFile builds a single source file into the build dir, without any
+// navigation for markdown pages
 func (s *StaticBuilder) BuildFile(path, build string) error {
 	ext := strings.ToLower(filepath.Ext(path))
 
@@ -90,35 +346,17 @@ func (s *StaticBuilder) BuildFile(path, build string) error {
 }
 
 func (s *StaticBuilder) BuildMarkdown(source, build string) error {
-	content, err := os.ReadFile(source)
-	if err != nil {
-		return err
-	}
-
-	var mdOutput bytes.Buffer
-	pCtx, err := s.md.HTML(content, &mdOutput)
+	page, err := s.readPage(source, "")
 	if err != nil {
 		return err
 	}
 
-	path := buildPath(source, build, ".html")
-	writer, err := os.Create(path)
+	content, err := s.renderPage(page, nil)
 	if err != nil {
 		return err
 	}
-	defer writer.Close()
 
-	pageData := PageData{}
-
-	if fm := frontmatter.Get(pCtx); fm != nil {
-		if err := fm.Decode(&pageData); err != nil {
-			return err
-		}
-	}
-
-	pageData.Content = template.HTML(mdOutput.String())
-
-	return s.pageTemplate.Execute(writer, pageData)
+	return writeFile(filepath.Join(build, page.path), content)
 }
 
 // BuildPlain takes a source file path and copies into the equivalent location
@@ -140,6 +378,186 @@ func (s *StaticBuilder) BuildPlain(source, build string) error {
 	return err
 }
 
+// readPage renders a markdown file to be written at the equivalent location in
+// relDir of the build dir
+func (s *StaticBuilder) readPage(source, relDir string) (*sitePage, error) {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	// Markdown isn't safe for concurrent use, so each page being read gets one
+	md := s.mdPool.Get().(*Markdown)
+	defer s.mdPool.Put(md)
+
+	var mdOutput bytes.Buffer
+	pCtx, toc, err := md.HTMLWithTOC(content, &mdOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	relPath := buildPath(source, relDir, ".html")
+	page := &sitePage{
+		hidden: relPath == notFoundPage,
+		index:  strings.ToLower(filepath.Base(relPath)) == "index.html",
+		path:   relPath,
+	}
+
+	if fm := frontmatter.Get(pCtx); fm != nil {
+		if err := fm.Decode(&page.data); err != nil {
+			return nil, err
+		}
+	}
+
+	if page.data.Title == "" {
+		page.data.Title = titleCase(strings.TrimSuffix(filepath.Base(relPath), ".html"))
+	}
+
+	page.data.Content = template.HTML(mdOutput.String())
+	page.data.TOC = toc
+
+	return page, nil
+}
+
+// renderPage renders a page with its layout
+func (s *StaticBuilder) renderPage(page *sitePage, nav []*NavItem) ([]byte, error) {
+	layout := page.data.Layout
+	if layout == "" {
+		layout = defaultLayout
+	}
+	if !s.layouts[layout] {
+		return nil, fmt.Errorf("unknown layout '%s'", layout)
+	}
+
+	data := page.data
+	data.Nav = nav
+	data.URL = pageURL(page.path)
+
+	var b bytes.Buffer
+	if err := s.templates.ExecuteTemplate(&b, layoutTemplate(layout), data); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// parseTemplates parses the templates and layouts in fsys, replacing any
+// previously parsed with the same name
+func (s *StaticBuilder) parseTemplates(fsys fs.FS) error {
+	for _, pattern := range []string{"*.html", "layouts/*.html"} {
+		paths, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range paths {
+			content, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+
+			// Templates are named by path, so layouts can share names with partials
+			if _, err := s.templates.New(p).Parse(string(content)); err != nil {
+				return err
+			}
+
+			if dir, name := path.Split(p); dir != "" {
+				s.layouts[strings.TrimSuffix(name, ".html")] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+func layoutTemplate(layout string) string {
+	return fmt.Sprintf("layouts/%s.html", layout)
+}
+
+// navTree arranges pages into a tree following their directories, where a
+// directory's index page is its parent and other directories are grouped
+// under their title cased name
+func navTree(pages []*sitePage) []*NavItem {
+	root := &NavItem{}
+	dirs := map[string]*NavItem{".": root}
+	// Items are ordered by weight, with index pages before their siblings
+	weights := map[*NavItem]int{}
+	indexes := map[*NavItem]bool{}
+
+	var dirItem func(dir string) *NavItem
+	dirItem = func(dir string) *NavItem {
+		if item, ok := dirs[dir]; ok {
+			return item
+		}
+
+		item := &NavItem{Title: titleCase(path.Base(dir))}
+		parent := dirItem(path.Dir(dir))
+		parent.Children = append(parent.Children, item)
+		dirs[dir] = item
+
+		return item
+	}
+
+	for _, page := range pages {
+		if page.hidden {
+			continue
+		}
+
+		relPath := filepath.ToSlash(page.path)
+		dir := path.Dir(relPath)
+
+		if page.index && dir != "." {
+			item := dirItem(dir)
+			item.Title = page.data.Title
+			item.URL = pageURL(page.path)
+			weights[item] = page.data.Weight
+			continue
+		}
+
+		item := &NavItem{Title: page.data.Title, URL: pageURL(page.path)}
+		indexes[item] = page.index
+		weights[item] = page.data.Weight
+
+		parent := dirItem(dir)
+		parent.Children = append(parent.Children, item)
+	}
+
+	var sortItems func(items []*NavItem)
+	sortItems = func(items []*NavItem) {
+		slices.SortStableFunc(items, func(a, b *NavItem) int {
+			if indexes[a] != indexes[b] {
+				if indexes[a] {
+					return -1
+				}
+				return 1
+			}
+
+			if weights[a] != weights[b] {
+				return weights[a] - weights[b]
+			}
+
+			return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+		})
+
+		for _, item := range items {
+			sortItems(item.Children)
+		}
+	}
+	sortItems(root.Children)
+
+	return root.Children
+}
+
+func newNavList(items []*NavItem, current string) navList {
+	return navList{Items: items, Current: current}
+}
+
+// pageURL is the absolute URL of a page in the site from its path in the
+// build dir
+func pageURL(relPath string) string {
+	return "/" + filepath.ToSlash(relPath)
+}
+
 // buildPath converts a source file path into a path in the build dir, optionally
 // altering the extension.
 func buildPath(source, build, ext string) string {
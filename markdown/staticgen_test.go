@@ -1,9 +1,13 @@
 package markdown
 
 import (
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/antchfx/htmlquery"
 	"github.com/stretchr/testify/assert"
@@ -32,6 +36,21 @@ func TestBuild(t *testing.T) {
 			},
 		},
 
+		{
+			"Navigation",
+			map[string][]byte{
+				"index.md":        []byte("# Home"),
+				"guides/index.md": []byte("---\ntitle: All guides\n---\n# Guides"),
+				"guides/setup.md": []byte("# Setup"),
+			},
+			map[string][]byte{
+				"index.html":        []byte(`<a href="/index.html" aria-current="page">Index</a>`),
+				"guides/setup.html": []byte(`<a href="/guides/index.html">All guides</a>`),
+				"guides/index.html": []byte(`<a href="/guides/setup.html">Setup</a>`),
+				"404.html":          []byte("<h1>Page not found</h1>"),
+			},
+		},
+
 		{
 			"Other files",
 			map[string][]byte{
@@ -57,7 +76,7 @@ func TestBuild(t *testing.T) {
 			require.NoError(t, err, "Build should complete without error")
 
 			for relPath, expectedContent := range tc.expected {
-				path := filepath.Join(buildDir, relPath)
+				path := filepath.Join(CurrentBuild(buildDir), relPath)
 				content, err := os.ReadFile(path)
 				if assert.NoError(t, err, "Should be able to read output file") {
 					assert.Contains(
@@ -144,3 +163,308 @@ description: This page
 		})
 	}
 }
+
+func TestBuildFlows(t *testing.T) {
+	flowsDir := setupPopulatedTestDir(t, map[string][]byte{
+		"deploy/index.md": []byte(`---
+command:
+- environment: {type: select, options: [staging, production], default: staging, required: true}
+- dry_run: {type: bool, default: true}
+- deploy_at: {type: datetime, default: "2024-02-29T13:30:00Z"}
+approval: {channel: "#deploys"}
+---
+# Deploy
+
+Deploys *the app*
+`),
+		"reports/weekly.md": []byte(`---
+schedule: "0 9 * * 1"
+---
+Sends the weekly report
+`),
+		"review/label.md": []byte(`---
+on: pull_request
+match:
+  branch: main
+unless: event.pull_request.draft
+worker: labeller
+---
+Labels pull requests
+`),
+	})
+
+	fr := NewFlowReader(flowsDir)
+	require.NoError(t, fr.ReadAll(), "Test setup error")
+
+	sourceDir := setupPopulatedTestDir(t, map[string][]byte{
+		"index.md": []byte("# Home\n\n{{< run-history flow=\"deploy.index\" limit=5 >}}"),
+	})
+	buildDir := t.TempDir()
+
+	builder, err := NewStaticBuilder(WithFlowsOpt(fr.IndexedFlows()))
+	require.NoError(t, err, "Test setup error")
+	builder.now = func() time.Time {
+		return time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+	}
+
+	err = builder.Build(sourceDir, buildDir)
+	require.NoError(t, err, "Build should complete without error")
+
+	expected := map[string][]string{
+		"index.html": {
+			`<a href="/flows/index.html">Flows</a>`,
+			`<a href="/flows/deploy.index.html">Deploy</a>`,
+			`data-shortcode="run-history" data-flow="deploy.index" data-limit="5"`,
+		},
+		"flows/index.html": {
+			`<a href="/flows/reports.weekly.html">Reports Weekly</a>`,
+			`<code>Command deploy</code>`,
+			`<code>On pull_request</code>`,
+			`<code>review.labeller</code>`,
+		},
+		"flows/deploy.index.html": {
+			"<title>Deploy</title>",
+			"<p>Deploys <em>the app</em></p>",
+			`<form class="command_form" data-action="deploy">`,
+			`<select id="param-environment" name="environment" required>`,
+			`<option selected>staging</option>`,
+			`<option>production</option>`,
+			`type="checkbox" checked`,
+			`type="datetime-local" value="2024-02-29T13:30"`,
+			"#deploys",
+		},
+		"flows/reports.weekly.html": {
+			`<script src=/_hops/hops.js defer></script>`,
+			"<code>Schedule 0 9 * * 1</code>",
+			"Mon, 04 Mar 2024 09:00 UTC",
+		},
+		"flows/review.label.html": {
+			"<th>Match branch</th><td><code>main</code></td>",
+			"<code>event.pull_request.draft</code>",
+			`<a href="/flows/review.label.html" aria-current="page">Review Label</a>`,
+		},
+	}
+
+	for relPath, contents := range expected {
+		content, err := os.ReadFile(filepath.Join(CurrentBuild(buildDir), relPath))
+		if !assert.NoError(t, err, "Should be able to read output file") {
+			continue
+		}
+
+		for _, c := range contents {
+			assert.Contains(t, string(content), c, "%s should contain catalogue content", relPath)
+		}
+	}
+
+	// Pages can't be overwritten by the catalogue
+	sourceDir = setupPopulatedTestDir(t, map[string][]byte{
+		"flows/index.md": []byte("# My flows"),
+	})
+	err = builder.Build(sourceDir, buildDir)
+	assert.Error(t, err, "Build should fail if pages conflict with the catalogue")
+}
+
+func TestNavTree(t *testing.T) {
+	pages := []*sitePage{
+		{path: "zebra.html", data: PageData{Title: "Zebra"}},
+		{path: "index.html", index: true, data: PageData{Title: "Home"}},
+		{path: "apple.html", data: PageData{Title: "Apple"}},
+		{path: "last.html", data: PageData{Title: "Aardvark", Weight: 10}},
+		{path: "first.html", data: PageData{Title: "Yak", Weight: -1}},
+		{path: filepath.Join("docs", "deep", "page.html"), data: PageData{Title: "Deep page"}},
+		{path: filepath.Join("docs", "index.html"), index: true, data: PageData{Title: "Docs"}},
+	}
+
+	expected := []*NavItem{
+		{Title: "Home", URL: "/index.html"},
+		{Title: "Yak", URL: "/first.html"},
+		{Title: "Apple", URL: "/apple.html"},
+		{Title: "Docs", URL: "/docs/index.html", Children: []*NavItem{
+			{Title: "Deep", Children: []*NavItem{
+				{Title: "Deep page", URL: "/docs/deep/page.html"},
+			}},
+		}},
+		{Title: "Zebra", URL: "/zebra.html"},
+		{Title: "Aardvark", URL: "/last.html"},
+	}
+
+	assert.Equal(t, expected, navTree(pages))
+}
+
+func TestBuildLayouts(t *testing.T) {
+	templatesDir := setupPopulatedTestDir(t, map[string][]byte{
+		"layouts/custom.html": []byte(`<main>{{ template "toc" . }}{{ .Content }}</main>{{ template "footer" }}`),
+		"partials.html":       []byte(`{{ define "footer" }}<footer>Custom</footer>{{ end }}`),
+	})
+
+	type testCase struct {
+		name        string
+		source      []byte
+		expected    []string
+		expectError bool
+	}
+
+	tests := []testCase{
+		{
+			name:     "Default layout",
+			source:   []byte("# Hello"),
+			expected: []string{`<div class="sidebar">`, "<h1>Hello</h1>"},
+		},
+		{
+			name:     "Embedded layout",
+			source:   []byte("---\nlayout: plain\n---\n# Hello"),
+			expected: []string{"<title>Test</title>", "<h1>Hello</h1>"},
+		},
+		{
+			name:   "Project layout",
+			source: []byte("---\nlayout: custom\n---\n## Usage\n### Flags"),
+			expected: []string{
+				"<main>",
+				`<a href="#usage">Usage</a>`,
+				`<h2 id="usage">Usage</h2>`,
+				`<h3 id="flags">Flags</h3>`,
+				"<footer>Custom</footer>",
+			},
+		},
+		{
+			name:        "Unknown layout",
+			source:      []byte("---\nlayout: missing\n---\n# Hello"),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sourceDir := setupPopulatedTestDir(t, map[string][]byte{"test.md": tc.source})
+			buildDir := t.TempDir()
+
+			builder, err := NewStaticBuilder(WithTemplatesDirOpt(templatesDir))
+			require.NoError(t, err, "Test setup error")
+
+			err = builder.Build(sourceDir, buildDir)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err, "Build should complete without error")
+
+			content, err := os.ReadFile(filepath.Join(CurrentBuild(buildDir), "test.html"))
+			require.NoError(t, err, "Should be able to read output file")
+
+			for _, c := range tc.expected {
+				assert.Contains(t, string(content), c)
+			}
+		})
+	}
+
+	// Embedded templates are used if the project has none
+	_, err := NewStaticBuilder(WithTemplatesDirOpt(filepath.Join(templatesDir, "missing")))
+	assert.NoError(t, err)
+}
+
+func TestBuildIncremental(t *testing.T) {
+	sourceDir := setupPopulatedTestDir(t, map[string][]byte{
+		"changed.md":  []byte("# Before"),
+		"same.md":     []byte("# Same"),
+		"old.txt":     []byte("Removed later"),
+		"sub/img.txt": []byte("Nested file"),
+	})
+	buildDir := filepath.Join(t.TempDir(), "site")
+	site := CurrentBuild(buildDir)
+
+	builder, err := NewStaticBuilder()
+	require.NoError(t, err, "Test setup error")
+
+	require.NoError(t, builder.Build(sourceDir, buildDir), "First build should complete without error")
+
+	firstBuild, err := filepath.EvalSymlinks(site)
+	require.NoError(t, err, "Site should be linked to the build")
+
+	sameBefore, err := os.Stat(filepath.Join(site, "same.html"))
+	require.NoError(t, err)
+	changedBefore, err := os.Stat(filepath.Join(site, "changed.html"))
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "changed.md"), []byte("# After"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(sourceDir, "old.txt")))
+	require.NoError(t, os.RemoveAll(filepath.Join(sourceDir, "sub")))
+
+	require.NoError(t, builder.Build(sourceDir, buildDir), "Second build should complete without error")
+
+	sameAfter, err := os.Stat(filepath.Join(site, "same.html"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(sameBefore, sameAfter), "Unchanged files should be left as they are")
+
+	changedAfter, err := os.Stat(filepath.Join(site, "changed.html"))
+	require.NoError(t, err)
+	assert.False(t, os.SameFile(changedBefore, changedAfter), "Changed files should be rewritten")
+
+	content, err := os.ReadFile(filepath.Join(site, "changed.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "<h1>After</h1>")
+
+	assert.NoFileExists(t, filepath.Join(site, "old.txt"), "Outputs of removed files should be removed")
+	assert.NoDirExists(t, filepath.Join(site, "sub"), "Dirs left empty should be removed")
+
+	secondBuild, err := filepath.EvalSymlinks(site)
+	require.NoError(t, err, "Site should be linked to the build")
+	assert.NotEqual(t, firstBuild, secondBuild, "Site should be linked to the new build")
+	assert.DirExists(t, firstBuild, "The previous build should be kept for requests reading from it")
+	assert.Len(t, builds(t, buildDir), 2, "Builds before the previous one should be removed")
+}
+
+func TestBuildErrorReport(t *testing.T) {
+	sourceDir := setupPopulatedTestDir(t, map[string][]byte{
+		"good.md": []byte("# Good"),
+	})
+	buildDir := filepath.Join(t.TempDir(), "site")
+	site := CurrentBuild(buildDir)
+
+	builder, err := NewStaticBuilder()
+	require.NoError(t, err, "Test setup error")
+	require.NoError(t, builder.Build(sourceDir, buildDir), "First build should complete without error")
+
+	for name, content := range map[string]string{
+		"bad.md":         "---\nlayout: missing\n---\n# Bad",
+		"sub/invalid.md": "---\ntitle: [\n---\n# Invalid",
+	} {
+		path := filepath.Join(sourceDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	err = builder.Build(sourceDir, buildDir)
+
+	var buildErr *BuildError
+	require.True(t, errors.As(err, &buildErr), "Build should report failed files")
+
+	paths := []string{}
+	for _, fe := range buildErr.Errors {
+		paths = append(paths, fe.Path)
+	}
+	assert.Equal(t, []string{"bad.html", "sub/invalid.html"}, paths, "Every failed file should be reported")
+
+	assert.FileExists(t, filepath.Join(site, "good.html"), "A failed build should leave the previous site")
+	assert.NoFileExists(t, filepath.Join(site, "bad.html"))
+	assert.Len(t, builds(t, buildDir), 1, "The failed build should be cleaned up")
+}
+
+// builds lists the builds in a build dir, failing if anything else is there
+// besides the current build link
+func builds(t *testing.T, buildDir string) []string {
+	entries, err := os.ReadDir(buildDir)
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.Name() == currentBuildLink {
+			assert.Equal(t, fs.ModeSymlink, entry.Type(), "The current build should be a link")
+			continue
+		}
+
+		assert.True(t, entry.IsDir() && strings.HasPrefix(entry.Name(), buildVersionPrefix), "Unexpected entry '%s' in build dir", entry.Name())
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func setupPopulatedTestDir(t *testing.T, source map[string][]byte) string {
+func setupPopulatedTestDir(t testing.TB, source map[string][]byte) string {
 	sourceDir := t.TempDir()
 	for relPath, content := range source {
 		// Ensure the file's dir exists (in case of nested dir structures)
@@ -0,0 +1,70 @@
+package markdown
+
+import (
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+)
+
+// Headings in this range of levels are listed in a page's table of contents,
+// as the level 1 heading is usually the page's title
+const (
+	tocMinLevel = 2
+	tocMaxLevel = 3
+)
+
+// TOCEntry is a heading in a page's table of contents, with the headings
+// beneath it
+type TOCEntry struct {
+	Title    string
+	ID       string
+	Children []*TOCEntry
+}
+
+// tableOfContents lists the headings of a document, giving each listed
+// heading an ID to link to if it doesn't have one
+func tableOfContents(doc ast.Node, source []byte, pCtx parser.Context) []*TOCEntry {
+	toc := []*TOCEntry{}
+	// parents holds the latest entry at each level, to nest deeper headings in
+	parents := map[int]*TOCEntry{}
+
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		if heading.Level < tocMinLevel || heading.Level > tocMaxLevel {
+			return ast.WalkSkipChildren, nil
+		}
+
+		title := heading.Text(source)
+
+		var id string
+		if attr, ok := heading.AttributeString("id"); ok {
+			id = string(attr.([]byte))
+		} else {
+			id = string(pCtx.IDs().Generate(title, ast.KindHeading))
+			heading.SetAttributeString("id", []byte(id))
+		}
+
+		entry := &TOCEntry{Title: string(title), ID: id}
+		parents[heading.Level] = entry
+		for level := heading.Level + 1; level <= tocMaxLevel; level++ {
+			delete(parents, level)
+		}
+
+		var parent *TOCEntry
+		for level := heading.Level - 1; level >= tocMinLevel && parent == nil; level-- {
+			parent = parents[level]
+		}
+
+		if parent == nil {
+			toc = append(toc, entry)
+		} else {
+			parent.Children = append(parent.Children, entry)
+		}
+
+		return ast.WalkSkipChildren, nil
+	})
+
+	return toc
+}
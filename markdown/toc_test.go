@@ -0,0 +1,67 @@
+package markdown
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableOfContents(t *testing.T) {
+	type testCase struct {
+		name     string
+		source   string
+		expected []*TOCEntry
+	}
+
+	tests := []testCase{
+		{
+			name:     "No headings",
+			source:   "# Title\n\nSome text",
+			expected: []*TOCEntry{},
+		},
+		{
+			name:   "Nested headings",
+			source: "# Title\n## Install\n### Linux\n### Mac\n## Usage\n#### Ignored",
+			expected: []*TOCEntry{
+				{Title: "Install", ID: "install", Children: []*TOCEntry{
+					{Title: "Linux", ID: "linux"},
+					{Title: "Mac", ID: "mac"},
+				}},
+				{Title: "Usage", ID: "usage"},
+			},
+		},
+		{
+			name:   "Deeper heading first",
+			source: "### Early\n## Later",
+			expected: []*TOCEntry{
+				{Title: "Early", ID: "early"},
+				{Title: "Later", ID: "later"},
+			},
+		},
+		{
+			name:   "Duplicate headings",
+			source: "## Example\n## Example",
+			expected: []*TOCEntry{
+				{Title: "Example", ID: "example"},
+				{Title: "Example", ID: "example-1"},
+			},
+		},
+	}
+
+	md := NewMarkdown()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			_, toc, err := md.HTMLWithTOC([]byte(tc.source), &b)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, toc)
+			for _, entry := range toc {
+				assert.Contains(t, b.String(), `id="`+entry.ID+`"`)
+			}
+		})
+	}
+}
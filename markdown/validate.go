@@ -1,15 +1,33 @@
 package markdown
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
 	"github.com/go-playground/validator/v10"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/robfig/cron"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var (
+	flowValidator = NewFlowValidator()
+	// slackUserIDRegex matches slack user IDs, which unlike usernames can't be
+	// changed by the user
+	slackUserIDRegex = regexp.MustCompile(`^[UW][A-Z0-9]{2,}$`)
 )
 
-var flowValidator = NewFlowValidator()
+// MaxParamOptions is the most static options a param can have, as chat
+// platforms such as slack show at most 100 options in a select
+const MaxParamOptions = 100
 
 const (
-	TagValidateCron    = "standard_cron"
-	TagValidateCommand = "command"
+	TagValidateCron        = "standard_cron"
+	TagValidateCommand     = "command"
+	TagValidateSlackUserID = "slack_user_id"
 )
 
 type FlowValidator struct {
@@ -22,6 +40,7 @@ func NewFlowValidator() *FlowValidator {
 	validate := validator.New()
 	validate.RegisterValidation(TagValidateCron, ValidateCron)
 	validate.RegisterValidation(TagValidateCommand, ValidateCommand)
+	validate.RegisterValidation(TagValidateSlackUserID, ValidateSlackUserID)
 
 	fv.validate = validate
 
@@ -34,6 +53,10 @@ func ValidateCron(fl validator.FieldLevel) bool {
 	return err == nil
 }
 
+func ValidateSlackUserID(fl validator.FieldLevel) bool {
+	return slackUserIDRegex.MatchString(fl.Field().String())
+}
+
 func ValidateCommand(fl validator.FieldLevel) bool {
 	command, ok := fl.Field().Interface().(Command)
 	if !ok {
@@ -65,6 +88,11 @@ func ValidateParam(p ParamItem) (string, bool) {
 
 	name, param := p.Param()
 
+	// Options only make sense for params that are chosen from a list
+	if !param.HasOptions() && (len(param.Options) > 0 || param.OptionsFrom != "") {
+		return "", false
+	}
+
 	switch param.Type {
 	case "string":
 		if param.Default == nil {
@@ -103,9 +131,176 @@ func ValidateParam(p ParamItem) (string, bool) {
 		if _, ok := param.Default.(bool); !ok {
 			return "", false
 		}
+	case "select":
+		if !validParamOptions(param) {
+			return "", false
+		}
+
+		if param.Default == nil {
+			break
+		}
+
+		defaultVal, ok := param.Default.(string)
+		if !ok || !param.OptionAllowed(defaultVal) {
+			return "", false
+		}
+	case "multiselect":
+		if !validParamOptions(param) {
+			return "", false
+		}
+
+		if param.Default == nil {
+			break
+		}
+
+		defaultVals, ok := param.Default.([]any)
+		if !ok {
+			return "", false
+		}
+
+		for _, d := range defaultVals {
+			defaultVal, ok := d.(string)
+			if !ok || !param.OptionAllowed(defaultVal) {
+				return "", false
+			}
+		}
+	case "date", "datetime":
+		if param.Default == nil {
+			break
+		}
+
+		defaultVal, ok := param.Default.(string)
+		if !ok {
+			return "", false
+		}
+
+		layout := ParamDateFormat
+		if param.Type == "datetime" {
+			layout = ParamDateTimeFormat
+		}
+
+		if _, err := time.Parse(layout, defaultVal); err != nil {
+			return "", false
+		}
+	case "user", "channel", "conversation":
+		if param.Default == nil {
+			break
+		}
+
+		if _, ok := param.Default.(string); !ok {
+			return "", false
+		}
 	default:
 		return "", false
 	}
 
 	return name, true
 }
+
+// validParamOptions checks a select param has either static options, up to
+// MaxParamOptions of them, or a parseable options_from expression, but not both
+func validParamOptions(param Param) bool {
+	hasStatic := len(param.Options) > 0
+	hasExpr := param.OptionsFrom != ""
+
+	if hasStatic == hasExpr || len(param.Options) > MaxParamOptions {
+		return false
+	}
+
+	if hasExpr {
+		_, diags := hclsyntax.ParseExpression([]byte(param.OptionsFrom), "options_from", hcl.InitialPos)
+		return !diags.HasErrors()
+	}
+
+	return true
+}
+
+// validateExprAccess checks the env vars and secrets an expression reads are
+// available, so flows fail when loaded rather than when an event arrives.
+// It returns true if the expression reads secrets
+//
+// Names must be given as literal strings, as they can't be checked otherwise
+func (fr *FlowReader) validateExprAccess(expr hcl.Expression) (bool, error) {
+	sensitive := false
+
+	diags := hclsyntax.VisitAll(expr.(hclsyntax.Node), func(node hclsyntax.Node) hcl.Diagnostics {
+		call, ok := node.(*hclsyntax.FunctionCallExpr)
+		if !ok || (call.Name != "env" && call.Name != "secret") {
+			return nil
+		}
+
+		if call.Name == "secret" {
+			sensitive = true
+		}
+
+		name, err := literalStringArg(call)
+		if err == nil {
+			err = fr.checkAccess(call.Name, name)
+		}
+		if err != nil {
+			return hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid call to %s()", call.Name),
+				Detail:   err.Error(),
+				Subject:  call.Range().Ptr(),
+			}}
+		}
+
+		return nil
+	})
+	if diags.HasErrors() {
+		return sensitive, errors.Join(diags.Errs()...)
+	}
+
+	return sensitive, nil
+}
+
+func (fr *FlowReader) checkAccess(funcName, name string) error {
+	switch funcName {
+	case "env":
+		if !fr.envAllow.Allows(name) {
+			return fmt.Errorf("env var '%s' is not allowed, add it to runner.expressions.env_allow in config", name)
+		}
+	case "secret":
+		if fr.secrets == nil {
+			return errors.New("no secrets provider is configured")
+		}
+		if _, err := fr.secrets.Secret(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func literalStringArg(call *hclsyntax.FunctionCallExpr) (string, error) {
+	if len(call.Args) == 0 {
+		return "", errors.New("a name must be given")
+	}
+
+	val, diags := call.Args[0].Value(nil)
+	if diags.HasErrors() || !val.IsKnown() || val.IsNull() || val.Type() != cty.String {
+		return "", errors.New("the name must be a literal string")
+	}
+
+	return val.AsString(), nil
+}
+
+// diagsError converts diagnostics to an error, omitting their detail for
+// expressions that read secrets in case it includes a secret's value
+func diagsError(diags hcl.Diagnostics, sensitive bool) error {
+	if !sensitive {
+		return errors.Join(diags.Errs()...)
+	}
+
+	errs := []error{}
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagError {
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %s; details are hidden as the expression reads secrets", diag.Subject, diag.Summary))
+	}
+
+	return errors.Join(errs...)
+}
@@ -10,7 +10,11 @@ import (
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/hiphops-io/hops/internal/tracing"
 )
 
 var (
@@ -94,28 +98,53 @@ func (c *Client) Consume(
 	// Note: In future we should make the active goroutine limit configurable
 	g.SetLimit(20)
 
-	deadline := consumer.CachedInfo().Config.AckWait
+	info := consumer.CachedInfo()
+	deadline := info.Config.AckWait
 
 	callback := func(msg jetstream.Msg) {
 		hopsMsg, err := Parse(msg)
 		if err != nil {
 			// There's no way to recover an unparseable event
 			msg.TermWithReason(fmt.Sprintf("unable to parse event: %s", err.Error()))
+			messagesHandled.WithLabelValues(info.Name, outcomeTerm).Inc()
 			return
 		}
 
+		consumerPending.WithLabelValues(info.Name).Set(float64(hopsMsg.NumPending))
+
 		g.Go(func() error {
-			if err := handler(ctx, hopsMsg, deadline); err != nil {
+			// Continue the trace of whatever published the message, if any
+			msgCtx, span := tracing.Start(
+				tracing.Extract(ctx, tracing.HeaderCarrier(msg.Headers())),
+				"hops.consume",
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(
+					attribute.String("messaging.system", "nats"),
+					attribute.String("messaging.destination.name", hopsMsg.Subject),
+					attribute.String("messaging.consumer.group.name", info.Name),
+					attribute.String("hops.sequence_id", hopsMsg.SequenceId),
+					attribute.String("hops.source", hopsMsg.Source),
+					attribute.String("hops.event", hopsMsg.Event),
+					attribute.String("hops.action", hopsMsg.Action),
+				),
+			)
+			defer span.End()
+
+			if err := handler(msgCtx, hopsMsg, deadline); err != nil {
+				tracing.RecordError(span, err)
 				if errors.Is(err, ErrEventFatal) {
 					msg.TermWithReason(err.Error())
+					messagesHandled.WithLabelValues(info.Name, outcomeTerm).Inc()
 					return nil
 				}
 
 				msg.NakWithDelay(3 * time.Second)
+				messagesHandled.WithLabelValues(info.Name, outcomeNak).Inc()
 				return nil
 			}
 
 			DoubleAck(ctx, msg)
+			messagesHandled.WithLabelValues(info.Name, outcomeAck).Inc()
 
 			return nil
 		})
@@ -132,10 +161,19 @@ func (c *Client) Consume(
 	return nil
 }
 
+// Publish publishes a message once, where messages already published on the
+// subject are ignored. The trace in ctx is propagated in the message headers
 func (c *Client) Publish(ctx context.Context, data []byte, subject string) (*jetstream.PubAck, bool, error) {
 	sent := true
 
-	puback, err := c.JetStream.Publish(ctx, subject, data, jetstream.WithExpectLastSequencePerSubject(0))
+	msg := &nats.Msg{Subject: subject, Data: data}
+	header := nats.Header{}
+	tracing.Inject(ctx, tracing.HeaderCarrier(header))
+	if len(header) > 0 {
+		msg.Header = header
+	}
+
+	puback, err := c.JetStream.PublishMsg(ctx, msg, jetstream.WithExpectLastSequencePerSubject(0))
 	if err != nil {
 		sent = false
 
@@ -191,17 +229,12 @@ func (c *Client) ReplayConsumer(ctx context.Context, sequenceId string) (jetstre
 	// Create a new, random replay sequence ID
 	replaySequenceId := fmt.Sprintf("replay-%s", uuid.NewString()[:20])
 
-	stream, err := c.JetStream.Stream(ctx, ChannelNotify)
+	// Get the source message to be replayed from the stream
+	rawMsg, err := c.SourceEvent(ctx, sequenceId)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get the source message to be replayed from the stream
-	rawMsg, err := stream.GetLastMsgForSubject(ctx, SourceEventSubject(sequenceId))
-	if err != nil || rawMsg == nil {
-		return nil, fmt.Errorf("Failed to fetch source event for '%s': %w", sequenceId, err)
-	}
-
 	// Create ephemeral consumer filtered by replayed sequence ID
 	consumerCfg := jetstream.ConsumerConfig{
 		Name:          replaySequenceId,
@@ -221,6 +254,26 @@ func (c *Client) ReplayConsumer(ctx context.Context, sequenceId string) (jetstre
 	return consumer, nil
 }
 
+// NotifyMsg fetches the latest message on a subject in the notify stream
+func (c *Client) NotifyMsg(ctx context.Context, subject string) (*jetstream.RawStreamMsg, error) {
+	stream, err := c.JetStream.Stream(ctx, ChannelNotify)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream.GetLastMsgForSubject(ctx, subject)
+}
+
+// SourceEvent fetches the source event that started the given sequence
+func (c *Client) SourceEvent(ctx context.Context, sequenceId string) (*jetstream.RawStreamMsg, error) {
+	rawMsg, err := c.NotifyMsg(ctx, SourceEventSubject(sequenceId))
+	if err != nil || rawMsg == nil {
+		return nil, fmt.Errorf("Failed to fetch source event for '%s': %w", sequenceId, err)
+	}
+
+	return rawMsg, nil
+}
+
 // RunnerConsumer returns a consumer for the `notify` stream
 func (c *Client) RunnerConsumer(ctx context.Context) (jetstream.Consumer, error) {
 	cfg := jetstream.ConsumerConfig{
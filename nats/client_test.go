@@ -9,8 +9,14 @@ import (
 	"time"
 
 	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/hiphops-io/hops/internal/tracing"
 )
 
 type receivedMsg struct {
@@ -60,6 +66,71 @@ func TestClientConsume(t *testing.T) {
 	assert.JSONEq(t, string(msgData), string(msg.data))
 }
 
+func TestClientConsumeTracing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := tracing.NewTracerProvider(exporter, "", 1)
+	tracing.SetDefault(tp)
+	t.Cleanup(func() {
+		tracing.SetDefault(nil)
+		tp.Shutdown(context.Background())
+	})
+
+	client, cleanup := setupClient(t)
+	defer cleanup()
+
+	consumer, err := client.RunnerConsumer(ctx)
+	require.NoError(t, err, "Consumer must be created without error")
+
+	upstream := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	_, _, err = client.Publish(
+		trace.ContextWithSpanContext(ctx, upstream),
+		[]byte(`{"hops": {"source": "test", "event": "test"}}`),
+		SourceEventSubject("SEQ_ID"),
+	)
+	require.NoError(t, err, "Message should be published without error")
+
+	handled := make(chan trace.SpanContext)
+	go client.Consume(ctx, consumer, func(ctx context.Context, hopsMsg *HopsMsg, ackDeadline time.Duration) error {
+		assert.Equal(
+			t,
+			"00-01000000000000000000000000000000-0200000000000000-01",
+			hopsMsg.msg.Headers().Get(tracing.TraceparentHeader),
+			"Trace should be propagated in headers",
+		)
+		handled <- trace.SpanContextFromContext(ctx)
+		return nil
+	})
+
+	var handlerSpan trace.SpanContext
+	select {
+	case handlerSpan = <-handled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Message not received within time limit")
+	}
+
+	assert.Equal(t, upstream.TraceID(), handlerSpan.TraceID(), "Handler should continue the upstream trace")
+
+	// The span ends after the handler returns
+	assert.Eventually(t, func() bool {
+		require.NoError(t, tp.ForceFlush(ctx))
+		return len(exporter.GetSpans()) > 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	span := exporter.GetSpans()[0]
+	assert.Equal(t, "hops.consume", span.Name)
+	assert.Equal(t, trace.SpanKindConsumer, span.SpanKind)
+	assert.Equal(t, upstream.SpanID(), span.Parent.SpanID())
+	assert.Equal(t, handlerSpan, span.SpanContext)
+	assert.Contains(t, span.Attributes, attribute.String("hops.sequence_id", "SEQ_ID"))
+}
+
 func TestClientPublish(t *testing.T) {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
@@ -108,6 +179,95 @@ func TestClientWorkerPublish(t *testing.T) {
 	assert.False(t, sent, "Duplicate message should not be sent")
 }
 
+func TestClientSourceEvent(t *testing.T) {
+	ctx := context.Background()
+
+	client, cleanup := setupClient(t)
+	defer cleanup()
+
+	msgData := []byte(`{"hops": {"source": "test", "event": "test"}, "Hello": "world"}`)
+	_, _, err := client.Publish(ctx, msgData, SourceEventSubject("SEQ_ID"))
+	require.NoError(t, err, "Test setup: Source event should be published without error")
+
+	// Other messages in the sequence should not be returned
+	result, err := json.Marshal(NewWorkResultMsg("flow.worker", time.Now(), "Done", nil))
+	require.NoError(t, err)
+	_, _, err = client.Publish(ctx, result, "notify.SEQ_ID.flow.worker")
+	require.NoError(t, err, "Test setup: Result should be published without error")
+
+	rawMsg, err := client.SourceEvent(ctx, "SEQ_ID")
+	if assert.NoError(t, err, "Source event should be fetched without error") {
+		assert.JSONEq(t, string(msgData), string(rawMsg.Data))
+	}
+
+	_, err = client.SourceEvent(ctx, "OTHER_SEQ_ID")
+	assert.Error(t, err, "Missing source events should return an error")
+}
+
+func TestClientConsumeWorkResult(t *testing.T) {
+	ctx := context.Background()
+
+	client, cleanup := setupClient(t)
+	defer cleanup()
+
+	workConsumer, err := client.JetStream.CreateOrUpdateConsumer(ctx, ChannelWork, jetstream.ConsumerConfig{
+		AckPolicy: jetstream.AckExplicitPolicy,
+	})
+	require.NoError(t, err, "Work consumer must be created without error")
+
+	workData := []byte(`{"hops": {"source": "test", "event": "test"}}`)
+	work, err := publishAndConsumeMessage(t, client, workConsumer, workData, WorkSubject("SEQ_ID", "flow.worker"))
+	require.NoError(t, err, "Publishing and consuming work should not return an error")
+	assert.Equal(t, "flow.worker", work.meta.HandlerName)
+
+	consumer, err := client.RunnerConsumer(ctx)
+	require.NoError(t, err, "Consumer must be created without error")
+
+	msgData, err := json.Marshal(NewWorkResultMsg("flow.worker", time.Now(), "Done", errors.New("oops")))
+	require.NoError(t, err)
+
+	msg, err := publishAndConsumeMessage(t, client, consumer, msgData, work.meta.ResponseSubject())
+	require.NoError(t, err, "Publishing and consuming a result should not return an error")
+
+	assert.Equal(t, "notify.SEQ_ID.flow.worker", msg.meta.Subject)
+	assert.Equal(t, "hiphops", msg.meta.Source)
+	assert.Equal(t, ResultEventId, msg.meta.Event)
+	assert.Equal(t, "flow.worker", msg.meta.Action)
+	assert.Equal(t, "SEQ_ID", msg.meta.SequenceId)
+	assert.Equal(t, true, msg.meta.Data["errored"])
+	assert.Equal(t, "Done", msg.meta.Data["body"])
+	assert.Equal(t, "oops", msg.meta.Data["hops"].(map[string]any)["error"])
+}
+
+func TestClientStreamCollector(t *testing.T) {
+	ctx := context.Background()
+
+	client, cleanup := setupClient(t)
+	defer cleanup()
+
+	msgData := []byte(`{"hops": {"source": "test", "event": "test"}, "Hello": "world"}`)
+	_, _, err := client.Publish(ctx, msgData, SourceEventSubject("SEQ_ID"))
+	require.NoError(t, err, "Test setup: Source event should be published without error")
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(client.StreamCollector())
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			stream := metric.GetLabel()[0].GetValue()
+			values[family.GetName()+"/"+stream] = metric.GetGauge().GetValue()
+		}
+	}
+
+	assert.Equal(t, float64(1), values["hops_stream_messages/"+ChannelNotify])
+	assert.Greater(t, values["hops_stream_bytes/"+ChannelNotify], float64(len(msgData)))
+	assert.Equal(t, float64(0), values["hops_stream_messages/"+ChannelWork])
+}
+
 // publishAndConsumeMessage is a helper method to send a message and consume it,
 // returning the message as it was received by the handler
 func publishAndConsumeMessage(t *testing.T, client *Client, consumer jetstream.Consumer, msgData []byte, subject string) (receivedMsg, error) {
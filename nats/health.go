@@ -0,0 +1,71 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ConnectionHealth errors if the client isn't connected to NATS
+func (c *Client) ConnectionHealth(ctx context.Context) error {
+	if !c.CheckConnection() {
+		return fmt.Errorf("not connected to NATS, connection is %s", c.NatsConn.Status())
+	}
+
+	return nil
+}
+
+// StreamsHealth errors if any of the streams hops requires are missing
+func (c *Client) StreamsHealth(ctx context.Context) error {
+	var err error
+	for _, name := range []string{ChannelNotify, ChannelRequest, ChannelWork, ChannelAudit} {
+		if _, streamErr := c.JetStream.Stream(ctx, name); streamErr != nil {
+			err = errors.Join(err, fmt.Errorf("stream '%s' unavailable: %w", name, streamErr))
+		}
+	}
+
+	return err
+}
+
+// ConsumerLagHealth errors if the consumer is missing or more than maxPending
+// messages are waiting to be delivered to it
+//
+// Lag isn't checked if maxPending is 0
+func (c *Client) ConsumerLagHealth(ctx context.Context, stream string, consumer string, maxPending uint64) error {
+	cons, err := c.JetStream.Consumer(ctx, stream, consumer)
+	if err != nil {
+		return fmt.Errorf("consumer '%s' unavailable: %w", consumer, err)
+	}
+
+	if maxPending == 0 {
+		return nil
+	}
+
+	info, err := cons.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get info for consumer '%s': %w", consumer, err)
+	}
+
+	if info.NumPending > maxPending {
+		return fmt.Errorf("consumer '%s' has %d messages pending, more than %d", consumer, info.NumPending, maxPending)
+	}
+
+	return nil
+}
+
+// HasLeafnodeRemotes is true if the server is configured to connect as a
+// leafnode to remote servers, such as hiphops.io
+func (n *NatsServer) HasLeafnodeRemotes() bool {
+	return len(n.Options.LeafNode.Remotes) > 0
+}
+
+// LeafnodeHealth errors if the server isn't connected to each of its
+// leafnode remotes
+func (n *NatsServer) LeafnodeHealth(ctx context.Context) error {
+	remotes := len(n.Options.LeafNode.Remotes)
+	if connected := n.Server.NumLeafNodes(); connected < remotes {
+		return fmt.Errorf("connected to %d of %d leafnode remotes", connected, remotes)
+	}
+
+	return nil
+}
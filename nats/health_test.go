@@ -0,0 +1,73 @@
+package nats
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hiphops-io/hops/logs"
+)
+
+func TestClientHealth(t *testing.T) {
+	ctx := context.Background()
+
+	client, cleanup := setupClient(t)
+	defer cleanup()
+
+	assert.NoError(t, client.ConnectionHealth(ctx))
+	assert.NoError(t, client.StreamsHealth(ctx))
+
+	assert.Error(t, client.ConsumerLagHealth(ctx, ChannelNotify, ChannelNotify, 1), "Missing consumers should be unhealthy")
+
+	_, err := client.RunnerConsumer(ctx)
+	require.NoError(t, err, "Test setup: Runner consumer should be created without error")
+	assert.NoError(t, client.ConsumerLagHealth(ctx, ChannelNotify, ChannelNotify, 1))
+
+	for _, seq := range []string{"SEQ_1", "SEQ_2"} {
+		_, _, err := client.Publish(ctx, []byte(`{"hops": {"source": "test", "event": "test"}}`), SourceEventSubject(seq))
+		require.NoError(t, err, "Test setup: Source event should be published without error")
+	}
+	assert.Error(t, client.ConsumerLagHealth(ctx, ChannelNotify, ChannelNotify, 1), "Lagging consumers should be unhealthy")
+	assert.NoError(t, client.ConsumerLagHealth(ctx, ChannelNotify, ChannelNotify, 2))
+	assert.NoError(t, client.ConsumerLagHealth(ctx, ChannelNotify, ChannelNotify, 0), "Lag shouldn't be checked without a max")
+
+	require.NoError(t, client.JetStream.DeleteStream(ctx, ChannelWork))
+	assert.ErrorContains(t, client.StreamsHealth(ctx), "stream 'work' unavailable")
+
+	client.NatsConn.Close()
+	assert.Error(t, client.ConnectionHealth(ctx))
+}
+
+func TestNatsServerLeafnodeHealth(t *testing.T) {
+	ctx := context.Background()
+
+	natsServer := setupNatsServer(t)
+	defer natsServer.Close()
+
+	assert.False(t, natsServer.HasLeafnodeRemotes())
+	assert.NoError(t, natsServer.LeafnodeHealth(ctx))
+
+	logger := logs.NoOpLogger()
+	natsLogger := logs.NewNatsZeroLogger(logger)
+	unreachable, err := url.Parse("nats://127.0.0.1:1")
+	require.NoError(t, err)
+
+	leafServer, err := NewDefaultNatsServer(
+		"./testdata/embedded-nats.conf",
+		false,
+		&natsLogger,
+		WithDataDirOpt(t.TempDir()),
+		func(opts *server.Options) {
+			opts.LeafNode.Remotes = []*server.RemoteLeafOpts{{URLs: []*url.URL{unreachable}}}
+		},
+	)
+	require.NoError(t, err, "Test setup: Leafnode NATS server should start without errors")
+	defer leafServer.Close()
+
+	assert.True(t, leafServer.HasLeafnodeRemotes())
+	assert.EqualError(t, leafServer.LeafnodeHealth(ctx), "connected to 0 of 1 leafnode remotes")
+}
@@ -0,0 +1,79 @@
+package nats
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	consumerPending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hops_consumer_pending_messages",
+		Help: "Messages waiting to be delivered to a consumer, as of its last delivery",
+	}, []string{"consumer"})
+	messagesHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hops_messages_handled_total",
+		Help: "Messages handled by a consumer, by whether they were acked, nakked to be redelivered or terminated",
+	}, []string{"consumer", "outcome"})
+
+	streamBytesDesc = prometheus.NewDesc(
+		"hops_stream_bytes",
+		"Bytes stored by a JetStream stream",
+		[]string{"stream"}, nil,
+	)
+	streamMessagesDesc = prometheus.NewDesc(
+		"hops_stream_messages",
+		"Messages stored by a JetStream stream",
+		[]string{"stream"}, nil,
+	)
+)
+
+// Outcomes of handling a consumed message
+const (
+	outcomeAck  = "ack"
+	outcomeNak  = "nak"
+	outcomeTerm = "term"
+)
+
+// streamInfoTimeout bounds how long a scrape waits on JetStream for the size
+// of hops' streams
+const streamInfoTimeout = 5 * time.Second
+
+// StreamCollector reports the size of hops' streams from JetStream, which is
+// too costly to do other than when metrics are scraped
+type StreamCollector struct {
+	client *Client
+}
+
+// StreamCollector returns a collector for the size of the client's streams,
+// to be registered with Prometheus
+func (c *Client) StreamCollector() *StreamCollector {
+	return &StreamCollector{client: c}
+}
+
+func (s *StreamCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- streamBytesDesc
+	ch <- streamMessagesDesc
+}
+
+func (s *StreamCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), streamInfoTimeout)
+	defer cancel()
+
+	for _, name := range []string{ChannelNotify, ChannelRequest, ChannelWork, ChannelAudit} {
+		stream, err := s.client.JetStream.Stream(ctx, name)
+		if err != nil {
+			continue
+		}
+
+		info, err := stream.Info(ctx)
+		if err != nil {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(streamBytesDesc, prometheus.GaugeValue, float64(info.State.Bytes), name)
+		ch <- prometheus.MustNewConstMetric(streamMessagesDesc, prometheus.GaugeValue, float64(info.State.Msgs), name)
+	}
+}
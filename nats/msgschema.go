@@ -1,6 +1,7 @@
 package nats
 
 import (
+	"bytes"
 	"fmt"
 	"regexp"
 	"strings"
@@ -13,16 +14,20 @@ import (
 
 const (
 	AllEventId     = ">"
+	ApprovalId     = "approval"
+	ChannelAudit   = "audit"
 	ChannelNotify  = "notify"
 	ChannelRequest = "request"
 	ChannelWork    = "work"
 	DoneMessageId  = "done"
 	HopsMessageId  = "hops"
 	MetadataKey    = "hops"
+	ResultEventId  = "result"
 	SourceEventId  = "event"
 )
 
 var (
+	AuditStreamSubjects   = []string{fmt.Sprintf("%s.>", ChannelAudit)}
 	NotifyStreamSubjects  = []string{fmt.Sprintf("%s.>", ChannelNotify)}
 	RequestStreamSubjects = []string{fmt.Sprintf("%s.>", ChannelRequest)}
 	WorkStreamSubjects    = []string{fmt.Sprintf("%s.>", ChannelWork)}
@@ -50,7 +55,13 @@ type (
 	}
 
 	// HopsResultMeta is metadata included in the top level of a result message
+	//
+	// Source, event and action are set on results from workers, so they're
+	// consumed like any other event. The action is the worker's name
 	HopsResultMeta struct {
+		Source     string    `json:"source,omitempty"`
+		Event      string    `json:"event,omitempty"`
+		Action     string    `json:"action,omitempty"`
 		Error      string    `json:"error,omitempty"`
 		FinishedAt time.Time `json:"finished_at"`
 		StartedAt  time.Time `json:"started_at"`
@@ -122,20 +133,27 @@ func (m *HopsMsg) Msg() jetstream.Msg {
 }
 
 func (m *HopsMsg) ResponseSubject() string {
-	// TODO: Will need to handle work response subjects as they have an extra component (flow_name.worker_name)
-	// Though, will workers ever have responses?
 	tokens := []string{
 		ChannelNotify,
 		m.SequenceId,
 		m.MessageId,
 	}
 
+	// Work messages are addressed to a worker, named flow_name.worker_name
+	if m.Channel == ChannelWork {
+		tokens[2] = m.HandlerName
+	}
+
 	return strings.Join(tokens, ".")
 }
 
 func (m *HopsMsg) parseData() error {
+	// Numbers are kept as json.Number so large integers such as IDs keep
+	// their precision when matched against or passed on to workers
 	msgData := map[string]any{}
-	if err := json.Unmarshal(m.msg.Data(), &msgData); err != nil {
+	decoder := json.NewDecoder(bytes.NewReader(m.msg.Data()))
+	decoder.UseNumber()
+	if err := decoder.Decode(&msgData); err != nil {
 		return fmt.Errorf("unable to unmarshal: %w", err)
 	}
 
@@ -190,6 +208,7 @@ func (m *HopsMsg) parseMetadata() error {
 // `notify.sequence_id.event`
 // `notify.sequence_id.message_id`
 // `request.sequence_id.message_id.app.handler`
+// `work.sequence_id.flow_name.worker_name`
 func (m *HopsMsg) parseTokens() error {
 	subjectTokens := strings.Split(m.msg.Subject(), ".")
 	if len(subjectTokens) < 3 {
@@ -207,6 +226,14 @@ func (m *HopsMsg) parseTokens() error {
 
 	switch m.Channel {
 	case ChannelNotify:
+		return nil
+	case ChannelWork:
+		if len(subjectTokens) < 4 {
+			return fmt.Errorf("Invalid work message subject (too few tokens): %s", m.msg.Subject())
+		}
+
+		m.HandlerName = strings.Join(subjectTokens[2:], ".")
+
 		return nil
 	case ChannelRequest:
 		if len(subjectTokens) < 5 {
@@ -250,6 +277,53 @@ func NewResultMsg(startedAt time.Time, result interface{}, err error) ResultMsg
 	return resultMsg
 }
 
+// NewWorkResultMsg creates the result of a worker running a flow, ready to
+// publish on the work message's ResponseSubject
+//
+// Output is optional markdown to be shown to the user that triggered the flow
+func NewWorkResultMsg(workerName string, startedAt time.Time, output string, err error) ResultMsg {
+	resultMsg := NewResultMsg(startedAt, output, err)
+	resultMsg.Hops.Source = "hiphops"
+	resultMsg.Hops.Event = ResultEventId
+	resultMsg.Hops.Action = workerName
+
+	return resultMsg
+}
+
+// Duration returns how long the handler or worker took to produce the result
+func (r ResultMsg) Duration() time.Duration {
+	if r.Hops.StartedAt.IsZero() || r.Hops.FinishedAt.IsZero() {
+		return 0
+	}
+
+	return r.Hops.FinishedAt.Sub(r.Hops.StartedAt)
+}
+
+// AuditSubject returns the subject an audit record of the given type is
+// published on for a sequence
+func AuditSubject(sequenceId string, recordType string) string {
+	tokens := []string{
+		ChannelAudit,
+		sequenceId,
+		recordType,
+	}
+
+	return strings.Join(tokens, ".")
+}
+
+// AuditFilterSubject returns the filter subject to get audit records, for any
+// sequence or type if they're empty
+func AuditFilterSubject(sequenceId string, recordType string) string {
+	if sequenceId == "" {
+		sequenceId = "*"
+	}
+	if recordType == "" {
+		recordType = "*"
+	}
+
+	return AuditSubject(sequenceId, recordType)
+}
+
 // NotifyFilterSubject returns the filter subject to get notify messages
 func NotifyFilterSubject() string {
 	tokens := []string{
@@ -317,6 +391,19 @@ func SourceEventSubject(sequenceId string) string {
 	return strings.Join(tokens, ".")
 }
 
+// ApprovalSubject returns the subject an approval decision for a flow in a
+// sequence is recorded on
+func ApprovalSubject(sequenceId string, flowAction string) string {
+	tokens := []string{
+		ChannelNotify,
+		sequenceId,
+		ApprovalId,
+		flowAction,
+	}
+
+	return strings.Join(tokens, ".")
+}
+
 func SourceEventSubjectAccount(accountId string, sequenceId string) string {
 	tokens := []string{
 		ChannelNotify,
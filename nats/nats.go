@@ -129,6 +129,10 @@ func (n *NatsServer) initStreams(ctx context.Context) error {
 		return err
 	}
 
+	if _, err := UpsertAuditStream(ctx, js, 10); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -182,6 +186,27 @@ func UpsertWorkStream(ctx context.Context, js jetstream.JetStream, maxGB float64
 	return js.CreateOrUpdateStream(ctx, cfg)
 }
 
+// UpsertAuditStream creates the stream for the audit trail of decisions made
+// by hops
+//
+// The stream is append only, so records can't be deleted or purged. The
+// oldest records are only discarded once it reaches maxGB
+func UpsertAuditStream(ctx context.Context, js jetstream.JetStream, maxGB float64) (jetstream.Stream, error) {
+	maxBytes := int64(math.Floor(1024 * 1024 * 1024 * maxGB))
+
+	cfg := jetstream.StreamConfig{
+		Name:       ChannelAudit,
+		Subjects:   AuditStreamSubjects,
+		Discard:    jetstream.DiscardOld,
+		Retention:  jetstream.LimitsPolicy,
+		MaxBytes:   maxBytes,
+		DenyDelete: true,
+		DenyPurge:  true,
+	}
+
+	return js.CreateOrUpdateStream(ctx, cfg)
+}
+
 // UpsertWorkConsumer creates the consumer for 'work' messages used by user-backend
 func UpsertWorkConsumer(ctx context.Context, js jetstream.JetStream) (jetstream.Consumer, error) {
 	cfg := jetstream.ConsumerConfig{